@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	tcpclient "aiplag-agent/cli/tcp-client"
+	"aiplag-agent/common/config"
+	"aiplag-agent/common/db"
+	"aiplag-agent/daemon/models"
+	"encoding/json"
+	"fmt"
+)
+
+// bindAssignment stores the backend assignment of a watched directory. It goes through the
+// daemon so open dashboards see the change, the database is written directly only when the
+// daemon can't be reached.
+func bindAssignment(binding models.WatchedAssignment) error {
+	payload, err := json.Marshal(binding)
+	if err != nil {
+		return err
+	}
+	resp, err := tcpclient.SendCommand('B', string(payload))
+	if err == nil {
+		if resp != 'A' {
+			return fmt.Errorf("daemon rejected the binding of %s", binding.Path)
+		}
+		return nil
+	}
+
+	eh, err := db.NewEditHistoryStore(config.DBPath())
+	if err != nil {
+		return fmt.Errorf("failed to access edit history: %w", err)
+	}
+	defer eh.Close()
+	return eh.BindAssignment(binding)
+}
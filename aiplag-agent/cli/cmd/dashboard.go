@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"aiplag-agent/cli/dashboard"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// dashboardCmd shows a live view of what the daemon records
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "Show a live view of the edits being recorded",
+	Long: `Opens a full-screen view of the watched directories, how often each file was edited, the time
+left until the deadline of each bound assignment and whether it was submitted. Events show up
+as soon as the daemon records them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := dashboard.Run(os.Stdout); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dashboardCmd)
+}
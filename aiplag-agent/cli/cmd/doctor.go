@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"aiplag-agent/cli/doctor"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var doctorBundle string
+
+// doctorCmd checks the installation and explains how to fix what is broken
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose problems with the plaggy installation",
+	Long: `Checks that the daemon service is installed and reachable, that plaggy can write its data
+directory, that the system allows enough directory watches, that the clock agrees with the
+server and that you are still logged in. Prints a fix for every problem found.
+
+With --bundle, also writes a zip you can send to support. It holds the report, the end of the
+daemon log with secrets redacted, the config without your session token and database
+statistics, but none of your files.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		results := doctor.RunChecks(doctor.DefaultChecks())
+		doctor.PrintResults(os.Stdout, results)
+
+		if doctorBundle == "" {
+			return
+		}
+		f, err := os.Create(doctorBundle)
+		if err != nil {
+			fmt.Println("Failed to create support bundle:", err)
+			return
+		}
+		defer f.Close()
+		if err := doctor.WriteSupportBundle(f, results); err != nil {
+			fmt.Println("Failed to write support bundle:", err)
+			return
+		}
+		fmt.Println()
+		fmt.Println("Support bundle written to", doctorBundle)
+	},
+}
+
+func init() {
+	doctorCmd.Flags().StringVar(&doctorBundle, "bundle", "", "write a support bundle to this zip file")
+	rootCmd.AddCommand(doctorCmd)
+}
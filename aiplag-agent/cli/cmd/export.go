@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"aiplag-agent/common/api/dtomodels"
+	"aiplag-agent/common/buildinfo"
+	"aiplag-agent/common/config"
+	"aiplag-agent/common/db"
+	"aiplag-agent/common/evidence"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	exportAssignmentID uint
+	exportEmail        string
+	exportOut          string
+)
+
+// exportCmd writes a signed evidence bundle for offline submission
+var exportCmd = &cobra.Command{
+	Use:   "export <dir>",
+	Short: "Export a watched directory as a signed bundle for offline submission",
+	Long: `Writes every recorded edit event of a watched directory, the final content of its files and
+the head of its hash chain to a single zip archive signed with this device's key.
+
+Hand the bundle to your instructor when the backend can't be reached, it is imported as if it
+had been submitted. It is only accepted if this device was registered with your account, which
+happens when a directory is bound to an assignment.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		root, err := filepath.Abs(args[0])
+		if err != nil {
+			fmt.Println("Invalid path:", err)
+			return
+		}
+		email := exportEmail
+		if email == "" {
+			email = viper.GetString("session.email")
+		}
+		if email == "" {
+			fmt.Println("Not logged in, give the email you are registered with using --email.")
+			return
+		}
+
+		eh, err := db.NewEditHistoryStore(config.DBPath())
+		if err != nil {
+			fmt.Println("Failed to access edit history:", err)
+			return
+		}
+		assignmentPaths, err := eh.GetAssignmentFullPaths()
+		if err != nil || !slices.Contains(assignmentPaths, root) {
+			fmt.Println("Not a watched directory:", root)
+			return
+		}
+		assignmentID, err := eh.GetAssignmentIDByFullPath(root)
+		if err != nil {
+			fmt.Println("Failed to find assignment:", err)
+			return
+		}
+		events, err := eh.GetEventsByAssignment(assignmentID)
+		if err != nil {
+			fmt.Println("Failed to read edit history:", err)
+			return
+		}
+		chainHead, err := eh.GetChainHead(assignmentID)
+		if err != nil {
+			fmt.Println("Failed to read edit history:", err)
+			return
+		}
+
+		storedFS, err := db.NewFilesystemStore(config.DBPath())
+		if err != nil {
+			fmt.Println("Failed to access stored files:", err)
+			return
+		}
+		snapshots := make(map[string]string)
+		for _, path := range storedFS.GetAllFilepaths() {
+			if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+				continue
+			}
+			file, err := storedFS.Open(path)
+			if err != nil {
+				fmt.Println("Failed to read stored file:", err)
+				return
+			}
+			relative, _ := filepath.Rel(root, path)
+			snapshots[relative] = file.Content
+		}
+
+		// Paths are relative like in a regular submission, in the form the hash chain uses
+		apiEvents := dtomodels.ConvertEditEvents(events)
+		for i := range apiEvents {
+			relative, err := filepath.Rel(root, apiEvents[i].FilePath)
+			if err == nil {
+				apiEvents[i].FilePath = evidence.ChainPath(relative)
+			}
+		}
+
+		hostname, _ := os.Hostname()
+		bundle := evidence.Bundle{
+			Manifest: evidence.Manifest{
+				AgentVersion: buildinfo.Version,
+				CreatedAt:    time.Now().UTC(),
+				Device:       evidence.DeviceInfo{Hostname: hostname, OS: runtime.GOOS + "/" + runtime.GOARCH},
+				Assignment:   evidence.AssignmentInfo{ID: exportAssignmentID, Directory: filepath.Base(root)},
+				StudentEmail: email,
+				ChainHead:    chainHead,
+			},
+			Events:    apiEvents,
+			Snapshots: snapshots,
+		}
+
+		key, err := evidence.LoadOrCreateDeviceKey()
+		if err != nil {
+			fmt.Println("Failed to load the device key:", err)
+			return
+		}
+		out := exportOut
+		if out == "" {
+			out = fmt.Sprintf("%s-%s.plaggy.zip", filepath.Base(root), time.Now().Format("20060102-150405"))
+		}
+		f, err := os.Create(out)
+		if err != nil {
+			fmt.Println("Failed to create bundle:", err)
+			return
+		}
+		defer f.Close()
+		if err := bundle.Write(f, key); err != nil {
+			fmt.Println("Failed to write bundle:", err)
+			return
+		}
+
+		fmt.Printf("Exported %d events and %d files to %s\n", len(apiEvents), len(snapshots), out)
+		fmt.Println("Device id:", key.ID())
+	},
+}
+
+func init() {
+	exportCmd.Flags().UintVar(&exportAssignmentID, "assignment", 0, "backend id of the assignment, if known")
+	exportCmd.Flags().StringVar(&exportEmail, "email", "", "email you are registered with, defaults to the logged in account")
+	exportCmd.Flags().StringVarP(&exportOut, "out", "o", "", "file to write the bundle to")
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"aiplag-agent/common/config"
+	"aiplag-agent/common/db"
+	"aiplag-agent/daemon/models"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyLimit int
+	historyAll   bool
+)
+
+// historyCmd prints the recorded events of a watched directory
+var historyCmd = &cobra.Command{
+	Use:   "history [dir]",
+	Short: "Show the recorded edit history of a watched directory",
+	Long: `Lists the most recent recorded events of a watched directory, the current directory by default.
+
+Changes made by git commands and by tools that changed many files at once, such as extracting an
+archive or running a formatter, are shown as one line per operation. Use --all to list every
+event on its own, heartbeats included.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		target := "."
+		if len(args) == 1 {
+			target = args[0]
+		}
+		root, err := filepath.Abs(target)
+		if err != nil {
+			fmt.Println("Invalid path:", err)
+			return
+		}
+
+		eh, err := db.NewEditHistoryStore(config.DBPath())
+		if err != nil {
+			fmt.Println("Failed to access edit history:", err)
+			return
+		}
+		defer eh.Close()
+		assignmentID, err := eh.GetAssignmentIDByFullPath(root)
+		if err != nil {
+			fmt.Println("Not inside a watched directory:", root)
+			return
+		}
+		events, err := eh.GetEventsByAssignment(assignmentID)
+		if err != nil {
+			fmt.Println("Failed to read edit history:", err)
+			return
+		}
+
+		lines := historyLines(events, root)
+		if historyLimit > 0 && len(lines) > historyLimit {
+			fmt.Printf("... %d earlier entries, see --limit\n", len(lines)-historyLimit)
+			lines = lines[len(lines)-historyLimit:]
+		}
+		if len(lines) == 0 {
+			fmt.Println("Nothing recorded yet.")
+		}
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	},
+}
+
+// historyLines turns events into the lines to print, collapsing the events of an operation
+// into the line of the operation unless --all is given
+func historyLines(events []models.EditEvent, root string) []string {
+	// Events are only collapsed into operations that wrote files themselves, edits made during a
+	// git commit or a git status were made by the student
+	collapsed := make(map[string]bool)
+	for _, event := range events {
+		switch event.EventType {
+		case models.EventVCSOperation:
+			var op models.VCSOperation
+			if json.Unmarshal([]byte(event.Patch), &op) == nil && op.Kind != models.VCSCommit {
+				collapsed[op.ID] = true
+			}
+		case models.EventBulkOperation:
+			var op models.BulkOperation
+			if json.Unmarshal([]byte(event.Patch), &op) == nil {
+				collapsed[op.ID] = true
+			}
+		}
+	}
+
+	var lines []string
+	for _, event := range events {
+		stamp := fmt.Sprintf("%6d  %s  ", event.Seq, event.Timestamp.Local().Format("2006-01-02 15:04:05"))
+		inOperation := collapsed[event.Meta.VCSOperation] || collapsed[event.Meta.BulkOperation]
+
+		switch {
+		case event.EventType == models.EventHeartbeat && !historyAll:
+		case inOperation && !historyAll:
+		case event.EventType == models.EventVCSOperation:
+			var op models.VCSOperation
+			if err := json.Unmarshal([]byte(event.Patch), &op); err != nil {
+				lines = append(lines, stamp+"git operation (unreadable)")
+				continue
+			}
+			text := fmt.Sprintf("git %-9s %s -> %s, %d files  [%s]", op.Kind,
+				gitPosition(op.FromBranch, op.FromCommit), gitPosition(op.ToBranch, op.ToCommit), op.Files, op.ID)
+			lines = append(lines, stamp+text)
+		case event.EventType == models.EventBulkOperation:
+			var op models.BulkOperation
+			if err := json.Unmarshal([]byte(event.Patch), &op); err != nil {
+				lines = append(lines, stamp+"bulk operation (unreadable)")
+				continue
+			}
+			text := fmt.Sprintf("bulk %-8s %d files in %s (%d added, %d modified, %d deleted)  [%s]", op.Kind,
+				op.Files, op.EndedAt.Sub(op.StartedAt).Round(time.Millisecond), op.Added, op.Modified, op.Deleted, op.ID)
+			lines = append(lines, stamp+text)
+		case event.EventType.IsLifecycle():
+			detail := event.Patch
+			switch event.EventType {
+			case models.EventBaseline:
+				var files []models.BaselineFile
+				_ = json.Unmarshal([]byte(event.Patch), &files)
+				detail = fmt.Sprintf("%d starter files", len(files))
+			case models.EventTrackingPaused:
+				var pause models.TrackingPause
+				_ = json.Unmarshal([]byte(event.Patch), &pause)
+				detail = fmt.Sprintf("%q", pause.Reason)
+			case models.EventTrackingResumed:
+				var pause models.TrackingPause
+				_ = json.Unmarshal([]byte(event.Patch), &pause)
+				detail = fmt.Sprintf("after %s, %d files changed", pause.ResumedAt.Sub(pause.PausedAt).Round(time.Second), pause.ChangedFiles)
+			}
+			lines = append(lines, stamp+fmt.Sprintf("%-14s %s", event.EventType, detail))
+		default:
+			text := fmt.Sprintf("%-14s %s", event.EventType, relativeTo(root, event.FilePath))
+			if event.Meta.Baseline {
+				text += "  (starter file)"
+			}
+			if event.Meta.Degraded {
+				text += "  (coarse diff)"
+			}
+			if inOperation {
+				text += fmt.Sprintf("  [%s]", event.Meta.VCSOperation+event.Meta.BulkOperation)
+			}
+			lines = append(lines, stamp+text)
+		}
+	}
+	return lines
+}
+
+// gitPosition describes where HEAD was, by branch if it was on one
+func gitPosition(branch string, commit string) string {
+	short := commit
+	if len(short) > 7 {
+		short = short[:7]
+	}
+	if branch == "" {
+		return short
+	}
+	return branch + "@" + short
+}
+
+// relativeTo shortens path for display when it is inside root
+func relativeTo(root string, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+func init() {
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 50, "number of most recent entries to show, 0 for all")
+	historyCmd.Flags().BoolVar(&historyAll, "all", false, "show every event on its own, heartbeats included")
+	rootCmd.AddCommand(historyCmd)
+}
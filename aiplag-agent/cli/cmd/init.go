@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	tcpclient "aiplag-agent/cli/tcp-client"
+	"aiplag-agent/common/api"
+	"aiplag-agent/common/api/dtomodels"
+	"aiplag-agent/common/redact"
+	"aiplag-agent/daemon/commandListener"
+	"aiplag-agent/daemon/filesystemwatching"
+	"aiplag-agent/daemon/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	initAssignmentID uint
+	initForce        bool
+)
+
+// initCmd sets up a directory with the starter files of an assignment
+var initCmd = &cobra.Command{
+	Use:   "init [path]",
+	Short: "Set up a directory with the starter files of an assignment",
+	Long: `Downloads the starter files your instructor handed out with the assignment, writes them into
+the directory, starts watching it and binds it to the assignment.
+
+The starter files are recorded as the baseline of the directory, so they are not counted as
+code you typed. Existing files that differ from a starter file are only overwritten with --force.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("assignment") {
+			fmt.Println("Specify the assignment with --assignment <id>")
+			return
+		}
+		token := viper.GetString("session.token")
+		if token == "" {
+			fmt.Println("Not logged in, run plaggy login first.")
+			return
+		}
+
+		root := "."
+		if len(args) == 1 && args[0] != "" {
+			root = args[0]
+		}
+		root, err := filepath.Abs(root)
+		if err != nil {
+			fmt.Println("Invalid path:", err)
+			return
+		}
+		if err := os.MkdirAll(root, 0755); err != nil {
+			fmt.Println("Failed to create directory:", err)
+			return
+		}
+
+		files, err := api.FetchStarterFiles(initAssignmentID, token)
+		if errors.Is(err, api.ErrAgentOutdated) {
+			fmt.Println("This version of plaggy is no longer accepted, upgrade it and try again.")
+			return
+		}
+		if err != nil {
+			fmt.Println("Could not fetch the starter files:", err)
+			return
+		}
+		if len(files) == 0 {
+			fmt.Println("The assignment has no starter files.")
+		}
+
+		baseline, err := starterBaseline(root, files)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		// The directory is watched and given its baseline before anything is written, so the
+		// starter files are recorded and recognized as such
+		if err := ensureWatched(root); err != nil {
+			fmt.Println(err)
+			return
+		}
+		payload, err := json.Marshal(commandListener.BaselineRequest{Root: root, Files: baseline})
+		if err != nil {
+			fmt.Println("Failed to encode baseline:", err)
+			return
+		}
+		resp, err := tcpclient.SendCommand('I', string(payload))
+		if err != nil || resp != 'A' {
+			fmt.Println("The daemon did not accept the baseline, nothing was written.")
+			return
+		}
+
+		written := 0
+		for _, file := range files {
+			destination := filepath.Join(root, filepath.FromSlash(file.Path))
+			current, err := os.ReadFile(destination)
+			if err == nil && string(current) == file.Content {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+				fmt.Printf("%s: %v\n", destination, err)
+				continue
+			}
+			if err := os.WriteFile(destination, []byte(file.Content), 0644); err != nil {
+				fmt.Printf("%s: %v\n", destination, err)
+				continue
+			}
+			written++
+		}
+		fmt.Printf("Wrote %d of %d starter files to %s\n", written, len(files), root)
+
+		bindWatchedDirectory(root, initAssignmentID)
+	},
+}
+
+// starterBaseline checks the starter files can be written into root and returns the baseline
+// to record for them. Files already on disk that differ are refused unless --force is given.
+func starterBaseline(root string, files []dtomodels.StarterFile) ([]models.BaselineFile, error) {
+	var conflicts []string
+	baseline := make([]models.BaselineFile, 0, len(files))
+	for _, file := range files {
+		destination := filepath.Join(root, filepath.FromSlash(file.Path))
+		if !strings.HasPrefix(destination, root+string(filepath.Separator)) {
+			return nil, fmt.Errorf("starter file %q points outside of the directory, refusing to write it", file.Path)
+		}
+		sum := sha256.Sum256([]byte(file.Content))
+		if file.SHA256 != "" && file.SHA256 != hex.EncodeToString(sum[:]) {
+			return nil, fmt.Errorf("starter file %q arrived damaged, try again", file.Path)
+		}
+		if current, err := os.ReadFile(destination); err == nil && string(current) != file.Content {
+			conflicts = append(conflicts, destination)
+		}
+		baseline = append(baseline, models.BaselineFile{
+			Path:        file.Path,
+			SHA256:      hex.EncodeToString(sum[:]),
+			ContentHash: filesystemwatching.ContentHash(redact.Default.Redact(destination, file.Content)),
+		})
+	}
+	if len(conflicts) > 0 && !initForce {
+		return nil, fmt.Errorf("these files differ from the starter files, use --force to overwrite them:\n - %s",
+			strings.Join(conflicts, "\n - "))
+	}
+	return baseline, nil
+}
+
+// ensureWatched starts watching root unless the daemon already does
+func ensureWatched(root string) error {
+	resp, payload, err := tcpclient.SendRequest('S', "")
+	if err != nil {
+		return fmt.Errorf("could not reach the daemon: %w", err)
+	}
+	var status commandListener.DaemonStatus
+	if resp == 'A' && json.Unmarshal(payload, &status) == nil && slices.Contains(status.WatchedDirectories, root) {
+		return nil
+	}
+	resp, err = tcpclient.SendCommand('W', root)
+	if err != nil {
+		return fmt.Errorf("could not reach the daemon: %w", err)
+	}
+	if resp != 'A' {
+		return fmt.Errorf("the daemon could not watch %s", root)
+	}
+	fmt.Println("Watching path:", root)
+	return nil
+}
+
+func init() {
+	initCmd.Flags().UintVar(&initAssignmentID, "assignment", 0, "id of the assignment to set up")
+	initCmd.Flags().BoolVarP(&initForce, "force", "f", false, "overwrite files that differ from the starter files")
+	rootCmd.AddCommand(initCmd)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	tcpclient "aiplag-agent/cli/tcp-client"
+	"aiplag-agent/common/config"
+	"aiplag-agent/common/db"
+	"aiplag-agent/daemon/commandListener"
+	"aiplag-agent/daemon/models"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var pauseReason string
+
+// pauseCmd stops recording edits of a watched directory until resumeCmd
+var pauseCmd = &cobra.Command{
+	Use:   "pause [dir]",
+	Short: "Pause tracking of a watched directory",
+	Long: `Stops recording the edits of the watched directory holding dir, the current directory by default,
+until plaggy resume. Nothing is deleted.
+
+The pause and its reason are recorded and shown to your instructor. When tracking resumes, the
+files that changed meanwhile are recorded as a single change, not as the edits that were made.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if strings.TrimSpace(pauseReason) == "" {
+			fmt.Println(`Say why you are pausing with --reason "...", it is shown to your instructor.`)
+			return
+		}
+		root, err := watchedRoot(args)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		request, _ := json.Marshal(commandListener.PauseRequest{Root: root, Reason: pauseReason})
+		resp, payload, err := tcpclient.SendRequest('P', string(request))
+		if err != nil {
+			fmt.Println("Could not reach the daemon:", err)
+			return
+		}
+		if resp != 'A' {
+			fmt.Println("The daemon could not pause", root+", it may already be paused.")
+			return
+		}
+		var pause models.TrackingPause
+		_ = json.Unmarshal(payload, &pause)
+		fmt.Printf("Paused tracking of %s at %s.\n", root, pause.PausedAt.Local().Format("15:04:05"))
+		fmt.Println("Run plaggy resume to continue.")
+	},
+}
+
+// resumeCmd records what changed during a pause and tracks the directory again
+var resumeCmd = &cobra.Command{
+	Use:   "resume [dir]",
+	Short: "Resume tracking of a paused directory",
+	Long:  `Resumes tracking of the watched directory holding dir, the current directory by default, and records what changed while it was paused.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		root, err := watchedRoot(args)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		request, _ := json.Marshal(commandListener.PauseRequest{Root: root})
+		resp, payload, err := tcpclient.SendRequest('U', string(request))
+		if err != nil {
+			fmt.Println("Could not reach the daemon:", err)
+			return
+		}
+		if resp != 'A' {
+			fmt.Println("Tracking of", root, "is not paused.")
+			return
+		}
+		var pause models.TrackingPause
+		_ = json.Unmarshal(payload, &pause)
+		fmt.Printf("Resumed tracking of %s after %s, %d files changed while paused.\n", root,
+			pause.ResumedAt.Sub(pause.PausedAt).Round(time.Second), pause.ChangedFiles)
+	},
+}
+
+// watchedRoot returns the watched directory holding the directory given in args, or the
+// current directory
+func watchedRoot(args []string) (string, error) {
+	target := "."
+	if len(args) == 1 && args[0] != "" {
+		target = args[0]
+	}
+	dir, err := filepath.Abs(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+	eh, err := db.NewEditHistoryStore(config.DBPath())
+	if err != nil {
+		return "", fmt.Errorf("failed to access edit history: %w", err)
+	}
+	defer eh.Close()
+	roots, err := eh.GetAssignmentFullPaths()
+	if err != nil {
+		return "", fmt.Errorf("failed to get watched directories: %w", err)
+	}
+	for _, root := range roots {
+		if dir == root || strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			return root, nil
+		}
+	}
+	return "", fmt.Errorf("not inside a watched directory: %s", dir)
+}
+
+func init() {
+	pauseCmd.Flags().StringVar(&pauseReason, "reason", "", "why tracking is paused, shown to your instructor")
+	rootCmd.AddCommand(pauseCmd)
+	rootCmd.AddCommand(resumeCmd)
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	tcpclient "aiplag-agent/cli/tcp-client"
+	"aiplag-agent/common/config"
+	"aiplag-agent/common/db"
+	"aiplag-agent/common/history"
+	"aiplag-agent/common/redact"
+	"aiplag-agent/daemon/commandListener"
+	"aiplag-agent/daemon/filesystemwatching"
+	"aiplag-agent/daemon/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreAt     string
+	restoreOut    string
+	restoreDryRun bool
+)
+
+// Accepted layouts of --at besides an event id, times without a zone are local
+var restoreTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// restoreCmd rolls files back to an earlier recorded state
+var restoreCmd = &cobra.Command{
+	Use:   "restore <file|dir>",
+	Short: "Restore a file or directory to an earlier recorded state",
+	Long: `Rebuilds the content a file, or every file in a directory, had at the given point from the
+recorded edit history and writes it back to disk, or to the directory given with --out.
+
+The point is either an event id or a time such as "2025-03-01 14:30".
+Secrets that were redacted while recording can't be restored and have to be filled in again.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		target, err := filepath.Abs(args[0])
+		if err != nil {
+			fmt.Println("Invalid path:", err)
+			return
+		}
+		if restoreAt == "" {
+			fmt.Println("Specify the point to restore to with --at <time|event-id>")
+			return
+		}
+
+		eh, err := db.NewEditHistoryStore(config.DBPath())
+		if err != nil {
+			fmt.Println("Failed to access edit history:", err)
+			return
+		}
+		assignmentID, err := eh.GetAssignmentIDByFullPath(target)
+		if err != nil {
+			fmt.Println("Path is not inside a watched directory:", target)
+			return
+		}
+		events, err := eh.GetEventsByAssignment(assignmentID)
+		if err != nil {
+			fmt.Println("Failed to read edit history:", err)
+			return
+		}
+
+		include, err := restorePoint(restoreAt, events)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		states := history.StatesAt(events, target, include)
+		if len(states) == 0 {
+			fmt.Println("No recorded history for", target, "up to that point.")
+			return
+		}
+
+		if restoreOut == "" && !restoreDryRun {
+			if _, _, err := tcpclient.SendRequest('S', ""); err != nil {
+				fmt.Println("The daemon is not running, restoring in place would be recorded as an edit.")
+				fmt.Println("Start the daemon or restore into a separate directory with --out.")
+				return
+			}
+		}
+
+		for _, state := range states {
+			restoreFile(target, state)
+		}
+	},
+}
+
+// restorePoint returns whether an event happened before the point given with --at
+func restorePoint(at string, events []models.EditEvent) (func(models.EditEvent) bool, error) {
+	if id, err := strconv.Atoi(at); err == nil {
+		for _, event := range events {
+			if event.ID == id {
+				// Events are replayed in order, so everything up to the chosen event is included
+				seq := event.Seq
+				return func(e models.EditEvent) bool { return e.Seq <= seq }, nil
+			}
+		}
+		return nil, fmt.Errorf("no event with id %d in this directory's history", id)
+	}
+	for _, layout := range restoreTimeLayouts {
+		if t, err := time.ParseInLocation(layout, at, time.Local); err == nil {
+			return func(e models.EditEvent) bool { return !e.Timestamp.After(t) }, nil
+		}
+	}
+	return nil, fmt.Errorf("--at must be an event id or a time like %q", "2006-01-02 15:04")
+}
+
+// restoreFile writes a single rebuilt file, or describes what would be written on a dry run
+func restoreFile(target string, state history.FileState) {
+	if state.Err != nil {
+		fmt.Printf("%s: history can't be replayed (%v), skipped\n", state.Path, state.Err)
+		return
+	}
+	if !state.Exists {
+		fmt.Printf("%s: did not exist at that point, left untouched\n", state.Path)
+		return
+	}
+
+	if restoreOut == "" && redact.IsEnvFile(state.Path) {
+		fmt.Printf("%s: values of env files are not recorded, left untouched\n", state.Path)
+		return
+	}
+
+	destination := state.Path
+	if restoreOut != "" {
+		relative, err := filepath.Rel(target, state.Path)
+		if err != nil || relative == "." {
+			relative = filepath.Base(state.Path)
+		}
+		destination = filepath.Join(restoreOut, relative)
+	}
+
+	current, err := os.ReadFile(destination)
+	if err == nil && string(current) == state.Content {
+		fmt.Printf("%s: unchanged\n", destination)
+		return
+	}
+	if restoreDryRun {
+		patch := filesystemwatching.NewFileDiffer().UnifiedLineLevelPatches(string(current), state.Content)
+		fmt.Printf("%s: would be restored to event %d (+%d -%d lines)\n",
+			destination, state.LastEventID, countPatchLines(patch, '+'), countPatchLines(patch, '-'))
+		return
+	}
+
+	if restoreOut == "" {
+		// Let the daemon record the write as a restore instead of an edit
+		request, _ := json.Marshal(commandListener.RestoreRequest{
+			Path:        destination,
+			ContentHash: filesystemwatching.ContentHash(redact.Default.Redact(destination, state.Content)),
+		})
+		if resp, err := tcpclient.SendCommand('O', string(request)); err != nil || resp != 'A' {
+			fmt.Printf("%s: daemon did not accept the restore, skipped\n", destination)
+			return
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		fmt.Printf("%s: failed to create directory: %v\n", destination, err)
+		return
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(destination); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(destination, []byte(state.Content), mode); err != nil {
+		fmt.Printf("%s: failed to write: %v\n", destination, err)
+		return
+	}
+	fmt.Printf("%s: restored to event %d\n", destination, state.LastEventID)
+	if strings.Contains(state.Content, "<redacted:") || redact.IsEnvFile(state.Path) {
+		fmt.Printf("%s: contains redacted secrets, fill them in again\n", destination)
+	}
+}
+
+func countPatchLines(patch string, kind byte) int {
+	count := 0
+	for line := range strings.SplitSeq(patch, "\n") {
+		if len(line) > 0 && line[0] == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func init() {
+	restoreCmd.Flags().StringVar(&restoreAt, "at", "", "event id or time to restore to")
+	restoreCmd.Flags().StringVar(&restoreOut, "out", "", "write the restored files to this directory instead")
+	restoreCmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "only show what would be restored")
+	rootCmd.AddCommand(restoreCmd)
+}
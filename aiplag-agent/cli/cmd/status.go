@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	tcpclient "aiplag-agent/cli/tcp-client"
+	"aiplag-agent/daemon/commandListener"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// statusCmd shows what the running daemon is doing
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of the running daemon",
+	Long:  `Shows the directories the daemon is watching and how well it is keeping up with filesystem events.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		resp, payload, err := tcpclient.SendRequest('S', "")
+		if err != nil {
+			fmt.Println("Could not reach the daemon:", err)
+			return
+		}
+		if resp != 'A' {
+			fmt.Println("Daemon could not report its status.")
+			return
+		}
+
+		var status commandListener.DaemonStatus
+		if err := json.Unmarshal(payload, &status); err != nil {
+			fmt.Println("Unexpected status from daemon:", err)
+			return
+		}
+
+		fmt.Println("Daemon version:", status.Version)
+		if u := status.Update; u != nil {
+			line := fmt.Sprintf("Last update:    %s to %s, %s on %s", u.FromVersion, u.ToVersion, u.Status, u.UpdatedAt.Local().Format("2006-01-02 15:04"))
+			if u.Reason != "" {
+				line += " (" + u.Reason + ")"
+			}
+			fmt.Println(line)
+		}
+		fmt.Println()
+		fmt.Println("Watched directories:")
+		if len(status.WatchedDirectories) == 0 {
+			fmt.Println(" (none)")
+		}
+		for _, path := range status.WatchedDirectories {
+			if pause, paused := status.Paused[path]; paused {
+				fmt.Printf(" - %s (paused since %s: %s)\n", path, pause.PausedAt.Local().Format("2006-01-02 15:04"), pause.Reason)
+				continue
+			}
+			fmt.Println(" -", path)
+		}
+
+		d := status.Dispatcher
+		if d == nil {
+			return
+		}
+		fmt.Println()
+		fmt.Printf("Event workers:     %d (queue capacity %d)\n", d.Workers, d.QueueCapacity)
+		fmt.Printf("Queue depths:      %v (max seen %d)\n", d.QueueDepths, d.MaxQueueDepth)
+		fmt.Printf("Events handled:    %d\n", d.Processed)
+		fmt.Printf("Handling time:     avg %.2fms, max %.2fms\n", d.AvgHandleMs, d.MaxHandleMs)
+		fmt.Printf("Blocked enqueues:  %d (%dms total)\n", d.BlockedEnqueues, d.BlockedMs)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
@@ -8,9 +8,12 @@ import (
 	"aiplag-agent/common/api"
 	"aiplag-agent/common/config"
 	"aiplag-agent/common/db"
+	daemonModels "aiplag-agent/daemon/models"
 	"errors"
 	"fmt"
+	"log"
 	"slices"
+	"time"
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
@@ -72,9 +75,22 @@ var submitCmd = &cobra.Command{
 		err = api.SubmitEdits(selectedAssignment.ID, eh, dirToSubmit, token)
 		if err == nil {
 			fmt.Println("Assignment submitted!")
+			err = bindAssignment(daemonModels.WatchedAssignment{
+				Path:        dirToSubmit,
+				RemoteID:    selectedAssignment.ID,
+				Title:       selectedAssignment.Title,
+				DueDate:     selectedAssignment.DueDate,
+				SubmittedAt: time.Now(),
+			})
+			if err != nil {
+				log.Printf("Failed to record submission of %s: %v", dirToSubmit, err)
+			}
 		} else {
 			if errors.Is(err, api.ServerError) {
 				fmt.Println("Server unavailable, please try again later")
+			} else if errors.Is(err, api.ErrAgentOutdated) {
+				fmt.Println("The server no longer accepts this version of plaggy. Update it with:")
+				fmt.Println("    sudo go run ./installer upgrade")
 			} else {
 				fmt.Println("Submission failed! Please try again")
 			}
@@ -7,18 +7,33 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
+	"aiplag-agent/cli/dashboard"
+	cliModels "aiplag-agent/cli/models"
 	tcpclient "aiplag-agent/cli/tcp-client"
+	"aiplag-agent/common/api"
+	"aiplag-agent/common/evidence"
+	"aiplag-agent/daemon/models"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	watchAssignmentID uint
+	watchUI           bool
 )
 
 // watchCmd represents the watch command
 var watchCmd = &cobra.Command{
 	Use:   "watch [path]",
 	Short: "Starts watching files in the specified directory",
-	Long:  `.`,
-	Args:  cobra.MaximumNArgs(1), // allow at most one argument
+	Long: `Starts watching files in the specified directory.
+
+With --assignment the directory is bound to one of your assignments, so plaggy dashboard can
+show its deadline and submission state. With --ui the dashboard opens right away.`,
+	Args: cobra.MaximumNArgs(1), // allow at most one argument
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get current working directory
 		cwd, err := os.Getwd()
@@ -63,12 +78,68 @@ var watchCmd = &cobra.Command{
 			fmt.Println("Started watching path!")
 		case 'R':
 			fmt.Println("Error while watching path!")
+			return
 		default:
 			fmt.Println("Unknown response from daemon:", resp)
+			return
+		}
+
+		if cmd.Flags().Changed("assignment") {
+			bindWatchedDirectory(pathToWatch, watchAssignmentID)
+		}
+		if watchUI {
+			if err := dashboard.Run(os.Stdout); err != nil {
+				fmt.Println(err)
+			}
 		}
 	},
 }
 
+// bindWatchedDirectory binds the directory to the assignment with the given backend id
+func bindWatchedDirectory(path string, assignmentID uint) {
+	email := viper.GetString("session.email")
+	token := viper.GetString("session.token")
+	if email == "" || token == "" {
+		fmt.Println("Not logged in, the directory is watched but not bound to an assignment.")
+		return
+	}
+	assignments, err := api.FetchAssignments(email, token)
+	if err != nil {
+		fmt.Println("Could not fetch your assignments, the directory is watched but not bound:", err)
+		return
+	}
+	idx := slices.IndexFunc(assignments, func(a cliModels.Assignment) bool {
+		return a.ID == assignmentID
+	})
+	if idx < 0 {
+		fmt.Println("You have no assignment with id", assignmentID)
+		return
+	}
+	assignment := assignments[idx]
+	err = bindAssignment(models.WatchedAssignment{
+		Path:     path,
+		RemoteID: assignment.ID,
+		Title:    assignment.Title,
+		DueDate:  assignment.DueDate,
+	})
+	if err != nil {
+		fmt.Println("Failed to bind assignment:", err)
+		return
+	}
+	fmt.Printf("Bound to %q, due %s\n", assignment.Title, assignment.DueDate.Local().Format("2006-01-02 15:04"))
+
+	// Evidence bundles exported from this device are only accepted once its key is registered
+	key, err := evidence.LoadOrCreateDeviceKey()
+	if err == nil {
+		err = api.RegisterDevice(key, email, token)
+	}
+	if err != nil {
+		fmt.Println("Could not register this device, run the command again before exporting evidence:", err)
+	}
+}
+
 func init() {
+	watchCmd.Flags().UintVar(&watchAssignmentID, "assignment", 0, "bind the directory to the assignment with this id")
+	watchCmd.Flags().BoolVar(&watchUI, "ui", false, "open the dashboard after watching starts")
 	rootCmd.AddCommand(watchCmd)
 }
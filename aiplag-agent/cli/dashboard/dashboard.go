@@ -0,0 +1,114 @@
+package dashboard
+
+import (
+	tcpclient "aiplag-agent/cli/tcp-client"
+	"aiplag-agent/common/db"
+	"aiplag-agent/daemon/commandListener"
+	"aiplag-agent/daemon/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Screen size used when the terminal doesn't report it through COLUMNS and LINES
+const (
+	defaultWidth  = 100
+	defaultHeight = 40
+)
+
+// message is a single response the daemon streamed to the dashboard
+type message struct {
+	resp    byte
+	payload []byte
+	err     error
+}
+
+// Run subscribes to the daemon and redraws the dashboard on out until interrupted or the
+// daemon goes away
+func Run(out io.Writer) error {
+	conn, resp, payload, err := tcpclient.OpenStream('D', "")
+	if err != nil {
+		return fmt.Errorf("could not reach the daemon: %w", err)
+	}
+	defer conn.Close()
+	if resp != 'A' {
+		return fmt.Errorf("daemon refused the dashboard subscription")
+	}
+	var assignments []models.WatchedAssignment
+	if err := json.Unmarshal(payload, &assignments); err != nil {
+		return fmt.Errorf("unexpected snapshot from daemon: %w", err)
+	}
+	state := NewState(assignments)
+
+	messages := make(chan message)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			resp, payload, err := tcpclient.ReadResponse(conn)
+			select {
+			case messages <- message{resp, payload, err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	// Deadlines count down even when nothing is recorded
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	io.WriteString(out, enterAltScreen)
+	defer io.WriteString(out, leaveAltScreen)
+
+	for {
+		width, height := screenSize()
+		Render(out, state, width, height, time.Now())
+
+		select {
+		case <-interrupted:
+			return nil
+		case <-ticker.C:
+		case m := <-messages:
+			if m.err != nil {
+				return fmt.Errorf("lost connection to the daemon: %w", m.err)
+			}
+			switch m.resp {
+			case commandListener.RespFileEvents:
+				var counts map[string]int
+				if err := json.Unmarshal(m.payload, &counts); err == nil {
+					state.AddFileEvents(counts)
+				}
+			case commandListener.RespChange:
+				var change db.StoreChange
+				if err := json.Unmarshal(m.payload, &change); err == nil {
+					state.Apply(change)
+				}
+			}
+		}
+	}
+}
+
+func screenSize() (int, int) {
+	width, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || width <= 0 {
+		width = defaultWidth
+	}
+	height, err := strconv.Atoi(os.Getenv("LINES"))
+	if err != nil || height <= 0 {
+		height = defaultHeight
+	}
+	return width, height
+}
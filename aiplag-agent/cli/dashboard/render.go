@@ -0,0 +1,158 @@
+package dashboard
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ANSI escape sequences, the dashboard needs nothing beyond these
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAltScreen = "\x1b[?25h\x1b[?1049l"
+	clearScreen    = "\x1b[H\x1b[2J"
+	bold           = "\x1b[1m"
+	dim            = "\x1b[2m"
+	red            = "\x1b[31m"
+	green          = "\x1b[32m"
+	yellow         = "\x1b[33m"
+	reset          = "\x1b[0m"
+)
+
+// Files listed per watched directory
+const filesPerAssignment = 5
+
+// Render draws the whole dashboard into a screen of the given size
+func Render(w io.Writer, s *State, width int, height int, now time.Time) {
+	var lines []string
+	add := func(format string, args ...any) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	add("%splaggy dashboard%s  %s%s  ctrl+c to quit%s", bold, reset, dim, now.Format("15:04:05"), reset)
+	add("")
+	if len(s.Assignments) == 0 {
+		add("Nothing is being watched, start with plaggy watch.")
+	}
+	for _, a := range s.Assignments {
+		title := a.Title
+		if title == "" {
+			title = dim + "not bound to an assignment" + reset
+		}
+		watching := green + "watching" + reset
+		if s.Stopped[a.Path] {
+			watching = yellow + "stopped" + reset
+		}
+		add("%s%s%s  %s", bold, a.Path, reset, watching)
+		add("  %s  %s  %s", title, deadline(a.DueDate, now), submission(a.SubmittedAt, a.IsBound()))
+		files := s.filesOf(a.Path)
+		for i, f := range files {
+			if i == filesPerAssignment {
+				add("  %s… %d more files%s", dim, len(files)-i, reset)
+				break
+			}
+			add("  %5d  %s", f.Events, s.relativePath(f.Path))
+		}
+		add("")
+	}
+
+	add("%sLive events%s", bold, reset)
+	// The feed gets whatever room is left, newest at the bottom
+	room := height - len(lines)
+	feed := s.Feed
+	if room < 1 {
+		room = 1
+	}
+	if len(feed) > room {
+		feed = feed[len(feed)-room:]
+	}
+	if len(feed) == 0 {
+		add("%swaiting for edits…%s", dim, reset)
+	}
+	for _, e := range feed {
+		marker := ""
+		if e.Meta.Degraded {
+			marker = yellow + " (coarse: " + e.Meta.DegradedReason + ")" + reset
+		}
+		add("%s  %-13s %s%s", e.Timestamp.Local().Format("15:04:05"), e.EventType, s.relativePath(e.FilePath), marker)
+	}
+
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	var screen strings.Builder
+	screen.WriteString(clearScreen)
+	for i, line := range lines {
+		if i > 0 {
+			screen.WriteString("\r\n")
+		}
+		screen.WriteString(truncate(line, width))
+	}
+	io.WriteString(w, screen.String())
+}
+
+func deadline(due time.Time, now time.Time) string {
+	if due.IsZero() {
+		return dim + "no deadline" + reset
+	}
+	left := due.Sub(now)
+	if left < 0 {
+		return red + "overdue by " + humanDuration(-left) + reset
+	}
+	color := green
+	if left < 24*time.Hour {
+		color = yellow
+	}
+	return color + humanDuration(left) + " left" + reset
+}
+
+func submission(submittedAt time.Time, bound bool) string {
+	if !submittedAt.IsZero() {
+		return green + "submitted " + submittedAt.Local().Format("2006-01-02 15:04") + reset
+	}
+	if !bound {
+		return ""
+	}
+	return yellow + "not submitted" + reset
+}
+
+func humanDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm %ds", minutes, int(d%time.Minute/time.Second))
+	}
+}
+
+// truncate cuts a line to width visible characters, escape sequences don't count
+func truncate(line string, width int) string {
+	var out strings.Builder
+	visible := 0
+	inEscape := false
+	for _, r := range line {
+		switch {
+		case r == '\x1b':
+			inEscape = true
+		case inEscape:
+			if r >= '@' && r <= '~' && r != '[' {
+				inEscape = false
+			}
+		default:
+			if visible == width {
+				out.WriteString(reset)
+				return out.String()
+			}
+			visible++
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
@@ -0,0 +1,126 @@
+// Package dashboard renders a live view of what the daemon records
+package dashboard
+
+import (
+	"aiplag-agent/common/db"
+	"aiplag-agent/daemon/models"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Events kept for the live feed
+const feedLength = 50
+
+// State is everything the dashboard shows, built from the daemon's snapshot and changes
+type State struct {
+	Assignments []models.WatchedAssignment
+	// Directories the daemon stopped watching since the dashboard opened
+	Stopped map[string]bool
+	// Recorded file events per file path
+	FileEvents map[string]int
+	// Most recent events, newest last
+	Feed []models.EditEvent
+}
+
+// NewState creates the state from the assignments the daemon sent on subscribing
+func NewState(assignments []models.WatchedAssignment) *State {
+	return &State{
+		Assignments: assignments,
+		Stopped:     make(map[string]bool),
+		FileEvents:  make(map[string]int),
+	}
+}
+
+// AddFileEvents adds counts sent by the daemon after the snapshot
+func (s *State) AddFileEvents(counts map[string]int) {
+	for path, count := range counts {
+		s.FileEvents[path] += count
+	}
+}
+
+// Apply updates the state with a change recorded by the daemon
+func (s *State) Apply(change db.StoreChange) {
+	if a := change.Assignment; a != nil {
+		for i := range s.Assignments {
+			if s.Assignments[i].Path == a.Path {
+				s.Assignments[i] = *a
+				return
+			}
+		}
+		s.Assignments = append(s.Assignments, *a)
+		return
+	}
+
+	e := change.Event
+	if e == nil {
+		return
+	}
+	switch {
+	case e.EventType == models.EventWatchAdded:
+		delete(s.Stopped, e.FilePath)
+		if s.assignmentIndex(e.FilePath) < 0 {
+			s.Assignments = append(s.Assignments, models.WatchedAssignment{ID: e.AssignmentID, Path: e.FilePath})
+		}
+	case e.EventType == models.EventWatchRemoved:
+		s.Stopped[e.FilePath] = true
+	case !e.EventType.IsLifecycle():
+		s.FileEvents[e.FilePath]++
+	}
+	if e.EventType == models.EventHeartbeat {
+		return
+	}
+	s.Feed = append(s.Feed, *e)
+	if len(s.Feed) > feedLength {
+		s.Feed = s.Feed[len(s.Feed)-feedLength:]
+	}
+}
+
+func (s *State) assignmentIndex(path string) int {
+	for i, a := range s.Assignments {
+		if a.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// fileCount is the number of events of a single file
+type fileCount struct {
+	Path   string
+	Events int
+}
+
+// filesOf returns the files under root ordered by how often they were edited
+func (s *State) filesOf(root string) []fileCount {
+	var files []fileCount
+	for path, count := range s.FileEvents {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			files = append(files, fileCount{Path: path, Events: count})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Events != files[j].Events {
+			return files[i].Events > files[j].Events
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// relativePath shortens path to be relative to the watched directory it is in
+func (s *State) relativePath(path string) string {
+	best := ""
+	for _, a := range s.Assignments {
+		if strings.HasPrefix(path, a.Path) && len(a.Path) > len(best) {
+			best = a.Path
+		}
+	}
+	if best == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(best, path); err == nil && rel != "." {
+		return filepath.Join(filepath.Base(best), rel)
+	}
+	return filepath.Base(best)
+}
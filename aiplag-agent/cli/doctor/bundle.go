@@ -0,0 +1,134 @@
+package doctor
+
+import (
+	"aiplag-agent/common/config"
+	"aiplag-agent/common/db"
+	"aiplag-agent/common/redact"
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Only the end of the daemon log goes into a support bundle
+const maxLogBytes = 1 << 20
+
+// DBStats summarizes the local database without any file contents
+type DBStats struct {
+	SizeBytes   int64                `json:"size_bytes"`
+	StoredFiles int                  `json:"stored_files"`
+	History     *db.EditHistoryStats `json:"history,omitempty"`
+	Error       string               `json:"error,omitempty"`
+}
+
+// WriteSupportBundle writes a zip with the report, the end of the daemon log, the config
+// without the session token and database statistics. Secrets are redacted from the log.
+func WriteSupportBundle(w io.Writer, results []Result) error {
+	zw := zip.NewWriter(w)
+
+	report := map[string]any{
+		"created_at": time.Now().UTC().Format(time.RFC3339),
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+		"results":    results,
+	}
+	if err := writeJSON(zw, "report.json", report); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "config.json", redactedConfig()); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "db-stats.json", readDBStats()); err != nil {
+		return err
+	}
+
+	log, err := tailFile(config.DaemonLogPath(), maxLogBytes)
+	if err != nil {
+		log = []byte(fmt.Sprintf("failed to read daemon log: %v\n", err))
+	}
+	f, err := zw.Create("daemon.log")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, redact.Default.Redact(config.DaemonLogPath(), string(log))); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func redactedConfig() map[string]any {
+	settings := viper.AllSettings()
+	if session, ok := settings["session"].(map[string]any); ok {
+		if _, ok := session["token"]; ok {
+			session["token"] = "<removed>"
+		}
+	}
+	return settings
+}
+
+func readDBStats() DBStats {
+	var stats DBStats
+	info, err := os.Stat(config.DBPath())
+	if err != nil {
+		stats.Error = err.Error()
+		return stats
+	}
+	stats.SizeBytes = info.Size()
+
+	storedFS, err := db.NewFilesystemStore(config.DBPath())
+	if err != nil {
+		stats.Error = err.Error()
+		return stats
+	}
+	stats.StoredFiles = len(storedFS.GetAllFilepaths())
+	storedFS.Close()
+
+	eh, err := db.NewEditHistoryStore(config.DBPath())
+	if err != nil {
+		stats.Error = err.Error()
+		return stats
+	}
+	defer eh.Close()
+	history, err := eh.Stats()
+	if err != nil {
+		stats.Error = err.Error()
+		return stats
+	}
+	stats.History = &history
+	return stats
+}
+
+// tailFile reads at most limit bytes from the end of a file
+func tailFile(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > limit {
+		if _, err := f.Seek(info.Size()-limit, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(f)
+}
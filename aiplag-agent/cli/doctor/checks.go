@@ -0,0 +1,279 @@
+package doctor
+
+import (
+	tcpclient "aiplag-agent/cli/tcp-client"
+	"aiplag-agent/common/api"
+	"aiplag-agent/common/config"
+	"aiplag-agent/common/db"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kardianos/service"
+	"github.com/spf13/viper"
+)
+
+// Clock differences to the server above these are reported
+const (
+	clockSkewWarning = time.Minute
+	clockSkewFailure = 5 * time.Minute
+)
+
+// Share of the inotify watch limit the watched directories may use before it is reported
+const watchLimitWarningRatio = 0.8
+
+// noopProgram lets the CLI look up the daemon service without being it
+type noopProgram struct{}
+
+func (noopProgram) Start(service.Service) error { return nil }
+func (noopProgram) Stop(service.Service) error  { return nil }
+
+func daemonCommand(action string) string {
+	if runtime.GOOS == "windows" {
+		return fmt.Sprintf(`"%s" %s (from an administrator terminal)`, config.DaemonExecutablePath(), action)
+	}
+	return fmt.Sprintf("sudo %s %s", config.DaemonExecutablePath(), action)
+}
+
+// installerCommand is the installer invocation that fixes a broken installation
+func installerCommand(action string) string {
+	if runtime.GOOS == "windows" {
+		return "go run ./installer " + action + " (from the plaggy source directory, in an administrator terminal)"
+	}
+	return "sudo go run ./installer " + action + " (from the plaggy source directory)"
+}
+
+func checkService() Result {
+	if _, err := os.Stat(config.DaemonExecutablePath()); err != nil {
+		return Result{
+			Status: StatusFailed,
+			Detail: "daemon executable not found at " + config.DaemonExecutablePath(),
+			Fix:    installerCommand("install"),
+		}
+	}
+	s, err := service.New(noopProgram{}, config.ServiceConfig())
+	if err != nil {
+		return Result{Status: StatusSkipped, Detail: "service status can't be read on this system: " + err.Error()}
+	}
+	status, err := s.Status()
+	if errors.Is(err, service.ErrNotInstalled) {
+		return Result{
+			Status: StatusFailed,
+			Detail: "daemon service is not installed",
+			Fix:    installerCommand("repair"),
+		}
+	}
+	if err != nil {
+		return Result{Status: StatusWarning, Detail: "failed to read service status: " + err.Error()}
+	}
+	if status != service.StatusRunning {
+		return Result{
+			Status: StatusFailed,
+			Detail: "daemon service is installed but not running",
+			Fix:    daemonCommand("start"),
+		}
+	}
+	return Result{Status: StatusOK, Detail: "daemon service is running"}
+}
+
+func checkDaemonPort() Result {
+	data, err := os.ReadFile(config.TCPPortFilePath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return Result{
+			Status: StatusFailed,
+			Detail: "no port file at " + config.TCPPortFilePath() + ", the daemon never started",
+			Fix:    daemonCommand("restart"),
+		}
+	}
+	if err != nil {
+		return Result{Status: StatusFailed, Detail: "can't read the port file: " + err.Error(), Fix: "see the permissions check"}
+	}
+	port := strings.TrimSpace(string(data))
+	if _, err := strconv.Atoi(port); err != nil {
+		return Result{
+			Status: StatusFailed,
+			Detail: fmt.Sprintf("port file holds %q instead of a port", port),
+			Fix:    daemonCommand("restart"),
+		}
+	}
+	if _, _, err := tcpclient.SendRequest('S', ""); err != nil {
+		return Result{
+			Status: StatusFailed,
+			Detail: fmt.Sprintf("nothing answers on port %s, the port file is stale", port),
+			Fix:    daemonCommand("restart"),
+		}
+	}
+	return Result{Status: StatusOK, Detail: "daemon answers on port " + port}
+}
+
+func checkPermissions() Result {
+	dir := config.AppDataDir()
+	info, err := os.Stat(dir)
+	if err != nil {
+		return Result{Status: StatusFailed, Detail: dir + " doesn't exist", Fix: installerCommand("install")}
+	}
+	if !info.IsDir() {
+		return Result{Status: StatusFailed, Detail: dir + " is not a directory", Fix: "remove it, then " + installerCommand("install")}
+	}
+
+	// Linux installs only give the plaggy group access
+	fix := installerCommand("repair")
+	if runtime.GOOS == "linux" {
+		fix += ", then check that groups lists plaggy"
+	}
+	probe, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return Result{Status: StatusFailed, Detail: "can't create files in " + dir, Fix: fix}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	for _, path := range []string{config.DBPath(), config.ConfigPath()} {
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Result{
+				Status: StatusFailed,
+				Detail: "can't open " + path + " for writing",
+				Fix:    fix,
+			}
+		}
+		f.Close()
+	}
+	return Result{Status: StatusOK, Detail: dir + " is writable"}
+}
+
+func checkWatchLimit() Result {
+	if runtime.GOOS != "linux" {
+		return Result{Status: StatusSkipped, Detail: "only applies to Linux"}
+	}
+	data, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return Result{Status: StatusSkipped, Detail: "can't read the inotify watch limit: " + err.Error()}
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return Result{Status: StatusSkipped, Detail: "unexpected inotify watch limit " + string(data)}
+	}
+
+	// Opening the store would create the database, doctor must not change the installation
+	if _, err := os.Stat(config.DBPath()); err != nil {
+		return Result{Status: StatusSkipped, Detail: "no edit history yet"}
+	}
+	eh, err := db.NewEditHistoryStore(config.DBPath())
+	if err != nil {
+		return Result{Status: StatusSkipped, Detail: "can't open the edit history: " + err.Error()}
+	}
+	defer eh.Close()
+	paths, err := eh.GetAssignmentFullPaths()
+	if err != nil {
+		return Result{Status: StatusSkipped, Detail: "can't list watched directories: " + err.Error()}
+	}
+	// The daemon watches every directory under a watched path
+	needed := 0
+	for _, root := range paths {
+		filepath.WalkDir(root, func(_ string, entry fs.DirEntry, err error) error {
+			if err == nil && entry.IsDir() {
+				needed++
+			}
+			return nil
+		})
+	}
+
+	detail := fmt.Sprintf("%d directories watched, limit is %d per user", needed, limit)
+	fix := "echo fs.inotify.max_user_watches=524288 | sudo tee /etc/sysctl.d/60-plaggy.conf && sudo sysctl --system"
+	if needed >= limit {
+		return Result{Status: StatusFailed, Detail: detail + ", edits in some directories are not tracked", Fix: fix}
+	}
+	if float64(needed) >= watchLimitWarningRatio*float64(limit) {
+		return Result{Status: StatusWarning, Detail: detail + ", editors and other tools share the same limit", Fix: fix}
+	}
+	return Result{Status: StatusOK, Detail: detail}
+}
+
+func checkClockSkew() Result {
+	client := &http.Client{Timeout: 10 * time.Second}
+	sent := time.Now()
+	resp, err := client.Head(api.BackendBaseURL)
+	if err != nil {
+		return Result{Status: StatusSkipped, Detail: "server can't be reached: " + err.Error()}
+	}
+	resp.Body.Close()
+	received := time.Now()
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return Result{Status: StatusSkipped, Detail: "server didn't send its time"}
+	}
+	// The Date header has second resolution, compare against the middle of the round trip
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := local.Sub(serverTime).Round(time.Second)
+	detail := fmt.Sprintf("local clock is %s off from the server", skew)
+	fix := "turn on automatic date and time in your system settings"
+	if skew.Abs() >= clockSkewFailure {
+		return Result{Status: StatusFailed, Detail: detail + ", your edits may be flagged", Fix: fix}
+	}
+	if skew.Abs() >= clockSkewWarning {
+		return Result{Status: StatusWarning, Detail: detail, Fix: fix}
+	}
+	return Result{Status: StatusOK, Detail: detail}
+}
+
+func checkToken() Result {
+	email := viper.GetString("session.email")
+	token := viper.GetString("session.token")
+	if email == "" || token == "" {
+		return Result{Status: StatusWarning, Detail: "not logged in", Fix: "plaggy login"}
+	}
+	expires, err := tokenExpiry(token)
+	if err != nil {
+		return Result{Status: StatusFailed, Detail: "stored token is unreadable", Fix: "plaggy login"}
+	}
+	if expires.IsZero() {
+		return Result{Status: StatusOK, Detail: "logged in as " + email}
+	}
+	if time.Now().After(expires) {
+		return Result{
+			Status: StatusFailed,
+			Detail: fmt.Sprintf("token of %s expired on %s", email, expires.Local().Format(time.DateTime)),
+			Fix:    "plaggy login",
+		}
+	}
+	return Result{
+		Status: StatusOK,
+		Detail: fmt.Sprintf("logged in as %s until %s", email, expires.Local().Format(time.DateTime)),
+	}
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it, the zero time means no expiry
+func tokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, err
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
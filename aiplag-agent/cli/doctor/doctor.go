@@ -0,0 +1,79 @@
+// Package doctor diagnoses the problems students most often run into with their installation
+package doctor
+
+import (
+	"fmt"
+	"io"
+)
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusWarning Status = "warning"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+// Result is what a check found and, if something is wrong, how to fix it
+type Result struct {
+	Check  string `json:"check"`
+	Status Status `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// Check inspects one part of the installation
+type Check struct {
+	Name string
+	Run  func() Result
+}
+
+// DefaultChecks are the checks plaggy doctor runs, in the order they are reported.
+// Later checks assume the earlier ones passed, so the first failure is usually the one to fix.
+func DefaultChecks() []Check {
+	return []Check{
+		{"service", checkService},
+		{"permissions", checkPermissions},
+		{"daemon port", checkDaemonPort},
+		{"watch limit", checkWatchLimit},
+		{"clock", checkClockSkew},
+		{"login", checkToken},
+	}
+}
+
+// RunChecks runs every check, a check that panics is reported as failed
+func RunChecks(checks []Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, runCheck(check))
+	}
+	return results
+}
+
+func runCheck(check Check) (result Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = Result{Status: StatusFailed, Detail: fmt.Sprintf("check crashed: %v", r)}
+		}
+		result.Check = check.Name
+	}()
+	return check.Run()
+}
+
+// PrintResults writes a human readable report
+func PrintResults(w io.Writer, results []Result) {
+	symbols := map[Status]string{
+		StatusOK:      "[ ok ]",
+		StatusWarning: "[warn]",
+		StatusFailed:  "[FAIL]",
+		StatusSkipped: "[skip]",
+	}
+	for _, r := range results {
+		fmt.Fprintf(w, "%s %-12s %s\n", symbols[r.Status], r.Check, r.Detail)
+		if r.Fix != "" && r.Status != StatusOK {
+			fmt.Fprintf(w, "       fix: %s\n", r.Fix)
+		}
+	}
+}
@@ -5,19 +5,53 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
 )
 
+// SendCommand sends a command to the daemon and returns its single byte response
 func SendCommand(cmd byte, payload string) (byte, error) {
+	resp, _, err := SendRequest(cmd, payload)
+	return resp, err
+}
+
+// SendRequest sends a command to the daemon and returns the response code together with
+// any payload that came after it
+func SendRequest(cmd byte, payload string) (byte, []byte, error) {
+	conn, err := dialAndSend(cmd, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer conn.Close()
+
+	return ReadResponse(conn)
+}
+
+// OpenStream sends a command the daemon answers with a stream of responses. The first
+// response is returned, read the rest with ReadResponse and close the connection when done.
+func OpenStream(cmd byte, payload string) (net.Conn, byte, []byte, error) {
+	conn, err := dialAndSend(cmd, payload)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	resp, respPayload, err := ReadResponse(conn)
+	if err != nil {
+		conn.Close()
+		return nil, 0, nil, err
+	}
+	return conn, resp, respPayload, nil
+}
+
+// dialAndSend connects to the daemon and writes a single length-prefixed command
+func dialAndSend(cmd byte, payload string) (net.Conn, error) {
 	address, err := config.UsedTCPAddress()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	conn, err := net.Dial("tcp", address)
 	if err != nil {
-		return 0, fmt.Errorf("connect: %w", err)
+		return nil, fmt.Errorf("connect: %w", err)
 	}
-	defer conn.Close()
 
 	// Build message
 	data := append([]byte{cmd}, []byte(payload)...)
@@ -27,23 +61,27 @@ func SendCommand(cmd byte, payload string) (byte, error) {
 
 	// Send
 	if _, err := conn.Write(buf.Bytes()); err != nil {
-		return 0, fmt.Errorf("write: %w", err)
+		conn.Close()
+		return nil, fmt.Errorf("write: %w", err)
 	}
+	return conn, nil
+}
 
-	// Read response
+// ReadResponse reads a single length-prefixed response from the daemon
+func ReadResponse(conn net.Conn) (byte, []byte, error) {
 	respHeader := make([]byte, 2)
-	if _, err := conn.Read(respHeader); err != nil {
-		return 0, fmt.Errorf("failed to read response header: %v", err)
+	if _, err := io.ReadFull(conn, respHeader); err != nil {
+		return 0, nil, fmt.Errorf("failed to read response header: %v", err)
 	}
 	respLength := binary.BigEndian.Uint16(respHeader)
-	if respLength != 1 {
-		return 0, fmt.Errorf("unexpected response length: %d", respLength)
+	if respLength < 1 {
+		return 0, nil, fmt.Errorf("unexpected response length: %d", respLength)
 	}
 
 	respPayload := make([]byte, respLength)
-	if _, err := conn.Read(respPayload); err != nil {
-		return 0, fmt.Errorf("failed to read response payload: %v", err)
+	if _, err := io.ReadFull(conn, respPayload); err != nil {
+		return 0, nil, fmt.Errorf("failed to read response payload: %v", err)
 	}
 
-	return respPayload[0], nil
+	return respPayload[0], respPayload[1:], nil
 }
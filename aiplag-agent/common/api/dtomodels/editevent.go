@@ -13,6 +13,23 @@ const (
 	APIEventModified EditEventType = "modified"
 	APIEventDeleted  EditEventType = "deleted"
 	APIEventRenamed  EditEventType = "renamed"
+	APIEventRestored EditEventType = "restored"
+)
+
+// Lifecycle events describe the daemon itself, FilePath is the assignment directory
+const (
+	APIEventDaemonStarted   EditEventType = "daemon_start"
+	APIEventDaemonStopped   EditEventType = "daemon_stop"
+	APIEventWatchAdded      EditEventType = "watch_added"
+	APIEventWatchRemoved    EditEventType = "watch_removed"
+	APIEventOverflow        EditEventType = "overflow"
+	APIEventReconcile       EditEventType = "reconcile"
+	APIEventHeartbeat       EditEventType = "heartbeat"
+	APIEventBaseline        EditEventType = "baseline"
+	APIEventVCSOperation    EditEventType = "vcs_operation"
+	APIEventBulkOperation   EditEventType = "bulk_operation"
+	APIEventTrackingPaused  EditEventType = "tracking_paused"
+	APIEventTrackingResumed EditEventType = "tracking_resumed"
 )
 
 // EditEvent is the JSON representation sent over HTTP
@@ -23,6 +40,25 @@ type EditEvent struct {
 	EventType    EditEventType `json:"event_type"`
 	Patch        string        `json:"patch,omitempty"`
 	Timestamp    time.Time     `json:"timestamp"`
+	Seq          int64         `json:"seq"`
+	WallMs       int64         `json:"wall_ms"`
+	MonoMs       int64         `json:"mono_ms"`
+	SessionID    string        `json:"session_id,omitempty"`
+	Meta         *EventMeta    `json:"meta,omitempty"`
+}
+
+// EventMeta carries optional facts about how an event was recorded
+type EventMeta struct {
+	// The patch replaces the changed block as a whole instead of listing the changed lines
+	Degraded       bool   `json:"degraded,omitempty"`
+	DegradedReason string `json:"degraded_reason,omitempty"`
+	// The file equals the starter file at its path
+	Baseline bool `json:"baseline,omitempty"`
+	// The file was changed by a git operation, described by the vcs_operation event with this ID
+	VCSOperation string `json:"vcs_operation,omitempty"`
+	VCSCommit    string `json:"vcs_commit,omitempty"`
+	// The file was changed along with many others at once, described by the bulk_operation event with this ID
+	BulkOperation string `json:"bulk_operation,omitempty"`
 }
 
 // ConvertEditEvent maps internal EditEvent to APIEditEvent
@@ -37,6 +73,44 @@ func ConvertEditEvent(e models.EditEvent) EditEvent {
 		apiType = APIEventDeleted
 	case models.EventRenamed:
 		apiType = APIEventRenamed
+	case models.EventRestored:
+		apiType = APIEventRestored
+	case models.EventDaemonStarted:
+		apiType = APIEventDaemonStarted
+	case models.EventDaemonStopped:
+		apiType = APIEventDaemonStopped
+	case models.EventWatchAdded:
+		apiType = APIEventWatchAdded
+	case models.EventWatchRemoved:
+		apiType = APIEventWatchRemoved
+	case models.EventOverflow:
+		apiType = APIEventOverflow
+	case models.EventReconcile:
+		apiType = APIEventReconcile
+	case models.EventHeartbeat:
+		apiType = APIEventHeartbeat
+	case models.EventBaseline:
+		apiType = APIEventBaseline
+	case models.EventVCSOperation:
+		apiType = APIEventVCSOperation
+	case models.EventBulkOperation:
+		apiType = APIEventBulkOperation
+	case models.EventTrackingPaused:
+		apiType = APIEventTrackingPaused
+	case models.EventTrackingResumed:
+		apiType = APIEventTrackingResumed
+	}
+
+	var meta *EventMeta
+	if !e.Meta.IsZero() {
+		meta = &EventMeta{
+			Degraded:       e.Meta.Degraded,
+			DegradedReason: e.Meta.DegradedReason,
+			Baseline:       e.Meta.Baseline,
+			VCSOperation:   e.Meta.VCSOperation,
+			VCSCommit:      e.Meta.VCSCommit,
+			BulkOperation:  e.Meta.BulkOperation,
+		}
 	}
 
 	return EditEvent{
@@ -46,6 +120,11 @@ func ConvertEditEvent(e models.EditEvent) EditEvent {
 		EventType:    apiType,
 		Patch:        e.Patch,
 		Timestamp:    e.Timestamp,
+		Seq:          e.Seq,
+		WallMs:       e.Timestamp.UnixMilli(),
+		MonoMs:       e.MonoMs,
+		SessionID:    e.SessionID,
+		Meta:         meta,
 	}
 }
 
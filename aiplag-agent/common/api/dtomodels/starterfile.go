@@ -0,0 +1,9 @@
+package dtomodels
+
+// StarterFile is a file the instructor hands out with an assignment
+type StarterFile struct {
+	// Relative to the assignment directory, slash separated
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	SHA256  string `json:"sha256"`
+}
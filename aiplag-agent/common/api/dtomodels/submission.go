@@ -3,4 +3,17 @@ package dtomodels
 type Submission struct {
 	AssignmentId uint        `json:"assignmentID"`
 	Edits        []EditEvent `json:"edits"`
+	// The submitted files as they are on disk, checked by the backend against the edits
+	Snapshot []SnapshotFile `json:"snapshot,omitempty"`
+}
+
+// SnapshotFile is a submitted file as it was on disk when it was submitted
+type SnapshotFile struct {
+	// Relative to the assignment directory, like the paths of the edits
+	Path string `json:"path"`
+	// Hash of the content with secrets redacted, the way the daemon diffs it
+	SHA256  string `json:"sha256"`
+	Content string `json:"content,omitempty"`
+	// Why the content was left out, only the hash is sent then
+	Omitted string `json:"omitted,omitempty"`
 }
@@ -3,6 +3,7 @@ package api
 import (
 	"aiplag-agent/cli/models"
 	"aiplag-agent/common/api/dtomodels"
+	"aiplag-agent/common/buildinfo"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -12,9 +13,11 @@ import (
 
 const (
 	//BackendBaseURL = "http://localhost:8080"
-	BackendBaseURL     = "https://plaggy.xyz"
-	SubmissionEndpoint = BackendBaseURL + "/api/v1/submit"
-	AssignmentEndpoint = BackendBaseURL + "/api/v1/assignments"
+	BackendBaseURL       = "https://plaggy.xyz"
+	SubmissionEndpoint   = BackendBaseURL + "/api/v1/submit"
+	AssignmentEndpoint   = BackendBaseURL + "/api/v1/assignments"
+	StarterFilesEndpoint = BackendBaseURL + "/api/v1/starter"
+	DevicesEndpoint      = BackendBaseURL + "/api/v1/devices"
 )
 
 func FetchAssignments(studentEmail string, token string) ([]models.Assignment, error) {
@@ -24,6 +27,7 @@ func FetchAssignments(studentEmail string, token string) ([]models.Assignment, e
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(AgentVersionHeader, buildinfo.Version)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"aiplag-agent/common/api/dtomodels"
+	"aiplag-agent/common/buildinfo"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// FetchStarterFiles returns the starter files of an assignment, an assignment without any returns none
+func FetchStarterFiles(assignmentID uint, token string) ([]dtomodels.StarterFile, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s?assignment=%d", StarterFilesEndpoint, assignmentID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(AgentVersionHeader, buildinfo.Version)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, ServerError
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUpgradeRequired {
+		return nil, ErrAgentOutdated
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, ServerError
+	}
+
+	var files []dtomodels.StarterFile
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal returned starter files: %w", err)
+	}
+	return files, nil
+}
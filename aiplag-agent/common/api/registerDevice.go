@@ -0,0 +1,58 @@
+package api
+
+import (
+	"aiplag-agent/common/buildinfo"
+	"aiplag-agent/common/evidence"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+)
+
+type deviceKeyRequest struct {
+	DeviceID  string `json:"deviceId"`
+	PublicKey string `json:"publicKey"`
+	Hostname  string `json:"hostname"`
+	OS        string `json:"os"`
+	Proof     string `json:"proof"`
+}
+
+// RegisterDevice registers the device key with the student's account. Instructors only import
+// evidence bundles signed by a registered key.
+func RegisterDevice(key *evidence.DeviceKey, studentEmail string, token string) error {
+	hostname, _ := os.Hostname()
+	body, err := json.Marshal(deviceKeyRequest{
+		DeviceID:  key.ID(),
+		PublicKey: key.PublicKey(),
+		Hostname:  hostname,
+		OS:        runtime.GOOS + "/" + runtime.GOARCH,
+		Proof:     key.Proof(studentEmail),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode device key: %w", err)
+	}
+	req, err := http.NewRequest("POST", DevicesEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(AgentVersionHeader, buildinfo.Version)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ServerError
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUpgradeRequired {
+		return ErrAgentOutdated
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ServerError
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"aiplag-agent/common/api/dtomodels"
+	"aiplag-agent/common/redact"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSnapshotFileBytes is the largest file sent with its content, the same limit the daemon
+// diffs files line by line up to
+const maxSnapshotFileBytes = 2 << 20
+
+// BuildSnapshot reads every file of the assignment directory the daemon tracks, with secrets
+// redacted the same way as in the edits. Binary and large files are sent as hashes only.
+func BuildSnapshot(root string) ([]dtomodels.SnapshotFile, error) {
+	var files []dtomodels.SnapshotFile
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// Files that vanish while walking simply aren't submitted
+			return nil
+		}
+		if entry.IsDir() {
+			// Git internals aren't part of the assignment, the daemon skips them too
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		relativePath, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+
+		redacted := redact.Default.Redact(path, string(content))
+		sum := sha256.Sum256([]byte(redacted))
+		file := dtomodels.SnapshotFile{
+			Path:   relativePath,
+			SHA256: hex.EncodeToString(sum[:]),
+		}
+		switch {
+		case len(content) > maxSnapshotFileBytes:
+			file.Omitted = "larger than 2 MiB"
+		case !utf8.Valid(content) || strings.ContainsRune(redacted, 0):
+			file.Omitted = "binary file"
+		default:
+			file.Content = redacted
+		}
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
@@ -2,7 +2,9 @@ package api
 
 import (
 	"aiplag-agent/common/api/dtomodels"
+	"aiplag-agent/common/buildinfo"
 	"aiplag-agent/common/db"
+	"aiplag-agent/common/redact"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -13,6 +15,12 @@ import (
 
 var ServerError = errors.New("server is offline")
 
+// ErrAgentOutdated is returned when the backend refuses this version of the agent
+var ErrAgentOutdated = errors.New("this version of plaggy is no longer accepted, update it")
+
+// AgentVersionHeader tells the backend which version of the agent sent a request
+const AgentVersionHeader = "X-Plaggy-Agent-Version"
+
 // SubmitEdits posts all edit events for a given assignment to a specified URL.
 // The token currently includes the email encoded inside
 func SubmitEdits(assignmentID uint, eh *db.EditHistoryStore, path string, token string) error {
@@ -30,14 +38,29 @@ func SubmitEdits(assignmentID uint, eh *db.EditHistoryStore, path string, token
 		Edits:        editEvents,
 	}
 
-	// Convert paths to relative filepaths to hide the students full path the the homework direcotry
+	// Without the daemon's key the snapshot's placeholders wouldn't match the recorded history
+	if err := redact.Default.LoadKey(); err != nil {
+		return fmt.Errorf("can't redact secrets like the daemon: %w", err)
+	}
+
+	// Redact the patches again in case they were recorded before a secret pattern was added,
+	// then convert paths to relative filepaths to hide the students full path the the homework direcotry
 	for i := range submission.Edits {
+		if !events[i].EventType.IsLifecycle() {
+			submission.Edits[i].Patch = redact.Default.RedactPatch(events[i].FilePath, submission.Edits[i].Patch)
+		}
 		relativeFilepath, err := filepath.Rel(path, submission.Edits[i].FilePath)
 		if err == nil {
 			submission.Edits[i].FilePath = relativeFilepath
 		}
 	}
 
+	// The files as they are now, so the backend can tell whether the edits explain them
+	submission.Snapshot, err = BuildSnapshot(path)
+	if err != nil {
+		return fmt.Errorf("failed to read the files to submit: %w", err)
+	}
+
 	data, err := json.Marshal(submission)
 	if err != nil {
 		return fmt.Errorf("failed to marshal events: %w", err)
@@ -51,6 +74,7 @@ func SubmitEdits(assignmentID uint, eh *db.EditHistoryStore, path string, token
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(AgentVersionHeader, buildinfo.Version)
 
 	// Send the request
 	client := &http.Client{}
@@ -60,6 +84,9 @@ func SubmitEdits(assignmentID uint, eh *db.EditHistoryStore, path string, token
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUpgradeRequired {
+		return ErrAgentOutdated
+	}
 	if resp.StatusCode != http.StatusOK {
 		return ServerError
 	}
@@ -0,0 +1,61 @@
+// Package buildinfo describes the running build of the agent
+package buildinfo
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Version of the agent, release builds set it with -ldflags "-X aiplag-agent/common/buildinfo.Version=..."
+var Version = "0.1.0"
+
+// UpdatePublicKey is the base64 Ed25519 key release manifests are signed with. Release builds
+// set it the same way as Version, without it the daemon doesn't update itself unless a key
+// is configured.
+var UpdatePublicKey = ""
+
+// CompareVersions compares two dotted versions like 1.4.2, an optional leading v and any
+// pre-release suffix after a dash are allowed. It returns -1, 0 or 1 like strings.Compare.
+// A pre-release sorts before the release it precedes.
+func CompareVersions(a string, b string) int {
+	aCore, aPre := splitVersion(a)
+	bCore, bPre := splitVersion(b)
+	for i := 0; i < max(len(aCore), len(bCore)); i++ {
+		var x, y int
+		if i < len(aCore) {
+			x = aCore[i]
+		}
+		if i < len(bCore) {
+			y = bCore[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return strings.Compare(aPre, bPre)
+}
+
+func splitVersion(v string) ([]int, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	core, pre, _ := strings.Cut(v, "-")
+	var parts []int
+	for _, part := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			n = 0
+		}
+		parts = append(parts, n)
+	}
+	return parts, pre
+}
@@ -71,3 +71,34 @@ func UserBinDir() string {
 	// Assume Unix
 	return "/usr/local/bin"
 }
+
+// CLIExecutablePath is where the CLI is installed, on the PATH of every user
+func CLIExecutablePath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(UserBinDir(), "plaggy.exe")
+	}
+	return filepath.Join(UserBinDir(), "plaggy")
+}
+
+// UpdateStatePath is where the daemon keeps track of an update until the new version is healthy
+func UpdateStatePath() string {
+	path := filepath.Join(AppDataDir(), "update.json")
+	return path
+}
+
+// UpdatesDir holds the downloaded binaries of updates
+func UpdatesDir() string {
+	path := filepath.Join(AppDataDir(), "updates")
+	return path
+}
+
+func DeviceKeyPath() string {
+	path := filepath.Join(AppDataDir(), "device.key")
+	return path
+}
+
+// RedactionKeyPath holds the key the placeholders of redacted secrets are derived with
+func RedactionKeyPath() string {
+	path := filepath.Join(AppDataDir(), "redaction.key")
+	return path
+}
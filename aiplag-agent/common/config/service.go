@@ -0,0 +1,31 @@
+package config
+
+import "github.com/kardianos/service"
+
+// ServiceConfig describes the daemon service, the daemon uses it to install itself and the
+// CLI to look up its status
+func ServiceConfig() *service.Config {
+	options := service.KeyValue{
+		"StartType": "automatic",
+		"RunAtLoad": true,
+	}
+	for key, value := range platformServiceOptions() {
+		options[key] = value
+	}
+	return &service.Config{
+		Name:        "com.plaggy.daemon",
+		DisplayName: "Plaggy Daemon",
+		Description: "Daemon for monitoring filesystem changes and assignments.",
+		Executable:  DaemonExecutablePath(),
+		Option:      options,
+	}
+}
+
+// LegacyServiceConfig describes the service older versions registered the daemon as, the
+// installer removes it so two daemons don't watch the same directories
+func LegacyServiceConfig() *service.Config {
+	return &service.Config{
+		Name:        "PlaggyDaemon",
+		DisplayName: "Plaggy Daemon",
+	}
+}
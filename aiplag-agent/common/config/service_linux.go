@@ -0,0 +1,44 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/kardianos/service"
+)
+
+// systemdUnit runs the daemon with only the access it needs: it reads the watched directories
+// and writes nothing but the app data directory and, when updating, the CLI binary. A daemon
+// that installed an update exits with a failure to be restarted.
+const systemdUnit = `[Unit]
+Description={{.Description}}
+ConditionFileIsExecutable={{.Path|cmdEscape}}
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
+Restart=on-failure
+RestartSec=5
+StartLimitIntervalSec=60
+StartLimitBurst=10
+NoNewPrivileges=true
+ProtectSystem=strict
+ReadWritePaths=@APPDATA@ @USERBIN@
+PrivateTmp=true
+PrivateDevices=true
+ProtectKernelTunables=true
+ProtectKernelModules=true
+ProtectControlGroups=true
+UMask=0007
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// platformServiceOptions replaces the default systemd unit, installing the service also
+// enables it so the daemon starts on boot
+func platformServiceOptions() service.KeyValue {
+	return service.KeyValue{
+		"SystemdScript": strings.NewReplacer("@APPDATA@", AppDataDir(), "@USERBIN@", UserBinDir()).Replace(systemdUnit),
+	}
+}
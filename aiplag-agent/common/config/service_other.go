@@ -0,0 +1,19 @@
+//go:build !linux
+
+package config
+
+import "github.com/kardianos/service"
+
+// platformServiceOptions makes the service manager restart the daemon when it exits with a
+// failure, which is how it restarts after installing an update. Windows is the only one of
+// these where StartType: "automatic" starts the daemon on boot without further commands,
+// macOS relies on RunAtLoad.
+func platformServiceOptions() service.KeyValue {
+	return service.KeyValue{
+		// Windows
+		"OnFailure":              "restart",
+		"OnFailureDelayDuration": "5s",
+		// macOS
+		"KeepAlive": true,
+	}
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"aiplag-agent/common/buildinfo"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// DaemonSettings holds the tunable behaviour of the daemon.
+// Values are read from the "daemon" section of the config file and fall back to defaults.
+type DaemonSettings struct {
+	// How often the daemon records that it is still running
+	HeartbeatInterval time.Duration
+	// Number of goroutines handling filesystem events and the queue length of each
+	Workers   int
+	QueueSize int
+	// Limits of a line level diff, files over them are stored with a coarse diff
+	DiffTimeout       time.Duration
+	DiffMaxBytes      int
+	DiffMaxLineLength int
+	// Where release manifests are fetched from, an http(s) or file URL or a path. Empty turns
+	// updates off.
+	UpdateManifestURL string
+	// Base64 Ed25519 key the manifest must be signed with, defaults to the key built in
+	UpdatePublicKey string
+	UpdateInterval  time.Duration
+	// Changes to at least BulkMinFiles files within BulkWindow of each other are grouped into one
+	// bulk operation, such as extracting an archive or running a formatter
+	BulkMinFiles int
+	BulkWindow   time.Duration
+}
+
+// LoadDaemonSettings reads the daemon settings from ConfigPath(). A missing or unreadable
+// config file is not an error, the defaults are used instead.
+func LoadDaemonSettings() DaemonSettings {
+	v := viper.New()
+	v.SetConfigFile(ConfigPath())
+	v.SetConfigType("yaml")
+	v.SetDefault("daemon.heartbeatInterval", 5*time.Minute)
+	v.SetDefault("daemon.workers", 4)
+	v.SetDefault("daemon.queueSize", 256)
+	v.SetDefault("daemon.diff.timeout", 500*time.Millisecond)
+	v.SetDefault("daemon.diff.maxBytes", 2<<20)
+	v.SetDefault("daemon.diff.maxLineLength", 2000)
+	v.SetDefault("daemon.update.manifestURL", "")
+	v.SetDefault("daemon.update.publicKey", buildinfo.UpdatePublicKey)
+	v.SetDefault("daemon.update.interval", 6*time.Hour)
+	v.SetDefault("daemon.bulk.minFiles", 10)
+	v.SetDefault("daemon.bulk.window", 500*time.Millisecond)
+	_ = v.ReadInConfig()
+
+	settings := DaemonSettings{
+		HeartbeatInterval: v.GetDuration("daemon.heartbeatInterval"),
+		Workers:           v.GetInt("daemon.workers"),
+		QueueSize:         v.GetInt("daemon.queueSize"),
+		DiffTimeout:       v.GetDuration("daemon.diff.timeout"),
+		DiffMaxBytes:      v.GetInt("daemon.diff.maxBytes"),
+		DiffMaxLineLength: v.GetInt("daemon.diff.maxLineLength"),
+		UpdateManifestURL: v.GetString("daemon.update.manifestURL"),
+		UpdatePublicKey:   v.GetString("daemon.update.publicKey"),
+		UpdateInterval:    v.GetDuration("daemon.update.interval"),
+		BulkMinFiles:      v.GetInt("daemon.bulk.minFiles"),
+		BulkWindow:        v.GetDuration("daemon.bulk.window"),
+	}
+	if settings.HeartbeatInterval <= 0 {
+		settings.HeartbeatInterval = 5 * time.Minute
+	}
+	if settings.Workers <= 0 {
+		settings.Workers = 4
+	}
+	if settings.QueueSize <= 0 {
+		settings.QueueSize = 256
+	}
+	if settings.UpdateInterval <= 0 {
+		settings.UpdateInterval = 6 * time.Hour
+	}
+	if settings.BulkMinFiles < 2 {
+		settings.BulkMinFiles = 10
+	}
+	if settings.BulkWindow <= 0 {
+		settings.BulkWindow = 500 * time.Millisecond
+	}
+	return settings
+}
@@ -2,11 +2,16 @@
 package db
 
 import (
+	"aiplag-agent/common/eventclock"
+	"aiplag-agent/common/evidence"
 	"aiplag-agent/daemon/models"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -17,6 +22,10 @@ type EditHistoryStore struct {
 	db                    *sql.DB
 	insertEventStmt       *sql.Stmt
 	getEventsByAssignStmt *sql.Stmt
+	// Serializes inserts so that sequence numbers are handed out without gaps or duplicates
+	insertMu sync.Mutex
+	// Receivers of changes, see Subscribe
+	subscribers subscribers
 }
 
 // NewEditHistoryStore opens or creates a database at the given path and
@@ -34,6 +43,9 @@ func NewEditHistoryStore(dbPath string) (*EditHistoryStore, error) {
 	if err := eh.prepareStatements(); err != nil {
 		return nil, fmt.Errorf("failed to prepare statements: %w", err)
 	}
+	if err := eh.backfillChain(); err != nil {
+		return nil, fmt.Errorf("failed to backfill hash chain: %w", err)
+	}
 
 	return eh, nil
 }
@@ -86,6 +98,183 @@ func (eh *EditHistoryStore) GetAssignmentFullPaths() ([]string, error) {
 	return assignments, nil
 }
 
+// GetAssignments returns every watched directory together with its binding
+func (eh *EditHistoryStore) GetAssignments() ([]models.WatchedAssignment, error) {
+	rows, err := eh.db.Query(`SELECT id, path, remote_id, title, due_ms, submitted_ms FROM assignments ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query assignments: %w", err)
+	}
+	defer rows.Close()
+
+	var assignments []models.WatchedAssignment
+	for rows.Next() {
+		var a models.WatchedAssignment
+		var remoteID, dueMs, submittedMs sql.NullInt64
+		var title sql.NullString
+		if err := rows.Scan(&a.ID, &a.Path, &remoteID, &title, &dueMs, &submittedMs); err != nil {
+			return nil, fmt.Errorf("failed to scan assignment: %w", err)
+		}
+		a.RemoteID = uint(remoteID.Int64)
+		a.Title = title.String
+		if dueMs.Valid {
+			a.DueDate = time.UnixMilli(dueMs.Int64).UTC()
+		}
+		if submittedMs.Valid {
+			a.SubmittedAt = time.UnixMilli(submittedMs.Int64).UTC()
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+// BindAssignment stores the backend assignment, its deadline and submission time for the
+// watched directory at binding.Path
+func (eh *EditHistoryStore) BindAssignment(binding models.WatchedAssignment) error {
+	nullableMs := func(t time.Time) sql.NullInt64 {
+		return sql.NullInt64{Int64: t.UnixMilli(), Valid: !t.IsZero()}
+	}
+	var id int
+	err := eh.db.QueryRow(`
+		UPDATE assignments SET remote_id = ?, title = ?, due_ms = ?, submitted_ms = ?
+		WHERE path = ?
+		RETURNING id
+	`, binding.RemoteID, binding.Title, nullableMs(binding.DueDate), nullableMs(binding.SubmittedAt), binding.Path).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("not a watched directory: %s", binding.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to bind assignment: %w", err)
+	}
+	binding.ID = id
+	eh.publish(StoreChange{Assignment: &binding})
+	return nil
+}
+
+// GetFileEventCounts returns the number of recorded file events per file path
+func (eh *EditHistoryStore) GetFileEventCounts() (map[string]int, error) {
+	rows, err := eh.db.Query(`
+		SELECT file_path, COUNT(*) FROM edit_history
+		WHERE event_type IN (?, ?, ?, ?, ?)
+		GROUP BY file_path
+	`, models.EventAdded, models.EventModified, models.EventDeleted, models.EventRenamed, models.EventRestored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count file events: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var path string
+		var count int
+		if err := rows.Scan(&path, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan file event count: %w", err)
+		}
+		counts[path] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetBaselines returns the starter files of every watched directory that has any, by
+// directory. Only the latest baseline event of a directory counts.
+func (eh *EditHistoryStore) GetBaselines() (map[string][]models.BaselineFile, error) {
+	rows, err := eh.db.Query(`
+		SELECT a.path, e.patch
+		FROM edit_history AS e JOIN assignments AS a ON a.id = e.assignment_id
+		WHERE e.event_type = ?
+		ORDER BY e.assignment_id, e.seq
+	`, models.EventBaseline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query baselines: %w", err)
+	}
+	defer rows.Close()
+
+	baselines := make(map[string][]models.BaselineFile)
+	for rows.Next() {
+		var root string
+		var patch sql.NullString
+		if err := rows.Scan(&root, &patch); err != nil {
+			return nil, fmt.Errorf("failed to scan baseline: %w", err)
+		}
+		var files []models.BaselineFile
+		if err := json.Unmarshal([]byte(patch.String), &files); err != nil {
+			log.Printf("GetBaselines: ignoring unreadable baseline of %s: %v", root, err)
+			continue
+		}
+		baselines[root] = files
+	}
+	return baselines, rows.Err()
+}
+
+// GetPauses returns the pauses of the watched directories that haven't been resumed, by directory
+func (eh *EditHistoryStore) GetPauses() (map[string]models.TrackingPause, error) {
+	rows, err := eh.db.Query(`
+		SELECT a.path, e.event_type, e.patch
+		FROM edit_history AS e JOIN assignments AS a ON a.id = e.assignment_id
+		WHERE e.event_type IN (?, ?)
+		ORDER BY e.assignment_id, e.seq
+	`, models.EventTrackingPaused, models.EventTrackingResumed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pauses: %w", err)
+	}
+	defer rows.Close()
+
+	pauses := make(map[string]models.TrackingPause)
+	for rows.Next() {
+		var root, eventType string
+		var patch sql.NullString
+		if err := rows.Scan(&root, &eventType, &patch); err != nil {
+			return nil, fmt.Errorf("failed to scan pause: %w", err)
+		}
+		if models.EditEventType(eventType) == models.EventTrackingResumed {
+			delete(pauses, root)
+			continue
+		}
+		var pause models.TrackingPause
+		if err := json.Unmarshal([]byte(patch.String), &pause); err != nil {
+			log.Printf("GetPauses: ignoring unreadable pause of %s: %v", root, err)
+			continue
+		}
+		pauses[root] = pause
+	}
+	return pauses, rows.Err()
+}
+
+// TagBulkOperation marks the file events recorded for paths since the given time as part of the
+// bulk operation with operationID, leaving out events a git operation made. It returns how many
+// events were marked in each watched directory.
+func (eh *EditHistoryStore) TagBulkOperation(operationID string, paths []string, since time.Time) (map[string]int, error) {
+	tx, err := eh.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	tagged := make(map[string]int)
+	for _, path := range paths {
+		var root string
+		err := tx.QueryRow(`SELECT path FROM assignments WHERE ? LIKE path || '%' ORDER BY LENGTH(path) DESC LIMIT 1`, path).Scan(&root)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find assignment for path %q: %w", path, err)
+		}
+		result, err := tx.Exec(`
+			UPDATE edit_history
+			SET meta = json_set(COALESCE(meta, '{}'), '$.bulkOperation', ?)
+			WHERE file_path = ? AND wall_ms >= ? AND event_type IN (?, ?, ?, ?)
+				AND json_extract(COALESCE(meta, '{}'), '$.vcsOperation') IS NULL
+		`, operationID, path, since.UnixMilli(), models.EventAdded, models.EventModified, models.EventDeleted, models.EventRenamed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to tag events of %q: %w", path, err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			tagged[root] += int(n)
+		}
+	}
+	return tagged, tx.Commit()
+}
+
 // GetAssignmentIDByFullPath returns the assignment ID whose path is a prefix of fullpath
 func (eh *EditHistoryStore) GetAssignmentIDByFullPath(fullpath string) (int, error) {
 	var id int
@@ -106,12 +295,169 @@ func (eh *EditHistoryStore) GetAssignmentIDByFullPath(fullpath string) (int, err
 
 // AddEvent records a new edit event in the database.
 func (eh *EditHistoryStore) AddEvent(filePath string, eventType models.EditEventType, patch string) error {
+	return eh.AddEventWithMeta(filePath, eventType, patch, models.EventMeta{})
+}
+
+// AddEventWithMeta records a new edit event together with its meta.
+func (eh *EditHistoryStore) AddEventWithMeta(filePath string, eventType models.EditEventType, patch string, meta models.EventMeta) error {
 	assignmentID, err := eh.GetAssignmentIDByFullPath(filePath)
 	if err != nil {
 		return fmt.Errorf("couldnt add event because of: %w", err)
 	}
-	_, err = eh.insertEventStmt.Exec(assignmentID, filePath, string(eventType), patch)
-	return err
+	return eh.insertEvent(assignmentID, filePath, eventType, patch, meta)
+}
+
+// AddAssignmentEvent records a lifecycle event for the assignment watched at assignmentPath.
+// The detail text is stored in place of the patch.
+func (eh *EditHistoryStore) AddAssignmentEvent(assignmentPath string, eventType models.EditEventType, detail string) error {
+	var assignmentID int
+	err := eh.db.QueryRow(`SELECT id FROM assignments WHERE path = ?`, assignmentPath).Scan(&assignmentID)
+	if err != nil {
+		return fmt.Errorf("couldnt add %s event for %q: %w", eventType, assignmentPath, err)
+	}
+	return eh.insertEvent(assignmentID, assignmentPath, eventType, detail, models.EventMeta{})
+}
+
+// insertEvent stores an event with the next sequence number of its assignment and the current clock reading
+func (eh *EditHistoryStore) insertEvent(assignmentID int, filePath string, eventType models.EditEventType, patch string, meta models.EventMeta) error {
+	var metaJSON sql.NullString
+	if !meta.IsZero() {
+		encoded, err := json.Marshal(meta)
+		if err != nil {
+			return fmt.Errorf("failed to encode event meta: %w", err)
+		}
+		metaJSON = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	eh.insertMu.Lock()
+	defer eh.insertMu.Unlock()
+
+	var lastSeq int64
+	var lastHash sql.NullString
+	err := eh.db.QueryRow(`SELECT seq, chain_hash FROM edit_history WHERE assignment_id = ? ORDER BY seq DESC LIMIT 1`, assignmentID).
+		Scan(&lastSeq, &lastHash)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get next sequence number: %w", err)
+	}
+	var root string
+	if err := eh.db.QueryRow(`SELECT path FROM assignments WHERE id = ?`, assignmentID).Scan(&root); err != nil {
+		return fmt.Errorf("failed to get assignment path: %w", err)
+	}
+
+	reading := eventclock.Now()
+	seq := lastSeq + 1
+	chainHash := evidence.ChainHash(lastHash.String, evidence.ChainedEvent{
+		Seq:       seq,
+		FilePath:  chainPath(root, filePath),
+		EventType: string(eventType),
+		Patch:     patch,
+		WallMs:    reading.WallMs,
+		MonoMs:    reading.MonoMs,
+		SessionID: reading.SessionID,
+		Degraded:  meta.Degraded,
+	})
+	result, err := eh.insertEventStmt.Exec(assignmentID, filePath, string(eventType), patch, seq, reading.WallMs, reading.MonoMs, reading.SessionID, metaJSON, chainHash)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	eh.publish(StoreChange{Event: &models.EditEvent{
+		ID:           int(id),
+		AssignmentID: assignmentID,
+		FilePath:     filePath,
+		EventType:    eventType,
+		Timestamp:    time.UnixMilli(reading.WallMs).UTC(),
+		Seq:          seq,
+		MonoMs:       reading.MonoMs,
+		SessionID:    reading.SessionID,
+		Meta:         meta,
+	}})
+	return nil
+}
+
+// chainPath returns the path of an event relative to its assignment as used in the hash chain
+func chainPath(root string, filePath string) string {
+	relative, err := filepath.Rel(root, filePath)
+	if err != nil {
+		relative = filePath
+	}
+	return evidence.ChainPath(relative)
+}
+
+// GetChainHead returns the chain hash of the last event of the assignment, see evidence.ChainHash
+func (eh *EditHistoryStore) GetChainHead(assignmentID int) (string, error) {
+	var head sql.NullString
+	err := eh.db.QueryRow(`SELECT chain_hash FROM edit_history WHERE assignment_id = ? ORDER BY seq DESC LIMIT 1`, assignmentID).Scan(&head)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get chain head: %w", err)
+	}
+	return head.String, nil
+}
+
+// backfillChain computes the hash chain of assignments recorded before events were chained
+func (eh *EditHistoryStore) backfillChain() error {
+	rows, err := eh.db.Query(`SELECT DISTINCT assignment_id FROM edit_history WHERE chain_hash IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to find unchained events: %w", err)
+	}
+	var assignmentIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		assignmentIDs = append(assignmentIDs, id)
+	}
+	rows.Close()
+
+	for _, assignmentID := range assignmentIDs {
+		var root string
+		if err := eh.db.QueryRow(`SELECT path FROM assignments WHERE id = ?`, assignmentID).Scan(&root); err != nil {
+			// Events of assignments that are no longer watched can't be submitted anyway
+			continue
+		}
+		events, err := eh.GetEventsByAssignment(assignmentID)
+		if err != nil {
+			return err
+		}
+		prev := ""
+		for _, event := range events {
+			prev = evidence.ChainHash(prev, evidence.ChainedEvent{
+				Seq:       event.Seq,
+				FilePath:  chainPath(root, event.FilePath),
+				EventType: string(event.EventType),
+				Patch:     event.Patch,
+				WallMs:    event.Timestamp.UnixMilli(),
+				MonoMs:    event.MonoMs,
+				SessionID: event.SessionID,
+				Degraded:  event.Meta.Degraded,
+			})
+			if _, err := eh.db.Exec(`UPDATE edit_history SET chain_hash = ? WHERE id = ?`, prev, event.ID); err != nil {
+				return fmt.Errorf("failed to store chain hash: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// AddLifecycleEvent records the same lifecycle event for every watched assignment.
+// It keeps going when a single assignment fails and returns the last error seen.
+func (eh *EditHistoryStore) AddLifecycleEvent(eventType models.EditEventType, detail string) error {
+	assignmentPaths, err := eh.GetAssignmentFullPaths()
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, path := range assignmentPaths {
+		if err := eh.AddAssignmentEvent(path, eventType, detail); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
 }
 
 // GetEventsByAssignment returns all edit events associated with a given assignment ID.
@@ -126,8 +472,10 @@ func (eh *EditHistoryStore) GetEventsByAssignment(assignmentID int) ([]models.Ed
 	for rows.Next() {
 		var id, assignmentID int
 		var filePath, eventTypeStr, patch, timestamp string
+		var seq, wallMs, monoMs sql.NullInt64
+		var sessionID, meta sql.NullString
 
-		if err := rows.Scan(&id, &assignmentID, &filePath, &eventTypeStr, &patch, &timestamp); err != nil {
+		if err := rows.Scan(&id, &assignmentID, &filePath, &eventTypeStr, &patch, &timestamp, &seq, &wallMs, &monoMs, &sessionID, &meta); err != nil {
 			log.Printf("GetEventsByAssignment: failed to scan row: %v", err)
 			continue
 		}
@@ -143,11 +491,23 @@ func (eh *EditHistoryStore) GetEventsByAssignment(assignmentID int) ([]models.Ed
 			Patch:        patch,
 			FilePath:     filePath,
 			EventType:    eventType,
+			Seq:          seq.Int64,
+			MonoMs:       monoMs.Int64,
+			SessionID:    sessionID.String,
 		}
-		// time.TFC3339 is the time format that sql uses
-		event.Timestamp, err = time.Parse(time.RFC3339, timestamp)
-		if err != nil {
-			log.Fatalf("GetEventsByAssignment: Invalid time conversion: %v", timestamp)
+		if meta.Valid {
+			if err := json.Unmarshal([]byte(meta.String), &event.Meta); err != nil {
+				log.Printf("GetEventsByAssignment: ignoring unreadable meta of event %d: %v", id, err)
+			}
+		}
+		if wallMs.Valid {
+			event.Timestamp = time.UnixMilli(wallMs.Int64).UTC()
+		} else {
+			// time.TFC3339 is the time format that sql uses
+			event.Timestamp, err = time.Parse(time.RFC3339, timestamp)
+			if err != nil {
+				log.Fatalf("GetEventsByAssignment: Invalid time conversion: %v", timestamp)
+			}
 		}
 		events = append(events, event)
 	}
@@ -155,6 +515,58 @@ func (eh *EditHistoryStore) GetEventsByAssignment(assignmentID int) ([]models.Ed
 	return events, rows.Err()
 }
 
+// EditHistoryStats summarises the stored history for diagnostics without exposing its content
+type EditHistoryStats struct {
+	Assignments        int            `json:"assignments"`
+	EventsByAssignment map[int]int    `json:"eventsByAssignment"`
+	EventsByType       map[string]int `json:"eventsByType"`
+	FirstEventMs       int64          `json:"firstEventMs"`
+	LastEventMs        int64          `json:"lastEventMs"`
+}
+
+// Stats counts the stored assignments and events
+func (eh *EditHistoryStore) Stats() (EditHistoryStats, error) {
+	stats := EditHistoryStats{
+		EventsByAssignment: make(map[int]int),
+		EventsByType:       make(map[string]int),
+	}
+	if err := eh.db.QueryRow(`SELECT COUNT(*) FROM assignments`).Scan(&stats.Assignments); err != nil {
+		return stats, fmt.Errorf("failed to count assignments: %w", err)
+	}
+	var first, last sql.NullInt64
+	if err := eh.db.QueryRow(`SELECT MIN(wall_ms), MAX(wall_ms) FROM edit_history`).Scan(&first, &last); err != nil {
+		return stats, fmt.Errorf("failed to get event time range: %w", err)
+	}
+	stats.FirstEventMs, stats.LastEventMs = first.Int64, last.Int64
+
+	counts := []struct {
+		query string
+		add   func(key string, id int, count int)
+	}{
+		{`SELECT '', assignment_id, COUNT(*) FROM edit_history GROUP BY assignment_id`,
+			func(_ string, id int, count int) { stats.EventsByAssignment[id] = count }},
+		{`SELECT event_type, 0, COUNT(*) FROM edit_history GROUP BY event_type`,
+			func(key string, _ int, count int) { stats.EventsByType[key] = count }},
+	}
+	for _, c := range counts {
+		rows, err := eh.db.Query(c.query)
+		if err != nil {
+			return stats, fmt.Errorf("failed to count events: %w", err)
+		}
+		for rows.Next() {
+			var key string
+			var id, count int
+			if err := rows.Scan(&key, &id, &count); err != nil {
+				rows.Close()
+				return stats, fmt.Errorf("failed to scan event count: %w", err)
+			}
+			c.add(key, id, count)
+		}
+		rows.Close()
+	}
+	return stats, nil
+}
+
 // DeleteEditsByFullPath deletes all stored edits for a given assignment path.
 // Returns an error if something goes wrong.
 func (eh *EditHistoryStore) DeleteEditsByFullPath(fullpath string) error {
@@ -198,25 +610,63 @@ func (eh *EditHistoryStore) initSchema() error {
     path TEXT UNIQUE NOT NULL
 	);
 	`
-	_, err := eh.db.Exec(schema)
+	if _, err := eh.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Columns added after the first release, existing rows get their values backfilled
+	// from the row order and the second resolution timestamp
+	columns := []struct{ name, definition string }{
+		{"seq", "INTEGER"},
+		{"wall_ms", "INTEGER"},
+		{"mono_ms", "INTEGER"},
+		{"session_id", "TEXT"},
+		{"meta", "TEXT"},
+		{"chain_hash", "TEXT"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(eh.db, "edit_history", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+	// Binding of a watched directory to a backend assignment, times are unix milliseconds
+	assignmentColumns := []struct{ name, definition string }{
+		{"remote_id", "INTEGER"},
+		{"title", "TEXT"},
+		{"due_ms", "INTEGER"},
+		{"submitted_ms", "INTEGER"},
+	}
+	for _, c := range assignmentColumns {
+		if err := addColumnIfMissing(eh.db, "assignments", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+	_, err := eh.db.Exec(`
+	UPDATE edit_history SET seq = (
+		SELECT COUNT(*) FROM edit_history AS earlier
+		WHERE earlier.assignment_id = edit_history.assignment_id AND earlier.id <= edit_history.id
+	) WHERE seq IS NULL;
+	UPDATE edit_history SET wall_ms = CAST(strftime('%s', timestamp) AS INTEGER) * 1000 WHERE wall_ms IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_assignment_seq ON edit_history(assignment_id, seq);
+	`)
 	return err
 }
 
 func (eh *EditHistoryStore) prepareStatements() error {
 	var err error
 	eh.insertEventStmt, err = eh.db.Prepare(`
-		INSERT INTO edit_history (assignment_id, file_path, event_type, patch, timestamp)
-		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		INSERT INTO edit_history (assignment_id, file_path, event_type, patch, seq, wall_ms, mono_ms, session_id, meta, chain_hash, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 	`)
 	if err != nil {
 		return fmt.Errorf("prepare insertEventStmt: %w", err)
 	}
 
 	eh.getEventsByAssignStmt, err = eh.db.Prepare(`
-		SELECT id, assignment_id, file_path, event_type, patch, timestamp
+		SELECT id, assignment_id, file_path, event_type, patch, timestamp, seq, wall_ms, mono_ms, session_id, meta
 		FROM edit_history
 		WHERE assignment_id = ?
-		ORDER BY timestamp ASC
+		ORDER BY seq ASC, id ASC
 	`)
 	if err != nil {
 		return fmt.Errorf("prepare getEventsByAssignStmt: %w", err)
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"aiplag-agent/daemon/models"
+	"log"
+	"sync"
+)
+
+// Changes are dropped for a subscriber that falls this far behind instead of slowing down recording
+const subscriberBuffer = 256
+
+// StoreChange is published to subscribers after the store was written. Exactly one field is set.
+type StoreChange struct {
+	// A newly recorded event, its patch is left out to keep the change small
+	Event *models.EditEvent `json:"event,omitempty"`
+	// The new binding of an assignment
+	Assignment *models.WatchedAssignment `json:"assignment,omitempty"`
+}
+
+type subscribers struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]chan StoreChange
+}
+
+// Subscribe returns a channel receiving every change made through this store from now on.
+// The returned function ends the subscription and closes the channel.
+func (eh *EditHistoryStore) Subscribe() (<-chan StoreChange, func()) {
+	eh.subscribers.mu.Lock()
+	defer eh.subscribers.mu.Unlock()
+	if eh.subscribers.subs == nil {
+		eh.subscribers.subs = make(map[int]chan StoreChange)
+	}
+	id := eh.subscribers.next
+	eh.subscribers.next++
+	ch := make(chan StoreChange, subscriberBuffer)
+	eh.subscribers.subs[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			eh.subscribers.mu.Lock()
+			defer eh.subscribers.mu.Unlock()
+			delete(eh.subscribers.subs, id)
+			close(ch)
+		})
+	}
+}
+
+// publish hands the change to every subscriber without blocking
+func (eh *EditHistoryStore) publish(change StoreChange) {
+	eh.subscribers.mu.Lock()
+	defer eh.subscribers.mu.Unlock()
+	for id, ch := range eh.subscribers.subs {
+		select {
+		case ch <- change:
+		default:
+			log.Printf("Dropped store change for slow subscriber %d", id)
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package db
 
 import (
+	"aiplag-agent/common/redact"
 	"aiplag-agent/daemon/models"
 	"database/sql"
 	"fmt"
@@ -94,7 +95,7 @@ func (fsstore *FilesystemStore) DeleteFile(path string) error {
 }
 
 // AddDirectory walks through the given directory, reads all files, and adds or updates
-// them in the FilesystemStore.
+// them in the FilesystemStore with their secrets redacted.
 // This goes againts separation of concerns and should be refactored later
 func (fsstore *FilesystemStore) AddDirectory(dirPath string) error {
 	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, walkErr error) error {
@@ -116,7 +117,7 @@ func (fsstore *FilesystemStore) AddDirectory(dirPath string) error {
 
 		file := &StoredFile{
 			Filepath: path,
-			Content:  string(contentBytes),
+			Content:  redact.Default.Redact(path, string(contentBytes)),
 		}
 
 		if err := fsstore.AddOrUpdateFile(file); err != nil {
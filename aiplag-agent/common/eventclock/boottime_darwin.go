@@ -0,0 +1,17 @@
+package eventclock
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// sinceBoot reads CLOCK_MONOTONIC, which on macOS keeps counting while asleep unlike the
+// monotonic clock of the Go runtime
+func sinceBoot() (time.Duration, bool) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0, false
+	}
+	return time.Duration(ts.Nano()), true
+}
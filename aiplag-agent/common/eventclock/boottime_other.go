@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package eventclock
+
+import "time"
+
+// sinceBoot isn't available, the monotonic clock of the Go runtime is used instead
+func sinceBoot() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,13 @@
+package eventclock
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// sinceBoot reads GetTickCount64, which keeps counting while asleep unlike the unbiased
+// interrupt time that the Go runtime uses
+func sinceBoot() (time.Duration, bool) {
+	return windows.DurationSinceBoot(), true
+}
@@ -0,0 +1,59 @@
+// Package eventclock timestamps recorded events with both the wall clock and a monotonic reading.
+// The wall clock can be changed by the user at any time, the monotonic reading can't, so the
+// backend can compare the two to find out if the clock was tampered with. The monotonic reading
+// comes from a clock that keeps counting while the machine sleeps, so the two only drift apart
+// when the wall clock is changed.
+package eventclock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+var (
+	sessionStart        = time.Now()
+	bootAtStart, bootOK = sinceBoot()
+	sessionID           = newSessionID()
+)
+
+// Reading is a single timestamp of an event
+type Reading struct {
+	// Milliseconds since the unix epoch according to the wall clock
+	WallMs int64
+	// Milliseconds since the session started according to the monotonic clock, including sleep
+	MonoMs int64
+	// Identifies the process the monotonic reading belongs to, readings from different sessions can't be compared
+	SessionID string
+}
+
+// Now returns the current reading
+func Now() Reading {
+	now := time.Now()
+	return Reading{
+		WallMs:    now.UnixMilli(),
+		MonoMs:    sinceStart(now).Milliseconds(),
+		SessionID: sessionID,
+	}
+}
+
+func sinceStart(now time.Time) time.Duration {
+	if boot, ok := sinceBoot(); ok && bootOK {
+		return boot - bootAtStart
+	}
+	// Stops while the machine sleeps, uses the monotonic clock of both times
+	return now.Sub(sessionStart)
+}
+
+// SessionID identifies the current process
+func SessionID() string {
+	return sessionID
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString([]byte(time.Now().String()))[:16]
+	}
+	return hex.EncodeToString(b)
+}
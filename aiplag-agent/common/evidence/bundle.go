@@ -0,0 +1,110 @@
+package evidence
+
+import (
+	"aiplag-agent/common/api/dtomodels"
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+// Names of the entries of a bundle
+const (
+	ManifestEntry  = "manifest.json"
+	SignatureEntry = "manifest.sig"
+	EventsEntry    = "events.json"
+	SnapshotsDir   = "snapshots/"
+)
+
+// BundleFormatVersion is increased whenever the layout of a bundle changes
+const BundleFormatVersion = 1
+
+// Manifest describes a bundle. It is the signed part of the bundle, the other entries are
+// covered by their hashes in Files.
+type Manifest struct {
+	FormatVersion int            `json:"formatVersion"`
+	AgentVersion  string         `json:"agentVersion"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	Device        DeviceInfo     `json:"device"`
+	Assignment    AssignmentInfo `json:"assignment"`
+	StudentEmail  string         `json:"studentEmail"`
+	EventCount    int            `json:"eventCount"`
+	// Chain hash of the last event, see ChainHash
+	ChainHead string `json:"chainHead"`
+	// sha256 of every other entry by entry name
+	Files map[string]string `json:"files"`
+}
+
+type DeviceInfo struct {
+	ID        string `json:"id"`
+	Hostname  string `json:"hostname"`
+	OS        string `json:"os"`
+	PublicKey string `json:"publicKey"`
+}
+
+type AssignmentInfo struct {
+	// Backend id of the assignment, 0 when it wasn't known at export time
+	ID uint `json:"id"`
+	// Name of the watched directory
+	Directory string `json:"directory"`
+}
+
+// Bundle is the content of an evidence bundle before it is written
+type Bundle struct {
+	Manifest Manifest
+	Events   []dtomodels.EditEvent
+	// Final content of every file by its path relative to the assignment directory
+	Snapshots map[string]string
+}
+
+// Write writes the bundle as a zip archive to w, filling in the hashes of the manifest and
+// signing it with key
+func (b *Bundle) Write(w io.Writer, key *DeviceKey) error {
+	events, err := json.MarshalIndent(b.Events, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode events: %w", err)
+	}
+	entries := map[string][]byte{EventsEntry: events}
+	for relativePath, content := range b.Snapshots {
+		entries[SnapshotsDir+path.Clean(ChainPath(relativePath))] = []byte(content)
+	}
+
+	b.Manifest.FormatVersion = BundleFormatVersion
+	b.Manifest.EventCount = len(b.Events)
+	b.Manifest.Device.PublicKey = key.PublicKey()
+	b.Manifest.Device.ID = key.ID()
+	b.Manifest.Files = make(map[string]string, len(entries))
+	for name, data := range entries {
+		sum := sha256.Sum256(data)
+		b.Manifest.Files[name] = hex.EncodeToString(sum[:])
+	}
+	manifest, err := json.MarshalIndent(b.Manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	entries[ManifestEntry] = manifest
+	entries[SignatureEntry] = []byte(key.Sign(manifest))
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		f, err := zw.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to bundle: %w", name, err)
+		}
+		if _, err := f.Write(entries[name]); err != nil {
+			return fmt.Errorf("failed to write %s to bundle: %w", name, err)
+		}
+	}
+	return zw.Close()
+}
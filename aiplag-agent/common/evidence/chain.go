@@ -0,0 +1,56 @@
+// Package evidence makes the recorded edit history verifiable once it leaves the device.
+//
+// Every event is chained to the one before it with a hash, so the last hash of an assignment
+// commits to its whole history, and exported bundles are signed with a key kept on the device.
+package evidence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// ChainedEvent holds the fields of an event that are covered by the hash chain.
+// FilePath is relative to the assignment directory with forward slashes, so the chain can be
+// checked without knowing where the assignment was on the student's machine.
+type ChainedEvent struct {
+	Seq       int64
+	FilePath  string
+	EventType string
+	Patch     string
+	WallMs    int64
+	MonoMs    int64
+	SessionID string
+	Degraded  bool
+}
+
+// ChainHash returns the chain hash of event given the hash of the event before it,
+// which is "" for the first event of an assignment.
+// The backend computes the same hash to verify bundles, the encoding must not change.
+func ChainHash(prev string, event ChainedEvent) string {
+	fields := []string{
+		prev,
+		strconv.FormatInt(event.Seq, 10),
+		event.FilePath,
+		event.EventType,
+		event.Patch,
+		strconv.FormatInt(event.WallMs, 10),
+		strconv.FormatInt(event.MonoMs, 10),
+		event.SessionID,
+		strconv.FormatBool(event.Degraded),
+	}
+	h := sha256.New()
+	for _, field := range fields {
+		// Length prefixes keep "ab"+"c" and "a"+"bc" apart
+		h.Write([]byte(strconv.Itoa(len(field))))
+		h.Write([]byte{':'})
+		h.Write([]byte(field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ChainPath turns a path inside the assignment into the form used by the chain
+func ChainPath(relativePath string) string {
+	return strings.ReplaceAll(relativePath, "\\", "/")
+}
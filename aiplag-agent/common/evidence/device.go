@@ -0,0 +1,68 @@
+package evidence
+
+import (
+	"aiplag-agent/common/config"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DeviceKey identifies this installation of the agent and signs the bundles it exports
+type DeviceKey struct {
+	private ed25519.PrivateKey
+}
+
+// LoadOrCreateDeviceKey reads the device key from config.DeviceKeyPath(), generating and
+// saving a new one the first time
+func LoadOrCreateDeviceKey() (*DeviceKey, error) {
+	path := config.DeviceKeyPath()
+	data, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("device key %s is corrupt", path)
+		}
+		return &DeviceKey{private: ed25519.NewKeyFromSeed(seed)}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read device key: %w", err)
+	}
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate device key: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(private.Seed())
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save device key: %w", err)
+	}
+	return &DeviceKey{private: private}, nil
+}
+
+// PublicKey returns the base64 encoded public key
+func (k *DeviceKey) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(k.private.Public().(ed25519.PublicKey))
+}
+
+// ID is a short fingerprint of the public key
+func (k *DeviceKey) ID() string {
+	sum := sha256.Sum256(k.private.Public().(ed25519.PublicKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign returns the base64 encoded signature of data
+func (k *DeviceKey) Sign(data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(k.private, data))
+}
+
+// Proof signs the message the backend checks when the key is registered for studentEmail,
+// showing that this device holds the private key
+func (k *DeviceKey) Proof(studentEmail string) string {
+	return k.Sign([]byte("plaggy device key of " + studentEmail))
+}
@@ -0,0 +1,66 @@
+// Package history rebuilds earlier states of watched files from the recorded edit events.
+package history
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ApplyPatch applies a patch recorded by the daemon's FileDiffer to text.
+//
+// The recorded patches are diffmatchpatch patches whose escaped lines were unescaped and split
+// on line breaks, so they have to be escaped again before the library can read them.
+func ApplyPatch(text string, patch string) (string, error) {
+	if strings.TrimSpace(patch) == "" {
+		return text, nil
+	}
+	dmp := diffmatchpatch.New()
+	patches, err := dmp.PatchFromText(EscapePatch(patch))
+	if err != nil {
+		return "", fmt.Errorf("bad patch text: %w", err)
+	}
+	newText, applied := dmp.PatchApply(patches, text)
+	for i, ok := range applied {
+		if !ok {
+			return "", fmt.Errorf("hunk %d failed to apply", i)
+		}
+	}
+	return newText, nil
+}
+
+// EscapePatch turns a recorded patch back into the diffmatchpatch text format.
+// Consecutive lines of the same kind were a single line before they were split,
+// diffmatchpatch never produces two diffs of the same kind next to each other.
+func EscapePatch(patch string) string {
+	dmp := diffmatchpatch.New()
+	sb := strings.Builder{}
+	lines := strings.Split(patch, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+		kind := line[0]
+		if kind != '+' && kind != '-' && kind != ' ' {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+			continue
+		}
+
+		hunk := []string{line[1:]}
+		for i+1 < len(lines) && lines[i+1] != "" && lines[i+1][0] == kind {
+			i++
+			hunk = append(hunk, lines[i][1:])
+		}
+		// DiffToDelta escapes an insert the same way PatchToText does, after the leading '+'
+		delta := dmp.DiffToDelta([]diffmatchpatch.Diff{
+			{Type: diffmatchpatch.DiffInsert, Text: strings.Join(hunk, "\n")},
+		})
+		sb.WriteByte(kind)
+		sb.WriteString(delta[1:])
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
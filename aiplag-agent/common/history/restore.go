@@ -0,0 +1,75 @@
+package history
+
+import (
+	"aiplag-agent/daemon/models"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileState is the content of a file at some point of its history
+type FileState struct {
+	Path    string
+	Content string
+	// False when the file was deleted or not created yet at that point
+	Exists bool
+	// ID of the last event that changed the file before that point
+	LastEventID int
+	// Set when the history can't be replayed up to that point, Content is then the last good state
+	Err error
+}
+
+// StatesAt replays the events of every file under target, which can be a single file or a
+// directory, up to and including the last event for which include returns true.
+// Events must be in recording order, as returned by EditHistoryStore.GetEventsByAssignment.
+func StatesAt(events []models.EditEvent, target string, include func(models.EditEvent) bool) []FileState {
+	states := make(map[string]*FileState)
+	for _, event := range events {
+		if event.EventType.IsLifecycle() || !isUnder(event.FilePath, target) {
+			continue
+		}
+		if !include(event) {
+			break
+		}
+
+		state, ok := states[event.FilePath]
+		if !ok {
+			state = &FileState{Path: event.FilePath}
+			states[event.FilePath] = state
+		}
+		if state.Err != nil {
+			continue
+		}
+		state.LastEventID = event.ID
+
+		switch event.EventType {
+		case models.EventDeleted, models.EventRenamed:
+			// Renames are recorded for the old path, the new path gets its own added event
+			state.Exists = false
+			state.Content = ""
+		case models.EventAdded, models.EventModified, models.EventRestored:
+			// Patches of files that didn't exist start from an empty file
+			content, err := ApplyPatch(state.Content, event.Patch)
+			if err != nil {
+				state.Err = fmt.Errorf("event %d: %w", event.ID, err)
+				continue
+			}
+			state.Exists = true
+			state.Content = content
+		}
+	}
+
+	result := make([]FileState, 0, len(states))
+	for _, state := range states {
+		result = append(result, *state)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+func isUnder(path string, target string) bool {
+	return path == target || strings.HasPrefix(path, target+string(filepath.Separator))
+}
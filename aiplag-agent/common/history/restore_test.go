@@ -0,0 +1,49 @@
+package history_test
+
+import (
+	"aiplag-agent/common/history"
+	"aiplag-agent/daemon/filesystemwatching"
+	"aiplag-agent/daemon/models"
+	"testing"
+)
+
+func TestStatesAtReplaysRecordedPatches(t *testing.T) {
+	fd := filesystemwatching.NewFileDiffer()
+	versions := []string{
+		"",
+		"package main\n\nfunc main() {\n}\n",
+		"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"100% done + more\")\n}\n",
+		"package main\n\nfunc main() {\n\tprintln(1)\n}\n",
+	}
+	var events []models.EditEvent
+	for i := 1; i < len(versions); i++ {
+		eventType := models.EventModified
+		if i == 1 {
+			eventType = models.EventAdded
+		}
+		events = append(events, models.EditEvent{
+			ID:        i,
+			Seq:       int64(i),
+			FilePath:  "/hw/main.go",
+			EventType: eventType,
+			Patch:     fd.UnifiedLineLevelPatches(versions[i-1], versions[i]),
+		})
+	}
+	events = append(events, models.EditEvent{ID: 4, Seq: 4, FilePath: "/hw/main.go", EventType: models.EventDeleted})
+
+	for upTo := 1; upTo <= 4; upTo++ {
+		states := history.StatesAt(events, "/hw", func(e models.EditEvent) bool { return e.ID <= upTo })
+		if len(states) != 1 || states[0].Err != nil {
+			t.Fatalf("event %d: unexpected states %+v", upTo, states)
+		}
+		if upTo == 4 {
+			if states[0].Exists {
+				t.Fatalf("file should not exist after it was deleted")
+			}
+			continue
+		}
+		if states[0].Content != versions[upTo] {
+			t.Fatalf("event %d: got %q, want %q", upTo, states[0].Content, versions[upTo])
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Package redact hides secrets in file contents before they are stored or submitted.
+//
+// Every secret is replaced with a placeholder of the same byte length that keeps its line breaks,
+// so patches stay applyable and the number of characters typed per edit doesn't change.
+// The placeholder only depends on the secret and a key kept on the device, so the same secret is
+// always replaced the same way and editing a file that holds a secret doesn't show up as a change
+// to the secret. Without the key the placeholder can't be used to check guesses of the secret.
+package redact
+
+import (
+	"aiplag-agent/common/config"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ManifestFile is the name of the assignment manifest. It is looked up in the directory of the
+// redacted file and every directory above it.
+const ManifestFile = ".plaggy.yaml"
+
+// secretGroup is the name of the capture group that holds the secret. Patterns without it
+// have their whole match redacted.
+const secretGroup = "secret"
+
+// builtinPatterns are applied to every file
+var builtinPatterns = []*regexp.Regexp{
+	// AWS access key ids
+	regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`),
+	// AWS secret access keys, only recognisable by the name they are assigned to
+	regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`),
+	// PEM private key blocks
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY( BLOCK)?-----`),
+	// JSON web tokens
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]+`),
+}
+
+// envPattern matches the values of KEY=value lines, it is only applied to .env files
+var envPattern = regexp.MustCompile(`(?m)^[ \t]*(?:export[ \t]+)?[A-Za-z_][A-Za-z0-9_.]*[ \t]*=[ \t]*(?P<secret>[^\r\n]*[^\s])`)
+
+// Redactor replaces secrets in file contents.
+// It is safe for concurrent use.
+type Redactor struct {
+	mu sync.Mutex
+	// Parsed manifests by manifest path
+	manifests map[string]*manifest
+	// Keys the placeholders, loaded from config.RedactionKeyPath() on first use. keyErr tells
+	// why it couldn't be loaded.
+	key     []byte
+	keyErr  error
+	keyOnce sync.Once
+}
+
+type manifest struct {
+	modTime  time.Time
+	patterns []*regexp.Regexp
+}
+
+// Default is the redactor used by the daemon and the CLI
+var Default = New()
+
+func New() *Redactor {
+	return &Redactor{manifests: make(map[string]*manifest)}
+}
+
+// NewWithKey returns a redactor keying its placeholders with key instead of the device's key
+func NewWithKey(key []byte) *Redactor {
+	r := New()
+	r.keyOnce.Do(func() { r.key = key })
+	return r
+}
+
+// Redact returns content with every secret replaced. The path decides which patterns apply:
+// .env files get all their values redacted and the instructor's patterns come from the
+// manifest of the assignment the path is in.
+func (r *Redactor) Redact(path string, content string) string {
+	for _, pattern := range r.patternsFor(path) {
+		content = r.redactMatches(pattern, content)
+	}
+	return content
+}
+
+// RedactPatch redacts the lines of a patch made for the file at path. Consecutive lines of the
+// same kind are redacted together so that secrets spanning several lines are found as well.
+func (r *Redactor) RedactPatch(path string, patch string) string {
+	lines := strings.Split(patch, "\n")
+	for start := 0; start < len(lines); {
+		kind := lineKind(lines[start])
+		end := start + 1
+		for end < len(lines) && kind != 0 && lineKind(lines[end]) == kind {
+			end++
+		}
+		if kind != 0 {
+			contents := make([]string, end-start)
+			for i := start; i < end; i++ {
+				contents[i-start] = lines[i][1:]
+			}
+			redacted := strings.Split(r.Redact(path, strings.Join(contents, "\n")), "\n")
+			for i := start; i < end; i++ {
+				lines[i] = string(kind) + redacted[i-start]
+			}
+		}
+		start = end
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lineKind returns the prefix of a patch line that holds file content, or 0 for header lines
+func lineKind(line string) byte {
+	if len(line) == 0 {
+		return 0
+	}
+	switch line[0] {
+	case '+', '-', ' ':
+		return line[0]
+	}
+	return 0
+}
+
+func (r *Redactor) patternsFor(path string) []*regexp.Regexp {
+	patterns := append([]*regexp.Regexp{}, builtinPatterns...)
+	if IsEnvFile(path) {
+		patterns = append(patterns, envPattern)
+	}
+	if m := r.manifestFor(path); m != nil {
+		patterns = append(patterns, m.patterns...)
+	}
+	return patterns
+}
+
+// IsEnvFile reports whether path is a dotenv file such as .env or .env.local
+func IsEnvFile(path string) bool {
+	base := filepath.Base(path)
+	return base == ".env" || strings.HasPrefix(base, ".env.")
+}
+
+// manifestFor returns the closest manifest above path, reloading it when it changed
+func (r *Redactor) manifestFor(path string) *manifest {
+	manifestPath := findManifest(filepath.Dir(path))
+	if manifestPath == "" {
+		return nil
+	}
+	info, err := os.Stat(manifestPath)
+	if err != nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.manifests[manifestPath]; ok && m.modTime.Equal(info.ModTime()) {
+		return m
+	}
+	m := &manifest{modTime: info.ModTime(), patterns: loadManifestPatterns(manifestPath)}
+	r.manifests[manifestPath] = m
+	return m
+}
+
+func findManifest(dir string) string {
+	for {
+		candidate := filepath.Join(dir, ManifestFile)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadManifestPatterns reads the "redact" list of regular expressions from the manifest.
+// Patterns that don't compile are logged and skipped.
+func loadManifestPatterns(manifestPath string) []*regexp.Regexp {
+	v := viper.New()
+	v.SetConfigFile(manifestPath)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		log.Printf("redact: failed to read manifest %s: %v", manifestPath, err)
+		return nil
+	}
+
+	var patterns []*regexp.Regexp
+	for _, expr := range v.GetStringSlice("redact") {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			log.Printf("redact: skipping invalid pattern %q in %s: %v", expr, manifestPath, err)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// redactMatches replaces the secret group of every match of pattern, or the whole match
+// if the pattern doesn't have one
+func (r *Redactor) redactMatches(pattern *regexp.Regexp, content string) string {
+	group := pattern.SubexpIndex(secretGroup)
+	matches := pattern.FindAllStringSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return content
+	}
+
+	sb := strings.Builder{}
+	last := 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if group > 0 {
+			start, end = match[2*group], match[2*group+1]
+		}
+		if start < last || start == end {
+			continue
+		}
+		sb.WriteString(content[last:start])
+		sb.WriteString(r.Placeholder(content[start:end]))
+		last = end
+	}
+	sb.WriteString(content[last:])
+	return sb.String()
+}
+
+// Placeholder returns the stable replacement of secret. It has the same length in bytes and
+// keeps the line breaks of the secret where they were. Without the device's key it is made of
+// stars only, see LoadKey.
+func (r *Redactor) Placeholder(secret string) string {
+	placeholder := []byte(strings.Repeat("*", len(secret)))
+	if key, err := r.placeholderKey(); err == nil {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(secret))
+		tag := "<redacted:" + hex.EncodeToString(mac.Sum(nil)[:4]) + ">"
+		if len(secret) >= len(tag) {
+			copy(placeholder, tag)
+		}
+	}
+	for i := 0; i < len(secret); i++ {
+		if secret[i] == '\n' || secret[i] == '\r' {
+			placeholder[i] = secret[i]
+		}
+	}
+	return string(placeholder)
+}
+
+// LoadKey loads the device's key of the placeholders and returns why it can't be used. The
+// daemon and the CLI have to redact with the same key, otherwise the files a submission sends
+// don't match the recorded history, so they refuse to record or submit without it.
+func (r *Redactor) LoadKey() error {
+	_, err := r.placeholderKey()
+	return err
+}
+
+func (r *Redactor) placeholderKey() ([]byte, error) {
+	r.keyOnce.Do(func() {
+		r.key, r.keyErr = loadOrCreateKey(config.RedactionKeyPath())
+		if r.keyErr != nil {
+			log.Printf("redact: %v", r.keyErr)
+		}
+	})
+	return r.key, r.keyErr
+}
+
+func loadOrCreateKey(path string) ([]byte, error) {
+	key, err := readKey(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return key, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate redaction key: %w", err)
+	}
+	// Written next to the key and linked into place, so a process reading the key never sees it
+	// half written and only one of two processes creating it at once gets to keep its key
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".redaction-key-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to save redaction key: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(hex.EncodeToString(key) + "\n")
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// Readable by the group of the app data directory, the CLI redacts with the same key
+		err = os.Chmod(tmp.Name(), 0640)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save redaction key: %w", err)
+	}
+	if err := os.Link(tmp.Name(), path); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("failed to save redaction key: %w", err)
+	}
+	return readKey(path)
+}
+
+func readKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return nil, fmt.Errorf("no permission to read the redaction key %s, the user has to be in the group of the app data directory", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redaction key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("redaction key %s is corrupt", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,167 @@
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Status of the last update
+type Status string
+
+const (
+	// The binaries were replaced, the new version has not proven to be healthy yet
+	StatusPending Status = "pending"
+	// The new version started and answered its health check
+	StatusConfirmed Status = "confirmed"
+	// The previous binaries were put back, the version in ToVersion is not installed again
+	StatusRolledBack Status = "rolled_back"
+)
+
+// State tracks an update across the restart of the daemon
+type State struct {
+	FromVersion string    `json:"fromVersion"`
+	ToVersion   string    `json:"toVersion"`
+	Status      Status    `json:"status"`
+	Reason      string    `json:"reason,omitempty"`
+	Attempts    int       `json:"attempts"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// LoadState reads the update state, a missing file means no update ever happened
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to read update state: %w", err)
+	}
+	return &state, nil
+}
+
+// Save writes the state atomically
+func (s *State) Save(path string) error {
+	s.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".new"
+	if err := os.WriteFile(tmp, data, 0660); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Swap replaces every target with its staged binary. The replaced binaries are kept next to
+// the targets with an .old suffix until Cleanup or Rollback. If a target can't be replaced the
+// ones already replaced are rolled back.
+// staged and targets map the artifact name to a path.
+func Swap(staged map[string]string, targets map[string]string) error {
+	var swapped []string
+	for name, target := range targets {
+		src, ok := staged[name]
+		if !ok {
+			continue
+		}
+		if err := swapOne(src, target); err != nil {
+			Rollback(swapped)
+			return fmt.Errorf("failed to replace %s: %w", target, err)
+		}
+		swapped = append(swapped, target)
+	}
+	return nil
+}
+
+// swapOne copies src next to target and renames it over target. Windows doesn't allow
+// replacing a running executable, but allows renaming it, so there the target is moved aside
+// first and for a moment doesn't exist.
+func swapOne(src string, target string) error {
+	if err := copyFile(src, target+".new"); err != nil {
+		return err
+	}
+	os.Remove(target + ".old")
+	if runtime.GOOS == "windows" {
+		if err := os.Rename(target, target+".old"); err != nil {
+			os.Remove(target + ".new")
+			return err
+		}
+		if err := os.Rename(target+".new", target); err != nil {
+			os.Rename(target+".old", target)
+			os.Remove(target + ".new")
+			return err
+		}
+		return nil
+	}
+
+	// The link keeps the current binary around without copying it
+	if err := os.Link(target, target+".old"); err != nil {
+		if err := copyFile(target, target+".old"); err != nil {
+			os.Remove(target + ".new")
+			return err
+		}
+	}
+	if err := os.Rename(target+".new", target); err != nil {
+		os.Remove(target + ".new")
+		return err
+	}
+	return nil
+}
+
+// Rollback puts the binaries replaced by Swap back
+func Rollback(targets []string) error {
+	var lastErr error
+	for _, target := range targets {
+		if _, err := os.Stat(target + ".old"); err != nil {
+			continue
+		}
+		if runtime.GOOS == "windows" {
+			// The failed binary may be the one running
+			os.Remove(target + ".failed")
+			os.Rename(target, target+".failed")
+		}
+		if err := os.Rename(target+".old", target); err != nil {
+			lastErr = fmt.Errorf("failed to restore %s: %w", target, err)
+		}
+	}
+	return lastErr
+}
+
+// Cleanup removes the binaries kept for a rollback
+func Cleanup(targets []string) {
+	for _, target := range targets {
+		os.Remove(target + ".old")
+	}
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,197 @@
+// Package update fetches signed release manifests and replaces the installed agent binaries
+package update
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Manifests larger than this are rejected before their signature is checked
+const maxManifestBytes = 1 << 20
+
+// ErrBadSignature is returned for a manifest that isn't signed with the expected key
+var ErrBadSignature = errors.New("release manifest signature is invalid")
+
+// Manifest describes a release and the binaries it is made of
+type Manifest struct {
+	Version    string     `json:"version"`
+	ReleasedAt time.Time  `json:"releasedAt"`
+	Artifacts  []Artifact `json:"artifacts"`
+}
+
+// Artifact is a single binary of a release. The signature over the manifest covers the
+// binary through its hash.
+type Artifact struct {
+	// plaggy or plaggydaemon
+	Name string `json:"name"`
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// Absolute or relative to the manifest
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// SignedManifest is the file published at the manifest URL. The signature is over the exact
+// bytes of Manifest.
+type SignedManifest struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Signature string          `json:"signature"`
+}
+
+// ArtifactsFor returns the binaries built for the given platform
+func (m *Manifest) ArtifactsFor(goos string, goarch string) []Artifact {
+	var artifacts []Artifact
+	for _, a := range m.Artifacts {
+		if a.OS == goos && a.Arch == goarch {
+			artifacts = append(artifacts, a)
+		}
+	}
+	return artifacts
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid update public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid update public key: %d bytes", len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// SignManifest encodes and signs a manifest for publishing
+func SignManifest(m Manifest, key ed25519.PrivateKey) ([]byte, error) {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	// Not indented, that would reformat the signed bytes
+	return json.Marshal(SignedManifest{
+		Manifest:  payload,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	})
+}
+
+// FetchManifest reads the manifest at source and returns it once its signature checks out
+func FetchManifest(source string, key ed25519.PublicKey) (*Manifest, error) {
+	data, err := readSource(source, maxManifestBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release manifest: %w", err)
+	}
+	var signed SignedManifest
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("failed to read release manifest: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(key, signed.Manifest, signature) {
+		return nil, ErrBadSignature
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(signed.Manifest, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to read release manifest: %w", err)
+	}
+	if manifest.Version == "" {
+		return nil, errors.New("release manifest has no version")
+	}
+	return &manifest, nil
+}
+
+// Download stores the artifact in dir under its name once its size and hash match the manifest
+func Download(manifestSource string, artifact Artifact, dir string) (string, error) {
+	source, err := resolve(manifestSource, artifact.URL)
+	if err != nil {
+		return "", err
+	}
+	data, err := readSource(source, artifact.Size)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", artifact.Name, err)
+	}
+	if int64(len(data)) != artifact.Size {
+		return "", fmt.Errorf("%s is %d bytes, the manifest says %d", artifact.Name, len(data), artifact.Size)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != strings.ToLower(artifact.SHA256) {
+		return "", fmt.Errorf("%s doesn't match the hash in the manifest", artifact.Name)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, filepath.Base(artifact.Name))
+	if err := os.WriteFile(path, data, 0755); err != nil {
+		return "", fmt.Errorf("failed to store %s: %w", artifact.Name, err)
+	}
+	return path, nil
+}
+
+// resolve makes ref absolute against the manifest source
+func resolve(manifestSource string, ref string) (string, error) {
+	base, err := url.Parse(manifestSource)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https" && base.Scheme != "file") {
+		// A plain path
+		if filepath.IsAbs(ref) || strings.Contains(ref, "://") {
+			return ref, nil
+		}
+		return filepath.Join(filepath.Dir(manifestSource), ref), nil
+	}
+	relative, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid artifact url %q: %w", ref, err)
+	}
+	return base.ResolveReference(relative).String(), nil
+}
+
+// readSource reads at most limit bytes from an http(s) URL, a file URL or a path
+func readSource(source string, limit int64) ([]byte, error) {
+	var body io.ReadCloser
+	u, err := url.Parse(source)
+	switch {
+	case err == nil && (u.Scheme == "http" || u.Scheme == "https"):
+		client := &http.Client{Timeout: 5 * time.Minute}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s returned %s", source, resp.Status)
+		}
+		body = resp.Body
+	case err == nil && u.Scheme == "file":
+		body, err = os.Open(u.Path)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		body, err = os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer body.Close()
+
+	// Read one byte over the limit to notice sources that are too large
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", source, limit)
+	}
+	return data, nil
+}
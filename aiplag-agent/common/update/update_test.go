@@ -0,0 +1,92 @@
+package update_test
+
+import (
+	"aiplag-agent/common/update"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchVerifiesManifestAndArtifacts(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	binary := []byte("#!/bin/sh\necho new daemon\n")
+	sum := sha256.Sum256(binary)
+	manifest := update.Manifest{
+		Version: "1.2.0",
+		Artifacts: []update.Artifact{{
+			Name: "plaggydaemon", OS: "linux", Arch: "amd64",
+			URL: "bin/plaggydaemon", SHA256: hex.EncodeToString(sum[:]), Size: int64(len(binary)),
+		}},
+	}
+	signed, err := update.SignManifest(manifest, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := binary
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/release/manifest.json":
+			w.Write(signed)
+		case "/release/bin/plaggydaemon":
+			w.Write(served)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	source := server.URL + "/release/manifest.json"
+
+	otherKey, _, _ := ed25519.GenerateKey(nil)
+	if _, err := update.FetchManifest(source, otherKey); !errors.Is(err, update.ErrBadSignature) {
+		t.Fatalf("manifest signed with another key: got %v", err)
+	}
+	fetched, err := update.FetchManifest(source, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts := fetched.ArtifactsFor("linux", "amd64")
+	if fetched.Version != "1.2.0" || len(artifacts) != 1 {
+		t.Fatalf("unexpected manifest %+v", fetched)
+	}
+
+	dir := t.TempDir()
+	path, err := update.Download(source, artifacts[0], dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(binary) {
+		t.Fatalf("downloaded %q", data)
+	}
+
+	served = []byte("#!/bin/sh\necho evil daemon\n")
+	if _, err := update.Download(source, artifacts[0], t.TempDir()); err == nil {
+		t.Fatal("a binary that doesn't match the manifest was accepted")
+	}
+}
+
+func TestSwapAndRollback(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "plaggydaemon")
+	staged := filepath.Join(dir, "staged")
+	os.WriteFile(target, []byte("old"), 0755)
+	os.WriteFile(staged, []byte("new"), 0755)
+
+	if err := update.Swap(map[string]string{"plaggydaemon": staged}, map[string]string{"plaggydaemon": target}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Fatalf("after swap the target holds %q", data)
+	}
+	if err := update.Rollback([]string{target}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "old" {
+		t.Fatalf("after rollback the target holds %q", data)
+	}
+}
@@ -1,12 +1,21 @@
 package commandListener
 
 import (
+	"aiplag-agent/common/buildinfo"
+	"aiplag-agent/common/config"
 	"aiplag-agent/common/db"
+	"aiplag-agent/common/update"
 	"aiplag-agent/daemon/filesystemwatching"
+	"aiplag-agent/daemon/models"
 	"encoding/binary"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
+	"slices"
+	"strings"
 )
 
 // TCPWatcher handles TCP commands from CLI using length-prefixed protocol
@@ -15,8 +24,62 @@ type TCPWatcher struct {
 	watcher          *filesystemwatching.FSWatcher
 	storedFS         *db.FilesystemStore
 	edithistoryStore *db.EditHistoryStore
+	dispatcher       *filesystemwatching.EventDispatcher
+	recorder         HistoryRecorder
+	pauseGate        *filesystemwatching.PauseGate
 }
 
+// HistoryRecorder is the part of the filesystem event handler that commands act on directly
+type HistoryRecorder interface {
+	// Reconcile records every difference between the stored files under root and the disk
+	Reconcile(root string)
+	// ExpectRestore marks the next write of path with the given content hash as a restore
+	ExpectRestore(path string, contentHash string)
+	// SetBaseline replaces the starter files of the directory at root
+	SetBaseline(root string, files []models.BaselineFile)
+}
+
+// BaselineRequest is the payload of the baseline command, sent by plaggy init before it
+// writes the starter files
+type BaselineRequest struct {
+	Root  string                `json:"root"`
+	Files []models.BaselineFile `json:"files"`
+}
+
+// PauseRequest is the payload of the pause and resume commands, Reason is only used to pause.
+// The response payload is the JSON models.TrackingPause.
+type PauseRequest struct {
+	Root   string `json:"root"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// RestoreRequest is the payload of the restore command
+type RestoreRequest struct {
+	Path        string `json:"path"`
+	ContentHash string `json:"contentHash"`
+}
+
+// DaemonStatus is the payload sent back for the status command
+type DaemonStatus struct {
+	Version            string                                `json:"version"`
+	Update             *update.State                         `json:"update,omitempty"`
+	WatchedDirectories []string                              `json:"watchedDirectories"`
+	Dispatcher         *filesystemwatching.DispatcherMetrics `json:"dispatcher,omitempty"`
+	// Watched directories whose tracking is paused
+	Paused map[string]models.TrackingPause `json:"paused,omitempty"`
+}
+
+// Responses streamed to a dashboard after the snapshot of its assignments
+const (
+	// JSON map from file path to the number of recorded file events, sent in chunks
+	RespFileEvents byte = 'F'
+	// JSON db.StoreChange
+	RespChange byte = 'C'
+)
+
+// File event counts sent in a single message, keeps the messages well below the length limit
+const fileEventsPerMessage = 200
+
 // NewTCPWatcher creates a new TCPWatcher
 func NewTCPWatcher(addr string, watcher *filesystemwatching.FSWatcher, storedFS *db.FilesystemStore, editHistoryStore *db.EditHistoryStore) *TCPWatcher {
 	return &TCPWatcher{
@@ -27,6 +90,23 @@ func NewTCPWatcher(addr string, watcher *filesystemwatching.FSWatcher, storedFS
 	}
 }
 
+// SetDispatcher makes the dispatcher's metrics available through the status command and
+// makes commands reconcile on its workers
+func (tcp *TCPWatcher) SetDispatcher(dispatcher *filesystemwatching.EventDispatcher) {
+	tcp.dispatcher = dispatcher
+}
+
+// SetHistoryRecorder lets watch commands record the initial state of the directory and
+// enables the restore command
+func (tcp *TCPWatcher) SetHistoryRecorder(recorder HistoryRecorder) {
+	tcp.recorder = recorder
+}
+
+// SetPauseGate enables the pause and resume commands
+func (tcp *TCPWatcher) SetPauseGate(gate *filesystemwatching.PauseGate) {
+	tcp.pauseGate = gate
+}
+
 // Run starts the TCP server (blocks until CLI connects)
 func (tcp *TCPWatcher) Run() {
 	listener, err := net.Listen("tcp", tcp.addr)
@@ -62,44 +142,313 @@ func (tcp *TCPWatcher) handleConnection(conn net.Conn) {
 		}
 
 		var resp byte = 'A' // success by default
+		var respPayload []byte
 
 		switch cmd {
 		case 'W': // watch
 			path := payload
 			log.Printf("Started watching path: %s", path)
-			if err := tcp.storedFS.AddDirectory(path); err != nil {
-				log.Printf("failed to add directory to stored filesystem: %s, err: %v", path, err)
-				resp = 'R' // reject
+			if tcp.recorder != nil {
+				// Record every file that is already there as added, so the history starts from
+				// the content the files had when watching started
+				tcp.edithistoryStore.AddAssignment(path)
+				if err := tcp.edithistoryStore.AddAssignmentEvent(path, models.EventWatchAdded, ""); err != nil {
+					log.Printf("failed to log watch event for %s: %v", path, err)
+				}
+				tcp.reconcile(path)
+			} else {
+				if err := tcp.storedFS.AddDirectory(path); err != nil {
+					log.Printf("failed to add directory to stored filesystem: %s, err: %v", path, err)
+					resp = 'R' // reject
+				}
+				tcp.edithistoryStore.AddAssignment(path)
+				if err := tcp.edithistoryStore.AddAssignmentEvent(path, models.EventWatchAdded, ""); err != nil {
+					log.Printf("failed to log watch event for %s: %v", path, err)
+				}
 			}
 			if err := tcp.watcher.AddDirectory(payload); err != nil {
 				log.Printf("failed to add directory to watcher: %s, err: %v", path, err)
 				resp = 'R' // reject
 			}
-			tcp.edithistoryStore.AddAssignment(path)
-			// TODO
 		case 'X': // stop watching
 			log.Printf("Stop watching path: %s", payload)
 			if err := tcp.watcher.StopWatchingDirectory(payload); err != nil {
 				log.Println(err)
 				resp = 'R' // reject
 			}
+			if err := tcp.edithistoryStore.AddAssignmentEvent(payload, models.EventWatchRemoved, ""); err != nil {
+				log.Printf("failed to log stop watching event for %s: %v", payload, err)
+			}
+			if tcp.pauseGate != nil && tcp.pauseGate.IsPaused(payload) {
+				// Watching again starts over from the files on disk, the pause has no end to record
+				tcp.pauseGate.Resume(payload)
+			}
+		case 'O': // restore
+			var request RestoreRequest
+			if err := json.Unmarshal([]byte(payload), &request); err != nil || tcp.recorder == nil {
+				log.Printf("Rejected restore request %q: %v", payload, err)
+				resp = 'R'
+				break
+			}
+			log.Printf("Expecting restore of %s", request.Path)
+			tcp.recorder.ExpectRestore(request.Path, request.ContentHash)
+		case 'B': // bind a watched directory to a backend assignment
+			var binding models.WatchedAssignment
+			if err := json.Unmarshal([]byte(payload), &binding); err != nil {
+				log.Printf("Rejected binding %q: %v", payload, err)
+				resp = 'R'
+				break
+			}
+			if err := tcp.edithistoryStore.BindAssignment(binding); err != nil {
+				log.Println("Failed to bind assignment:", err)
+				resp = 'R'
+			}
+		case 'D': // dashboard, streams changes until the client disconnects
+			if err := tcp.streamDashboard(conn); err != nil {
+				log.Println("Dashboard stream ended:", err)
+			}
+			return
+		case 'I': // starter files baseline
+			var request BaselineRequest
+			if err := json.Unmarshal([]byte(payload), &request); err != nil || tcp.recorder == nil {
+				log.Printf("Rejected baseline request: %v", err)
+				resp = 'R'
+				break
+			}
+			files, _ := json.Marshal(request.Files)
+			if err := tcp.edithistoryStore.AddAssignmentEvent(request.Root, models.EventBaseline, string(files)); err != nil {
+				log.Printf("failed to log baseline event for %s: %v", request.Root, err)
+				resp = 'R'
+				break
+			}
+			log.Printf("Baseline of %d starter files for %s", len(request.Files), request.Root)
+			tcp.recorder.SetBaseline(request.Root, request.Files)
+		case 'P': // pause tracking
+			pause, err := tcp.pause(payload)
+			if err != nil {
+				log.Printf("Rejected pause request %q: %v", payload, err)
+				resp = 'R'
+				break
+			}
+			respPayload = pause
+		case 'U': // resume tracking
+			pause, err := tcp.resume(payload)
+			if err != nil {
+				log.Printf("Rejected resume request %q: %v", payload, err)
+				resp = 'R'
+				break
+			}
+			respPayload = pause
+		case 'S': // status
+			status, err := tcp.status()
+			if err != nil {
+				log.Println("Failed to build status:", err)
+				resp = 'R'
+			} else {
+				respPayload = status
+			}
 		default:
 			resp = 'R' // unknown command
 		}
 
 		// send response back to CLI
-		length := uint16(1) // 1 byte for the response
-		lengthBytes := make([]byte, 2)
-		binary.BigEndian.PutUint16(lengthBytes, length)
-
-		_, err = conn.Write(append(lengthBytes, resp))
-		if err != nil {
+		if err := writeMessage(conn, resp, respPayload); err != nil {
 			log.Println("Failed to send response:", err)
 			return
 		}
 	}
 }
 
+// pause stops recording the watched directory of the request and records the pause
+func (tcp *TCPWatcher) pause(payload string) ([]byte, error) {
+	var request PauseRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return nil, err
+	}
+	if tcp.pauseGate == nil {
+		return nil, fmt.Errorf("pausing is not available")
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		return nil, fmt.Errorf("a reason is required")
+	}
+	if err := tcp.checkWatched(request.Root); err != nil {
+		return nil, err
+	}
+
+	pause, err := tcp.pauseGate.Pause(request.Root, request.Reason)
+	if err != nil {
+		return nil, err
+	}
+	detail, err := json.Marshal(pause)
+	if err != nil {
+		tcp.pauseGate.Resume(request.Root)
+		return nil, err
+	}
+	// Without the event the pause would be a gap nobody explained, so it doesn't take effect
+	if err := tcp.edithistoryStore.AddAssignmentEvent(request.Root, models.EventTrackingPaused, string(detail)); err != nil {
+		tcp.pauseGate.Resume(request.Root)
+		return nil, fmt.Errorf("failed to log pause event: %w", err)
+	}
+	log.Printf("Paused tracking of %s: %s", request.Root, request.Reason)
+	return detail, nil
+}
+
+// resume records the end of a pause and then the net change made while it lasted
+func (tcp *TCPWatcher) resume(payload string) ([]byte, error) {
+	var request PauseRequest
+	if err := json.Unmarshal([]byte(payload), &request); err != nil {
+		return nil, err
+	}
+	if tcp.pauseGate == nil || tcp.recorder == nil {
+		return nil, fmt.Errorf("pausing is not available")
+	}
+
+	pause, err := tcp.pauseGate.Resume(request.Root)
+	if err != nil {
+		return nil, err
+	}
+	detail, err := json.Marshal(pause)
+	if err != nil {
+		return nil, err
+	}
+	if err := tcp.edithistoryStore.AddAssignmentEvent(request.Root, models.EventTrackingResumed, string(detail)); err != nil {
+		log.Printf("failed to log resume event for %s: %v", request.Root, err)
+	}
+	log.Printf("Resumed tracking of %s, %d files changed while paused", request.Root, pause.ChangedFiles)
+	tcp.reconcile(request.Root)
+	return detail, nil
+}
+
+// reconcile reconciles root through the dispatcher when there is one, so it doesn't race with
+// the workers recording events of the same files
+func (tcp *TCPWatcher) reconcile(root string) {
+	if tcp.dispatcher != nil {
+		tcp.dispatcher.Reconcile(root)
+		return
+	}
+	tcp.recorder.Reconcile(root)
+}
+
+// checkWatched returns an error unless root is a watched directory
+func (tcp *TCPWatcher) checkWatched(root string) error {
+	paths, err := tcp.edithistoryStore.GetAssignmentFullPaths()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(paths, root) {
+		return fmt.Errorf("%s is not a watched directory", root)
+	}
+	return nil
+}
+
+// status returns the JSON encoded DaemonStatus
+func (tcp *TCPWatcher) status() ([]byte, error) {
+	paths, err := tcp.edithistoryStore.GetAssignmentFullPaths()
+	if err != nil {
+		return nil, err
+	}
+	status := DaemonStatus{Version: buildinfo.Version, WatchedDirectories: paths}
+	if state, err := update.LoadState(config.UpdateStatePath()); err == nil {
+		status.Update = state
+	}
+	if tcp.dispatcher != nil {
+		metrics := tcp.dispatcher.Metrics()
+		status.Dispatcher = &metrics
+	}
+	if tcp.pauseGate != nil {
+		if paused := tcp.pauseGate.Paused(); len(paused) > 0 {
+			status.Paused = paused
+		}
+	}
+	return json.Marshal(status)
+}
+
+// streamDashboard sends the watched assignments and the file event counts, then every change
+// recorded afterwards until the client disconnects
+func (tcp *TCPWatcher) streamDashboard(conn net.Conn) error {
+	// Subscribe before reading the snapshot so nothing recorded in between is missed
+	changes, unsubscribe := tcp.edithistoryStore.Subscribe()
+	defer unsubscribe()
+
+	assignments, err := tcp.edithistoryStore.GetAssignments()
+	if err != nil {
+		writeMessage(conn, 'R', nil)
+		return err
+	}
+	counts, err := tcp.edithistoryStore.GetFileEventCounts()
+	if err != nil {
+		writeMessage(conn, 'R', nil)
+		return err
+	}
+	snapshot, err := json.Marshal(assignments)
+	if err != nil {
+		return err
+	}
+	if err := writeMessage(conn, 'A', snapshot); err != nil {
+		return err
+	}
+	chunk := make(map[string]int, fileEventsPerMessage)
+	flush := func() error {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		clear(chunk)
+		return writeMessage(conn, RespFileEvents, data)
+	}
+	for path, count := range counts {
+		chunk[path] = count
+		if len(chunk) == fileEventsPerMessage {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(chunk) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+
+	// The client sends nothing after subscribing, reading only notices when it goes away
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(gone)
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return nil
+		case change, ok := <-changes:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(change)
+			if err != nil {
+				return err
+			}
+			if err := writeMessage(conn, RespChange, data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeMessage writes a length-prefixed response, the first byte is the response code
+func writeMessage(conn net.Conn, resp byte, payload []byte) error {
+	if len(payload)+1 > math.MaxUint16 {
+		return fmt.Errorf("response of %d bytes is too long", len(payload))
+	}
+	lengthBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(lengthBytes, uint16(len(payload)+1))
+
+	message := append(lengthBytes, resp)
+	_, err := conn.Write(append(message, payload...))
+	return err
+}
+
 // readMessage reads length-prefixed message from the TCP connection
 func readMessage(conn net.Conn) (byte, string, error) {
 	header := make([]byte, 2)
@@ -118,7 +467,7 @@ func readMessage(conn net.Conn) (byte, string, error) {
 		total += n
 	}
 
-	cmd := data[0]              // first byte = command ('W', 'S', 'X') /watch /send
+	cmd := data[0]              // first byte = command ('W', 'S', 'X', 'O', 'B', 'D', 'I') /watch /status /stop watching /restore /bind /dashboard /baseline
 	payload := string(data[1:]) // payload
 	return cmd, payload, nil
 }
@@ -3,21 +3,30 @@ package main
 import (
 	"aiplag-agent/common/config"
 	"aiplag-agent/common/db"
+	"aiplag-agent/common/redact"
 	"aiplag-agent/daemon/commandListener"
 	"aiplag-agent/daemon/filesystemwatching"
+	"aiplag-agent/daemon/models"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/kardianos/service"
 )
 
 type Daemon struct {
-	watcher     *filesystemwatching.FSWatcher
-	logFile     *os.File
-	editHistory *db.EditHistoryStore
+	watcher       *filesystemwatching.FSWatcher
+	dispatcher    *filesystemwatching.EventDispatcher
+	logFile       *os.File
+	editHistory   *db.EditHistoryStore
+	settings      config.DaemonSettings
+	stopHeartbeat chan struct{}
+	stopUpdater   chan struct{}
+	// Detail of the daemon_stop event, says why the daemon stopped when it stops itself
+	stopDetail string
 }
 
 // Start is called when the service starts
@@ -38,6 +47,12 @@ func (d *Daemon) Start(s service.Service) error {
 		d.logFile = logFile
 	}
 
+	// Recorded secrets are redacted with the key the CLI submits with
+	if err := redact.Default.LoadKey(); err != nil {
+		log.Println("Failed to load the redaction key:", err)
+		return err
+	}
+
 	freePort, err := getFreePort()
 	if err != nil {
 		log.Println("Failed to get free TCP port:", err)
@@ -53,6 +68,7 @@ func (d *Daemon) Start(s service.Service) error {
 	log.Printf("Daemon TCP port written to %s (port %d)\n", portFilePath, freePort)
 
 	log.Println("Daemon starting...")
+	d.settings = config.LoadDaemonSettings()
 	dbPath := config.DBPath()
 
 	// Initialize stores
@@ -68,9 +84,33 @@ func (d *Daemon) Start(s service.Service) error {
 		return err
 	}
 
-	// Event handler + watcher
+	// Event handler + dispatcher + watcher
 	diffingHandler := filesystemwatching.NewDiffingEventHandler(d.editHistory, storedFS)
-	d.watcher = filesystemwatching.NewFSWatcher(diffingHandler)
+	diffingHandler.SetDiffBudget(filesystemwatching.DiffBudget{
+		Timeout:       d.settings.DiffTimeout,
+		MaxBytes:      d.settings.DiffMaxBytes,
+		MaxLineLength: d.settings.DiffMaxLineLength,
+	})
+	baselines, err := d.editHistory.GetBaselines()
+	if err != nil {
+		log.Println("Failed to load starter file baselines:", err)
+	}
+	for root, files := range baselines {
+		diffingHandler.SetBaseline(root, files)
+	}
+	d.dispatcher = filesystemwatching.NewEventDispatcher(diffingHandler, d.settings.Workers, d.settings.QueueSize)
+	// Reconciling records the differences on the workers, so it never races with them
+	diffingHandler.SetReconciler(d.dispatcher.Reconcile)
+	// Git commands and bulk changes are recognized before events are dispatched, so they are
+	// seen in the order they happened
+	bulkDetector := filesystemwatching.NewBulkOperationDetector(d.dispatcher, d.dispatcher, diffingHandler, filesystemwatching.BulkSettings{
+		MinFiles: d.settings.BulkMinFiles,
+		Window:   d.settings.BulkWindow,
+	})
+	// Paused directories are held back first, nothing done while paused is taken for an operation
+	pauseGate := filesystemwatching.NewPauseGate(filesystemwatching.NewGitOperationDetector(bulkDetector, diffingHandler))
+	diffingHandler.SetPauseCheck(pauseGate.IsPaused)
+	d.watcher = filesystemwatching.NewFSWatcher(pauseGate)
 
 	// TCP command listener (new signature includes editHistory)
 	tcpAdress, err := config.UsedTCPAddress()
@@ -79,15 +119,48 @@ func (d *Daemon) Start(s service.Service) error {
 		return nil
 	}
 	socket := commandListener.NewTCPWatcher(tcpAdress, d.watcher, storedFS, d.editHistory)
+	socket.SetDispatcher(d.dispatcher)
+	socket.SetHistoryRecorder(diffingHandler)
+	socket.SetPauseGate(pauseGate)
 
 	// Start components
-	go d.watcher.Run()
 	go socket.Run()
 
 	assignmentPaths, err := d.editHistory.GetAssignmentFullPaths()
 	for _, path := range assignmentPaths {
 		d.watcher.AddDirectory(path)
 	}
+	// Directories stay paused across restarts until plaggy resume
+	pauses, err := d.editHistory.GetPauses()
+	if err != nil {
+		log.Println("Failed to load paused directories:", err)
+	}
+	for root, pause := range pauses {
+		if err := pauseGate.Restore(root, pause); err != nil {
+			log.Printf("Failed to pause %s again: %v", root, err)
+		}
+	}
+
+	// Anything edited while the daemon was down is picked up by reconciling after the start event,
+	// so that the backend can tell those changes apart from live typing
+	startDetail := fmt.Sprintf("heartbeat=%s", d.settings.HeartbeatInterval)
+	if err := d.editHistory.AddLifecycleEvent(models.EventDaemonStarted, startDetail); err != nil {
+		log.Println("Failed to log daemon start event:", err)
+	}
+	for _, path := range assignmentPaths {
+		if !pauseGate.IsPaused(path) {
+			d.dispatcher.Reconcile(path)
+		}
+	}
+	// Events that arrive during reconciling wait in the watcher until it runs
+	go d.watcher.Run()
+
+	d.stopHeartbeat = make(chan struct{})
+	go d.runHeartbeat(d.stopHeartbeat)
+
+	d.stopUpdater = make(chan struct{})
+	go d.runUpdater(d.stopUpdater)
+	go d.confirmUpdate()
 
 	log.Println("Daemon started successfully.")
 	return nil
@@ -97,6 +170,25 @@ func (d *Daemon) Start(s service.Service) error {
 func (d *Daemon) Stop(s service.Service) error {
 	log.Println("Daemon stopping...")
 
+	if d.stopHeartbeat != nil {
+		close(d.stopHeartbeat)
+		d.stopHeartbeat = nil
+	}
+	if d.stopUpdater != nil {
+		close(d.stopUpdater)
+		d.stopUpdater = nil
+	}
+	// Let the workers store the edits that are still queued before recording the stop
+	if d.dispatcher != nil {
+		d.dispatcher.Close()
+		d.dispatcher = nil
+	}
+	if d.editHistory != nil {
+		if err := d.editHistory.AddLifecycleEvent(models.EventDaemonStopped, d.stopDetail); err != nil {
+			log.Println("Failed to log daemon stop event:", err)
+		}
+	}
+
 	if d.logFile != nil {
 		_ = d.logFile.Close()
 		d.logFile = nil
@@ -104,19 +196,23 @@ func (d *Daemon) Stop(s service.Service) error {
 	return nil
 }
 
-func GetServiceConfig() *service.Config {
-	svcConfig := &service.Config{
-		Name:        "PlaggyDaemon",
-		DisplayName: "Plaggy Daemon",
-		Description: "Daemon for monitoring filesystem changes and assignments.",
-		Option: map[string]any{
-			"StartType": "automatic",
-			// Windows is the only OS where StartType: "automatic" actually auto-starts without extra commands, after the service is installed.
-			// linux and macos require some shell commands of their own for launch on boot, could work on this later
-			// but it seems like that will be done when we actually have installer stuff instead of dev commands
-		},
-	}
-	return svcConfig
+// runHeartbeat periodically records that the daemon is alive until stop is closed.
+// Gaps between heartbeats are how the backend finds out that tracking was missing.
+func (d *Daemon) runHeartbeat(stop <-chan struct{}) {
+	ticker := time.NewTicker(d.settings.HeartbeatInterval)
+	defer ticker.Stop()
+
+	detail := fmt.Sprintf("heartbeat=%s", d.settings.HeartbeatInterval)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := d.editHistory.AddLifecycleEvent(models.EventHeartbeat, detail); err != nil {
+				log.Println("Failed to log heartbeat event:", err)
+			}
+		}
+	}
 }
 
 func getFreePort() (int, error) {
@@ -0,0 +1,201 @@
+// Recognizes tools changing many files at once, such as archive extraction or formatters
+package filesystemwatching
+
+import (
+	"aiplag-agent/daemon/models"
+	"log"
+	"sync"
+	"time"
+)
+
+// BulkSettings are the thresholds of the BulkOperationDetector
+type BulkSettings struct {
+	// Number of distinct files that have to change for a bulk operation
+	MinFiles int
+	// Time within which MinFiles have to change for an operation to start, and the largest gap
+	// between two changes of a running operation
+	Window time.Duration
+}
+
+// BulkRecorder receives the bulk operations found by a BulkOperationDetector
+type BulkRecorder interface {
+	// BulkOperationEnded tags the recorded events of the changed paths since the operation
+	// started and records the operation
+	BulkOperationEnded(operation models.BulkOperation, paths []string)
+}
+
+// Flusher waits until the events passed on so far are handled, see EventDispatcher.Flush
+type Flusher interface {
+	Flush()
+}
+
+// BulkOperationDetector is an FSEventHandler that groups changes to many files within a short
+// time into a bulk operation. A tool is only recognized once enough files changed, so the events
+// are tagged after they were recorded, when the operation is over.
+type BulkOperationDetector struct {
+	next     FSEventHandler
+	flusher  Flusher
+	recorder BulkRecorder
+	settings BulkSettings
+
+	mu sync.Mutex
+	// Changes within the last window while no operation is running, oldest first
+	recent    []observedChange
+	operation *bulkOperation
+}
+
+type observedChange struct {
+	path string
+	kind FSEventType
+	at   time.Time
+}
+
+// bulkOperation is a bulk operation that is still running
+type bulkOperation struct {
+	id        string
+	startedAt time.Time
+	last      time.Time
+	timer     *time.Timer
+	// First and last change of every path, a file that was added and deleted again is temporary
+	first map[string]FSEventType
+	final map[string]FSEventType
+	order []string
+}
+
+func NewBulkOperationDetector(next FSEventHandler, flusher Flusher, recorder BulkRecorder, settings BulkSettings) *BulkOperationDetector {
+	return &BulkOperationDetector{
+		next:     next,
+		flusher:  flusher,
+		recorder: recorder,
+		settings: settings,
+	}
+}
+
+func (d *BulkOperationDetector) FileAdded(path string) {
+	d.observe(path, FileAdded)
+	d.next.FileAdded(path)
+}
+
+func (d *BulkOperationDetector) FileDeleted(path string) {
+	d.observe(path, FileDeleted)
+	d.next.FileDeleted(path)
+}
+
+func (d *BulkOperationDetector) FileRenamed(oldPath string) {
+	d.observe(oldPath, FileRenamed)
+	d.next.FileRenamed(oldPath)
+}
+
+func (d *BulkOperationDetector) FileModified(path string) {
+	d.observe(path, FileModified)
+	d.next.FileModified(path)
+}
+
+func (d *BulkOperationDetector) EventsOverflowed() {
+	d.next.EventsOverflowed()
+}
+
+// observe adds a change to the running operation, or starts one when enough files changed recently
+func (d *BulkOperationDetector) observe(path string, kind FSEventType) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.operation != nil {
+		d.operation.add(path, kind)
+		d.operation.last = now
+		return
+	}
+
+	// An operation starts when enough files changed within one window
+	keep := 0
+	for keep < len(d.recent) && now.Sub(d.recent[keep].at) > d.settings.Window {
+		keep++
+	}
+	d.recent = append(d.recent[keep:], observedChange{path: path, kind: kind, at: now})
+
+	paths := make(map[string]bool)
+	for _, c := range d.recent {
+		paths[c.path] = true
+	}
+	if len(paths) < d.settings.MinFiles {
+		return
+	}
+
+	op := &bulkOperation{
+		id:        newOperationID(),
+		startedAt: d.recent[0].at,
+		last:      now,
+		first:     make(map[string]FSEventType),
+		final:     make(map[string]FSEventType),
+	}
+	for _, c := range d.recent {
+		op.add(c.path, c.kind)
+	}
+	d.recent = nil
+	d.operation = op
+	op.timer = time.AfterFunc(d.settings.Window, func() { d.finish(op) })
+}
+
+// finish ends the operation once no file changed for a window and hands it to the recorder
+func (d *BulkOperationDetector) finish(op *bulkOperation) {
+	d.mu.Lock()
+	if quietFor := time.Since(op.last); quietFor < d.settings.Window {
+		op.timer.Reset(d.settings.Window - quietFor)
+		d.mu.Unlock()
+		return
+	}
+	d.operation = nil
+	d.mu.Unlock()
+
+	// The events have to be recorded before they can be tagged
+	d.flusher.Flush()
+
+	operation := models.BulkOperation{
+		ID:        op.id,
+		StartedAt: op.startedAt,
+		EndedAt:   op.last,
+	}
+	for _, path := range op.order {
+		first, final := op.first[path], op.final[path]
+		switch {
+		case first == FileAdded && (final == FileDeleted || final == FileRenamed):
+			// Temporary files such as the backups formatters write
+		case first == FileAdded:
+			operation.Added++
+		case final == FileDeleted || final == FileRenamed:
+			operation.Deleted++
+		default:
+			operation.Modified++
+		}
+	}
+	operation.Kind = bulkKind(operation)
+	log.Printf("Bulk %s of %d files (%d added, %d modified, %d deleted) in %s", operation.Kind, len(op.order),
+		operation.Added, operation.Modified, operation.Deleted, op.last.Sub(op.startedAt).Round(time.Millisecond))
+	d.recorder.BulkOperationEnded(operation, op.order)
+}
+
+func (op *bulkOperation) add(path string, kind FSEventType) {
+	if _, seen := op.first[path]; !seen {
+		op.first[path] = kind
+		op.order = append(op.order, path)
+	}
+	op.final[path] = kind
+}
+
+// bulkKind labels an operation by what happened to at least four in five of its files
+func bulkKind(op models.BulkOperation) models.BulkOperationKind {
+	total := op.Added + op.Modified + op.Deleted
+	switch {
+	case total == 0:
+		return models.BulkMixed
+	case op.Added*5 >= total*4:
+		return models.BulkCopyIn
+	case op.Modified*5 >= total*4:
+		return models.BulkRewrite
+	case op.Deleted*5 >= total*4:
+		return models.BulkDelete
+	default:
+		return models.BulkMixed
+	}
+}
@@ -2,9 +2,19 @@ package filesystemwatching
 
 import (
 	"aiplag-agent/common/db"
+	"aiplag-agent/common/redact"
 	"aiplag-agent/daemon/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
 // DiffingEventHandler handles filesystem events by updating the stored
@@ -15,8 +25,39 @@ import (
 type DiffingEventHandler struct {
 	editHistoryHandler EditHistoryEventHandler
 	fsStore            *db.FilesystemStore
+
+	// Content hashes of files plaggy restore is about to write, by path
+	restoresMu      sync.Mutex
+	pendingRestores map[string]pendingRestore
+
+	// Content hashes of the starter files of every watched directory, by path
+	baselineMu sync.Mutex
+	baselines  map[string]string
+
+	// Git operations that changed a file whose event isn't recorded yet, by path
+	vcsTagsMu sync.Mutex
+	vcsTags   map[string]vcsTag
+
+	// Reports whether tracking of a watched directory is paused, see PauseGate
+	isPaused func(root string) bool
+	// Reconciles a watched directory after an overflow, see SetReconciler
+	reconcile func(root string)
+}
+
+type vcsTag struct {
+	operationID string
+	fromCommit  string
+	expires     time.Time
 }
 
+type pendingRestore struct {
+	contentHash string
+	expires     time.Time
+}
+
+// How long an announced restore waits for its write to show up
+const restoreExpiry = time.Minute
+
 // EditHistoryEventHandler provides the underlying logic for diffing file states
 // and writing events into the EditHistoryStore.
 type EditHistoryEventHandler struct {
@@ -35,52 +76,237 @@ func NewDiffingEventHandler(eh *db.EditHistoryStore, storedFS *db.FilesystemStor
 			storedFS:         storedFS,
 			fileDiffer:       NewFileDiffer(),
 		},
-		fsStore: storedFS,
+		fsStore:         storedFS,
+		pendingRestores: make(map[string]pendingRestore),
+		baselines:       make(map[string]string),
+		vcsTags:         make(map[string]vcsTag),
+	}
+}
+
+// SetDiffBudget limits the time and size of the diffs computed for modified files
+func (h *DiffingEventHandler) SetDiffBudget(budget DiffBudget) {
+	h.editHistoryHandler.fileDiffer.SetBudget(budget)
+}
+
+// SetPauseCheck makes reconciling after an overflow leave out the directories isPaused reports
+// as paused. They are reconciled when tracking resumes.
+func (h *DiffingEventHandler) SetPauseCheck(isPaused func(root string) bool) {
+	h.isPaused = isPaused
+}
+
+// SetReconciler makes reconciling after an overflow go through reconcile instead of recording the
+// differences on the calling goroutine, see EventDispatcher.Reconcile
+func (h *DiffingEventHandler) SetReconciler(reconcile func(root string)) {
+	h.reconcile = reconcile
+}
+
+// ExpectRestore announces that plaggy restore is about to write the file at path with content
+// of the given hash, see ContentHash. The write is then recorded as a "restored" event instead
+// of an edit, so restored text isn't mistaken for pasted text.
+func (h *DiffingEventHandler) ExpectRestore(path string, contentHash string) {
+	h.restoresMu.Lock()
+	defer h.restoresMu.Unlock()
+	h.pendingRestores[path] = pendingRestore{contentHash: contentHash, expires: time.Now().Add(restoreExpiry)}
+}
+
+// takeRestore reports whether content is the announced restore of path and forgets the announcement if so
+func (h *DiffingEventHandler) takeRestore(path string, content string) bool {
+	h.restoresMu.Lock()
+	defer h.restoresMu.Unlock()
+	restore, ok := h.pendingRestores[path]
+	if !ok {
+		return false
+	}
+	if time.Now().After(restore.expires) {
+		delete(h.pendingRestores, path)
+		return false
+	}
+	if restore.contentHash != ContentHash(content) {
+		return false
+	}
+	delete(h.pendingRestores, path)
+	return true
+}
+
+// SetBaseline replaces the starter files of the directory at root. Files whose content equals
+// their starter file are recorded with EventMeta.Baseline from now on.
+func (h *DiffingEventHandler) SetBaseline(root string, files []models.BaselineFile) {
+	h.baselineMu.Lock()
+	defer h.baselineMu.Unlock()
+	prefix := root + string(filepath.Separator)
+	for path := range h.baselines {
+		if strings.HasPrefix(path, prefix) {
+			delete(h.baselines, path)
+		}
+	}
+	for _, f := range files {
+		h.baselines[filepath.Join(root, filepath.FromSlash(f.Path))] = f.ContentHash
+	}
+}
+
+// isBaseline reports whether content is the starter file at path
+func (h *DiffingEventHandler) isBaseline(path string, content string) bool {
+	h.baselineMu.Lock()
+	defer h.baselineMu.Unlock()
+	hash, ok := h.baselines[path]
+	return ok && hash == ContentHash(content)
+}
+
+// TagOperation marks the next event recorded for path as changed by a git operation,
+// see GitOperationDetector
+func (h *DiffingEventHandler) TagOperation(path string, operationID string, fromCommit string) {
+	h.vcsTagsMu.Lock()
+	defer h.vcsTagsMu.Unlock()
+	h.vcsTags[path] = vcsTag{operationID: operationID, fromCommit: fromCommit, expires: time.Now().Add(restoreExpiry)}
+}
+
+// takeOperationTag adds the git operation that changed path to meta and forgets it
+func (h *DiffingEventHandler) takeOperationTag(path string, meta *models.EventMeta) {
+	h.vcsTagsMu.Lock()
+	defer h.vcsTagsMu.Unlock()
+	tag, ok := h.vcsTags[path]
+	if !ok {
+		return
+	}
+	delete(h.vcsTags, path)
+	if time.Now().After(tag.expires) {
+		return
+	}
+	meta.VCSOperation = tag.operationID
+	meta.VCSCommit = tag.fromCommit
+}
+
+// OperationEnded records a git operation found by the GitOperationDetector
+func (h *DiffingEventHandler) OperationEnded(operation models.VCSOperation) {
+	detail, err := json.Marshal(operation)
+	if err != nil {
+		log.Printf("OperationEnded: failed to encode git operation: %v", err)
+		return
+	}
+	err = h.editHistoryHandler.editHistoryStore.AddEvent(operation.Repository, models.EventVCSOperation, string(detail))
+	if err != nil {
+		log.Printf("OperationEnded: failed to log git %s in %s: %v", operation.Kind, operation.Repository, err)
+	}
+}
+
+// BulkOperationEnded tags the events recorded for paths since the operation started and records
+// the operation in every watched directory it touched, see BulkOperationDetector
+func (h *DiffingEventHandler) BulkOperationEnded(operation models.BulkOperation, paths []string) {
+	store := h.editHistoryHandler.editHistoryStore
+	tagged, err := store.TagBulkOperation(operation.ID, paths, operation.StartedAt)
+	if err != nil {
+		log.Printf("BulkOperationEnded: failed to tag events of bulk operation %s: %v", operation.ID, err)
+		return
 	}
+	for root, files := range tagged {
+		operation.Files = files
+		detail, err := json.Marshal(operation)
+		if err != nil {
+			log.Printf("BulkOperationEnded: failed to encode bulk operation: %v", err)
+			return
+		}
+		if err := store.AddAssignmentEvent(root, models.EventBulkOperation, string(detail)); err != nil {
+			log.Printf("BulkOperationEnded: failed to log bulk operation in %s: %v", root, err)
+		}
+	}
+}
+
+// ContentHash is the hash of a file's redacted content used to announce restores and baselines
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
 }
 
 // FileAdded stores the new file in the FilesystemStore and records an "added"
-// event in the EditHistoryStore. If reading or storing fails, errors are logged
+// event in the EditHistoryStore with the whole content as its patch, so the file can be
+// rebuilt from its history. If reading or storing fails, errors are logged
 // and the event may not be recorded.
+//
+// Editors that save by renaming a temporary file over the original make the original show up
+// as added while it is still in the FilesystemStore, that is handled as a modification.
 func (h *DiffingEventHandler) FileAdded(path string) {
-	content, err := os.ReadFile(path)
+	if _, err := h.fsStore.Open(path); err == nil {
+		h.FileModified(path)
+		return
+	}
+	content, err := readRedacted(path)
 	if err != nil {
 		log.Printf("FileAdded: failed to read file %s: %v", path, err)
 		return
 	}
 	file := &db.StoredFile{
-		Content:  string(content),
+		Content:  content,
 		Filepath: path,
 	}
+
+	eventType := models.EventAdded
+	if h.takeRestore(path, content) {
+		eventType = models.EventRestored
+	}
+	h.recordDiff("FileAdded", &db.StoredFile{Filepath: path}, file, eventType)
+
 	err = h.fsStore.AddOrUpdateFile(file)
 	if err != nil {
 		log.Printf("FileAdded: failed to add file to db %s: %v", path, err)
 	}
-	err = h.editHistoryHandler.editHistoryStore.AddEvent(path, models.EventAdded, "")
+}
+
+// recordDiff records an event of eventType with the patch from oldState to newState
+func (h *DiffingEventHandler) recordDiff(caller string, oldState *db.StoredFile, newState *db.StoredFile, eventType models.EditEventType) {
+	path := newState.Filepath
+	diff, err := h.editHistoryHandler.fileDiffer.Diff(oldState, newState)
+	if err != nil {
+		log.Printf("%s: failed diffing for %v", caller, path)
+	}
+	meta := models.EventMeta{}
+	if diff.Degraded {
+		log.Printf("%s: diff of %s is over budget (%s), storing a coarse patch", caller, path, diff.DegradedReason)
+		meta.Degraded = true
+		meta.DegradedReason = diff.DegradedReason
+	}
+	if eventType == models.EventAdded || eventType == models.EventModified {
+		meta.Baseline = h.isBaseline(path, newState.Content)
+	}
+	h.takeOperationTag(path, &meta)
+	err = h.editHistoryHandler.editHistoryStore.AddEventWithMeta(path, eventType, diff.Patch, meta)
 	if err != nil {
-		log.Printf("FileAdded: failed to log add event for %s: %v", path, err)
+		log.Printf("%s: failed to log %s event for %s: %v", caller, eventType, path, err)
 	}
 }
 
-// FileDeleted records a "deleted" event in the EditHistoryStore. No file
-// contents are touched.
+// FileDeleted records a "deleted" event in the EditHistoryStore and forgets the stored
+// copy, so a file created at the same path later starts a new history.
 func (h *DiffingEventHandler) FileDeleted(path string) {
-	err := h.editHistoryHandler.editHistoryStore.AddEvent(path, models.EventDeleted, "")
+	meta := models.EventMeta{}
+	h.takeOperationTag(path, &meta)
+	err := h.editHistoryHandler.editHistoryStore.AddEventWithMeta(path, models.EventDeleted, "", meta)
 	if err != nil {
 		log.Printf("FileDeleted: failed to log delete event for %s: %v", path, err)
 	}
+	if err := h.fsStore.DeleteFile(path); err != nil {
+		log.Printf("FileDeleted: failed to remove %s from stored filesystem: %v", path, err)
+	}
 }
 
-// FileRenamed records a "renamed" event in the EditHistoryStore for the old path.
+// FileRenamed records a "renamed" event in the EditHistoryStore for the old path and forgets
+// its stored copy, the new path is reported as added.
 func (h *DiffingEventHandler) FileRenamed(oldPath string) {
-	err := h.editHistoryHandler.editHistoryStore.AddEvent(oldPath, models.EventRenamed, "")
+	meta := models.EventMeta{}
+	h.takeOperationTag(oldPath, &meta)
+	err := h.editHistoryHandler.editHistoryStore.AddEventWithMeta(oldPath, models.EventRenamed, "", meta)
 	if err != nil {
 		log.Printf("FileRenamed: failed to log rename event for %s: %v", oldPath, err)
 	}
+	if err := h.fsStore.DeleteFile(oldPath); err != nil {
+		log.Printf("FileRenamed: failed to remove %s from stored filesystem: %v", oldPath, err)
+	}
 }
 
 // FileModified computes a diff between the stored file state and the local file,
 // then records a "modified" event with the patch in the EditHistoryStore.
+// Secrets are redacted from the local file before diffing, see the redact package.
+// The file is read once and the same snapshot is used for the diff and the stored state,
+// so a write that lands in between can't make the two disagree.
 // If diffing fails, the event may be missing or incomplete.
 func (h *DiffingEventHandler) FileModified(path string) {
 	log.Printf("EditHistoryEventHandler FileModified for %v", path)
@@ -90,27 +316,132 @@ func (h *DiffingEventHandler) FileModified(path string) {
 		log.Printf("FileModified: failed to open old file state for %s: %v", path, err)
 		return
 	}
-	file := LocalFile(path)
-	filePatch, err := h.editHistoryHandler.fileDiffer.Diff(oldFileState, file)
+	content, err := readRedacted(path)
 	if err != nil {
-		log.Printf("FileModified: failed diffing for %v", path)
+		log.Printf("FileModified: failed to read file %s: %v", path, err)
+		return
+	}
+	if content == oldFileState.Content {
+		// Metadata only changes and writes of the same content aren't edits
+		return
+	}
+	snapshot := &db.StoredFile{
+		Content:  content,
+		Filepath: path,
+	}
+
+	eventType := models.EventModified
+	if h.takeRestore(path, content) {
+		eventType = models.EventRestored
 	}
-	err = h.editHistoryHandler.editHistoryStore.AddEvent(path, models.EventModified, filePatch)
+	h.recordDiff("FileModified", oldFileState, snapshot, eventType)
+
+	err = h.fsStore.AddOrUpdateFile(snapshot)
 	if err != nil {
-		log.Printf("FileModified: failed to log modify event for %s: %v", path, err)
+		log.Printf("FileModified: failed to add file to db %s: %v", path, err)
 	}
+}
 
-	content, err := os.ReadFile(path)
+// EventsOverflowed records an "overflow" event for every watched assignment and then
+// reconciles each of them, since any edit may have been lost while the queue was full.
+func (h *DiffingEventHandler) EventsOverflowed() {
+	eh := h.editHistoryHandler.editHistoryStore
+	if err := eh.AddLifecycleEvent(models.EventOverflow, "kernel event queue overflowed"); err != nil {
+		log.Printf("EventsOverflowed: failed to log overflow event: %v", err)
+	}
+	assignmentPaths, err := eh.GetAssignmentFullPaths()
 	if err != nil {
-		log.Printf("FileAdded: failed to read file %s: %v", path, err)
+		log.Printf("EventsOverflowed: failed to get watched directories: %v", err)
 		return
 	}
-	fileToStore := &db.StoredFile{
-		Content:  string(content),
-		Filepath: path,
+	for _, root := range assignmentPaths {
+		if h.isPaused != nil && h.isPaused(root) {
+			continue
+		}
+		if h.reconcile != nil {
+			h.reconcile(root)
+		} else {
+			h.Reconcile(root)
+		}
+	}
+}
+
+// Reconcile compares the stored copy of every file under root with the files on disk and
+// records the differences as regular edit events, followed by a single "reconcile" event
+// summarising what was found. It is used after events may have been missed, for example
+// after a queue overflow or while the daemon was not running.
+func (h *DiffingEventHandler) Reconcile(root string) {
+	h.ReconcileThrough(root, h, func() {})
+}
+
+// ReconcileThrough is Reconcile with the differences handed to events instead of being recorded
+// right away, see EventDispatcher.Reconcile. flush is called before the summary is recorded and
+// returns once events has handled all of them.
+func (h *DiffingEventHandler) ReconcileThrough(root string, events FSEventHandler, flush func()) {
+	var added, modified, deleted int
+	onDisk := make(map[string]bool)
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			log.Printf("Reconcile: failed to walk %s: %v", path, walkErr)
+			return nil
+		}
+		if entry.IsDir() {
+			// Git internals aren't part of the assignment, see GitOperationDetector
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		onDisk[path] = true
+
+		stored, err := h.fsStore.Open(path)
+		if err != nil {
+			events.FileAdded(path)
+			added++
+			return nil
+		}
+		content, err := readRedacted(path)
+		if err != nil {
+			log.Printf("Reconcile: failed to read file %s: %v", path, err)
+			return nil
+		}
+		if content != stored.Content {
+			events.FileModified(path)
+			modified++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Reconcile: failed to walk %s: %v", root, err)
+	}
+
+	prefix := root + string(filepath.Separator)
+	for _, path := range h.fsStore.GetAllFilepaths() {
+		if !strings.HasPrefix(path, prefix) || onDisk[path] {
+			continue
+		}
+		if _, _, inGit := SplitGitPath(path); inGit {
+			continue
+		}
+		events.FileDeleted(path)
+		deleted++
+	}
+
+	flush()
+
+	detail := fmt.Sprintf("added=%d modified=%d deleted=%d", added, modified, deleted)
+	if err := h.editHistoryHandler.editHistoryStore.AddAssignmentEvent(root, models.EventReconcile, detail); err != nil {
+		log.Printf("Reconcile: failed to log reconcile event for %s: %v", root, err)
 	}
-	err = h.fsStore.AddOrUpdateFile(fileToStore)
+}
+
+// readRedacted reads the file at path with its secrets redacted.
+// Nothing read from disk should be stored or diffed without going through here.
+func readRedacted(path string) (string, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		log.Printf("FileAdded: failed to add file to db %s: %v", path, err)
+		return "", err
 	}
+	return redact.Default.Redact(path, string(content)), nil
 }
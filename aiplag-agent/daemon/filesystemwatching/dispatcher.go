@@ -0,0 +1,202 @@
+// Spreads filesystem events over a pool of workers so that a slow event doesn't hold up the others
+package filesystemwatching
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventDispatcher is an FSEventHandler that hands events to a fixed number of workers, each of
+// which calls the wrapped handler. Events are assigned to workers by hashing their path, so events
+// of the same file are always handled in the order they were observed.
+//
+// When a worker's queue is full the caller blocks until there is room again, which pushes back on
+// the fsnotify goroutine. How often and how long that happens is reported in the metrics.
+type EventDispatcher struct {
+	handler FSEventHandler
+	queues  []chan FSEvent
+	pending sync.WaitGroup
+	closed  chan struct{}
+
+	processed      atomic.Uint64
+	blocked        atomic.Uint64
+	blockedNanos   atomic.Int64
+	handleNanos    atomic.Int64
+	maxHandleNanos atomic.Int64
+	maxQueueDepth  atomic.Int64
+}
+
+// DispatcherMetrics is a snapshot of the dispatcher's backpressure counters
+type DispatcherMetrics struct {
+	Workers       int   `json:"workers"`
+	QueueCapacity int   `json:"queueCapacity"`
+	QueueDepths   []int `json:"queueDepths"`
+	// Highest queue depth seen on any worker since the daemon started
+	MaxQueueDepth int    `json:"maxQueueDepth"`
+	Processed     uint64 `json:"processed"`
+	// Number of events that had to wait for room in a full queue
+	BlockedEnqueues uint64  `json:"blockedEnqueues"`
+	BlockedMs       int64   `json:"blockedMs"`
+	AvgHandleMs     float64 `json:"avgHandleMs"`
+	MaxHandleMs     float64 `json:"maxHandleMs"`
+}
+
+// NewEventDispatcher starts workers goroutines with a queue of queueSize events each
+func NewEventDispatcher(handler FSEventHandler, workers int, queueSize int) *EventDispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	d := &EventDispatcher{
+		handler: handler,
+		queues:  make([]chan FSEvent, workers),
+		closed:  make(chan struct{}),
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan FSEvent, queueSize)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+func (d *EventDispatcher) FileAdded(path string) {
+	d.dispatch(FSEvent{Type: FileAdded, Path: path})
+}
+
+func (d *EventDispatcher) FileDeleted(path string) {
+	d.dispatch(FSEvent{Type: FileDeleted, Path: path})
+}
+
+func (d *EventDispatcher) FileRenamed(oldPath string) {
+	d.dispatch(FSEvent{Type: FileRenamed, Path: oldPath, OldPath: oldPath})
+}
+
+func (d *EventDispatcher) FileModified(path string) {
+	d.dispatch(FSEvent{Type: FileModified, Path: path})
+}
+
+// EventsOverflowed waits for every queued event to be handled before passing the overflow on,
+// since reconciling while workers are still writing the same files would race with them.
+func (d *EventDispatcher) EventsOverflowed() {
+	d.pending.Wait()
+	d.handler.EventsOverflowed()
+}
+
+// Reconciler is a handler that can reconcile a watched directory through another handler,
+// see DiffingEventHandler.ReconcileThrough
+type Reconciler interface {
+	ReconcileThrough(root string, events FSEventHandler, flush func())
+}
+
+// Reconcile reconciles root on the workers. It waits for the queued events first, so the stored
+// files are current when they are compared with the disk, and then hands every difference to the
+// worker of its path, so no other event of the same file is recorded at the same time. It returns
+// once the differences and the summary are recorded.
+func (d *EventDispatcher) Reconcile(root string) {
+	reconciler, ok := d.handler.(Reconciler)
+	if !ok {
+		return
+	}
+	d.pending.Wait()
+	reconciler.ReconcileThrough(root, d, d.Flush)
+}
+
+// Flush waits until every event queued so far is handled
+func (d *EventDispatcher) Flush() {
+	d.pending.Wait()
+}
+
+// Metrics returns the current backpressure counters
+func (d *EventDispatcher) Metrics() DispatcherMetrics {
+	m := DispatcherMetrics{
+		Workers:         len(d.queues),
+		QueueCapacity:   cap(d.queues[0]),
+		QueueDepths:     make([]int, len(d.queues)),
+		MaxQueueDepth:   int(d.maxQueueDepth.Load()),
+		Processed:       d.processed.Load(),
+		BlockedEnqueues: d.blocked.Load(),
+		BlockedMs:       time.Duration(d.blockedNanos.Load()).Milliseconds(),
+		MaxHandleMs:     float64(d.maxHandleNanos.Load()) / float64(time.Millisecond),
+	}
+	for i, q := range d.queues {
+		m.QueueDepths[i] = len(q)
+	}
+	if m.Processed > 0 {
+		m.AvgHandleMs = float64(d.handleNanos.Load()) / float64(m.Processed) / float64(time.Millisecond)
+	}
+	return m
+}
+
+// Close stops the workers after the already queued events are handled
+func (d *EventDispatcher) Close() {
+	d.pending.Wait()
+	close(d.closed)
+}
+
+func (d *EventDispatcher) dispatch(event FSEvent) {
+	queue := d.queues[d.workerFor(event.Path)]
+	d.pending.Add(1)
+
+	select {
+	case queue <- event:
+	default:
+		// Queue is full, block the caller until the worker catches up
+		d.blocked.Add(1)
+		start := time.Now()
+		queue <- event
+		d.blockedNanos.Add(int64(time.Since(start)))
+	}
+
+	storeMax(&d.maxQueueDepth, int64(len(queue)))
+}
+
+func (d *EventDispatcher) workerFor(path string) int {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+func (d *EventDispatcher) work(queue <-chan FSEvent) {
+	for {
+		select {
+		case <-d.closed:
+			return
+		case event := <-queue:
+			start := time.Now()
+			d.handle(event)
+			elapsed := int64(time.Since(start))
+
+			d.processed.Add(1)
+			d.handleNanos.Add(elapsed)
+			storeMax(&d.maxHandleNanos, elapsed)
+			d.pending.Done()
+		}
+	}
+}
+
+func (d *EventDispatcher) handle(event FSEvent) {
+	switch event.Type {
+	case FileAdded:
+		d.handler.FileAdded(event.Path)
+	case FileDeleted:
+		d.handler.FileDeleted(event.Path)
+	case FileRenamed:
+		d.handler.FileRenamed(event.Path)
+	case FileModified:
+		d.handler.FileModified(event.Path)
+	}
+}
+
+// storeMax raises the value of max to v if v is larger
+func storeMax(max *atomic.Int64, v int64) {
+	for {
+		current := max.Load()
+		if v <= current || max.CompareAndSwap(current, v) {
+			return
+		}
+	}
+}
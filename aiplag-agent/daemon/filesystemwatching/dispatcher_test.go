@@ -0,0 +1,55 @@
+package filesystemwatching
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingReconciler records the order in which files and reconcile summaries are handled
+type recordingReconciler struct {
+	mu      sync.Mutex
+	handled []string
+}
+
+func (r *recordingReconciler) record(entry string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handled = append(r.handled, entry)
+}
+
+func (r *recordingReconciler) FileAdded(path string) {
+	// Slow enough that anything not waiting for the worker overtakes it
+	time.Sleep(20 * time.Millisecond)
+	r.record("added " + path)
+}
+func (r *recordingReconciler) FileDeleted(path string)  { r.record("deleted " + path) }
+func (r *recordingReconciler) FileRenamed(path string)  { r.record("renamed " + path) }
+func (r *recordingReconciler) FileModified(path string) { r.record("modified " + path) }
+func (r *recordingReconciler) EventsOverflowed()        {}
+
+func (r *recordingReconciler) ReconcileThrough(root string, events FSEventHandler, flush func()) {
+	r.record("scan " + root)
+	events.FileModified(root + "/a.txt")
+	flush()
+	r.record("reconcile " + root)
+}
+
+func TestReconcileWaitsForTheWorkers(t *testing.T) {
+	handler := &recordingReconciler{}
+	d := NewEventDispatcher(handler, 4, 8)
+	defer d.Close()
+
+	d.FileAdded("/work/b.txt")
+	d.Reconcile("/work")
+
+	want := []string{"added /work/b.txt", "scan /work", "modified /work/a.txt", "reconcile /work"}
+	if len(handler.handled) != len(want) {
+		t.Fatalf("handled %v, want %v", handler.handled, want)
+	}
+	for i := range want {
+		if handler.handled[i] != want[i] {
+			t.Fatalf("handled %v, want %v", handler.handled, want)
+		}
+	}
+}
@@ -8,43 +8,139 @@ import (
 	"net/url"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
+// DiffBudget bounds how much work a single diff may take. Files over the budget get a coarse
+// diff that replaces the changed block as a whole instead of a line level one.
+type DiffBudget struct {
+	// Time allowed for the line level diff
+	Timeout time.Duration
+	// Largest file, in bytes, that gets a line level diff
+	MaxBytes int
+	// Longest line that gets a line level diff, minified and generated files go over this
+	MaxLineLength int
+}
+
+// DefaultDiffBudget is used until SetBudget is called
+var DefaultDiffBudget = DiffBudget{
+	Timeout:       500 * time.Millisecond,
+	MaxBytes:      2 << 20,
+	MaxLineLength: 2000,
+}
+
+// DiffResult is the patch between two file states.
+// A degraded patch is still applyable but doesn't tell which lines inside the changed block changed.
+type DiffResult struct {
+	Patch          string
+	Degraded       bool
+	DegradedReason string
+}
+
 type FileDiffer struct {
 	differ *diffmatchpatch.DiffMatchPatch
+	budget DiffBudget
 }
 
 func NewFileDiffer() *FileDiffer {
 	fd := &FileDiffer{}
 	fd.differ = diffmatchpatch.New()
+	fd.SetBudget(DefaultDiffBudget)
 	return fd
 }
 
-func (fd *FileDiffer) Diff(file1 models.File, file2 models.File) (string, error) {
+// SetBudget changes the limits used for the following diffs
+func (fd *FileDiffer) SetBudget(budget DiffBudget) {
+	fd.budget = budget
+	fd.differ.DiffTimeout = budget.Timeout
+}
+
+func (fd *FileDiffer) Diff(file1 models.File, file2 models.File) (result DiffResult, err error) {
 	// diffmatchpath PatchMake can sometimes throw a fatal error, especially when the file is a binary.
 	// For these cases, we need to catch the error with recover()
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("FileDiffer panic on %s vs %s: %v", file1.Path(), file2.Path(), r)
+			err = fmt.Errorf("diffing %s panicked: %v", file2.Path(), r)
 		}
 	}()
 
 	filecontent1, err := file1.Read()
 	if err != nil {
 		log.Printf("FileDiffer Diff: Failed to read %s: %v", file1.Path(), err)
-		return "", err
+		return DiffResult{}, err
 	}
 	filecontent2, err := file2.Read()
 	if err != nil {
 		log.Printf("FileDiffer Diff; Failed to read %s: %v", file2.Path(), err)
-		return "", err
+		return DiffResult{}, err
 	}
 
+	if reason := fd.overBudget(filecontent1, filecontent2); reason != "" {
+		return fd.coarseResult(filecontent1, filecontent2, reason), nil
+	}
+
+	start := time.Now()
 	patchText := fd.UnifiedLineLevelPatches(filecontent1, filecontent2)
-	fmt.Println(patchText)
-	return patchText, nil
+	if fd.budget.Timeout > 0 && time.Since(start) >= fd.budget.Timeout {
+		// diffmatchpatch gives up on finding a minimal diff when it runs out of time,
+		// the result is valid but not worth more than the coarse diff
+		return fd.coarseResult(filecontent1, filecontent2, "timeout"), nil
+	}
+	return DiffResult{Patch: patchText}, nil
+}
+
+// overBudget returns why the contents can't get a line level diff, or "" if they can
+func (fd *FileDiffer) overBudget(contents ...string) string {
+	for _, content := range contents {
+		if fd.budget.MaxBytes > 0 && len(content) > fd.budget.MaxBytes {
+			return "file too large"
+		}
+		if fd.budget.MaxLineLength > 0 && longestLine(content) > fd.budget.MaxLineLength {
+			return "line too long"
+		}
+	}
+	return ""
+}
+
+func (fd *FileDiffer) coarseResult(filecontent1 string, filecontent2 string, reason string) DiffResult {
+	return DiffResult{
+		Patch:          fd.CoarseBlockPatches(filecontent1, filecontent2),
+		Degraded:       true,
+		DegradedReason: reason,
+	}
+}
+
+// CoarseBlockPatches makes a patch that keeps the lines both contents start and end with
+// and replaces everything in between as a single block. It takes linear time.
+func (fd *FileDiffer) CoarseBlockPatches(filecontent1 string, filecontent2 string) string {
+	lines1 := strings.SplitAfter(filecontent1, "\n")
+	lines2 := strings.SplitAfter(filecontent2, "\n")
+
+	prefix := 0
+	for prefix < len(lines1) && prefix < len(lines2) && lines1[prefix] == lines2[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(lines1)-prefix && suffix < len(lines2)-prefix &&
+		lines1[len(lines1)-1-suffix] == lines2[len(lines2)-1-suffix] {
+		suffix++
+	}
+
+	diffs := []diffmatchpatch.Diff{}
+	addDiff := func(diffType diffmatchpatch.Operation, lines []string) {
+		if text := strings.Join(lines, ""); text != "" {
+			diffs = append(diffs, diffmatchpatch.Diff{Type: diffType, Text: text})
+		}
+	}
+	addDiff(diffmatchpatch.DiffEqual, lines1[:prefix])
+	addDiff(diffmatchpatch.DiffDelete, lines1[prefix:len(lines1)-suffix])
+	addDiff(diffmatchpatch.DiffInsert, lines2[prefix:len(lines2)-suffix])
+	addDiff(diffmatchpatch.DiffEqual, lines1[len(lines1)-suffix:])
+
+	return fd.patchText(filecontent1, diffs)
 }
 
 func (fd *FileDiffer) UnifiedLineLevelPatches(filecontent1 string, filecontent2 string) string {
@@ -53,6 +149,11 @@ func (fd *FileDiffer) UnifiedLineLevelPatches(filecontent1 string, filecontent2
 	diffs = fd.differ.DiffCharsToLines(diffs, lineArray)
 	diffs = fd.differ.DiffCleanupSemantic(diffs)
 	diffs = fd.differ.DiffCleanupEfficiency(diffs)
+	return fd.patchText(filecontent1, diffs)
+}
+
+// patchText turns diffs into the patch text format that is stored and sent to the backend
+func (fd *FileDiffer) patchText(filecontent1 string, diffs []diffmatchpatch.Diff) string {
 	patches := fd.differ.PatchMake(filecontent1, diffs)
 	unfilteredPatchText := fd.differ.PatchToText(patches)
 
@@ -74,7 +175,9 @@ func (fd *FileDiffer) UnifiedLineLevelPatches(filecontent1 string, filecontent2
 			continue
 		}
 
-		patchHunk, err := url.QueryUnescape(encodedPatchText)
+		// PatchToText leaves '+' unescaped and QueryUnescape would turn it into a space,
+		// escape it first like diffmatchpatch's own PatchFromText does
+		patchHunk, err := url.QueryUnescape(strings.ReplaceAll(encodedPatchText, "+", "%2b"))
 		if err != nil {
 			sb.WriteString(patchLine)
 			sb.WriteString("\n")
@@ -123,3 +226,11 @@ func (fd *FileDiffer) UnifiedLineLevelPatches(filecontent1 string, filecontent2
 		return sb.String()
 	*/
 }
+
+func longestLine(content string) int {
+	longest := 0
+	for line := range strings.SplitSeq(content, "\n") {
+		longest = max(longest, len(line))
+	}
+	return longest
+}
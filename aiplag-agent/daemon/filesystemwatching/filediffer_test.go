@@ -0,0 +1,113 @@
+package filesystemwatching
+
+import (
+	"aiplag-agent/common/history"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// studentSource builds a Java like file of roughly the given number of lines, the kind of
+// file students edit most of the time
+func studentSource(lines int) string {
+	sb := strings.Builder{}
+	sb.WriteString("import java.util.*;\n\npublic class Solution {\n")
+	for i := 0; sb.Len() == 0 || strings.Count(sb.String(), "\n") < lines; i++ {
+		fmt.Fprintf(&sb, "    // Computes step %d of the assignment\n", i)
+		fmt.Fprintf(&sb, "    public static int step%d(int[] values) {\n", i)
+		fmt.Fprintf(&sb, "        int total = 0;\n")
+		fmt.Fprintf(&sb, "        for (int v : values) {\n            total += v * %d;\n        }\n", i)
+		fmt.Fprintf(&sb, "        return total;\n    }\n\n")
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// minifiedSource builds a single line file like a bundled or minified javascript file
+func minifiedSource(bytes int) string {
+	sb := strings.Builder{}
+	for i := 0; sb.Len() < bytes; i++ {
+		fmt.Fprintf(&sb, "function f%d(a,b){return a*%d+b;}var v%d=f%d(1,2);", i, i, i, i)
+	}
+	return sb.String()
+}
+
+func TestCoarsePatchApplies(t *testing.T) {
+	fd := NewFileDiffer()
+	original := studentSource(200)
+	edited := strings.Replace(original, "total += v * 42;", "total -= v * 42; // fixed", 1)
+	edited = strings.Replace(edited, "step150", "stepOneFifty", 1)
+
+	patch := fd.CoarseBlockPatches(original, edited)
+	got, err := history.ApplyPatch(original, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != edited {
+		t.Fatalf("coarse patch didn't reproduce the edited file")
+	}
+}
+
+func TestDiffDegradesOverBudget(t *testing.T) {
+	fd := NewFileDiffer()
+	fd.SetBudget(DiffBudget{Timeout: time.Second, MaxBytes: 1 << 20, MaxLineLength: 1000})
+
+	original := minifiedSource(20000)
+	edited := strings.Replace(original, "f10(1,2)", "f10(3,4)", 1)
+	result, err := fd.Diff(inMemoryFile{"a.js", original}, inMemoryFile{"a.js", edited})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Degraded || result.DegradedReason != "line too long" {
+		t.Fatalf("expected a degraded diff, got %+v", result)
+	}
+}
+
+type inMemoryFile struct {
+	path    string
+	content string
+}
+
+func (f inMemoryFile) Path() string          { return f.path }
+func (f inMemoryFile) Read() (string, error) { return f.content, nil }
+
+func BenchmarkDiffSmallEdit(b *testing.B) {
+	fd := NewFileDiffer()
+	original := studentSource(300)
+	edited := strings.Replace(original, "total += v * 7;", "total += v * 7 + 1;", 1)
+	b.ResetTimer()
+	for b.Loop() {
+		fd.Diff(inMemoryFile{"Solution.java", original}, inMemoryFile{"Solution.java", edited})
+	}
+}
+
+func BenchmarkDiffPastedBlock(b *testing.B) {
+	fd := NewFileDiffer()
+	original := studentSource(300)
+	edited := strings.Replace(original, "    // Computes step 20", studentSource(150)+"    // Computes step 20", 1)
+	b.ResetTimer()
+	for b.Loop() {
+		fd.Diff(inMemoryFile{"Solution.java", original}, inMemoryFile{"Solution.java", edited})
+	}
+}
+
+func BenchmarkDiffLargeFile(b *testing.B) {
+	fd := NewFileDiffer()
+	original := studentSource(20000)
+	edited := strings.Replace(original, "step19000(", "stepLast(", 1)
+	b.ResetTimer()
+	for b.Loop() {
+		fd.Diff(inMemoryFile{"Solution.java", original}, inMemoryFile{"Solution.java", edited})
+	}
+}
+
+func BenchmarkDiffMinifiedFile(b *testing.B) {
+	fd := NewFileDiffer()
+	original := minifiedSource(500000)
+	edited := strings.Replace(original, "f10(1,2)", "f10(3,4)", 1)
+	b.ResetTimer()
+	for b.Loop() {
+		fd.Diff(inMemoryFile{"bundle.js", original}, inMemoryFile{"bundle.js", edited})
+	}
+}
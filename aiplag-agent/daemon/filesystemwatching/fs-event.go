@@ -38,4 +38,6 @@ type FSEventHandler interface {
 	// A rename is always sent with the old path as Event.Name, and a Create event will be sent with the new name.
 	FileRenamed(oldPath string)
 	FileModified(path string)
+	// Called when the kernel event queue overflowed and some events were lost
+	EventsOverflowed()
 }
@@ -2,6 +2,7 @@
 package filesystemwatching
 
 import (
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
@@ -123,6 +124,9 @@ func (fsw *FSWatcher) Run() {
 				return
 			}
 			log.Println("error:", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				fsw.eventHandler.EventsOverflowed()
+			}
 		}
 	}
 }
@@ -0,0 +1,260 @@
+// Recognizes git commands running in watched directories, so the files they change aren't taken for typing
+package filesystemwatching
+
+import (
+	"aiplag-agent/daemon/models"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long after the last change inside .git an operation is considered over. Git changes the
+// working tree and then its refs in quick succession, and a pull fetches before it merges.
+const gitQuietPeriod = 2 * time.Second
+
+// VCSRecorder receives the git operations found by a GitOperationDetector
+type VCSRecorder interface {
+	// TagOperation marks the next event recorded for path as changed by the git operation
+	TagOperation(path string, operationID string, fromCommit string)
+	// OperationEnded records a git operation once it is over
+	OperationEnded(operation models.VCSOperation)
+}
+
+// GitOperationDetector is an FSEventHandler that watches the .git directories inside watched
+// directories for signs of a running git command: the index lock, HEAD and the refs. File events
+// that happen while a command runs are tagged with it before they are passed on, and events
+// inside .git are not passed on at all since they aren't edits of the assignment.
+type GitOperationDetector struct {
+	next     FSEventHandler
+	recorder VCSRecorder
+
+	mu         sync.Mutex
+	operations map[string]*gitOperation // by repository directory
+}
+
+// gitOperation is a git command that is still running or hasn't been quiet for long enough
+type gitOperation struct {
+	models.VCSOperation
+	lastSignal time.Time
+	timer      *time.Timer
+	// What the command changed inside .git, used to tell which command it was
+	mergeHead, fetchHead, origHead, stash, rebase, refs bool
+}
+
+func NewGitOperationDetector(next FSEventHandler, recorder VCSRecorder) *GitOperationDetector {
+	return &GitOperationDetector{
+		next:       next,
+		recorder:   recorder,
+		operations: make(map[string]*gitOperation),
+	}
+}
+
+func (d *GitOperationDetector) FileAdded(path string) {
+	if d.observe(path) {
+		d.next.FileAdded(path)
+	}
+}
+
+func (d *GitOperationDetector) FileDeleted(path string) {
+	if d.observe(path) {
+		d.next.FileDeleted(path)
+	}
+}
+
+func (d *GitOperationDetector) FileRenamed(oldPath string) {
+	if d.observe(oldPath) {
+		d.next.FileRenamed(oldPath)
+	}
+}
+
+func (d *GitOperationDetector) FileModified(path string) {
+	if d.observe(path) {
+		d.next.FileModified(path)
+	}
+}
+
+func (d *GitOperationDetector) EventsOverflowed() {
+	d.next.EventsOverflowed()
+}
+
+// observe handles a changed path and reports whether its event should be passed on.
+// Changes inside .git open or extend an operation, other changes are tagged with a running one.
+func (d *GitOperationDetector) observe(path string) bool {
+	repository, inside, ok := SplitGitPath(path)
+	if ok {
+		d.signal(repository, filepath.ToSlash(inside))
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for repository, op := range d.operations {
+		if strings.HasPrefix(path, repository+string(filepath.Separator)) {
+			op.Files++
+			d.recorder.TagOperation(path, op.ID, op.FromCommit)
+			break
+		}
+	}
+	return true
+}
+
+// signal records a change of the file inside the .git directory of repository
+func (d *GitOperationDetector) signal(repository string, inside string) {
+	opens := inside == "index.lock" || inside == "HEAD" || inside == "HEAD.lock" ||
+		inside == "MERGE_HEAD" || inside == "FETCH_HEAD" || inside == "ORIG_HEAD" ||
+		strings.HasPrefix(inside, "refs/") || inside == "packed-refs" ||
+		strings.HasPrefix(inside, "rebase-merge/") || strings.HasPrefix(inside, "rebase-apply/")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	op, running := d.operations[repository]
+	if !running {
+		// Objects and logs are written by commands that come with other signals as well
+		if !opens {
+			return
+		}
+		branch, commit := readGitHead(filepath.Join(repository, ".git"))
+		op = &gitOperation{VCSOperation: models.VCSOperation{
+			ID:         newOperationID(),
+			Repository: repository,
+			FromBranch: branch,
+			FromCommit: commit,
+			StartedAt:  time.Now(),
+		}}
+		d.operations[repository] = op
+		op.timer = time.AfterFunc(gitQuietPeriod, func() { d.finish(repository, op) })
+	}
+
+	op.lastSignal = time.Now()
+	switch {
+	case inside == "MERGE_HEAD":
+		op.mergeHead = true
+	case inside == "FETCH_HEAD":
+		op.fetchHead = true
+	case inside == "ORIG_HEAD":
+		op.origHead = true
+	case inside == "refs/stash" || inside == "logs/refs/stash":
+		op.stash = true
+	case strings.HasPrefix(inside, "rebase-merge/") || strings.HasPrefix(inside, "rebase-apply/"):
+		op.rebase = true
+	case strings.HasPrefix(inside, "refs/heads/") || inside == "packed-refs":
+		op.refs = true
+	}
+}
+
+// finish ends the operation once git has been quiet and released the index, or waits some more
+func (d *GitOperationDetector) finish(repository string, op *gitOperation) {
+	d.mu.Lock()
+	if d.operations[repository] != op {
+		d.mu.Unlock()
+		return
+	}
+	gitDir := filepath.Join(repository, ".git")
+	quietFor := time.Since(op.lastSignal)
+	if _, err := os.Stat(filepath.Join(gitDir, "index.lock")); err == nil || quietFor < gitQuietPeriod {
+		op.timer.Reset(max(gitQuietPeriod-quietFor, gitQuietPeriod/4))
+		d.mu.Unlock()
+		return
+	}
+	delete(d.operations, repository)
+	d.mu.Unlock()
+
+	op.ToBranch, op.ToCommit = readGitHead(gitDir)
+	op.EndedAt = op.lastSignal
+	op.Kind = op.kind()
+	if op.Kind == "" {
+		return
+	}
+	log.Printf("git %s in %s changed %d files (%s -> %s)", op.Kind, repository, op.Files, shortCommit(op.FromCommit), shortCommit(op.ToCommit))
+	d.recorder.OperationEnded(op.VCSOperation)
+}
+
+// kind tells which command ran from what it changed inside .git
+func (op *gitOperation) kind() models.VCSOperationKind {
+	headMoved := op.FromCommit != op.ToCommit
+	switch {
+	case op.rebase:
+		return models.VCSRebase
+	case op.mergeHead && op.fetchHead:
+		return models.VCSPull
+	case op.fetchHead && headMoved:
+		return models.VCSPull
+	case op.mergeHead:
+		return models.VCSMerge
+	case op.stash:
+		return models.VCSStash
+	case op.FromBranch != op.ToBranch:
+		return models.VCSCheckout
+	case op.origHead && headMoved:
+		return models.VCSReset
+	case op.refs && headMoved:
+		return models.VCSCommit
+	case headMoved:
+		// Detached HEAD moved to another commit
+		return models.VCSCheckout
+	default:
+		// Nothing moved, like git status refreshing the index or a fetch. Files changed meanwhile
+		// were changed by someone else, so the operation isn't recorded and their tags aren't trusted.
+		return ""
+	}
+}
+
+// SplitGitPath splits a path inside a .git directory into the directory holding .git and the
+// path below .git. ok is false for paths outside of any .git directory.
+func SplitGitPath(path string) (repository string, inside string, ok bool) {
+	parts := strings.Split(path, string(filepath.Separator))
+	for i, part := range parts {
+		if part == ".git" {
+			return strings.Join(parts[:i], string(filepath.Separator)), filepath.Join(parts[i+1:]...), true
+		}
+	}
+	return "", "", false
+}
+
+// readGitHead returns the branch HEAD is on, empty when detached, and the commit it points at
+func readGitHead(gitDir string) (branch string, commit string) {
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", ""
+	}
+	content := strings.TrimSpace(string(head))
+	ref, symbolic := strings.CutPrefix(content, "ref: ")
+	if !symbolic {
+		return "", content
+	}
+	branch = strings.TrimPrefix(ref, "refs/heads/")
+	if target, err := os.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref))); err == nil {
+		return branch, strings.TrimSpace(string(target))
+	}
+	// Refs that haven't changed since the last gc only live in packed-refs
+	packed, err := os.ReadFile(filepath.Join(gitDir, "packed-refs"))
+	if err != nil {
+		return branch, ""
+	}
+	for _, line := range strings.Split(string(packed), "\n") {
+		if hash, name, found := strings.Cut(strings.TrimSpace(line), " "); found && name == ref {
+			return branch, hash
+		}
+	}
+	return branch, ""
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+func newOperationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString([]byte(time.Now().String()))[:16]
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,276 @@
+// Lets students pause tracking of a watched directory without losing track of what changed
+package filesystemwatching
+
+import (
+	"aiplag-agent/daemon/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAlreadyPaused = errors.New("tracking is already paused")
+	ErrNotPaused     = errors.New("tracking is not paused")
+)
+
+// PauseGate is an FSEventHandler that holds back the events of paused directories. Instead of
+// being recorded they keep the hashes of the paused files up to date, so that the checksum of
+// the directory is known at any time. Events of other directories are passed on unchanged.
+type PauseGate struct {
+	next FSEventHandler
+
+	mu     sync.Mutex
+	paused map[string]*pausedTree // by watched directory
+}
+
+type pausedTree struct {
+	pause models.TrackingPause
+	// Hashes of the files when tracking paused and as they are now, by path
+	atPause map[string]string
+	current map[string]string
+}
+
+func NewPauseGate(next FSEventHandler) *PauseGate {
+	return &PauseGate{
+		next:   next,
+		paused: make(map[string]*pausedTree),
+	}
+}
+
+// Pause stops passing on the events of root and returns the pause with the checksum of root
+func (g *PauseGate) Pause(root string, reason string) (models.TrackingPause, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, paused := g.paused[root]; paused {
+		return models.TrackingPause{}, ErrAlreadyPaused
+	}
+	files, err := hashTree(root)
+	if err != nil {
+		return models.TrackingPause{}, err
+	}
+	tree := &pausedTree{
+		pause:   models.TrackingPause{Reason: reason, PausedAt: time.Now(), ChecksumAtPause: TreeChecksum(files)},
+		atPause: files,
+		current: make(map[string]string, len(files)),
+	}
+	for path, hash := range files {
+		tree.current[path] = hash
+	}
+	g.paused[root] = tree
+	return tree.pause, nil
+}
+
+// Restore pauses root again after a restart of the daemon, keeping the time and the checksum
+// of the original pause. Changes made while the daemon was down count as made while paused.
+func (g *PauseGate) Restore(root string, pause models.TrackingPause) error {
+	files, err := hashTree(root)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// The files at pause aren't known anymore, each file counts as changed if the tree did
+	atPause := files
+	if TreeChecksum(files) != pause.ChecksumAtPause {
+		atPause = nil
+	}
+	g.paused[root] = &pausedTree{pause: pause, atPause: atPause, current: files}
+	return nil
+}
+
+// Resume passes on the events of root again. The returned pause tells how the directory
+// changed meanwhile, its net change still has to be recorded by reconciling root.
+func (g *PauseGate) Resume(root string) (models.TrackingPause, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	tree, paused := g.paused[root]
+	if !paused {
+		return models.TrackingPause{}, ErrNotPaused
+	}
+	files, err := hashTree(root)
+	if err != nil {
+		return models.TrackingPause{}, err
+	}
+	delete(g.paused, root)
+
+	pause := tree.pause
+	pause.ResumedAt = time.Now()
+	pause.ChecksumAtResume = TreeChecksum(files)
+	pause.RollingChecksum = TreeChecksum(tree.current)
+	for path, hash := range files {
+		if tree.atPause[path] != hash {
+			pause.ChangedFiles++
+		}
+	}
+	for path := range tree.atPause {
+		if _, exists := files[path]; !exists {
+			pause.ChangedFiles++
+		}
+	}
+	return pause, nil
+}
+
+// IsPaused reports whether the events of root are held back
+func (g *PauseGate) IsPaused(root string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, paused := g.paused[root]
+	return paused
+}
+
+// Paused returns the pauses in effect, by watched directory
+func (g *PauseGate) Paused() map[string]models.TrackingPause {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	pauses := make(map[string]models.TrackingPause, len(g.paused))
+	for root, tree := range g.paused {
+		pauses[root] = tree.pause
+	}
+	return pauses
+}
+
+func (g *PauseGate) FileAdded(path string) {
+	if !g.hold(path, FileAdded) {
+		g.next.FileAdded(path)
+	}
+}
+
+func (g *PauseGate) FileDeleted(path string) {
+	if !g.hold(path, FileDeleted) {
+		g.next.FileDeleted(path)
+	}
+}
+
+func (g *PauseGate) FileRenamed(oldPath string) {
+	if !g.hold(oldPath, FileRenamed) {
+		g.next.FileRenamed(oldPath)
+	}
+}
+
+func (g *PauseGate) FileModified(path string) {
+	if !g.hold(path, FileModified) {
+		g.next.FileModified(path)
+	}
+}
+
+// EventsOverflowed hashes the paused directories again, since their events may have been lost
+func (g *PauseGate) EventsOverflowed() {
+	g.mu.Lock()
+	for root, tree := range g.paused {
+		if files, err := hashTree(root); err == nil {
+			tree.current = files
+		} else {
+			log.Printf("PauseGate: failed to hash %s after overflow: %v", root, err)
+		}
+	}
+	g.mu.Unlock()
+	g.next.EventsOverflowed()
+}
+
+// hold updates the hashes of a paused directory with the event and reports whether the event
+// belongs to a paused directory and must not be passed on
+func (g *PauseGate) hold(path string, kind FSEventType) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var tree *pausedTree
+	for root, t := range g.paused {
+		if strings.HasPrefix(path, root+string(filepath.Separator)) {
+			tree = t
+			break
+		}
+	}
+	if tree == nil {
+		return false
+	}
+	if _, _, inGit := SplitGitPath(path); inGit {
+		return true
+	}
+
+	// A path that was deleted or renamed away takes everything below it along
+	prefix := path + string(filepath.Separator)
+	for known := range tree.current {
+		if known == path || strings.HasPrefix(known, prefix) {
+			delete(tree.current, known)
+		}
+	}
+	if kind == FileAdded || kind == FileModified {
+		// Directories copied in are hashed as a whole, their files have no events of their own
+		if files, err := hashTree(path); err == nil {
+			for file, hash := range files {
+				tree.current[file] = hash
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("PauseGate: failed to hash %s: %v", path, err)
+		}
+	}
+	return true
+}
+
+// TreeChecksum combines the hashes of files into one checksum of the directory. It changes
+// whenever a file is added, removed or changes its content.
+func TreeChecksum(files map[string]string) string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	h := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%s\x00%s\n", path, files[path])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashTree returns the SHA-256 of every file below root, or of root itself when it is a file,
+// by path. Git internals are left out like everywhere else.
+func hashTree(root string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// Files that vanish while walking simply aren't part of the tree
+			return nil
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return nil
+		}
+		files[path] = hash
+		return nil
+	})
+	return files, err
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
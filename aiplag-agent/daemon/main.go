@@ -10,19 +10,7 @@ import (
 )
 
 func main() {
-	svcConfig := &service.Config{
-		Name:        "com.plaggy.daemon",
-		DisplayName: "Plaggy Daemon",
-		Description: "Daemon for monitoring filesystem changes and assignments.",
-		Executable:  config.DaemonExecutablePath(),
-		Option: map[string]interface{}{
-			"StartType": "automatic",
-			"RunAtLoad": true,
-			// Windows is the only OS where StartType: "automatic" actually auto-starts without extra commands, after the service is installed.
-			// linux and macos require some shell commands of their own for launch on boot, could work on this later
-			// but it seems like that will be done when we actually have installer stuff instead of dev commands
-		},
-	}
+	svcConfig := config.ServiceConfig()
 
 	d := &Daemon{} // <- type from daemon.go
 	s, err := service.New(d, svcConfig)
@@ -45,6 +33,7 @@ func main() {
 		return
 	}
 
+	checkPendingUpdate()
 	err = s.Run()
 	if err != nil {
 		logger.Error(err)
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// WatchedAssignment is a watched directory together with the backend assignment it was bound to
+// with plaggy watch --assignment or plaggy submit
+type WatchedAssignment struct {
+	ID   int
+	Path string
+	// Zero while the directory is not bound to a backend assignment
+	RemoteID    uint
+	Title       string
+	DueDate     time.Time
+	SubmittedAt time.Time
+}
+
+// IsBound reports whether the directory is bound to a backend assignment
+func (a WatchedAssignment) IsBound() bool {
+	return a.RemoteID != 0
+}
+
+// IsSubmitted reports whether the directory was submitted at least once
+func (a WatchedAssignment) IsSubmitted() bool {
+	return !a.SubmittedAt.IsZero()
+}
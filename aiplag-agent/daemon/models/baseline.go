@@ -0,0 +1,12 @@
+package models
+
+// BaselineFile is a starter file handed out with an assignment. Edits that leave a file equal
+// to its starter file are recorded with EventMeta.Baseline, so they don't count as typed.
+type BaselineFile struct {
+	// Relative to the assignment directory, slash separated
+	Path string `json:"path"`
+	// Of the file as handed out by the backend
+	SHA256 string `json:"sha256"`
+	// Of the redacted content, which is what the daemon stores and compares
+	ContentHash string `json:"contentHash"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// BulkOperationKind labels a BulkOperation by what happened to most of its files
+type BulkOperationKind string
+
+const (
+	// Files appeared, as when extracting an archive or copying a folder in
+	BulkCopyIn BulkOperationKind = "copy_in"
+	// Existing files were rewritten, as when running a formatter over the tree
+	BulkRewrite BulkOperationKind = "rewrite"
+	BulkDelete  BulkOperationKind = "delete"
+	BulkMixed   BulkOperationKind = "mixed"
+)
+
+// BulkOperation is a burst of changes to many files at once, made by a tool rather than typed.
+// File events recorded during it carry its ID in EventMeta.BulkOperation.
+type BulkOperation struct {
+	ID        string            `json:"id"`
+	Kind      BulkOperationKind `json:"kind"`
+	StartedAt time.Time         `json:"startedAt"`
+	EndedAt   time.Time         `json:"endedAt"`
+	// Number of file events tagged with the operation in the watched directory
+	Files    int `json:"files"`
+	Added    int `json:"added"`
+	Modified int `json:"modified"`
+	Deleted  int `json:"deleted"`
+}
@@ -13,6 +13,32 @@ type EditEvent struct {
 	FilePath     string
 	EventType    EditEventType
 	Timestamp    time.Time
+	// Position of the event within its assignment, starting from 1 without gaps
+	Seq int64
+	// Monotonic milliseconds since the daemon session started, only comparable within the same SessionID
+	MonoMs    int64
+	SessionID string
+	Meta      EventMeta
+}
+
+// EventMeta holds optional facts about how an event was recorded
+type EventMeta struct {
+	// The patch replaces the changed block as a whole because the file was over the diff budget
+	Degraded       bool   `json:"degraded,omitempty"`
+	DegradedReason string `json:"degradedReason,omitempty"`
+	// The file content equals a starter file handed out with the assignment, see EventBaseline
+	Baseline bool `json:"baseline,omitempty"`
+	// ID of the git operation that changed the file, see EventVCSOperation
+	VCSOperation string `json:"vcsOperation,omitempty"`
+	// Commit HEAD pointed at when the git operation started
+	VCSCommit string `json:"vcsCommit,omitempty"`
+	// ID of the burst of changes to many files the event was part of, see EventBulkOperation
+	BulkOperation string `json:"bulkOperation,omitempty"`
+}
+
+// IsZero reports whether there is nothing to store for the meta
+func (m EventMeta) IsZero() bool {
+	return m == EventMeta{}
 }
 
 // EditEventType represents the type of edit event applied to a file.
@@ -23,8 +49,46 @@ const (
 	EventModified EditEventType = "modified"
 	EventDeleted  EditEventType = "deleted"
 	EventRenamed  EditEventType = "renamed"
+	// A file was written back to an earlier recorded state with plaggy restore.
+	// The patch is a regular diff, but the content was not typed by the student.
+	EventRestored EditEventType = "restored"
+)
+
+// Lifecycle events are recorded by the daemon about itself rather than about a file.
+// They let the backend tell apart "nothing was typed" from "nothing was being tracked".
+// For these events FilePath is the assignment directory and Patch holds a short detail text.
+const (
+	EventDaemonStarted EditEventType = "daemon_start"
+	EventDaemonStopped EditEventType = "daemon_stop"
+	EventWatchAdded    EditEventType = "watch_added"
+	EventWatchRemoved  EditEventType = "watch_removed"
+	EventOverflow      EditEventType = "overflow"
+	EventReconcile     EditEventType = "reconcile"
+	EventHeartbeat     EditEventType = "heartbeat"
+	// Starter files were written with plaggy init, Patch lists them as JSON []BaselineFile
+	EventBaseline EditEventType = "baseline"
+	// A git command such as a checkout or pull ended, Patch holds the VCSOperation as JSON
+	EventVCSOperation EditEventType = "vcs_operation"
+	// Many files changed at once, Patch holds the BulkOperation as JSON
+	EventBulkOperation EditEventType = "bulk_operation"
+	// Tracking was paused or resumed with plaggy pause and plaggy resume, Patch holds the
+	// TrackingPause as JSON. The net change made while paused is reconciled after resuming.
+	EventTrackingPaused  EditEventType = "tracking_paused"
+	EventTrackingResumed EditEventType = "tracking_resumed"
 )
 
+// IsLifecycle reports whether the event describes the daemon itself instead of a file edit.
+func (t EditEventType) IsLifecycle() bool {
+	switch t {
+	case EventDaemonStarted, EventDaemonStopped, EventWatchAdded, EventWatchRemoved,
+		EventOverflow, EventReconcile, EventHeartbeat, EventBaseline, EventVCSOperation, EventBulkOperation,
+		EventTrackingPaused, EventTrackingResumed:
+		return true
+	default:
+		return false
+	}
+}
+
 // StringToEditEventType converts a string to an EditEventType constant.
 func StringToEditEventType(s string) (EditEventType, error) {
 	switch s {
@@ -36,7 +100,11 @@ func StringToEditEventType(s string) (EditEventType, error) {
 		return EventDeleted, nil
 	case string(EventRenamed):
 		return EventRenamed, nil
-	default:
-		return "", fmt.Errorf("invalid EditEventType: %q", s)
+	case string(EventRestored):
+		return EventRestored, nil
+	}
+	if t := EditEventType(s); t.IsLifecycle() {
+		return t, nil
 	}
+	return "", fmt.Errorf("invalid EditEventType: %q", s)
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// TrackingPause is a time the student paused tracking of a watched directory with plaggy pause.
+// The pause event holds it as JSON up to the checksum at pause, the resume event holds all of it.
+type TrackingPause struct {
+	Reason   string    `json:"reason"`
+	PausedAt time.Time `json:"pausedAt"`
+	// Checksum of the whole directory when tracking paused, see filesystemwatching.TreeChecksum
+	ChecksumAtPause string    `json:"checksumAtPause"`
+	ResumedAt       time.Time `json:"resumedAt,omitzero"`
+	// Checksum of the directory when tracking resumed, and the one kept up to date from the file
+	// events seen while paused. They differ when events were missed.
+	ChecksumAtResume string `json:"checksumAtResume,omitempty"`
+	RollingChecksum  string `json:"rollingChecksum,omitempty"`
+	// Number of files that are different, new or gone after the pause
+	ChangedFiles int `json:"changedFiles"`
+}
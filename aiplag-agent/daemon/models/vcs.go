@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// VCSOperationKind is the git command a VCSOperation was recognized as
+type VCSOperationKind string
+
+const (
+	VCSCheckout VCSOperationKind = "checkout"
+	VCSPull     VCSOperationKind = "pull"
+	VCSMerge    VCSOperationKind = "merge"
+	VCSRebase   VCSOperationKind = "rebase"
+	VCSReset    VCSOperationKind = "reset"
+	VCSStash    VCSOperationKind = "stash"
+	VCSCommit   VCSOperationKind = "commit"
+)
+
+// VCSOperation is a git command that ran in a watched directory. File events recorded while it
+// ran carry its ID in EventMeta.VCSOperation, since the files were changed by git and not typed.
+type VCSOperation struct {
+	ID   string           `json:"id"`
+	Kind VCSOperationKind `json:"kind"`
+	// Directory holding the .git directory
+	Repository string    `json:"repository"`
+	FromBranch string    `json:"fromBranch,omitempty"`
+	ToBranch   string    `json:"toBranch,omitempty"`
+	FromCommit string    `json:"fromCommit,omitempty"`
+	ToCommit   string    `json:"toCommit,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	EndedAt    time.Time `json:"endedAt"`
+	// Number of file events tagged with the operation
+	Files int `json:"files"`
+}
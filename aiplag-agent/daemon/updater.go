@@ -0,0 +1,227 @@
+package main
+
+import (
+	tcpclient "aiplag-agent/cli/tcp-client"
+	"aiplag-agent/common/buildinfo"
+	"aiplag-agent/common/config"
+	"aiplag-agent/common/update"
+	"aiplag-agent/daemon/commandListener"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// Exit code of a daemon that replaced its binaries, the service manager restarts it from the
+// new binary because it exited with a failure
+const updateRestartExitCode = 3
+
+// Startups of a new version that end before its health check passes, after these it is rolled back
+const maxUpdateAttempts = 3
+
+// How long a new version has to answer its status command after starting
+const healthCheckTimeout = 30 * time.Second
+
+// Time after starting before the first update check, so updates don't slow down booting
+const firstUpdateCheckDelay = 2 * time.Minute
+
+// updateTargets maps the artifact names of a release to the installed binaries they replace
+func updateTargets() map[string]string {
+	return map[string]string{
+		"plaggydaemon": config.DaemonExecutablePath(),
+		"plaggy":       config.CLIExecutablePath(),
+	}
+}
+
+func updateTargetPaths() []string {
+	var paths []string
+	for _, path := range updateTargets() {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// runUpdater checks the release manifest periodically until stop is closed. When a newer
+// release was installed the daemon exits to be restarted from it.
+func (d *Daemon) runUpdater(stop <-chan struct{}) {
+	if d.settings.UpdateManifestURL == "" {
+		log.Println("Updates are off, no release manifest configured")
+		return
+	}
+	key, err := update.ParsePublicKey(d.settings.UpdatePublicKey)
+	if err != nil {
+		log.Println("Updates are off:", err)
+		return
+	}
+
+	timer := time.NewTimer(firstUpdateCheckDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+			installed, err := d.installUpdate(key)
+			if err != nil {
+				log.Println("Update check failed:", err)
+			}
+			if installed {
+				d.exitForRestart()
+				return
+			}
+			timer.Reset(d.settings.UpdateInterval)
+		}
+	}
+}
+
+// installUpdate downloads a newer release and swaps in its binaries, it reports whether it did
+func (d *Daemon) installUpdate(key ed25519.PublicKey) (bool, error) {
+	manifest, err := update.FetchManifest(d.settings.UpdateManifestURL, key)
+	if err != nil {
+		return false, err
+	}
+	if buildinfo.CompareVersions(manifest.Version, buildinfo.Version) <= 0 {
+		return false, nil
+	}
+	state, err := update.LoadState(config.UpdateStatePath())
+	if err != nil {
+		return false, err
+	}
+	if state != nil && state.Status == update.StatusRolledBack && state.ToVersion == manifest.Version {
+		// Already failed once, wait for the next release
+		return false, nil
+	}
+
+	artifacts := manifest.ArtifactsFor(runtime.GOOS, runtime.GOARCH)
+	staged := make(map[string]string)
+	dir := filepath.Join(config.UpdatesDir(), manifest.Version)
+	for _, artifact := range artifacts {
+		path, err := update.Download(d.settings.UpdateManifestURL, artifact, dir)
+		if err != nil {
+			return false, err
+		}
+		staged[artifact.Name] = path
+	}
+	if _, ok := staged["plaggydaemon"]; !ok {
+		return false, fmt.Errorf("release %s has no daemon for %s/%s", manifest.Version, runtime.GOOS, runtime.GOARCH)
+	}
+
+	log.Printf("Installing update from %s to %s", buildinfo.Version, manifest.Version)
+	if err := update.Swap(staged, updateTargets()); err != nil {
+		return false, err
+	}
+	state = &update.State{
+		FromVersion: buildinfo.Version,
+		ToVersion:   manifest.Version,
+		Status:      update.StatusPending,
+	}
+	if err := state.Save(config.UpdateStatePath()); err != nil {
+		// Without the state a broken new version would never be rolled back
+		update.Rollback(updateTargetPaths())
+		return false, fmt.Errorf("failed to save update state: %w", err)
+	}
+	d.stopDetail = "update to " + manifest.Version
+	return true, nil
+}
+
+// exitForRestart stops the daemon and exits with a failure, the service manager then starts
+// whatever binary is installed now
+func (d *Daemon) exitForRestart() {
+	d.Stop(nil)
+	os.Exit(updateRestartExitCode)
+}
+
+// checkPendingUpdate runs before the daemon starts. It counts the startups of a freshly
+// installed version and rolls it back when it keeps failing before its health check.
+func checkPendingUpdate() {
+	state, err := update.LoadState(config.UpdateStatePath())
+	if err != nil {
+		log.Println("Failed to read update state:", err)
+		return
+	}
+	if state == nil || state.Status != update.StatusPending {
+		return
+	}
+	if state.ToVersion != buildinfo.Version {
+		state.Status = update.StatusRolledBack
+		state.Reason = fmt.Sprintf("version %s started instead", buildinfo.Version)
+		state.Save(config.UpdateStatePath())
+		return
+	}
+	state.Attempts++
+	if state.Attempts > maxUpdateAttempts {
+		rollbackUpdate(state, fmt.Sprintf("stopped %d times before its health check passed", maxUpdateAttempts))
+		os.Exit(updateRestartExitCode)
+	}
+	if err := state.Save(config.UpdateStatePath()); err != nil {
+		log.Println("Failed to save update state:", err)
+	}
+}
+
+// confirmUpdate waits for the daemon to answer its status command with the new version.
+// If it doesn't in time the previous binaries are put back and the daemon restarts.
+func (d *Daemon) confirmUpdate() {
+	state, err := update.LoadState(config.UpdateStatePath())
+	if err != nil || state == nil || state.Status != update.StatusPending || state.ToVersion != buildinfo.Version {
+		return
+	}
+
+	deadline := time.Now().Add(healthCheckTimeout)
+	for {
+		err := healthCheck()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			rollbackUpdate(state, "health check failed: "+err.Error())
+			d.stopDetail = "rollback to " + state.FromVersion
+			d.exitForRestart()
+			return
+		}
+		time.Sleep(time.Second)
+	}
+
+	state.Status = update.StatusConfirmed
+	if err := state.Save(config.UpdateStatePath()); err != nil {
+		log.Println("Failed to save update state:", err)
+	}
+	update.Cleanup(updateTargetPaths())
+	os.RemoveAll(config.UpdatesDir())
+	log.Printf("Update from %s to %s is healthy", state.FromVersion, state.ToVersion)
+}
+
+// healthCheck asks the running daemon for its status the way the CLI does
+func healthCheck() error {
+	resp, payload, err := tcpclient.SendRequest('S', "")
+	if err != nil {
+		return err
+	}
+	if resp != 'A' {
+		return errors.New("status command was rejected")
+	}
+	var status commandListener.DaemonStatus
+	if err := json.Unmarshal(payload, &status); err != nil {
+		return err
+	}
+	if status.Version != buildinfo.Version {
+		return fmt.Errorf("daemon reports version %q", status.Version)
+	}
+	return nil
+}
+
+func rollbackUpdate(state *update.State, reason string) {
+	log.Printf("Rolling back update to %s: %s", state.ToVersion, reason)
+	if err := update.Rollback(updateTargetPaths()); err != nil {
+		log.Println("Rollback failed:", err)
+	}
+	state.Status = update.StatusRolledBack
+	state.Reason = reason
+	if err := state.Save(config.UpdateStatePath()); err != nil {
+		log.Println("Failed to save update state:", err)
+	}
+}
@@ -1,129 +1,75 @@
 package main
 
 import (
-	"aiplag-agent/common/config"
 	"fmt"
-	"net"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
-	"strconv"
-)
-
-func main() {
-	isWindows := runtime.GOOS == "windows"
-	// Create directory
-	if err := os.MkdirAll(config.AppDataDir(), 0755); err != nil {
-		fmt.Println("Error creating directory:", config.AppDataDir(), err)
-		return
-	}
-
-	// Make the directory readable and writable by all
-	if err := os.Chmod(config.AppDataDir(), 0777); err != nil {
-		fmt.Println("Failed to set permissions on directory:", config.AppDataDir(), err)
-		return
-	}
-
-	// Check if config file exists
-	if _, err := os.Stat(config.ConfigPath()); os.IsNotExist(err) {
-		// Create empty file with 0666 permissions (read/write for all)
-		file, err := os.OpenFile(config.ConfigPath(), os.O_CREATE|os.O_WRONLY, 0666)
-		if err != nil {
-			fmt.Println("Failed to create config file:", err)
-			return
-		}
-		file.Close()
-		// Make sure permissions are correct
-		if err := os.Chmod(config.ConfigPath(), 0666); err != nil {
-			fmt.Println("Failed to set permissions on config file:", err)
-			return
-		}
-	}
-
-	dbPath := config.DBPath()
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		file, err := os.OpenFile(dbPath, os.O_CREATE|os.O_WRONLY, 0666)
-		if err != nil {
-			fmt.Println("Failed to create DB file:", err)
-			return
-		}
-		file.Close()
-	}
-
-	// Ensure permissions are 0666
-	if err := os.Chmod(dbPath, 0666); err != nil {
-		fmt.Println("Failed to set permissions on DB file:", err)
-		return
-	}
 
-	// Build CLI
-	fmt.Println("Building CLI...")
-	cliOut := filepath.Join(config.UserBinDir(), "plaggy")
-	if isWindows {
-		cliOut += ".exe"
-	}
-	err := build("./cli", cliOut)
+	"github.com/spf13/cobra"
+)
 
-	// Build daemon
-	fmt.Println("Building daemon...")
-	daemonOut := config.DaemonExecutablePath()
-	err = build("./daemon", daemonOut)
-	if err != nil {
-		if isWindows {
-			fmt.Println("You need to run this installer with a root terminal")
-		} else {
-			fmt.Println("You need to run this installer with sudo:")
-			fmt.Println("    sudo go run ./installer")
-		}
-	}
+var (
+	binariesDir string
+	keepData    bool
+	assumeYes   bool
+)
 
-	portFile, err := os.Create(config.TCPPortFilePath())
-	freePort, err := getFreePort()
-	portFile.WriteString(strconv.Itoa(freePort))
+var rootCmd = &cobra.Command{
+	Use:   "installer",
+	Short: "Install, upgrade, repair or uninstall plaggy",
+	Long: `Installs the plaggy CLI and daemon, registers the daemon as a service that starts on boot and
+sets up the app data directory.
+
+Needs to run as root, with sudo on Linux and macOS and from an administrator terminal on
+Windows. Without a subcommand it installs.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return install()
+	},
+}
 
-	// Run daemon commands using exec
-	actions := []string{"stop", "uninstall", "install", "start"}
-	for _, action := range actions {
-		if err := runDaemonCommand(daemonOut, action); err != nil {
-			fmt.Printf("Daemon command %q failed: %v\n", action, err)
-		}
-	}
-	fmt.Println("Started Plaggy Daemon")
+var installCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install plaggy and start the daemon",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return install()
+	},
+}
 
-	fmt.Println("Installation complete!")
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Replace the installed binaries and migrate the existing data",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return upgrade()
+	},
 }
 
-func build(pkg, output string) error {
-	cmd := exec.Command("go", "build", "-o", output, pkg)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		fmt.Println("Build failed")
-		return err
-	}
-	return nil
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Restore permissions, the port file and the service registration",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return repair()
+	},
 }
 
-// runDaemonCommand runs the daemon binary with the given argument, suppressing stdout/stderr
-func runDaemonCommand(daemonPath, arg string) error {
-	cmd := exec.Command(daemonPath, arg)
-	cmd.Stdout = nil // Supress output
-	cmd.Stderr = nil
-	return cmd.Run()
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove plaggy, offering to export the recorded history first",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return uninstall()
+	},
 }
 
-func getFreePort() (int, error) {
-	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
-	if err != nil {
-		return 0, err
+func main() {
+	for _, cmd := range []*cobra.Command{rootCmd, installCmd, upgradeCmd} {
+		cmd.Flags().StringVar(&binariesDir, "binaries", "", "install prebuilt plaggy and plaggydaemon binaries from this directory instead of building them")
 	}
+	uninstallCmd.Flags().BoolVar(&keepData, "keep-data", false, "keep the recorded history and config")
+	uninstallCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "don't ask, remove everything without exporting")
+	rootCmd.AddCommand(installCmd, upgradeCmd, repairCmd, uninstallCmd)
 
-	l, err := net.ListenTCP("tcp", addr)
-	if err != nil {
-		return 0, err
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
-	defer l.Close()
-
-	return l.Addr().(*net.TCPAddr).Port, nil
 }
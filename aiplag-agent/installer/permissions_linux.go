@@ -0,0 +1,119 @@
+package main
+
+import (
+	"aiplag-agent/common/config"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// Members of this group may use the CLI, everyone else has no access to the recorded history
+const groupName = "plaggy"
+
+// applyPermissions gives root and the plaggy group access to the app data directory and no one
+// else. The setgid bit makes files the daemon or CLI create later belong to the group as well.
+func applyPermissions() error {
+	gid, err := ensureGroup()
+	if err != nil {
+		return err
+	}
+	dataDir := config.AppDataDir()
+	if err := setOwnership(dataDir, 0, gid, 0770|fs.ModeSetgid); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", dataDir, err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dataDir, entry.Name())
+		switch {
+		case path == config.AppBinDir():
+			// Only root runs the daemon
+			if err := setOwnership(path, 0, 0, 0755); err != nil {
+				return err
+			}
+		case path == config.DeviceKeyPath(), path == config.RedactionKeyPath():
+			// The CLI signs exports and redacts secrets with the keys but never changes them
+			if err := setOwnership(path, 0, gid, 0640); err != nil {
+				return err
+			}
+		case entry.Type().IsRegular():
+			// Database, its journal, config, port file and logs
+			if err := setOwnership(path, 0, gid, 0660); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func setBinaryOwnership(path string) error {
+	return setOwnership(path, 0, 0, 0755)
+}
+
+func setOwnership(path string, uid int, gid int, mode fs.FileMode) error {
+	if err := os.Chown(path, uid, gid); err != nil {
+		return fmt.Errorf("failed to change owner of %s: %w", path, err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	return nil
+}
+
+func ensureGroup() (int, error) {
+	group, err := user.LookupGroup(groupName)
+	var unknown user.UnknownGroupError
+	if errors.As(err, &unknown) {
+		if out, err := exec.Command("groupadd", "--system", groupName).CombinedOutput(); err != nil {
+			return 0, fmt.Errorf("failed to create group %s: %v: %s", groupName, err, out)
+		}
+		group, err = user.LookupGroup(groupName)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up group %s: %w", groupName, err)
+	}
+	return strconv.Atoi(group.Gid)
+}
+
+// grantInstallingUser adds the user who ran sudo to the plaggy group
+func grantInstallingUser() {
+	name := os.Getenv("SUDO_USER")
+	if name == "" || name == "root" {
+		fmt.Printf("Add the students using plaggy to the %s group: sudo usermod -aG %s <user>\n", groupName, groupName)
+		return
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return
+	}
+	groups, err := u.GroupIds()
+	if err == nil {
+		group, err := user.LookupGroup(groupName)
+		if err == nil {
+			for _, id := range groups {
+				if id == group.Gid {
+					return
+				}
+			}
+		}
+	}
+	if out, err := exec.Command("usermod", "-aG", groupName, name).CombinedOutput(); err != nil {
+		fmt.Printf("Failed to add %s to the %s group: %v: %s\n", name, groupName, err, out)
+		return
+	}
+	fmt.Printf("Added %s to the %s group, log out and back in before using plaggy\n", name, groupName)
+}
+
+// revokeAccess removes the plaggy group once nothing belongs to it anymore
+func revokeAccess() {
+	if out, err := exec.Command("groupdel", groupName).CombinedOutput(); err != nil {
+		fmt.Printf("Failed to remove the %s group: %v: %s\n", groupName, err, out)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package main
+
+import (
+	"aiplag-agent/common/config"
+	"fmt"
+	"os"
+)
+
+// applyPermissions makes the app data directory usable by the CLI of every user. Only Linux
+// installs restrict it to a group so far.
+func applyPermissions() error {
+	if err := os.Chmod(config.AppDataDir(), 0777); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", config.AppDataDir(), err)
+	}
+	for _, path := range []string{config.ConfigPath(), config.DBPath(), config.TCPPortFilePath()} {
+		if err := os.Chmod(path, 0666); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func setBinaryOwnership(path string) error {
+	return os.Chmod(path, 0755)
+}
+
+// grantInstallingUser does nothing, every user has access
+func grantInstallingUser() {}
+
+// revokeAccess does nothing, there is no group to remove
+func revokeAccess() {}
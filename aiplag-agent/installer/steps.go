@@ -0,0 +1,401 @@
+package main
+
+import (
+	"aiplag-agent/common/config"
+	"aiplag-agent/common/db"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kardianos/service"
+	"github.com/manifoldco/promptui"
+)
+
+var isWindows = runtime.GOOS == "windows"
+
+func install() error {
+	if err := requireAdmin(); err != nil {
+		return err
+	}
+	if err := prepareDataDir(); err != nil {
+		return err
+	}
+	if err := layDownBinaries(); err != nil {
+		return err
+	}
+	removeLegacyService()
+	if err := migrateData(); err != nil {
+		return err
+	}
+	if err := ensurePortFile(true); err != nil {
+		return err
+	}
+	if err := applyPermissions(); err != nil {
+		return err
+	}
+	grantInstallingUser()
+	if err := registerService(); err != nil {
+		return err
+	}
+	fmt.Println("Installation complete!")
+	return nil
+}
+
+func upgrade() error {
+	if err := requireAdmin(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(config.DaemonExecutablePath()); err != nil {
+		return errors.New("plaggy is not installed, run the installer with install instead")
+	}
+	if err := prepareDataDir(); err != nil {
+		return err
+	}
+	// The daemon keeps the database open, it has to be stopped before the schema is migrated
+	daemonCommand("stop")
+	removeLegacyService()
+	if err := layDownBinaries(); err != nil {
+		daemonCommand("start")
+		return err
+	}
+	if err := migrateData(); err != nil {
+		return err
+	}
+	if err := ensurePortFile(false); err != nil {
+		return err
+	}
+	if err := applyPermissions(); err != nil {
+		return err
+	}
+	if err := registerService(); err != nil {
+		return err
+	}
+	fmt.Println("Upgrade complete!")
+	return nil
+}
+
+func repair() error {
+	if err := requireAdmin(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(config.DaemonExecutablePath()); err != nil {
+		return errors.New("the daemon executable is missing, run the installer with install instead")
+	}
+	if err := prepareDataDir(); err != nil {
+		return err
+	}
+	daemonCommand("stop")
+	removeLegacyService()
+	if err := migrateData(); err != nil {
+		return err
+	}
+	if err := ensurePortFile(false); err != nil {
+		return err
+	}
+	if err := applyPermissions(); err != nil {
+		return err
+	}
+	grantInstallingUser()
+	if err := registerService(); err != nil {
+		return err
+	}
+	fmt.Println("Repair complete!")
+	return nil
+}
+
+func uninstall() error {
+	if err := requireAdmin(); err != nil {
+		return err
+	}
+	if !keepData && !assumeYes {
+		if err := offerExport(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Removing the daemon service...")
+	daemonCommand("stop")
+	daemonCommand("uninstall")
+	removeLegacyService()
+
+	for _, path := range []string{config.CLIExecutablePath(), config.DaemonExecutablePath()} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	if keepData {
+		fmt.Println("Kept the recorded history in", config.AppDataDir())
+	} else {
+		if err := os.RemoveAll(config.AppDataDir()); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", config.AppDataDir(), err)
+		}
+		revokeAccess()
+	}
+	fmt.Println("Plaggy was uninstalled.")
+	return nil
+}
+
+// offerExport asks whether the history of every watched directory should be exported with
+// plaggy export before it is deleted
+func offerExport() error {
+	if _, err := os.Stat(config.DBPath()); err != nil {
+		return nil
+	}
+	eh, err := db.NewEditHistoryStore(config.DBPath())
+	if err != nil {
+		return fmt.Errorf("failed to read the recorded history: %w", err)
+	}
+	paths, err := eh.GetAssignmentFullPaths()
+	eh.Close()
+	if err != nil || len(paths) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Plaggy recorded the history of %d directories, uninstalling deletes it.\n", len(paths))
+	if !confirm("Export it as evidence bundles first") {
+		return nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	failed := false
+	for _, path := range paths {
+		out := filepath.Join(cwd, fmt.Sprintf("plaggy-%s-%s.zip", filepath.Base(path), time.Now().Format("20060102-150405")))
+		cmd := exec.Command(config.CLIExecutablePath(), "export", path, "-o", out)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("Failed to export %s: %v\n", path, err)
+			failed = true
+		}
+	}
+	if failed && !confirm("Some directories could not be exported, uninstall anyway") {
+		return errors.New("uninstall cancelled")
+	}
+	return nil
+}
+
+func confirm(label string) bool {
+	prompt := promptui.Prompt{Label: label, IsConfirm: true}
+	_, err := prompt.Run()
+	return err == nil
+}
+
+func requireAdmin() error {
+	if isWindows {
+		// Creating the service fails later with a clear message if the terminal isn't elevated
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return errors.New("you need to run this installer with sudo:\n    sudo go run ./installer " + strings.Join(os.Args[1:], " "))
+	}
+	return nil
+}
+
+// prepareDataDir creates the app data directory with an empty config and database
+func prepareDataDir() error {
+	for _, dir := range []string{config.AppDataDir(), config.AppBinDir(), config.UserBinDir()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+	for _, path := range []string{config.ConfigPath(), config.DBPath()} {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0660)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		file.Close()
+	}
+	return nil
+}
+
+// layDownBinaries builds or copies the CLI and daemon and swaps them in place. A running
+// daemon keeps using its old executable until it is restarted.
+func layDownBinaries() error {
+	source := binariesDir
+	if source == "" {
+		tmp, err := os.MkdirTemp("", "plaggy-build-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		fmt.Println("Building CLI...")
+		if err := build("./cli", filepath.Join(tmp, filepath.Base(config.CLIExecutablePath()))); err != nil {
+			return err
+		}
+		fmt.Println("Building daemon...")
+		if err := build("./daemon", filepath.Join(tmp, filepath.Base(config.DaemonExecutablePath()))); err != nil {
+			return err
+		}
+		source = tmp
+	}
+
+	for _, dst := range []string{config.CLIExecutablePath(), config.DaemonExecutablePath()} {
+		if err := installBinary(filepath.Join(source, filepath.Base(dst)), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installBinary copies src next to dst and renames it over dst, so an interrupted copy never
+// leaves a broken executable behind
+func installBinary(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	tmp := dst + ".new"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := setBinaryOwnership(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace %s: %w", dst, err)
+	}
+	return nil
+}
+
+// migrateData opens the stores, which brings the schema up to date and fills in anything
+// newer versions record for old events
+func migrateData() error {
+	fmt.Println("Migrating recorded history...")
+	eh, err := db.NewEditHistoryStore(config.DBPath())
+	if err != nil {
+		return fmt.Errorf("failed to migrate edit history: %w", err)
+	}
+	stats, err := eh.Stats()
+	eh.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read edit history: %w", err)
+	}
+	storedFS, err := db.NewFilesystemStore(config.DBPath())
+	if err != nil {
+		return fmt.Errorf("failed to migrate stored files: %w", err)
+	}
+	storedFS.Close()
+
+	events := 0
+	for _, count := range stats.EventsByAssignment {
+		events += count
+	}
+	fmt.Printf("Kept %d events of %d watched directories\n", events, stats.Assignments)
+	return nil
+}
+
+// ensurePortFile picks a free port for the daemon, an existing valid port is kept unless force is set
+func ensurePortFile(force bool) error {
+	if !force {
+		data, err := os.ReadFile(config.TCPPortFilePath())
+		if err == nil {
+			if _, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+				return nil
+			}
+		}
+	}
+	port, err := getFreePort()
+	if err != nil {
+		return fmt.Errorf("failed to find a free port: %w", err)
+	}
+	if err := os.WriteFile(config.TCPPortFilePath(), []byte(strconv.Itoa(port)), 0660); err != nil {
+		return fmt.Errorf("failed to write port file: %w", err)
+	}
+	return nil
+}
+
+// registerService reinstalls the service so its definition matches the installed version and starts it
+func registerService() error {
+	daemonCommand("stop")
+	daemonCommand("uninstall")
+	for _, action := range []string{"install", "start"} {
+		if err := daemonCommand(action); err != nil {
+			return fmt.Errorf("daemon command %q failed: %w", action, err)
+		}
+	}
+	fmt.Println("Started Plaggy Daemon")
+	return nil
+}
+
+func build(pkg, output string) error {
+	cmd := exec.Command("go", "build", "-o", output, pkg)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("build of %s failed: %w", pkg, err)
+	}
+	return nil
+}
+
+// daemonCommand runs the installed daemon binary with the given service action, suppressing stdout/stderr
+func daemonCommand(action string) error {
+	cmd := exec.Command(config.DaemonExecutablePath(), action)
+	cmd.Stdout = nil // Supress output
+	cmd.Stderr = nil
+	return cmd.Run()
+}
+
+// noopProgram lets the installer control a service without being it
+type noopProgram struct{}
+
+func (noopProgram) Start(service.Service) error { return nil }
+func (noopProgram) Stop(service.Service) error  { return nil }
+
+// removeLegacyService stops and uninstalls the daemon service of versions before the service
+// was renamed, an upgrade would otherwise leave it running next to the new one
+func removeLegacyService() {
+	legacy := config.LegacyServiceConfig()
+	s, err := service.New(noopProgram{}, legacy)
+	if err != nil {
+		return
+	}
+	if _, err := s.Status(); errors.Is(err, service.ErrNotInstalled) {
+		return
+	}
+	_ = s.Stop()
+	if err := s.Uninstall(); err != nil {
+		fmt.Printf("Failed to remove the old %s service: %v\n", legacy.Name, err)
+		return
+	}
+	fmt.Printf("Removed the old %s service\n", legacy.Name)
+}
+
+func getFreePort() (int, error) {
+	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+
+	l, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,44 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/plagai/plagai-backend/flagging"
+	"github.com/plagai/plagai-backend/flagging/features"
+	"github.com/plagai/plagai-backend/flagging/similarity"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+	"gorm.io/gorm"
+)
+
+// ruleContext loads what the rules know about a student assignment besides its events
+func ruleContext(db *gorm.DB, assignment domain.Assignment, studentAssignmentID uint) (flagging.RuleContext, error) {
+	pairs, err := repository.NewSimilarityRepository(db).GetPairsOf(studentAssignmentID)
+	if err != nil {
+		return flagging.RuleContext{}, fmt.Errorf("failed to load similarity pairs: %w", err)
+	}
+	documents, err := repository.NewCorpusRepository(db).GetDocuments(assignment.ID)
+	if err != nil {
+		return flagging.RuleContext{}, fmt.Errorf("failed to load corpus documents: %w", err)
+	}
+	starterFiles, err := repository.NewStarterFileRepository(db).GetStarterFiles(assignment.ID)
+	if err != nil {
+		return flagging.RuleContext{}, fmt.Errorf("failed to load starter files: %w", err)
+	}
+	class, err := repository.NewFeatureRepository(db).GetClassFeatures(assignment.ID)
+	if err != nil {
+		return flagging.RuleContext{}, fmt.Errorf("failed to load class features: %w", err)
+	}
+	ctx := flagging.RuleContext{
+		Assignment:      assignment,
+		SimilarityPairs: pairs,
+		Corpus:          similarity.NewCorpus(documents, similarity.StarterHashes(starterFiles)),
+		ClassStats:      features.Stats(class),
+	}
+	for _, f := range class {
+		if f.StudentAssignmentID == studentAssignmentID {
+			ctx.Features = f.Values
+		}
+	}
+	return ctx, nil
+}
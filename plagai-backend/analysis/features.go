@@ -0,0 +1,35 @@
+package analysis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/plagai/plagai-backend/flagging"
+	"github.com/plagai/plagai-backend/flagging/features"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+	"gorm.io/gorm"
+)
+
+// UpdateFeatures measures the features of a student assignment and stores them for the class
+// distributions of its assignment. Sessions are split with the idle gap of the assignment's
+// work_session rule. Student assignments without typed edits are left out of the distributions.
+func UpdateFeatures(db *gorm.DB, sa database.StudentAssignment, configs []domain.RuleConfig, events []models.EditEvent) error {
+	def, _ := flagging.LookupRule("work_session")
+	idleGap := time.Duration(flagging.ConfiguredParams(configs, def)["idle_gap_minutes"] * float64(time.Minute))
+
+	repo := repository.NewFeatureRepository(db)
+	values, measured := features.Measure(flagging.AssignmentDiffs(events), idleGap)
+	if !measured {
+		if err := repo.DeleteFeatures(sa.ID); err != nil {
+			return fmt.Errorf("failed to delete features: %w", err)
+		}
+		return nil
+	}
+	if err := repo.SaveFeatures(sa.AssignmentID, domain.FeatureValues{StudentAssignmentID: sa.ID, Values: values}); err != nil {
+		return fmt.Errorf("failed to store features: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/plagai/plagai-backend/flagging/similarity"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+	"github.com/plagai/plagai-backend/service"
+	"gorm.io/gorm"
+)
+
+// MinStoredScore is the similarity below which pairs aren't stored, most submissions of a class
+// share a few fingerprints by chance
+const MinStoredScore = 10
+
+// UpdateSimilarity fingerprints the final files rebuilt from the events of a student assignment
+// and compares them with the other submissions of its assignment. Code of the starter files isn't
+// fingerprinted since everyone was handed it. It returns the other student assignments whose pair
+// with this one changed, their similarity flags are outdated.
+//
+// Two submissions analysed at the same time may each compare against the other's previous
+// fingerprints. The pair then changes for both, so both are analysed again and the pair settles.
+func UpdateSimilarity(db *gorm.DB, sa database.StudentAssignment, events []models.EditEvent) ([]uint, error) {
+	starterFiles, err := repository.NewStarterFileRepository(db).GetStarterFiles(sa.AssignmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load starter files: %w", err)
+	}
+	starter := similarity.StarterHashes(starterFiles)
+
+	// Files whose history can't be replayed are left out, FinalSnapshotRule flags them
+	files, _ := service.RebuildFiles(events)
+	fingerprints := similarity.FileFingerprints(files, starter)
+
+	repo := repository.NewSimilarityRepository(db)
+	if err := repo.ReplaceFingerprints(sa.ID, fingerprints); err != nil {
+		return nil, fmt.Errorf("failed to store %d fingerprints: %w", len(fingerprints), err)
+	}
+	all, err := repo.GetFingerprints(sa.AssignmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fingerprints of assignment %d: %w", sa.AssignmentID, err)
+	}
+	var pairs []domain.SimilarityPair
+	for other, theirs := range all {
+		if other == sa.ID {
+			continue
+		}
+		match := similarity.Compare(fingerprints, theirs)
+		if match.Score < MinStoredScore {
+			continue
+		}
+		pairs = append(pairs, domain.SimilarityPair{
+			AssignmentID:             sa.AssignmentID,
+			StudentAssignmentID:      sa.ID,
+			OtherStudentAssignmentID: other,
+			Score:                    match.Score,
+			SharedFingerprints:       match.Shared,
+			Regions:                  match.Regions,
+		})
+	}
+	changed, err := repo.ReplacePairs(sa.AssignmentID, sa.ID, pairs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store %d similarity pairs: %w", len(pairs), err)
+	}
+	return changed, nil
+}
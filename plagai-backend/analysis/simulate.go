@@ -0,0 +1,48 @@
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/plagai/plagai-backend/flagging"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+	"gorm.io/gorm"
+)
+
+// SimulatedSubmission holds the flags two engines raise on the stored history of a submission
+type SimulatedSubmission struct {
+	StudentAssignmentID uint
+	Current             []domain.Flag
+	Candidate           []domain.Flag
+}
+
+// Simulate runs the current and the candidate rule configurations over the stored history of
+// every student assignment without storing anything, to compare them
+func Simulate(db *gorm.DB, assignment domain.Assignment, studentAssignmentIDs []uint, current []domain.RuleConfig, candidate []domain.RuleConfig) ([]SimulatedSubmission, error) {
+	events := repository.NewEditEventRepository(db)
+	submissions := make([]SimulatedSubmission, 0, len(studentAssignmentIDs))
+	for _, id := range studentAssignmentIDs {
+		history, err := events.GetEvents(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load events of student assignment %d: %w", id, err)
+		}
+		ctx, err := ruleContext(db, assignment, id)
+		if err != nil {
+			return nil, err
+		}
+		currentEngine, err := flagging.BuildFlaggingEngine(current, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("invalid current rule configuration: %w", err)
+		}
+		candidateEngine, err := flagging.BuildFlaggingEngine(candidate, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("invalid candidate rule configuration: %w", err)
+		}
+		submissions = append(submissions, SimulatedSubmission{
+			StudentAssignmentID: id,
+			Current:             currentEngine.FlagAssignment(history),
+			Candidate:           candidateEngine.FlagAssignment(history),
+		})
+	}
+	return submissions, nil
+}
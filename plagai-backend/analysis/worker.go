@@ -0,0 +1,220 @@
+// Package analysis runs the flagging engine over submitted histories in the background, so
+// students don't wait for the rules when they submit.
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/plagai/plagai-backend/flagging"
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/models/mappers"
+	"github.com/plagai/plagai-backend/repository"
+	"gorm.io/gorm"
+)
+
+// Runs of a job before it is given up on and left as dead
+const DefaultMaxAttempts = 5
+
+type Settings struct {
+	Workers int
+	// How long a worker waits before looking for jobs again when there were none
+	PollInterval time.Duration
+	// How long a claimed job stays locked to its worker. A worker that crashes or hangs loses
+	// the job to another worker afterwards.
+	VisibilityTimeout time.Duration
+	// Wait before the first retry, doubled for every further one up to MaxRetryDelay
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+}
+
+// SettingsFromEnv returns the defaults, with the number of workers taken from ANALYSIS_WORKERS
+func SettingsFromEnv() Settings {
+	settings := Settings{
+		Workers:           2,
+		PollInterval:      2 * time.Second,
+		VisibilityTimeout: 10 * time.Minute,
+		RetryDelay:        30 * time.Second,
+		MaxRetryDelay:     30 * time.Minute,
+	}
+	if v, err := strconv.Atoi(os.Getenv("ANALYSIS_WORKERS")); err == nil && v >= 0 {
+		settings.Workers = v
+	}
+	return settings
+}
+
+// Pool is a set of workers taking analysis jobs off the queue
+type Pool struct {
+	db       *gorm.DB
+	jobs     repository.AnalysisJobRepository
+	settings Settings
+	wg       sync.WaitGroup
+}
+
+func NewPool(db *gorm.DB, settings Settings) *Pool {
+	return &Pool{
+		db:       db,
+		jobs:     repository.NewAnalysisJobRepository(db),
+		settings: settings,
+	}
+}
+
+// Start runs the workers until stop is closed, Wait waits for them to finish their jobs
+func (p *Pool) Start(stop <-chan struct{}) {
+	hostname, _ := os.Hostname()
+	for i := 0; i < p.settings.Workers; i++ {
+		workerID := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.work(workerID, stop)
+		}()
+	}
+	log.Printf("Started %d analysis workers", p.settings.Workers)
+}
+
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *Pool) work(workerID string, stop <-chan struct{}) {
+	for {
+		ran, err := p.runNext(workerID)
+		if err != nil {
+			log.Printf("analysis worker %s: %v", workerID, err)
+		}
+		if ran {
+			// Keep going while there is work, unless asked to stop
+			select {
+			case <-stop:
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(p.settings.PollInterval):
+		}
+	}
+}
+
+// runNext claims the next due job and runs it, it reports whether there was a job
+func (p *Pool) runNext(workerID string) (bool, error) {
+	job, err := p.jobs.Claim(workerID, p.settings.VisibilityTimeout)
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	// A job claimed again after its lock expired may have used up its attempts already
+	if job.Attempts > job.MaxAttempts {
+		reason := fmt.Sprintf("gave up after %d attempts, the last one didn't finish within %s", job.MaxAttempts, p.settings.VisibilityTimeout)
+		return true, p.jobs.Fail(job.ID, workerID, reason, time.Time{})
+	}
+
+	changes, runErr := runSafely(func() (domain.FlagVersionChanges, error) { return Analyze(p.db, job.StudentAssignmentID) })
+	if runErr == nil {
+		log.Printf("analysis job %d for student assignment %d raised %d flags in version %d", job.ID, job.StudentAssignmentID, changes.Flags, changes.Version)
+		return true, p.jobs.Complete(job.ID, workerID, changes.Flags)
+	}
+
+	retryAt := time.Time{}
+	if job.Attempts < job.MaxAttempts {
+		retryAt = time.Now().Add(p.retryDelay(job.Attempts))
+		log.Printf("analysis job %d for student assignment %d failed (attempt %d of %d), retrying at %s: %v",
+			job.ID, job.StudentAssignmentID, job.Attempts, job.MaxAttempts, retryAt.Format(time.RFC3339), runErr)
+	} else {
+		log.Printf("analysis job %d for student assignment %d failed for good after %d attempts: %v",
+			job.ID, job.StudentAssignmentID, job.Attempts, runErr)
+	}
+	if err := p.jobs.Fail(job.ID, workerID, runErr.Error(), retryAt); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func (p *Pool) retryDelay(attempts int) time.Duration {
+	delay := p.settings.RetryDelay
+	for i := 1; i < attempts && delay < p.settings.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.settings.MaxRetryDelay)
+}
+
+// runSafely turns a panic of a rule into an error of the job, so it doesn't take the server down
+func runSafely(run func() (domain.FlagVersionChanges, error)) (changes domain.FlagVersionChanges, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("analysis panicked: %v", recovered)
+		}
+	}()
+	return run()
+}
+
+// Analyze flags the whole history of a student assignment with the rules configured for its
+// assignment, after measuring its features and comparing its final files with the other
+// submissions. Flags judged against the class record the class as it was at this analysis. The
+// flags become a new version of the student assignment's flags when they differ from the stored
+// ones, see FlagRepository.SupersedeFlags.
+func Analyze(db *gorm.DB, studentAssignmentID uint) (domain.FlagVersionChanges, error) {
+	var sa database.StudentAssignment
+	if err := db.First(&sa, studentAssignmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.FlagVersionChanges{}, fmt.Errorf("student assignment %d not found", studentAssignmentID)
+		}
+		return domain.FlagVersionChanges{}, fmt.Errorf("failed to load student assignment %d: %w", studentAssignmentID, err)
+	}
+
+	var assignment database.Assignment
+	if err := db.First(&assignment, sa.AssignmentID).Error; err != nil {
+		return domain.FlagVersionChanges{}, fmt.Errorf("failed to load assignment %d: %w", sa.AssignmentID, err)
+	}
+	configs, err := repository.NewRuleConfigRepository(db).GetRuleConfigs(sa.AssignmentID)
+	if err != nil {
+		return domain.FlagVersionChanges{}, fmt.Errorf("failed to load rule configurations: %w", err)
+	}
+
+	events, err := repository.NewEditEventRepository(db).GetEvents(studentAssignmentID)
+	if err != nil {
+		return domain.FlagVersionChanges{}, fmt.Errorf("failed to load events: %w", err)
+	}
+	// Features and pairs are updated before flagging, so the rules judge this submission with them
+	if err := UpdateFeatures(db, sa, configs, events); err != nil {
+		return domain.FlagVersionChanges{}, fmt.Errorf("failed to update features: %w", err)
+	}
+	changedPairs, err := UpdateSimilarity(db, sa, events)
+	if err != nil {
+		return domain.FlagVersionChanges{}, fmt.Errorf("failed to update similarity: %w", err)
+	}
+	ctx, err := ruleContext(db, mappers.AssignmentToDomain(&assignment), studentAssignmentID)
+	if err != nil {
+		return domain.FlagVersionChanges{}, err
+	}
+	engine, err := flagging.BuildFlaggingEngine(configs, ctx)
+	if err != nil {
+		return domain.FlagVersionChanges{}, fmt.Errorf("invalid rule configuration of assignment %d: %w", sa.AssignmentID, err)
+	}
+	flags := engine.FlagAssignment(events)
+
+	// Compared against the version read before the events, a newer analysis stored meanwhile wins
+	changes, err := repository.NewFlagRepository(db).SupersedeFlags(studentAssignmentID, sa.AnalysisVersion, flags)
+	if err != nil {
+		return domain.FlagVersionChanges{}, fmt.Errorf("failed to store %d flags: %w", len(flags), err)
+	}
+
+	// The other submissions of changed pairs are flagged again with the pair as it is now
+	jobs := repository.NewAnalysisJobRepository(db)
+	for _, other := range changedPairs {
+		if _, err := jobs.Enqueue(other, DefaultMaxAttempts); err != nil {
+			log.Printf("failed to queue analysis of student assignment %d after its similarity to %d changed: %v", other, studentAssignmentID, err)
+		}
+	}
+	return changes, nil
+}
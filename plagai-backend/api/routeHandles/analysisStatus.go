@@ -0,0 +1,87 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+)
+
+// analysisStatusDto is the state of the latest analysis of a student's submissions
+type analysisStatusDto struct {
+	Student string                   `json:"student"`
+	JobID   uint                     `json:"jobId"`
+	Status  domain.AnalysisJobStatus `json:"status"`
+	// Runs so far and how many are allowed before the job is given up on
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"maxAttempts"`
+	LastError   string     `json:"lastError,omitempty"`
+	QueuedAt    time.Time  `json:"queuedAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	// Flags stored by the job, set once it succeeded
+	Flags int `json:"flags"`
+}
+
+// Send the state of the latest analysis of every student of a homework that submitted, or of
+// the student given by the optional student query param
+func (h *Handler) SendAnalysisStatus(w http.ResponseWriter, r *http.Request) {
+	classroom, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	studentEmail := r.URL.Query().Get("student")
+
+	jobs, err := repository.NewAnalysisJobRepository(h.DB).GetLatestJobs(assignment.ID)
+	if err != nil {
+		log.Printf("failed to load analysis jobs of homework %d: %v", assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"db error loading analysis jobs"}`, http.StatusInternalServerError)
+		return
+	}
+
+	type row struct {
+		StudentAssignmentID uint
+		Email               string
+	}
+	var rows []row
+	q := h.DB.Table("student_assignments sa").
+		Select("sa.id AS student_assignment_id, s.email AS email").
+		Joins("JOIN students s ON s.id = sa.student_id").
+		Where("sa.assignment_id = ? AND s.classroom_id = ? AND sa.deleted_at IS NULL", assignment.ID, classroom.ID).
+		Order("s.email ASC")
+	if studentEmail != "" {
+		q = q.Where("s.email = ?", studentEmail)
+	}
+	if err := q.Scan(&rows).Error; err != nil {
+		http.Error(w, `{"status":"ERROR","message":"db error loading students"}`, http.StatusInternalServerError)
+		return
+	}
+
+	statuses := make([]analysisStatusDto, 0, len(rows))
+	for _, row := range rows {
+		job, found := jobs[row.StudentAssignmentID]
+		if !found {
+			continue
+		}
+		statuses = append(statuses, analysisStatusDto{
+			Student:     row.Email,
+			JobID:       job.ID,
+			Status:      job.Status,
+			Attempts:    job.Attempts,
+			MaxAttempts: job.MaxAttempts,
+			LastError:   job.LastError,
+			QueuedAt:    job.CreatedAt,
+			UpdatedAt:   job.UpdatedAt,
+			FinishedAt:  job.FinishedAt,
+			Flags:       job.Flags,
+		})
+	}
+	resp := models.Response[[]analysisStatusDto]{Data: statuses, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
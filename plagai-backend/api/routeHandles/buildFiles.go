@@ -159,7 +159,7 @@ func (h *Handler) BuildFile(w http.ResponseWriter, r *http.Request) {
 	if err := h.DB.Table("diffs").
 		Select("diffs.id AS id, diffs.created_at AS created_at, diffs.diff_data AS patch_text").
 		Where(whereSQL, whereArgs...).
-		Order("diffs.created_at DESC, diffs.id DESC").
+		Order("diffs.seq DESC, diffs.created_at DESC, diffs.id DESC").
 		Limit(limit).
 		Offset(offset).
 		Find(&pageRows).Error; err != nil && err != gorm.ErrRecordNotFound {
@@ -183,7 +183,7 @@ func (h *Handler) BuildFile(w http.ResponseWriter, r *http.Request) {
 	if err := h.DB.Table("diffs").
 		Select("diffs.diff_data AS patch_text").
 		Where(whereSQL, whereArgs...).
-		Order("diffs.created_at ASC, diffs.id ASC").
+		Order("diffs.seq ASC, diffs.created_at ASC, diffs.id ASC").
 		Find(&allRows).Error; err != nil && err != gorm.ErrRecordNotFound {
 		http.Error(w, `{"status":"ERROR","message":"database error while loading full patch history"}`, http.StatusInternalServerError)
 		return
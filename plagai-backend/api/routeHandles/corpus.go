@@ -0,0 +1,211 @@
+package routeHandles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/plagai/plagai-backend/analysis"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+	"gorm.io/gorm"
+)
+
+// Largest corpus document accepted for upload, the JSON body may be larger for escaping
+const maxCorpusDocumentBytes = 2 << 20
+
+type corpusDocumentRequest struct {
+	// File name, its extension tells how the content is tokenised
+	Name string           `json:"name"`
+	Tag  domain.CorpusTag `json:"tag"`
+	// Where the document comes from, such as the assistant and prompt that wrote it
+	Note    string `json:"note"`
+	Content string `json:"content"`
+}
+
+type corpusDocumentDto struct {
+	ID         uint             `json:"id"`
+	Name       string           `json:"name"`
+	Tag        domain.CorpusTag `json:"tag"`
+	Note       string           `json:"note"`
+	SHA256     string           `json:"sha256"`
+	Lines      int              `json:"lines"`
+	UploadedBy string           `json:"uploadedBy"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	// Only sent for a single document
+	Content string `json:"content,omitempty"`
+}
+
+// Add a reference document to the corpus of a homework. The submissions of the homework are
+// queued to be analysed again so they are matched against it.
+func (h *Handler) UploadCorpusDocument(w http.ResponseWriter, r *http.Request) {
+	classroom, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	inst, ok := h.sectionInstructor(w, r, classroom)
+	if !ok {
+		return
+	}
+	var request corpusDocumentRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxCorpusDocumentBytes)).Decode(&request); err != nil {
+		http.Error(w, `{"status":"ERROR","message":"invalid or too large request body"}`, http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	switch {
+	case request.Name == "":
+		http.Error(w, `{"status":"ERROR","message":"missing 'name'"}`, http.StatusBadRequest)
+		return
+	case !request.Tag.Valid():
+		http.Error(w, `{"status":"ERROR","message":"'tag' must be ai-generated, past-term or public-solution"}`, http.StatusBadRequest)
+		return
+	case strings.TrimSpace(request.Content) == "":
+		http.Error(w, `{"status":"ERROR","message":"missing 'content'"}`, http.StatusBadRequest)
+		return
+	case len(request.Content) > maxCorpusDocumentBytes:
+		http.Error(w, `{"status":"ERROR","message":"'content' is larger than 2 MiB"}`, http.StatusBadRequest)
+		return
+	case !utf8.ValidString(request.Content) || strings.ContainsRune(request.Content, 0):
+		http.Error(w, `{"status":"ERROR","message":"'content' must be text"}`, http.StatusBadRequest)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(request.Content))
+	var document domain.CorpusDocument
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		document, err = repository.NewCorpusRepository(tx).AddDocument(domain.CorpusDocument{
+			AssignmentID: assignment.ID,
+			Name:         request.Name,
+			Tag:          request.Tag,
+			Note:         request.Note,
+			Content:      request.Content,
+			SHA256:       hex.EncodeToString(sum[:]),
+			UploadedBy:   inst.Email,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = repository.NewAnalysisJobRepository(tx).EnqueueAssignment(assignment.ID, analysis.DefaultMaxAttempts)
+		return err
+	})
+	if err != nil {
+		log.Printf("failed to store corpus document of homework %d: %v", assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to store corpus document"}`, http.StatusInternalServerError)
+		return
+	}
+	resp := models.Response[corpusDocumentDto]{Data: toCorpusDocumentDto(document, false), Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Send the reference documents of a homework without their content
+func (h *Handler) SendCorpusDocuments(w http.ResponseWriter, r *http.Request) {
+	_, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	documents, err := repository.NewCorpusRepository(h.DB).GetDocuments(assignment.ID)
+	if err != nil {
+		log.Printf("failed to load corpus of homework %d: %v", assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to load corpus documents"}`, http.StatusInternalServerError)
+		return
+	}
+	dtos := make([]corpusDocumentDto, len(documents))
+	for i, document := range documents {
+		dtos[i] = toCorpusDocumentDto(document, false)
+	}
+	resp := models.Response[[]corpusDocumentDto]{Data: dtos, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Send the reference document given by the document query param with its content, so the lines
+// a flag links to can be shown
+func (h *Handler) SendCorpusDocument(w http.ResponseWriter, r *http.Request) {
+	_, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	documentID, err := strconv.Atoi(r.URL.Query().Get("document"))
+	if err != nil || documentID <= 0 {
+		http.Error(w, `{"status":"ERROR","message":"invalid 'document'"}`, http.StatusBadRequest)
+		return
+	}
+	document, err := repository.NewCorpusRepository(h.DB).GetDocument(assignment.ID, uint(documentID))
+	if err != nil {
+		if errors.Is(err, repository.ErrCorpusDocumentNotFound) {
+			http.Error(w, `{"status":"ERROR","message":"document not in homework corpus"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"status":"ERROR","message":"failed to load corpus document"}`, http.StatusInternalServerError)
+		return
+	}
+	resp := models.Response[corpusDocumentDto]{Data: toCorpusDocumentDto(document, true), Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Remove the reference document given by the document query param from the corpus of a
+// homework and queue its submissions to be analysed again. Archived flags that matched it keep
+// linking to it.
+func (h *Handler) DeleteCorpusDocument(w http.ResponseWriter, r *http.Request) {
+	_, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	documentID, err := strconv.Atoi(r.URL.Query().Get("document"))
+	if err != nil || documentID <= 0 {
+		http.Error(w, `{"status":"ERROR","message":"invalid 'document'"}`, http.StatusBadRequest)
+		return
+	}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := repository.NewCorpusRepository(tx).DeleteDocument(assignment.ID, uint(documentID)); err != nil {
+			return err
+		}
+		_, err := repository.NewAnalysisJobRepository(tx).EnqueueAssignment(assignment.ID, analysis.DefaultMaxAttempts)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrCorpusDocumentNotFound) {
+			http.Error(w, `{"status":"ERROR","message":"document not in homework corpus"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("failed to delete corpus document %d of homework %d: %v", documentID, assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to delete corpus document"}`, http.StatusInternalServerError)
+		return
+	}
+	resp := models.Response[string]{Data: "Deleted", Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func toCorpusDocumentDto(document domain.CorpusDocument, withContent bool) corpusDocumentDto {
+	dto := corpusDocumentDto{
+		ID:         document.ID,
+		Name:       document.Name,
+		Tag:        document.Tag,
+		Note:       document.Note,
+		SHA256:     document.SHA256,
+		Lines:      strings.Count(strings.TrimSuffix(document.Content, "\n"), "\n") + 1,
+		UploadedBy: document.UploadedBy,
+		CreatedAt:  document.CreatedAt,
+	}
+	if withContent {
+		dto.Content = document.Content
+	}
+	return dto
+}
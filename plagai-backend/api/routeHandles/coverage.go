@@ -0,0 +1,126 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/plagai/plagai-backend/core"
+	"github.com/plagai/plagai-backend/middleware"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+	"github.com/plagai/plagai-backend/service"
+	"gorm.io/gorm"
+)
+
+type coveragePayload struct {
+	Student string `json:"student"`
+	service.Coverage
+}
+
+// Send the windows where the student's agent was tracking the homework and the gaps in between,
+// so instructors don't mistake untracked time for a suspicious burst of work
+func (h *Handler) SendCoverage(w http.ResponseWriter, r *http.Request) {
+	sectionStr := r.URL.Query().Get("section")
+	homeworkStr := r.URL.Query().Get("homework")
+	studentEmail := r.URL.Query().Get("student")
+	if sectionStr == "" || homeworkStr == "" || studentEmail == "" {
+		http.Error(w, `{"status":"ERROR","message":"missing required query params: section, homework, student"}`, http.StatusBadRequest)
+		return
+	}
+	sectionID, err := strconv.Atoi(sectionStr)
+	if err != nil || sectionID <= 0 {
+		http.Error(w, `{"status":"ERROR","message":"invalid 'section'"}`, http.StatusBadRequest)
+		return
+	}
+	homeworkID, err := strconv.Atoi(homeworkStr)
+	if err != nil || homeworkID <= 0 {
+		http.Error(w, `{"status":"ERROR","message":"invalid 'homework'"}`, http.StatusBadRequest)
+		return
+	}
+
+	var classroom database.Classroom
+	if err := h.DB.First(&classroom, sectionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, `{"status":"ERROR","message":"section not found"}`, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, `{"status":"ERROR","message":"db error loading section"}`, http.StatusInternalServerError)
+		return
+	}
+	var assignment database.Assignment
+	if err := h.DB.Where("id = ? AND classroom_id = ?", homeworkID, classroom.ID).
+		First(&assignment).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, `{"status":"ERROR","message":"homework not in section"}`, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, `{"status":"ERROR","message":"db error loading homework"}`, http.StatusInternalServerError)
+		return
+	}
+
+	claims := middleware.Claims{}
+	core.ConvertToken(r.Header.Get("Authorization"), &claims)
+	var inst database.Instructor
+	if err := h.DB.Where("email = ?", claims.Email).First(&inst).Error; err != nil || inst.ID == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(models.Response[string]{
+			Data: "Error", Status: "Unauthorized",
+			Message: "Only instructors are allowed", Error: "Unauthorized",
+		})
+		return
+	}
+	if classroom.InstructorID != inst.ID {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(models.Response[string]{
+			Data: "Error", Status: "Unauthorized",
+			Message: "You don't have access to this section", Error: "Unauthorized",
+		})
+		return
+	}
+
+	var sa database.StudentAssignment
+	if err := h.DB.
+		Joins(`JOIN students s ON s.id = student_assignments.student_id`).
+		Where(`s.email = ? AND s.classroom_id = ? AND student_assignments.assignment_id = ?`, studentEmail, classroom.ID, assignment.ID).
+		First(&sa).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, `{"status":"ERROR","message":"no student-assignment record for this student & homework"}`, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, `{"status":"ERROR","message":"db error loading student assignment"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Edits count as much as heartbeats as proof that the daemon was watching
+	events, err := repository.NewEditEventRepository(h.DB).GetEvents(sa.ID)
+	if err != nil {
+		http.Error(w, `{"status":"ERROR","message":"db error loading tracking events"}`, http.StatusInternalServerError)
+		return
+	}
+	trackingEvents := make([]domain.TrackingEvent, 0, len(events))
+	for _, event := range events {
+		trackingEvents = append(trackingEvents, domain.TrackingEvent{
+			EventType:  string(event.EventType),
+			Detail:     event.Patch,
+			OccurredAt: event.EventTime(),
+			Seq:        event.Seq,
+			FilePath:   event.FilePath,
+			MonoMs:     event.MonoMs,
+			SessionID:  event.SessionID,
+		})
+	}
+
+	payload := coveragePayload{
+		Student:  studentEmail,
+		Coverage: service.ComputeCoverage(trackingEvents),
+	}
+	resp := models.Response[coveragePayload]{Data: payload, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/plagai/plagai-backend/middleware"
 	"github.com/plagai/plagai-backend/models"
 	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
 	"gorm.io/gorm"
 )
 
@@ -112,7 +113,7 @@ func (h *Handler) SendDetections(w http.ResponseWriter, r *http.Request) {
 	}
 
 	whereSQL := `
-		assignments.id = ? AND assignments.classroom_id = ? AND
+		assignments.id = ? AND assignments.classroom_id = ? AND flags.archived_at IS NULL AND
 		diffs.diff_data IS NOT NULL AND TRIM(diffs.diff_data) <> ''
 	`
 	// Above is for filtering only the ones with patch data, below is anything. Ideally we should use the one below change later ~brtcrt
@@ -140,6 +141,15 @@ func (h *Handler) SendDetections(w http.ResponseWriter, r *http.Request) {
 		AssignmentID  uint
 		DiffFilePath  string
 		DiffPatchData string
+		RuleID        string
+		Decision      string
+		DecisionNote  string
+		CorpusID      *uint
+		CorpusName    string
+		CorpusTag     string
+		CorpusStart   int
+		CorpusEnd     int
+		Baseline      string
 	}
 
 	var rows []row
@@ -152,12 +162,22 @@ func (h *Handler) SendDetections(w http.ResponseWriter, r *http.Request) {
 			students.email    AS student_email,
 			assignments.id    AS assignment_id,
 			diffs.file_path   AS diff_file_path,
-			diffs.diff_data   AS diff_patch_data
+			diffs.diff_data   AS diff_patch_data,
+			flags.rule_id     AS rule_id,
+			flags.decision    AS decision,
+			flags.decision_note AS decision_note,
+			corpus_documents.id   AS corpus_id,
+			COALESCE(corpus_documents.name, '') AS corpus_name,
+			COALESCE(corpus_documents.tag, '')  AS corpus_tag,
+			flags.corpus_start_line AS corpus_start,
+			flags.corpus_end_line   AS corpus_end,
+			flags.baseline          AS baseline
 		`).
 		Joins(`JOIN student_assignments sa ON sa.id = flags.student_assignment_id`).
 		Joins(`JOIN diffs ON diffs.id = flags.diff_id AND diffs.student_assignment_id = sa.id`).
 		Joins(`JOIN students    ON students.id = sa.student_id`).
 		Joins(`JOIN assignments ON assignments.id = sa.assignment_id`).
+		Joins(`LEFT JOIN corpus_documents ON corpus_documents.id = flags.corpus_document_id`).
 		Where(whereSQL, whereArgs...).
 		Order("flags.severity DESC, flags.created_at DESC").
 		Limit(limit).
@@ -170,15 +190,47 @@ func (h *Handler) SendDetections(w http.ResponseWriter, r *http.Request) {
 
 	dets := make([]models.Detection, 0, len(rows))
 	for _, r := range rows {
+		var reference *models.CorpusReference
+		if r.CorpusID != nil {
+			reference = &models.CorpusReference{
+				DocumentID: *r.CorpusID,
+				Name:       r.CorpusName,
+				Tag:        r.CorpusTag,
+				StartLine:  r.CorpusStart,
+				EndLine:    r.CorpusEnd,
+			}
+		}
+		var baseline *models.ClassBaseline
+		if r.Baseline != "" {
+			var judged domain.ClassBaseline
+			if err := json.Unmarshal([]byte(r.Baseline), &judged); err == nil {
+				baseline = &models.ClassBaseline{
+					Feature:     string(judged.Feature),
+					Submissions: judged.Submissions,
+					Mean:        judged.Mean,
+					StdDev:      judged.StdDev,
+					Median:      judged.Median,
+					Percentile:  judged.Percentile,
+					ZScore:      judged.ZScore,
+					Threshold:   judged.Threshold,
+					Value:       judged.Value,
+				}
+			}
+		}
 		dets = append(dets, models.Detection{
-			ID:         strconv.Itoa(int(r.FlagID)),
-			CreatedBy:  r.StudentEmail,
-			Content:    r.Text,
-			CreatedAt:  r.FlagCreatedAt,
-			HomeworkID: strconv.Itoa(int(r.AssignmentID)),
-			Severity:   r.FlagSeverity,
-			FilePath:   r.DiffFilePath,
-			DiffData:   r.DiffPatchData,
+			ID:           strconv.Itoa(int(r.FlagID)),
+			CreatedBy:    r.StudentEmail,
+			Content:      r.Text,
+			CreatedAt:    r.FlagCreatedAt,
+			HomeworkID:   strconv.Itoa(int(r.AssignmentID)),
+			Severity:     r.FlagSeverity,
+			FilePath:     r.DiffFilePath,
+			DiffData:     r.DiffPatchData,
+			RuleID:       r.RuleID,
+			Decision:     r.Decision,
+			DecisionNote: r.DecisionNote,
+			Reference:    reference,
+			Baseline:     baseline,
 		})
 	}
 
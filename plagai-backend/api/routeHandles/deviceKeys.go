@@ -0,0 +1,77 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/plagai/plagai-backend/api"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+	"github.com/plagai/plagai-backend/service"
+)
+
+type deviceKeyRequest struct {
+	DeviceID  string `json:"deviceId"`
+	PublicKey string `json:"publicKey"`
+	Hostname  string `json:"hostname"`
+	OS        string `json:"os"`
+	// Signature of service.DeviceKeyProof by the device key
+	Proof string `json:"proof"`
+}
+
+// Register the device key of the student's agent, sent when the agent binds a directory to an
+// assignment. Evidence bundles of the student are only imported when signed by a registered key.
+func (h *Handler) RegisterDeviceKey(w http.ResponseWriter, r *http.Request) {
+	claims, err := api.GetClaimsFromAuthorization(r)
+	if err != nil {
+		switch err {
+		case api.ErrMissingAuthHeader:
+			http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
+		case api.ErrInvalidToken:
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		log.Println("auth error:", err)
+		return
+	}
+
+	var req deviceKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := service.VerifyDeviceKeyProof(req.PublicKey, claims.Email, req.Proof); err != nil {
+		http.Error(w, "Invalid device key: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	student, err := repository.NewStudentRepository(h.DB).FindByEmail(claims.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrStudentNotFound) {
+			http.Error(w, "No student found", http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = repository.NewDeviceKeyRepository(h.DB).RegisterKey(domain.DeviceKey{
+		StudentID: student.ID,
+		DeviceID:  req.DeviceID,
+		PublicKey: req.PublicKey,
+		Hostname:  req.Hostname,
+		OS:        req.OS,
+	})
+	if err != nil {
+		log.Printf("failed to register device %s of %s: %v", req.DeviceID, claims.Email, err)
+		http.Error(w, "Failed to register device key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "registered"})
+}
@@ -0,0 +1,270 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/plagai/plagai-backend/analysis"
+	"github.com/plagai/plagai-backend/flagging"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+	"gorm.io/gorm"
+)
+
+type flagVersionDto struct {
+	ID          uint   `json:"id,omitempty"`
+	RuleID      string `json:"ruleId,omitempty"`
+	RuleVersion int    `json:"ruleVersion"`
+	Severity    int    `json:"severity"`
+	Text        string `json:"text"`
+	FilePath    string `json:"filePath,omitempty"`
+	// The instructor's decision, empty while undecided
+	Decision     domain.FlagDecision `json:"decision,omitempty"`
+	DecisionNote string              `json:"decisionNote,omitempty"`
+	DecidedBy    string              `json:"decidedBy,omitempty"`
+	DecidedAt    *time.Time          `json:"decidedAt,omitempty"`
+}
+
+type flagChangeDto struct {
+	Previous flagVersionDto `json:"previous"`
+	Current  flagVersionDto `json:"current"`
+}
+
+// studentReevaluationDto is what re-evaluating a student's submission changed about their flags
+type studentReevaluationDto struct {
+	Student    string `json:"student"`
+	HomeworkID uint   `json:"homeworkId"`
+	// Equal when the flags stayed the same
+	PreviousVersion uint             `json:"previousVersion"`
+	Version         uint             `json:"version"`
+	Flags           int              `json:"flags"`
+	Added           []flagVersionDto `json:"added"`
+	Removed         []flagVersionDto `json:"removed"`
+	Changed         []flagChangeDto  `json:"changed"`
+	Unchanged       int              `json:"unchanged"`
+	DecisionsKept   int              `json:"decisionsKept"`
+	// Set when the submission couldn't be re-evaluated, its flags are left as they were
+	Error string `json:"error,omitempty"`
+}
+
+// queuedReevaluationDto is a submission queued to be re-evaluated in the background
+type queuedReevaluationDto struct {
+	Student    string `json:"student"`
+	HomeworkID uint   `json:"homeworkId"`
+	JobID      uint   `json:"jobId"`
+}
+
+type reevaluationDto struct {
+	EngineVersion int `json:"engineVersion"`
+	// Submissions whose flags changed, stayed the same or couldn't be re-evaluated
+	Changed   int                      `json:"changed"`
+	Unchanged int                      `json:"unchanged"`
+	Failed    int                      `json:"failed"`
+	Students  []studentReevaluationDto `json:"students"`
+	// Submissions left to analysis.Pool, how far it got is in SendAnalysisStatus
+	Queued []queuedReevaluationDto `json:"queued"`
+}
+
+type flagDecisionRequest struct {
+	// confirmed, dismissed, or empty to clear the decision
+	Decision domain.FlagDecision `json:"decision"`
+	Note     string              `json:"note"`
+}
+
+// Flag the submissions of a section again with the current rule configuration. The homework
+// query param narrows it down to one homework and the student query param to one student's
+// submission of it. Flags that changed become a new version and the previous one is archived.
+// One student's submission is re-evaluated right away and the changes are returned, any more
+// are queued for the analysis workers and the IDs of their jobs are returned instead.
+func (h *Handler) ReevaluateFlags(w http.ResponseWriter, r *http.Request) {
+	classroom, ok := h.instructorSection(w, r)
+	if !ok {
+		return
+	}
+	homeworkStr := r.URL.Query().Get("homework")
+	studentEmail := r.URL.Query().Get("student")
+	if studentEmail != "" && homeworkStr == "" {
+		http.Error(w, `{"status":"ERROR","message":"'student' requires 'homework'"}`, http.StatusBadRequest)
+		return
+	}
+
+	type row struct {
+		StudentAssignmentID uint
+		AssignmentID        uint
+		Email               string
+	}
+	var rows []row
+	q := h.DB.Table("student_assignments sa").
+		Select("sa.id AS student_assignment_id, sa.assignment_id AS assignment_id, s.email AS email").
+		Joins("JOIN students s ON s.id = sa.student_id").
+		Joins("JOIN assignments a ON a.id = sa.assignment_id").
+		Where("a.classroom_id = ? AND sa.deleted_at IS NULL", classroom.ID).
+		Order("sa.assignment_id ASC, s.email ASC")
+	if homeworkStr != "" {
+		homeworkID, err := strconv.Atoi(homeworkStr)
+		if err != nil || homeworkID <= 0 {
+			http.Error(w, `{"status":"ERROR","message":"invalid 'homework'"}`, http.StatusBadRequest)
+			return
+		}
+		q = q.Where("sa.assignment_id = ?", homeworkID)
+	}
+	if studentEmail != "" {
+		q = q.Where("s.email = ?", studentEmail)
+	}
+	if err := q.Scan(&rows).Error; err != nil {
+		http.Error(w, `{"status":"ERROR","message":"db error loading submissions"}`, http.StatusInternalServerError)
+		return
+	}
+	if studentEmail != "" && len(rows) == 0 {
+		http.Error(w, `{"status":"ERROR","message":"student has no submission for this homework"}`, http.StatusBadRequest)
+		return
+	}
+
+	result := reevaluationDto{EngineVersion: flagging.EngineVersion, Students: []studentReevaluationDto{}, Queued: []queuedReevaluationDto{}}
+	if studentEmail == "" {
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			jobs := repository.NewAnalysisJobRepository(tx)
+			for _, row := range rows {
+				job, err := jobs.Enqueue(row.StudentAssignmentID, analysis.DefaultMaxAttempts)
+				if err != nil {
+					return err
+				}
+				result.Queued = append(result.Queued, queuedReevaluationDto{Student: row.Email, HomeworkID: row.AssignmentID, JobID: job.ID})
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("failed to queue re-evaluation of section %d: %v", classroom.ID, err)
+			http.Error(w, `{"status":"ERROR","message":"db error queueing re-evaluation"}`, http.StatusInternalServerError)
+			return
+		}
+		resp := models.Response[reevaluationDto]{Data: result, Status: "OK"}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	for _, row := range rows {
+		dto := studentReevaluationDto{Student: row.Email, HomeworkID: row.AssignmentID}
+		changes, err := analysis.Analyze(h.DB, row.StudentAssignmentID)
+		if err != nil {
+			log.Printf("failed to re-evaluate student assignment %d: %v", row.StudentAssignmentID, err)
+			dto.Error = err.Error()
+			result.Failed++
+			result.Students = append(result.Students, dto)
+			continue
+		}
+		dto.PreviousVersion, dto.Version = changes.PreviousVersion, changes.Version
+		dto.Flags, dto.Unchanged, dto.DecisionsKept = changes.Flags, changes.Unchanged, changes.DecisionsKept
+		dto.Added = toFlagVersionDtos(changes.Added)
+		dto.Removed = toFlagVersionDtos(changes.Removed)
+		dto.Changed = make([]flagChangeDto, 0, len(changes.Changed))
+		for _, change := range changes.Changed {
+			dto.Changed = append(dto.Changed, flagChangeDto{
+				Previous: toFlagVersionDto(change.Previous),
+				Current:  toFlagVersionDto(change.Current),
+			})
+		}
+		if changes.Version != changes.PreviousVersion {
+			result.Changed++
+		} else {
+			result.Unchanged++
+		}
+		result.Students = append(result.Students, dto)
+	}
+
+	resp := models.Response[reevaluationDto]{Data: result, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Record the instructor's decision on the flag given by the flag query param. Decisions stay
+// with the flag when later re-evaluations raise it again.
+func (h *Handler) SaveFlagDecision(w http.ResponseWriter, r *http.Request) {
+	flagID, err := strconv.Atoi(r.URL.Query().Get("flag"))
+	if err != nil || flagID <= 0 {
+		http.Error(w, `{"status":"ERROR","message":"invalid 'flag'"}`, http.StatusBadRequest)
+		return
+	}
+	var request flagDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, `{"status":"ERROR","message":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	switch request.Decision {
+	case domain.FlagUndecided, domain.FlagConfirmed, domain.FlagDismissed:
+	default:
+		http.Error(w, `{"status":"ERROR","message":"'decision' must be confirmed, dismissed or empty"}`, http.StatusBadRequest)
+		return
+	}
+
+	var classroom database.Classroom
+	if err := h.DB.Model(&database.Classroom{}).
+		Joins("JOIN assignments a ON a.classroom_id = classrooms.id").
+		Joins("JOIN student_assignments sa ON sa.assignment_id = a.id").
+		Joins("JOIN flags f ON f.student_assignment_id = sa.id").
+		Where("f.id = ? AND f.deleted_at IS NULL", flagID).
+		First(&classroom).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, `{"status":"ERROR","message":"flag not found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"status":"ERROR","message":"db error loading flag"}`, http.StatusInternalServerError)
+		return
+	}
+	inst, ok := h.sectionInstructor(w, r, classroom)
+	if !ok {
+		return
+	}
+
+	repo := repository.NewFlagRepository(h.DB)
+	if err := repo.SetDecision(uint(flagID), request.Decision, request.Note, inst.Email); err != nil {
+		if errors.Is(err, repository.ErrFlagNotFound) {
+			http.Error(w, `{"status":"ERROR","message":"flag was replaced by a later re-evaluation"}`, http.StatusConflict)
+			return
+		}
+		log.Printf("failed to save decision on flag %d: %v", flagID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to save decision"}`, http.StatusInternalServerError)
+		return
+	}
+	flag, err := repo.FindByID(uint(flagID))
+	if err != nil {
+		http.Error(w, `{"status":"ERROR","message":"db error loading flag"}`, http.StatusInternalServerError)
+		return
+	}
+	resp := models.Response[flagVersionDto]{Data: toFlagVersionDto(*flag), Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func toFlagVersionDtos(flags []domain.Flag) []flagVersionDto {
+	dtos := make([]flagVersionDto, 0, len(flags))
+	for _, flag := range flags {
+		dtos = append(dtos, toFlagVersionDto(flag))
+	}
+	return dtos
+}
+
+func toFlagVersionDto(flag domain.Flag) flagVersionDto {
+	return flagVersionDto{
+		ID:           flag.ID,
+		RuleID:       flag.RuleID,
+		RuleVersion:  flag.RuleVersion,
+		Severity:     flag.Severity,
+		Text:         flag.FlagExplanation,
+		FilePath:     flag.Diff.FilePath,
+		Decision:     flag.Decision,
+		DecisionNote: flag.DecisionNote,
+		DecidedBy:    flag.DecidedBy,
+		DecidedAt:    flag.DecidedAt,
+	}
+}
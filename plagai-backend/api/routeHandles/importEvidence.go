@@ -0,0 +1,169 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+	"github.com/plagai/plagai-backend/service"
+	"gorm.io/gorm"
+)
+
+// Largest evidence bundle accepted for import
+const maxEvidenceBundleBytes = 64 << 20
+
+type evidenceImportPayload struct {
+	Student      string `json:"student"`
+	HomeworkID   uint   `json:"homeworkId"`
+	EventCount   int    `json:"eventCount"`
+	FileCount    int    `json:"fileCount"`
+	DeviceID     string `json:"deviceId"`
+	AgentVersion string `json:"agentVersion"`
+	ChainHead    string `json:"chainHead"`
+}
+
+// Import an evidence bundle made with plaggy export on behalf of a student who couldn't submit.
+// The zip archive is the request body and has to be signed by a device key the student registered
+// when binding an assignment. After it is verified it is ingested like a regular submission.
+func (h *Handler) ImportEvidence(w http.ResponseWriter, r *http.Request) {
+	// Checked before the bundle is read, so only instructors of the section make the server verify one
+	classroom, ok := h.instructorSection(w, r)
+	if !ok {
+		return
+	}
+	inst, ok := h.sectionInstructor(w, r, classroom)
+	if !ok {
+		return
+	}
+	homeworkStr := r.URL.Query().Get("homework")
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEvidenceBundleBytes))
+	if err != nil {
+		http.Error(w, `{"status":"ERROR","message":"bundle too large or unreadable"}`, http.StatusBadRequest)
+		return
+	}
+	// Only the keys of a student of the section count, a bundle of anyone else is refused below
+	registeredKeys := func(studentEmail string) ([]string, error) {
+		var student database.Student
+		err := h.DB.Where("email = ? AND classroom_id = ?", studentEmail, classroom.ID).First(&student).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return repository.NewDeviceKeyRepository(h.DB).GetKeys(student.ID)
+	}
+	bundle, err := service.ReadEvidenceBundle(data, registeredKeys)
+	if err != nil {
+		if !errors.Is(err, service.ErrInvalidBundle) {
+			log.Printf("failed to verify evidence bundle: %v", err)
+			http.Error(w, `{"status":"ERROR","message":"db error loading device keys"}`, http.StatusInternalServerError)
+			return
+		}
+		log.Printf("rejected evidence bundle: %v", err)
+		msg, _ := json.Marshal(err.Error())
+		http.Error(w, fmt.Sprintf(`{"status":"ERROR","message":%s}`, msg), http.StatusBadRequest)
+		return
+	}
+
+	homeworkID := int(bundle.Manifest.Assignment.ID)
+	if homeworkStr != "" {
+		queryHomeworkID, err := strconv.Atoi(homeworkStr)
+		if err != nil || queryHomeworkID <= 0 {
+			http.Error(w, `{"status":"ERROR","message":"invalid 'homework'"}`, http.StatusBadRequest)
+			return
+		}
+		if homeworkID != 0 && homeworkID != queryHomeworkID {
+			http.Error(w, `{"status":"ERROR","message":"bundle was exported for a different homework"}`, http.StatusBadRequest)
+			return
+		}
+		homeworkID = queryHomeworkID
+	}
+	if homeworkID == 0 {
+		http.Error(w, `{"status":"ERROR","message":"bundle doesn't name a homework, pass 'homework'"}`, http.StatusBadRequest)
+		return
+	}
+
+	var assignment database.Assignment
+	if err := h.DB.Where("id = ? AND classroom_id = ?", homeworkID, classroom.ID).
+		First(&assignment).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, `{"status":"ERROR","message":"homework not in section"}`, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, `{"status":"ERROR","message":"db error loading homework"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var student database.Student
+	if err := h.DB.Where("email = ? AND classroom_id = ?", bundle.Manifest.StudentEmail, classroom.ID).
+		First(&student).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, `{"status":"ERROR","message":"student of the bundle is not in this section"}`, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, `{"status":"ERROR","message":"db error loading student"}`, http.StatusInternalServerError)
+		return
+	}
+
+	importRepo := repository.NewEvidenceImportRepository(h.DB)
+	imported, err := importRepo.IsImported(bundle.SHA256)
+	if err != nil {
+		http.Error(w, `{"status":"ERROR","message":"db error checking earlier imports"}`, http.StatusInternalServerError)
+		return
+	}
+	if imported {
+		http.Error(w, `{"status":"ERROR","message":"bundle was already imported"}`, http.StatusConflict)
+		return
+	}
+
+	sa, err := h.ingestSubmission(student.ID, models.Submission{
+		AssignmentId: assignment.ID,
+		Edits:        bundle.Events,
+		Snapshot:     bundle.SnapshotFiles(),
+	})
+	if err != nil {
+		log.Printf("failed to ingest evidence bundle %s: %v", bundle.SHA256, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to store bundle events"}`, http.StatusInternalServerError)
+		return
+	}
+	_, err = importRepo.AddImport(domain.EvidenceImport{
+		StudentAssignmentID: sa.ID,
+		InstructorID:        inst.ID,
+		DeviceID:            bundle.Manifest.Device.ID,
+		DevicePublicKey:     bundle.Manifest.Device.PublicKey,
+		DeviceHostname:      bundle.Manifest.Device.Hostname,
+		AgentVersion:        bundle.Manifest.AgentVersion,
+		ChainHead:           bundle.Manifest.ChainHead,
+		EventCount:          len(bundle.Events),
+		FileCount:           len(bundle.Snapshots),
+		BundleSHA256:        bundle.SHA256,
+		ExportedAt:          bundle.Manifest.CreatedAt,
+	})
+	if err != nil {
+		log.Printf("failed to record import of evidence bundle %s: %v", bundle.SHA256, err)
+	}
+
+	payload := evidenceImportPayload{
+		Student:      student.Email,
+		HomeworkID:   assignment.ID,
+		EventCount:   len(bundle.Events),
+		FileCount:    len(bundle.Snapshots),
+		DeviceID:     bundle.Manifest.Device.ID,
+		AgentVersion: bundle.Manifest.AgentVersion,
+		ChainHead:    bundle.Manifest.ChainHead,
+	}
+	resp := models.Response[evidenceImportPayload]{Data: payload, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
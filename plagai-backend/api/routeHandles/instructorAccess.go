@@ -0,0 +1,117 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/plagai/plagai-backend/core"
+	"github.com/plagai/plagai-backend/middleware"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/database"
+	"gorm.io/gorm"
+)
+
+// adminEmails are the instructors with access to every section, set with ADMIN_EMAILS as a comma
+// separated list
+var adminEmails []string
+
+func init() {
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			adminEmails = append(adminEmails, strings.ToLower(email))
+		}
+	}
+}
+
+// instructorHomework loads the homework named by the section and homework query params and
+// checks that the instructor sending the request teaches the section. When it returns false the
+// error response has been written.
+func (h *Handler) instructorHomework(w http.ResponseWriter, r *http.Request) (database.Classroom, database.Assignment, bool) {
+	var assignment database.Assignment
+
+	homeworkStr := r.URL.Query().Get("homework")
+	if r.URL.Query().Get("section") == "" || homeworkStr == "" {
+		http.Error(w, `{"status":"ERROR","message":"missing required query params: section, homework"}`, http.StatusBadRequest)
+		return database.Classroom{}, assignment, false
+	}
+	homeworkID, err := strconv.Atoi(homeworkStr)
+	if err != nil || homeworkID <= 0 {
+		http.Error(w, `{"status":"ERROR","message":"invalid 'homework'"}`, http.StatusBadRequest)
+		return database.Classroom{}, assignment, false
+	}
+	classroom, ok := h.instructorSection(w, r)
+	if !ok {
+		return classroom, assignment, false
+	}
+	if err := h.DB.Where("id = ? AND classroom_id = ?", homeworkID, classroom.ID).
+		First(&assignment).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, `{"status":"ERROR","message":"homework not in section"}`, http.StatusBadRequest)
+			return classroom, assignment, false
+		}
+		http.Error(w, `{"status":"ERROR","message":"db error loading homework"}`, http.StatusInternalServerError)
+		return classroom, assignment, false
+	}
+	return classroom, assignment, true
+}
+
+// instructorSection loads the section named by the section query param and checks that the
+// instructor sending the request teaches it. When it returns false the error response has been
+// written.
+func (h *Handler) instructorSection(w http.ResponseWriter, r *http.Request) (database.Classroom, bool) {
+	var classroom database.Classroom
+
+	sectionStr := r.URL.Query().Get("section")
+	if sectionStr == "" {
+		http.Error(w, `{"status":"ERROR","message":"missing 'section' query param"}`, http.StatusBadRequest)
+		return classroom, false
+	}
+	sectionID, err := strconv.Atoi(sectionStr)
+	if err != nil || sectionID <= 0 {
+		http.Error(w, `{"status":"ERROR","message":"invalid 'section'"}`, http.StatusBadRequest)
+		return classroom, false
+	}
+	if err := h.DB.First(&classroom, sectionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, `{"status":"ERROR","message":"section not found"}`, http.StatusBadRequest)
+			return classroom, false
+		}
+		http.Error(w, `{"status":"ERROR","message":"db error loading section"}`, http.StatusInternalServerError)
+		return classroom, false
+	}
+	if _, ok := h.sectionInstructor(w, r, classroom); !ok {
+		return classroom, false
+	}
+	return classroom, true
+}
+
+// sectionInstructor returns the instructor sending the request after checking that they teach
+// the section or are an admin. When it returns false the error response has been written.
+func (h *Handler) sectionInstructor(w http.ResponseWriter, r *http.Request, classroom database.Classroom) (database.Instructor, bool) {
+	claims := middleware.Claims{}
+	core.ConvertToken(r.Header.Get("Authorization"), &claims)
+	var inst database.Instructor
+	if err := h.DB.Where("email = ?", claims.Email).First(&inst).Error; err != nil || inst.ID == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(models.Response[string]{
+			Data: "Error", Status: "Unauthorized",
+			Message: "Only instructors are allowed", Error: "Unauthorized",
+		})
+		return inst, false
+	}
+	if classroom.InstructorID != inst.ID && !slices.Contains(adminEmails, strings.ToLower(inst.Email)) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(models.Response[string]{
+			Data: "Error", Status: "Unauthorized",
+			Message: "You don't have access to this section", Error: "Unauthorized",
+		})
+		return inst, false
+	}
+	return inst, true
+}
@@ -0,0 +1,165 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/plagai/plagai-backend/flagging"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+)
+
+// ruleConfigDto is how a rule is set up for a homework
+type ruleConfigDto struct {
+	RuleID      string            `json:"ruleId"`
+	Kind        flagging.RuleKind `json:"kind"`
+	Description string            `json:"description"`
+	Enabled     bool              `json:"enabled"`
+	// Parameters the rule runs with, defaults included
+	Params domain.RuleParams `json:"params"`
+	// False when the rule runs as the registry sets it up by default
+	Configured bool `json:"configured"`
+}
+
+type ruleConfigRequest struct {
+	// Left out to keep the rule enabled or disabled as it is
+	Enabled *bool `json:"enabled"`
+	// Parameters that differ from the defaults, the ones left out run with their defaults
+	Params domain.RuleParams `json:"params"`
+}
+
+// Send every rule homeworks can be flagged with, with their parameters and defaults
+func (h *Handler) SendRuleRegistry(w http.ResponseWriter, r *http.Request) {
+	resp := models.Response[[]flagging.RuleDefinition]{Data: flagging.Rules(), Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Send how every rule of the registry is set up for a homework
+func (h *Handler) SendRuleConfigs(w http.ResponseWriter, r *http.Request) {
+	_, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	configs, err := repository.NewRuleConfigRepository(h.DB).GetRuleConfigs(assignment.ID)
+	if err != nil {
+		log.Printf("failed to load rule configurations of homework %d: %v", assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to load rule configurations"}`, http.StatusInternalServerError)
+		return
+	}
+
+	dtos := make([]ruleConfigDto, 0, len(flagging.Rules()))
+	for _, def := range flagging.Rules() {
+		var config *domain.RuleConfig
+		for i := range configs {
+			if configs[i].RuleID == def.ID {
+				config = &configs[i]
+			}
+		}
+		dtos = append(dtos, toRuleConfigDto(def, config))
+	}
+	resp := models.Response[[]ruleConfigDto]{Data: dtos, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Enable, disable or change the parameters of the rule given by the rule query param for a
+// homework. Later submissions are flagged with the new setup.
+func (h *Handler) SaveRuleConfig(w http.ResponseWriter, r *http.Request) {
+	_, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	def, found := flagging.LookupRule(r.URL.Query().Get("rule"))
+	if !found {
+		http.Error(w, `{"status":"ERROR","message":"unknown 'rule'"}`, http.StatusBadRequest)
+		return
+	}
+	var request ruleConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, `{"status":"ERROR","message":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if err := def.ValidateParams(request.Params); err != nil {
+		msg, _ := json.Marshal(err.Error())
+		http.Error(w, fmt.Sprintf(`{"status":"ERROR","message":%s}`, msg), http.StatusBadRequest)
+		return
+	}
+
+	repo := repository.NewRuleConfigRepository(h.DB)
+	enabled := def.DefaultEnabled
+	if request.Enabled != nil {
+		enabled = *request.Enabled
+	} else {
+		configs, err := repo.GetRuleConfigs(assignment.ID)
+		if err != nil {
+			http.Error(w, `{"status":"ERROR","message":"failed to load rule configurations"}`, http.StatusInternalServerError)
+			return
+		}
+		for _, config := range configs {
+			if config.RuleID == def.ID {
+				enabled = config.Enabled
+			}
+		}
+	}
+
+	config, err := repo.SaveRuleConfig(domain.RuleConfig{
+		AssignmentID: assignment.ID,
+		RuleID:       def.ID,
+		Enabled:      enabled,
+		Params:       request.Params,
+	})
+	if err != nil {
+		log.Printf("failed to save rule %s of homework %d: %v", def.ID, assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to save rule configuration"}`, http.StatusInternalServerError)
+		return
+	}
+	resp := models.Response[ruleConfigDto]{Data: toRuleConfigDto(def, &config), Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Reset the rule given by the rule query param to its defaults for a homework
+func (h *Handler) DeleteRuleConfig(w http.ResponseWriter, r *http.Request) {
+	_, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	def, found := flagging.LookupRule(r.URL.Query().Get("rule"))
+	if !found {
+		http.Error(w, `{"status":"ERROR","message":"unknown 'rule'"}`, http.StatusBadRequest)
+		return
+	}
+	if err := repository.NewRuleConfigRepository(h.DB).DeleteRuleConfig(assignment.ID, def.ID); err != nil {
+		log.Printf("failed to reset rule %s of homework %d: %v", def.ID, assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to reset rule configuration"}`, http.StatusInternalServerError)
+		return
+	}
+	resp := models.Response[ruleConfigDto]{Data: toRuleConfigDto(def, nil), Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// toRuleConfigDto describes how the rule is set up, by config or by default when config is nil
+func toRuleConfigDto(def flagging.RuleDefinition, config *domain.RuleConfig) ruleConfigDto {
+	dto := ruleConfigDto{
+		RuleID:      def.ID,
+		Kind:        def.Kind,
+		Description: def.Description,
+		Enabled:     def.DefaultEnabled,
+		Params:      def.EffectiveParams(nil),
+	}
+	if config != nil {
+		dto.Enabled = config.Enabled
+		dto.Params = def.EffectiveParams(config.Params)
+		dto.Configured = true
+	}
+	return dto
+}
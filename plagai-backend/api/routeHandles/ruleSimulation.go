@@ -0,0 +1,274 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/plagai/plagai-backend/analysis"
+	"github.com/plagai/plagai-backend/flagging"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/models/mappers"
+	"github.com/plagai/plagai-backend/repository"
+)
+
+type ruleSimulationRequest struct {
+	// Rules to set up differently than now by rule ID, the others stay as they are
+	Rules map[string]ruleConfigRequest `json:"rules"`
+}
+
+// ruleOutcomeDto is what a rule raised on the homework under one configuration
+type ruleOutcomeDto struct {
+	Enabled bool              `json:"enabled"`
+	Params  domain.RuleParams `json:"params"`
+	Flags   int               `json:"flags"`
+	// Students with at least one flag of the rule
+	Students int `json:"students"`
+}
+
+type ruleSimulationDto struct {
+	RuleID    string         `json:"ruleId"`
+	Current   ruleOutcomeDto `json:"current"`
+	Candidate ruleOutcomeDto `json:"candidate"`
+}
+
+// affectedStudentDto is a student whose flags differ under the candidate configuration
+type affectedStudentDto struct {
+	Student        string `json:"student"`
+	CurrentFlags   int    `json:"currentFlags"`
+	CandidateFlags int    `json:"candidateFlags"`
+	// Flags only the candidate configuration raises and flags it no longer raises
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+type simulatedFlagDto struct {
+	Student  string `json:"student"`
+	RuleID   string `json:"ruleId"`
+	Severity int    `json:"severity"`
+	Text     string `json:"text"`
+	FilePath string `json:"filePath,omitempty"`
+}
+
+type simulationDto struct {
+	// Submissions the configurations were run over
+	Submissions int                  `json:"submissions"`
+	Rules       []ruleSimulationDto  `json:"rules"`
+	Affected    []affectedStudentDto `json:"affected"`
+	// Samples of the flags only the candidate configuration raises and of those it no longer raises
+	AddedSample   []simulatedFlagDto `json:"addedSample"`
+	RemovedSample []simulatedFlagDto `json:"removedSample"`
+}
+
+// Run the rules over the stored submissions of a homework as the body sets them up and compare
+// the flags side by side with the current configuration. Nothing is stored. The sample query
+// param sets how many example flags are sent, 20 by default.
+func (h *Handler) SimulateRuleConfigs(w http.ResponseWriter, r *http.Request) {
+	_, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	sample := 20
+	if sampleStr := r.URL.Query().Get("sample"); sampleStr != "" {
+		if v, err := strconv.Atoi(sampleStr); err == nil && v >= 0 {
+			sample = min(v, 200)
+		}
+	}
+	var request ruleSimulationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, `{"status":"ERROR","message":"invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	current, err := repository.NewRuleConfigRepository(h.DB).GetRuleConfigs(assignment.ID)
+	if err != nil {
+		log.Printf("failed to load rule configurations of homework %d: %v", assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to load rule configurations"}`, http.StatusInternalServerError)
+		return
+	}
+	candidate, err := candidateRuleConfigs(current, request.Rules)
+	if err != nil {
+		msg, _ := json.Marshal(err.Error())
+		http.Error(w, fmt.Sprintf(`{"status":"ERROR","message":%s}`, msg), http.StatusBadRequest)
+		return
+	}
+	// The engines are built per submission by the simulation, invalid configurations are caught here
+	ctx := flagging.RuleContext{Assignment: mappers.AssignmentToDomain(&assignment)}
+	if _, err := flagging.BuildFlaggingEngine(current, ctx); err != nil {
+		http.Error(w, `{"status":"ERROR","message":"the current rule configuration is invalid"}`, http.StatusInternalServerError)
+		return
+	}
+	if _, err := flagging.BuildFlaggingEngine(candidate, ctx); err != nil {
+		msg, _ := json.Marshal(err.Error())
+		http.Error(w, fmt.Sprintf(`{"status":"ERROR","message":%s}`, msg), http.StatusBadRequest)
+		return
+	}
+
+	type row struct {
+		StudentAssignmentID uint
+		Email               string
+	}
+	var rows []row
+	if err := h.DB.Table("student_assignments sa").
+		Select("sa.id AS student_assignment_id, s.email AS email").
+		Joins("JOIN students s ON s.id = sa.student_id").
+		Where("sa.assignment_id = ? AND sa.deleted_at IS NULL", assignment.ID).
+		Order("s.email ASC").
+		Scan(&rows).Error; err != nil {
+		http.Error(w, `{"status":"ERROR","message":"db error loading submissions"}`, http.StatusInternalServerError)
+		return
+	}
+	ids := make([]uint, len(rows))
+	emails := make(map[uint]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.StudentAssignmentID
+		emails[row.StudentAssignmentID] = row.Email
+	}
+	submissions, err := analysis.Simulate(h.DB, ctx.Assignment, ids, current, candidate)
+	if err != nil {
+		log.Printf("failed to simulate rules of homework %d: %v", assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to load submissions"}`, http.StatusInternalServerError)
+		return
+	}
+
+	result := simulationDto{
+		Submissions:   len(submissions),
+		Affected:      []affectedStudentDto{},
+		AddedSample:   []simulatedFlagDto{},
+		RemovedSample: []simulatedFlagDto{},
+	}
+	outcomes := make(map[string]*ruleSimulationDto, len(flagging.Rules()))
+	for _, def := range flagging.Rules() {
+		outcome := &ruleSimulationDto{
+			RuleID:    def.ID,
+			Current:   ruleOutcome(def, current),
+			Candidate: ruleOutcome(def, candidate),
+		}
+		outcomes[def.ID] = outcome
+	}
+	for _, submission := range submissions {
+		email := emails[submission.StudentAssignmentID]
+		countRuleOutcomes(outcomes, submission.Current, func(o *ruleSimulationDto) *ruleOutcomeDto { return &o.Current })
+		countRuleOutcomes(outcomes, submission.Candidate, func(o *ruleSimulationDto) *ruleOutcomeDto { return &o.Candidate })
+
+		added, removed := diffFlags(submission.Current, submission.Candidate)
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		result.Affected = append(result.Affected, affectedStudentDto{
+			Student:        email,
+			CurrentFlags:   len(submission.Current),
+			CandidateFlags: len(submission.Candidate),
+			Added:          len(added),
+			Removed:        len(removed),
+		})
+		result.AddedSample = appendFlagSample(result.AddedSample, added, email, sample)
+		result.RemovedSample = appendFlagSample(result.RemovedSample, removed, email, sample)
+	}
+	for _, def := range flagging.Rules() {
+		result.Rules = append(result.Rules, *outcomes[def.ID])
+	}
+
+	resp := models.Response[simulationDto]{Data: result, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// candidateRuleConfigs returns the current configurations with the rules of the request set up as
+// it asks
+func candidateRuleConfigs(current []domain.RuleConfig, requested map[string]ruleConfigRequest) ([]domain.RuleConfig, error) {
+	candidate := make([]domain.RuleConfig, 0, len(current)+len(requested))
+	for _, config := range current {
+		if _, ok := requested[config.RuleID]; !ok {
+			candidate = append(candidate, config)
+		}
+	}
+	for ruleID, request := range requested {
+		def, found := flagging.LookupRule(ruleID)
+		if !found {
+			return nil, fmt.Errorf("unknown rule %q", ruleID)
+		}
+		if err := def.ValidateParams(request.Params); err != nil {
+			return nil, err
+		}
+		enabled := def.DefaultEnabled
+		for _, config := range current {
+			if config.RuleID == ruleID {
+				enabled = config.Enabled
+			}
+		}
+		if request.Enabled != nil {
+			enabled = *request.Enabled
+		}
+		candidate = append(candidate, domain.RuleConfig{RuleID: ruleID, Enabled: enabled, Params: request.Params})
+	}
+	return candidate, nil
+}
+
+// ruleOutcome returns how the rule is set up by configs, with nothing counted yet
+func ruleOutcome(def flagging.RuleDefinition, configs []domain.RuleConfig) ruleOutcomeDto {
+	outcome := ruleOutcomeDto{Enabled: def.DefaultEnabled, Params: def.EffectiveParams(nil)}
+	for _, config := range configs {
+		if config.RuleID == def.ID {
+			outcome.Enabled, outcome.Params = config.Enabled, def.EffectiveParams(config.Params)
+		}
+	}
+	return outcome
+}
+
+func countRuleOutcomes(outcomes map[string]*ruleSimulationDto, flags []domain.Flag, side func(*ruleSimulationDto) *ruleOutcomeDto) {
+	flagged := make(map[string]bool)
+	for _, flag := range flags {
+		outcome, ok := outcomes[flag.RuleID]
+		if !ok {
+			continue
+		}
+		side(outcome).Flags++
+		if !flagged[flag.RuleID] {
+			flagged[flag.RuleID] = true
+			side(outcome).Students++
+		}
+	}
+}
+
+// diffFlags returns the flags only the candidate raises and the ones only the current raises
+func diffFlags(current []domain.Flag, candidate []domain.Flag) (added []domain.Flag, removed []domain.Flag) {
+	raised := make(map[string]int, len(current))
+	for _, flag := range current {
+		raised[flag.Identity()]++
+	}
+	for _, flag := range candidate {
+		if raised[flag.Identity()] > 0 {
+			raised[flag.Identity()]--
+			continue
+		}
+		added = append(added, flag)
+	}
+	for _, flag := range current {
+		if raised[flag.Identity()] > 0 {
+			raised[flag.Identity()]--
+			removed = append(removed, flag)
+		}
+	}
+	return added, removed
+}
+
+func appendFlagSample(sample []simulatedFlagDto, flags []domain.Flag, email string, size int) []simulatedFlagDto {
+	for _, flag := range flags {
+		if len(sample) >= size {
+			break
+		}
+		sample = append(sample, simulatedFlagDto{
+			Student:  email,
+			RuleID:   flag.RuleID,
+			Severity: flag.Severity,
+			Text:     flag.FlagExplanation,
+			FilePath: flag.Diff.FilePath,
+		})
+	}
+	return sample
+}
@@ -0,0 +1,125 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/plagai/plagai-backend/flagging"
+	"github.com/plagai/plagai-backend/flagging/sessions"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/repository"
+)
+
+type workSessionDto struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationMinutes float64   `json:"durationMinutes"`
+	Edits           int       `json:"edits"`
+	CharsAdded      int       `json:"charsAdded"`
+	CharsDeleted    int       `json:"charsDeleted"`
+	NetGrowth       int       `json:"netGrowth"`
+	Files           []string  `json:"files"`
+	// Percentage of all characters the student added that were added in this session
+	Share float64 `json:"share"`
+}
+
+type studentSessionsDto struct {
+	Student  string           `json:"student"`
+	Sessions []workSessionDto `json:"sessions"`
+}
+
+type sessionTimelineDto struct {
+	Deadline       time.Time            `json:"deadline"`
+	IdleGapMinutes float64              `json:"idleGapMinutes"`
+	Students       []studentSessionsDto `json:"students"`
+}
+
+// Send the work sessions of every student of a homework, or of the student given by the student
+// query param. Sessions are split where no edit was made for as long as the work_session rule of
+// the homework is set up with, or for idle_gap minutes when given.
+func (h *Handler) SendWorkSessions(w http.ResponseWriter, r *http.Request) {
+	classroom, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+
+	def, _ := flagging.LookupRule("work_session")
+	configs, err := repository.NewRuleConfigRepository(h.DB).GetRuleConfigs(assignment.ID)
+	if err != nil {
+		http.Error(w, `{"status":"ERROR","message":"failed to load rule configurations"}`, http.StatusInternalServerError)
+		return
+	}
+	idleGapMinutes := flagging.ConfiguredParams(configs, def)["idle_gap_minutes"]
+	if gapStr := r.URL.Query().Get("idle_gap"); gapStr != "" {
+		v, err := strconv.ParseFloat(gapStr, 64)
+		if err != nil || v < 1 {
+			http.Error(w, `{"status":"ERROR","message":"'idle_gap' must be at least 1 minute"}`, http.StatusBadRequest)
+			return
+		}
+		idleGapMinutes = v
+	}
+
+	type row struct {
+		StudentAssignmentID uint
+		Email               string
+	}
+	var rows []row
+	q := h.DB.Table("student_assignments sa").
+		Select("sa.id AS student_assignment_id, s.email AS email").
+		Joins("JOIN students s ON s.id = sa.student_id").
+		Where("sa.assignment_id = ? AND s.classroom_id = ? AND sa.deleted_at IS NULL", assignment.ID, classroom.ID).
+		Order("s.email ASC")
+	if studentEmail := r.URL.Query().Get("student"); studentEmail != "" {
+		q = q.Where("s.email = ?", studentEmail)
+	}
+	if err := q.Scan(&rows).Error; err != nil {
+		http.Error(w, `{"status":"ERROR","message":"db error loading students"}`, http.StatusInternalServerError)
+		return
+	}
+
+	timeline := sessionTimelineDto{
+		Deadline:       assignment.DueDate,
+		IdleGapMinutes: idleGapMinutes,
+		Students:       make([]studentSessionsDto, 0, len(rows)),
+	}
+	events := repository.NewEditEventRepository(h.DB)
+	for _, row := range rows {
+		history, err := events.GetEvents(row.StudentAssignmentID)
+		if err != nil {
+			log.Printf("failed to load events of student assignment %d: %v", row.StudentAssignmentID, err)
+			http.Error(w, `{"status":"ERROR","message":"db error loading edits"}`, http.StatusInternalServerError)
+			return
+		}
+		found := sessions.Segment(flagging.AssignmentDiffs(history), time.Duration(idleGapMinutes*float64(time.Minute)))
+		total := 0
+		for _, session := range found {
+			total += session.CharsAdded
+		}
+		student := studentSessionsDto{Student: row.Email, Sessions: make([]workSessionDto, 0, len(found))}
+		for _, session := range found {
+			dto := workSessionDto{
+				Start:           session.Start,
+				End:             session.End,
+				DurationMinutes: session.Duration().Minutes(),
+				Edits:           session.Edits,
+				CharsAdded:      session.CharsAdded,
+				CharsDeleted:    session.CharsDeleted,
+				NetGrowth:       session.NetGrowth(),
+				Files:           session.Files,
+			}
+			if total > 0 {
+				dto.Share = float64(session.CharsAdded) / float64(total) * 100
+			}
+			student.Sessions = append(student.Sessions, dto)
+		}
+		timeline.Students = append(timeline.Students, student)
+	}
+
+	resp := models.Response[sessionTimelineDto]{Data: timeline, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
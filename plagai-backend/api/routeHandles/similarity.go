@@ -0,0 +1,140 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/plagai/plagai-backend/analysis"
+	"github.com/plagai/plagai-backend/flagging"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+)
+
+type matchedRegionDto struct {
+	FilePath       string `json:"filePath"`
+	StartLine      int    `json:"startLine"`
+	EndLine        int    `json:"endLine"`
+	OtherFilePath  string `json:"otherFilePath"`
+	OtherStartLine int    `json:"otherStartLine"`
+	OtherEndLine   int    `json:"otherEndLine"`
+}
+
+type similarityPairDto struct {
+	Student      string `json:"student"`
+	OtherStudent string `json:"otherStudent"`
+	// Percentage of the fingerprints of the smaller submission found in the other one
+	Score              float64 `json:"score"`
+	SharedFingerprints int     `json:"sharedFingerprints"`
+	// Whether the similarity rule of the homework flags the pair
+	Flagged bool `json:"flagged"`
+	// Lines of the student's files matching lines of the other student's files
+	Regions []matchedRegionDto `json:"regions"`
+}
+
+type similarityDto struct {
+	// Thresholds of the similarity rule of the homework
+	FlagScore  float64             `json:"flagScore"`
+	FlagShared int                 `json:"flagShared"`
+	Pairs      []similarityPairDto `json:"pairs"`
+}
+
+// Send the pairs of students of a homework with similar final files, most similar first. Pairs
+// scoring below the min_score query param are left out, and the student query param keeps only
+// the pairs of one student. Pairs are updated as submissions are analysed.
+func (h *Handler) SendSimilarityPairs(w http.ResponseWriter, r *http.Request) {
+	classroom, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	minScore := float64(analysis.MinStoredScore)
+	if scoreStr := r.URL.Query().Get("min_score"); scoreStr != "" {
+		v, err := strconv.ParseFloat(scoreStr, 64)
+		if err != nil || v < 0 || v > 100 {
+			http.Error(w, `{"status":"ERROR","message":"'min_score' must be a percentage"}`, http.StatusBadRequest)
+			return
+		}
+		minScore = v
+	}
+
+	def, _ := flagging.LookupRule("similarity")
+	configs, err := repository.NewRuleConfigRepository(h.DB).GetRuleConfigs(assignment.ID)
+	if err != nil {
+		http.Error(w, `{"status":"ERROR","message":"failed to load rule configurations"}`, http.StatusInternalServerError)
+		return
+	}
+	params := flagging.ConfiguredParams(configs, def)
+
+	type row struct {
+		StudentAssignmentID uint
+		Email               string
+	}
+	var rows []row
+	if err := h.DB.Table("student_assignments sa").
+		Select("sa.id AS student_assignment_id, s.email AS email").
+		Joins("JOIN students s ON s.id = sa.student_id").
+		Where("sa.assignment_id = ? AND s.classroom_id = ? AND sa.deleted_at IS NULL", assignment.ID, classroom.ID).
+		Scan(&rows).Error; err != nil {
+		http.Error(w, `{"status":"ERROR","message":"db error loading students"}`, http.StatusInternalServerError)
+		return
+	}
+	emails := make(map[uint]string, len(rows))
+	for _, row := range rows {
+		emails[row.StudentAssignmentID] = row.Email
+	}
+
+	pairs, err := repository.NewSimilarityRepository(h.DB).GetPairs(assignment.ID, minScore)
+	if err != nil {
+		log.Printf("failed to load similarity pairs of homework %d: %v", assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to load similarity pairs"}`, http.StatusInternalServerError)
+		return
+	}
+
+	studentEmail := r.URL.Query().Get("student")
+	result := similarityDto{
+		FlagScore:  params["min_score"],
+		FlagShared: int(params["min_shared"]),
+		Pairs:      []similarityPairDto{},
+	}
+	for _, pair := range pairs {
+		if studentEmail != "" && emails[pair.OtherStudentAssignmentID] == studentEmail {
+			pair = pair.Swapped()
+		}
+		student, found := emails[pair.StudentAssignmentID]
+		other, otherFound := emails[pair.OtherStudentAssignmentID]
+		// Pairs with student assignments deleted since are left out
+		if !found || !otherFound || (studentEmail != "" && student != studentEmail) {
+			continue
+		}
+		result.Pairs = append(result.Pairs, toSimilarityPairDto(pair, student, other, result.FlagScore, result.FlagShared))
+	}
+
+	resp := models.Response[similarityDto]{Data: result, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func toSimilarityPairDto(pair domain.SimilarityPair, student string, other string, flagScore float64, flagShared int) similarityPairDto {
+	dto := similarityPairDto{
+		Student:            student,
+		OtherStudent:       other,
+		Score:              pair.Score,
+		SharedFingerprints: pair.SharedFingerprints,
+		Flagged:            pair.Score >= flagScore && pair.SharedFingerprints >= flagShared,
+		Regions:            make([]matchedRegionDto, 0, len(pair.Regions)),
+	}
+	for _, r := range pair.Regions {
+		dto.Regions = append(dto.Regions, matchedRegionDto{
+			FilePath:       r.FilePath,
+			StartLine:      r.StartLine,
+			EndLine:        r.EndLine,
+			OtherFilePath:  r.OtherFilePath,
+			OtherStartLine: r.OtherStartLine,
+			OtherEndLine:   r.OtherEndLine,
+		})
+	}
+	return dto
+}
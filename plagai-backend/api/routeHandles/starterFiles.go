@@ -0,0 +1,135 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/plagai/plagai-backend/analysis"
+	"github.com/plagai/plagai-backend/api"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+	"github.com/plagai/plagai-backend/service"
+	"gorm.io/gorm"
+)
+
+// Largest starter archive accepted for upload
+const maxStarterArchiveBytes = 16 << 20
+
+type starterFileDto struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	SHA256  string `json:"sha256"`
+}
+
+type starterUploadPayload struct {
+	HomeworkID uint     `json:"homeworkId"`
+	Files      []string `json:"files"`
+}
+
+// Upload the starter code of a homework as a zip archive in the request body.
+// It replaces the starter files uploaded before and queues the submissions to be analysed again.
+func (h *Handler) UploadStarterFiles(w http.ResponseWriter, r *http.Request) {
+	_, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStarterArchiveBytes))
+	if err != nil {
+		http.Error(w, `{"status":"ERROR","message":"archive too large or unreadable"}`, http.StatusBadRequest)
+		return
+	}
+	files, err := service.ReadStarterArchive(data)
+	if err != nil {
+		log.Printf("rejected starter archive for homework %d: %v", assignment.ID, err)
+		msg, _ := json.Marshal(err.Error())
+		http.Error(w, fmt.Sprintf(`{"status":"ERROR","message":%s}`, msg), http.StatusBadRequest)
+		return
+	}
+	// Submissions are flagged against the starter code, so all of them are analysed again
+	var jobs []domain.AnalysisJob
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := repository.NewStarterFileRepository(tx).ReplaceStarterFiles(assignment.ID, files); err != nil {
+			return err
+		}
+		jobs, err = repository.NewAnalysisJobRepository(tx).EnqueueAssignment(assignment.ID, analysis.DefaultMaxAttempts)
+		return err
+	})
+	if err != nil {
+		log.Printf("failed to store starter files of homework %d: %v", assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to store starter files"}`, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Replaced the starter files of homework %d, queued %d analysis jobs", assignment.ID, len(jobs))
+
+	payload := starterUploadPayload{HomeworkID: assignment.ID, Files: make([]string, len(files))}
+	for i, f := range files {
+		payload.Files[i] = f.Path
+	}
+	resp := models.Response[starterUploadPayload]{Data: payload, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Send the starter files of an assignment to a student of its classroom, used by plaggy init
+func (h *Handler) SendStarterFiles(w http.ResponseWriter, r *http.Request) {
+	claims, err := api.GetClaimsFromAuthorization(r)
+	if err != nil {
+		switch err {
+		case api.ErrMissingAuthHeader:
+			http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
+		case api.ErrInvalidToken:
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		log.Println("auth error:", err)
+		return
+	}
+
+	assignmentID, err := strconv.Atoi(r.URL.Query().Get("assignment"))
+	if err != nil || assignmentID <= 0 {
+		http.Error(w, "Invalid 'assignment'", http.StatusBadRequest)
+		return
+	}
+
+	student, err := repository.NewStudentRepository(h.DB).FindByEmail(claims.Email)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("No student found with email: %v", claims.Email), http.StatusNotFound)
+		log.Println(err)
+		return
+	}
+	var assignment database.Assignment
+	if err := h.DB.Where("id = ? AND classroom_id = ?", assignmentID, student.ClassroomID).
+		First(&assignment).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, fmt.Sprintf("No assignment with id %d in your classroom", assignmentID), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	files, err := repository.NewStarterFileRepository(h.DB).GetStarterFiles(assignment.ID)
+	if err != nil {
+		http.Error(w, "Failed to load starter files", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+	dtos := make([]starterFileDto, len(files))
+	for i, f := range files {
+		dtos[i] = starterFileDto{Path: f.Path, Content: f.Content, SHA256: f.SHA256}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(dtos)
+}
@@ -0,0 +1,116 @@
+package routeHandles
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/plagai/plagai-backend/flagging/features"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/repository"
+)
+
+type featureStatsDto struct {
+	Feature domain.Feature `json:"feature"`
+	// Submissions the feature was measured on
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stdDev"`
+	Min    float64 `json:"min"`
+	P10    float64 `json:"p10"`
+	P25    float64 `json:"p25"`
+	Median float64 `json:"median"`
+	P75    float64 `json:"p75"`
+	P90    float64 `json:"p90"`
+	Max    float64 `json:"max"`
+}
+
+type studentFeaturesDto struct {
+	Student string                     `json:"student"`
+	Values  map[domain.Feature]float64 `json:"values"`
+	// Standard deviations from the class mean of every feature
+	ZScores map[domain.Feature]float64 `json:"zScores"`
+}
+
+type classStatisticsDto struct {
+	Features []featureStatsDto    `json:"features"`
+	Students []studentFeaturesDto `json:"students"`
+}
+
+// Send the distributions of the features class-relative rules compare against for a homework,
+// with the features of every analysed student, or of the student given by the student query
+// param. They are updated as submissions are analysed.
+func (h *Handler) SendClassStatistics(w http.ResponseWriter, r *http.Request) {
+	classroom, assignment, ok := h.instructorHomework(w, r)
+	if !ok {
+		return
+	}
+	class, err := repository.NewFeatureRepository(h.DB).GetClassFeatures(assignment.ID)
+	if err != nil {
+		log.Printf("failed to load features of homework %d: %v", assignment.ID, err)
+		http.Error(w, `{"status":"ERROR","message":"failed to load class statistics"}`, http.StatusInternalServerError)
+		return
+	}
+
+	type row struct {
+		StudentAssignmentID uint
+		Email               string
+	}
+	var rows []row
+	if err := h.DB.Table("student_assignments sa").
+		Select("sa.id AS student_assignment_id, s.email AS email").
+		Joins("JOIN students s ON s.id = sa.student_id").
+		Where("sa.assignment_id = ? AND s.classroom_id = ? AND sa.deleted_at IS NULL", assignment.ID, classroom.ID).
+		Scan(&rows).Error; err != nil {
+		http.Error(w, `{"status":"ERROR","message":"db error loading students"}`, http.StatusInternalServerError)
+		return
+	}
+	emails := make(map[uint]string, len(rows))
+	for _, row := range rows {
+		emails[row.StudentAssignmentID] = row.Email
+	}
+
+	stats := features.Stats(class)
+	result := classStatisticsDto{
+		Features: make([]featureStatsDto, 0, len(domain.Features)),
+		Students: []studentFeaturesDto{},
+	}
+	for _, feature := range domain.Features {
+		s := stats[feature]
+		result.Features = append(result.Features, featureStatsDto{
+			Feature: feature,
+			Count:   s.Count,
+			Mean:    s.Mean,
+			StdDev:  s.StdDev,
+			Min:     features.Percentile(s, 0),
+			P10:     features.Percentile(s, 10),
+			P25:     features.Percentile(s, 25),
+			Median:  features.Percentile(s, 50),
+			P75:     features.Percentile(s, 75),
+			P90:     features.Percentile(s, 90),
+			Max:     features.Percentile(s, 100),
+		})
+	}
+	studentEmail := r.URL.Query().Get("student")
+	for _, measured := range class {
+		email, found := emails[measured.StudentAssignmentID]
+		if !found || (studentEmail != "" && email != studentEmail) {
+			continue
+		}
+		student := studentFeaturesDto{
+			Student: email,
+			Values:  measured.Values,
+			ZScores: make(map[domain.Feature]float64, len(measured.Values)),
+		}
+		for feature, value := range measured.Values {
+			student.ZScores[feature] = features.ZScore(stats[feature], value)
+		}
+		result.Students = append(result.Students, student)
+	}
+
+	resp := models.Response[classStatisticsDto]{Data: result, Status: "OK"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
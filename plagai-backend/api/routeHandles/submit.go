@@ -8,12 +8,15 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/plagai/plagai-backend/analysis"
 	"github.com/plagai/plagai-backend/api"
-	"github.com/plagai/plagai-backend/flagging"
 	"github.com/plagai/plagai-backend/models"
 	"github.com/plagai/plagai-backend/models/database"
 	"github.com/plagai/plagai-backend/models/domain"
 	"github.com/plagai/plagai-backend/repository"
+	"github.com/plagai/plagai-backend/service"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func (h *Handler) SubmitHandler(w http.ResponseWriter, r *http.Request) {
@@ -37,7 +40,6 @@ func (h *Handler) SubmitHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	edits := submission.Edits
 
 	email := claims.Email
 	studentRepo := repository.NewStudentRepository(h.DB)
@@ -52,8 +54,25 @@ func (h *Handler) SubmitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, err := h.ingestSubmission(student.ID, submission); err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to store submission", http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("Received %d edit events from %s:\n", len(submission.Edits), claims.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "received"})
+}
+
+// ingestSubmission stores the events of a submission for the student and queues their analysis.
+// Regular submissions and imported evidence bundles both go through here.
+func (h *Handler) ingestSubmission(studentID uint, submission models.Submission) (domain.StudentAssignment, error) {
+	edits := submission.Edits
+	models.SortEventsBySeq(edits)
+
 	studentAssignmentRepo := repository.NewStudentAssignmentRepo(h.DB)
-	assignments := studentAssignmentRepo.GetStudentAssignments(student.ID)
+	assignments := studentAssignmentRepo.GetStudentAssignments(studentID)
 	studentAssignmentToSubmitTo := domain.StudentAssignment{}
 	assignmentFound := false
 	for _, a := range assignments {
@@ -64,19 +83,60 @@ func (h *Handler) SubmitHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if assignmentFound == false {
-		studentAssignmentToSubmitTo, err = studentAssignmentRepo.NewStudentAssignment(student.ID, submission.AssignmentId)
+		var err error
+		studentAssignmentToSubmitTo, err = studentAssignmentRepo.NewStudentAssignment(studentID, submission.AssignmentId)
 		if err != nil {
-			log.Println(err)
-			return
+			return domain.StudentAssignment{}, err
 		}
 	}
 
+	starterFiles, err := repository.NewStarterFileRepository(h.DB).GetStarterFiles(submission.AssignmentId)
+	if err != nil {
+		log.Printf("failed to load starter files of assignment %d, baseline events aren't trusted: %v", submission.AssignmentId, err)
+	}
+	if cleared := service.VerifyBaselines(edits, starterFiles); cleared > 0 {
+		log.Printf("%d events claimed to match starter files of assignment %d but don't", cleared, submission.AssignmentId)
+	}
+
+	if _, cleared := service.VerifyVCSOperations(edits); cleared > 0 {
+		log.Printf("%d events of assignment %d claimed to be written by git but don't belong to a git operation", cleared, submission.AssignmentId)
+	}
+
+	if _, cleared := service.VerifyBulkOperations(edits); cleared > 0 {
+		log.Printf("%d events of assignment %d claimed to be part of a bulk operation that isn't described", cleared, submission.AssignmentId)
+	}
+
 	var editEventsForDB []models.DBEditEvent
+	var trackingEvents []domain.TrackingEvent
 	for _, editDTO := range edits {
+		if editDTO.EventType == models.APIEventFinalSnapshot {
+			// Only the snapshot sent with the submission stands for the handed in files
+			continue
+		}
+		if editDTO.EventType.IsLifecycle() {
+			trackingEvents = append(trackingEvents, domain.TrackingEvent{
+				EventType:  string(editDTO.EventType),
+				Detail:     editDTO.Patch,
+				OccurredAt: editDTO.EventTime(),
+				Seq:        editDTO.Seq,
+				FilePath:   editDTO.FilePath,
+				MonoMs:     editDTO.MonoMs,
+				SessionID:  editDTO.SessionID,
+			})
+			continue
+		}
 		editEventsForDB = append(editEventsForDB, models.DBEditEvent{
-			PatchText: editDTO.Patch,
-			Timestamp: editDTO.Timestamp.UnixMilli(),
-			FilePath:  editDTO.FilePath,
+			PatchText:     editDTO.Patch,
+			Timestamp:     editDTO.EventTime().UnixMilli(),
+			FilePath:      editDTO.FilePath,
+			Seq:           editDTO.Seq,
+			MonoMs:        editDTO.MonoMs,
+			SessionID:     editDTO.SessionID,
+			Degraded:      editDTO.IsDegraded(),
+			Baseline:      editDTO.IsBaseline(),
+			VCSOperation:  editDTO.VCSOperationID(),
+			BulkOperation: editDTO.BulkOperationID(),
+			EventType:     editDTO.EventType,
 		})
 	}
 
@@ -93,32 +153,55 @@ func (h *Handler) SubmitHandler(w http.ResponseWriter, r *http.Request) {
 			DiffData:            event.PatchText,
 			CreatedAt:           createdAt,
 			UpdatedAt:           createdAt,
+			Seq:                 event.Seq,
+			MonoMs:              event.MonoMs,
+			SessionID:           event.SessionID,
+			Degraded:            event.Degraded,
+			Baseline:            event.Baseline,
+			VCSOperation:        event.VCSOperation,
+			BulkOperation:       event.BulkOperation,
+			EventType:           string(event.EventType),
 		})
 	}
 
-	if err := h.DB.CreateInBatches(&diffsToCreate, 200).Error; err != nil {
-		log.Printf(`{"status":"ERROR","message":"failed to create diffs: %v"}`, err)
-		return
-	}
-
-	log.Printf("Recieved %d edit events and added to db", len(diffsToCreate))
-
-	ruleEngine := flagging.GetDefaultFlaggingEngine()
-	flags := ruleEngine.FlagAssignment(edits)
-
-	flagRepo := repository.NewFlagRepository(h.DB)
-
-	for _, flag := range flags {
-		err = flagRepo.AddFlag(&flag, studentAssignmentToSubmitTo.ID)
+	// The analysis is queued together with the events, so stored events always get flagged
+	var job domain.AnalysisJob
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if len(diffsToCreate) > 0 {
+			// Agents submit their whole history, events stored by an earlier submission are skipped
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&diffsToCreate, 200).Error; err != nil {
+				return fmt.Errorf("failed to create diffs: %w", err)
+			}
+		}
+		if err := repository.NewTrackingEventRepository(tx).AddEvents(studentAssignmentToSubmitTo.ID, trackingEvents); err != nil {
+			return fmt.Errorf("failed to add %d tracking events: %w", len(trackingEvents), err)
+		}
+		if len(submission.Snapshot) > 0 {
+			files, err := json.Marshal(submission.Snapshot)
+			if err != nil {
+				return fmt.Errorf("failed to encode snapshot: %w", err)
+			}
+			if err := tx.Create(&database.SubmissionSnapshot{
+				StudentAssignmentID: studentAssignmentToSubmitTo.ID,
+				Files:               string(files),
+			}).Error; err != nil {
+				return fmt.Errorf("failed to store snapshot of %d files: %w", len(submission.Snapshot), err)
+			}
+		}
+		// Flagging runs in the background, see analysis.Pool
+		var err error
+		job, err = repository.NewAnalysisJobRepository(tx).Enqueue(studentAssignmentToSubmitTo.ID, analysis.DefaultMaxAttempts)
 		if err != nil {
-			log.Printf("failed to add flag for assignment %d, flag text: %q: %v",
-				submission.AssignmentId, flag.FlagExplanation, err)
+			return fmt.Errorf("failed to queue analysis: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return domain.StudentAssignment{}, err
 	}
-	fmt.Printf("Received %d edit events from %s:\n", len(edits), claims.Email)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "received"})
+	log.Printf("Recieved %d edit events and added to db, queued analysis job %d", len(diffsToCreate), job.ID)
+	return studentAssignmentToSubmitTo, nil
 }
 
 /*
@@ -0,0 +1,113 @@
+// Package features measures how each student assignment was written and compares the measures
+// across the class, so rules can flag what is unusual for this class instead of using constants
+// that mean different things in different courses.
+package features
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/plagai/plagai-backend/flagging/sessions"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// TypingSpeedPercentile is the percentile of a student's edit speeds taken as their typing speed,
+// it stands for their fast typing without single pastes deciding it
+const TypingSpeedPercentile = 90
+
+// Measure returns the features of the typed edits of a student assignment, in recording order.
+// It returns false when there are no edits to measure.
+func Measure(diffs []domain.Diff, idleGap time.Duration) (map[domain.Feature]float64, bool) {
+	if len(diffs) == 0 {
+		return nil, false
+	}
+	added, deleted := 0, 0
+	var speeds []float64
+	lastEditForFile := make(map[string]domain.Diff)
+	for _, diff := range diffs {
+		a, d := sessions.CountChanges(diff.PatchText)
+		added += a
+		deleted += d
+		// Coarse patches count a whole changed block as typed, they say nothing about speed
+		if prev, ok := lastEditForFile[diff.FilePath]; ok && !diff.Degraded {
+			if elapsed := diff.ElapsedSince(prev); elapsed > 0 && elapsed <= idleGap && a > 0 {
+				speeds = append(speeds, float64(a)/elapsed.Seconds())
+			}
+		}
+		lastEditForFile[diff.FilePath] = diff
+	}
+
+	found := sessions.Segment(diffs, idleGap)
+	var onTask time.Duration
+	for _, session := range found {
+		onTask += session.Duration()
+	}
+	values := map[domain.Feature]float64{
+		domain.FeatureTypingSpeed:   0,
+		domain.FeatureDeletionRatio: 0,
+		domain.FeatureSessionCount:  float64(len(found)),
+		domain.FeatureTimeOnTask:    onTask.Minutes(),
+	}
+	if len(speeds) > 0 {
+		slices.Sort(speeds)
+		values[domain.FeatureTypingSpeed] = percentile(speeds, TypingSpeedPercentile)
+	}
+	if added > 0 {
+		values[domain.FeatureDeletionRatio] = float64(deleted) / float64(added)
+	}
+	return values, true
+}
+
+// Stats returns the distribution of every feature over the measured submissions
+func Stats(measured []domain.FeatureValues) domain.ClassStats {
+	stats := make(domain.ClassStats, len(domain.Features))
+	for _, feature := range domain.Features {
+		s := domain.FeatureStats{Feature: feature}
+		for _, m := range measured {
+			if v, ok := m.Values[feature]; ok {
+				s.Values = append(s.Values, v)
+			}
+		}
+		slices.Sort(s.Values)
+		s.Count = len(s.Values)
+		if s.Count > 0 {
+			sum := 0.0
+			for _, v := range s.Values {
+				sum += v
+			}
+			s.Mean = sum / float64(s.Count)
+			variance := 0.0
+			for _, v := range s.Values {
+				variance += (v - s.Mean) * (v - s.Mean)
+			}
+			s.StdDev = math.Sqrt(variance / float64(s.Count))
+		}
+		stats[feature] = s
+	}
+	return stats
+}
+
+// Percentile returns the value below which p percent of the class lies, interpolating between
+// the measured values
+func Percentile(stats domain.FeatureStats, p float64) float64 {
+	return percentile(stats.Values, p)
+}
+
+// ZScore returns how many standard deviations the value lies from the class mean
+func ZScore(stats domain.FeatureStats, value float64) float64 {
+	if stats.StdDev == 0 {
+		return 0
+	}
+	return (value - stats.Mean) / stats.StdDev
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := min(max(p, 0), 100) / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
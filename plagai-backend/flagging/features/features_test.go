@@ -0,0 +1,99 @@
+package features
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+func classOf(feature domain.Feature, values ...float64) domain.FeatureStats {
+	measured := make([]domain.FeatureValues, len(values))
+	for i, v := range values {
+		measured[i] = domain.FeatureValues{StudentAssignmentID: uint(i + 1), Values: map[domain.Feature]float64{feature: v}}
+	}
+	return Stats(measured)[feature]
+}
+
+func TestStatsAndPercentile(t *testing.T) {
+	stats := classOf(domain.FeatureTypingSpeed, 4, 2, 8, 6, 10)
+	if stats.Count != 5 || stats.Mean != 6 {
+		t.Fatalf("expected 5 values with mean 6, got %d with mean %v", stats.Count, stats.Mean)
+	}
+	if math.Abs(stats.StdDev-math.Sqrt(8)) > 1e-9 {
+		t.Errorf("expected a standard deviation of sqrt(8), got %v", stats.StdDev)
+	}
+	for p, want := range map[float64]float64{0: 2, 50: 6, 100: 10, 90: 9.2, 12.5: 3} {
+		if got := Percentile(stats, p); math.Abs(got-want) > 1e-9 {
+			t.Errorf("percentile %v: expected %v, got %v", p, want, got)
+		}
+	}
+	if z := ZScore(stats, 6+2*math.Sqrt(8)); math.Abs(z-2) > 1e-9 {
+		t.Errorf("expected a z-score of 2, got %v", z)
+	}
+}
+
+func TestRelativeThresholdBaseline(t *testing.T) {
+	stats := classOf(domain.FeatureDeletionRatio, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1.0, 1.1)
+
+	byPercentile := RelativeThreshold{Percentile: 90, MinClassSize: 10}
+	above, ok := byPercentile.Baseline(stats, Above)
+	if !ok || math.Abs(above.Threshold-1.0) > 1e-9 || above.Percentile != 90 {
+		t.Errorf("expected the 90th percentile 1.0 above, got %+v", above)
+	}
+	below, _ := byPercentile.Baseline(stats, Below)
+	if math.Abs(below.Threshold-0.2) > 1e-9 || below.Percentile != 10 {
+		t.Errorf("expected the 10th percentile 0.2 below, got %+v", below)
+	}
+	if !Exceeds(below, 0.15, Below) || Exceeds(below, 0.25, Below) {
+		t.Error("expected only values under 0.2 to exceed the lower threshold")
+	}
+	if below.Submissions != 11 || math.Abs(below.Median-0.6) > 1e-9 {
+		t.Errorf("expected the baseline of 11 submissions with median 0.6, got %+v", below)
+	}
+
+	byZScore := RelativeThreshold{Percentile: 90, ZScore: 2, MinClassSize: 10}
+	z, _ := byZScore.Baseline(stats, Above)
+	if z.ZScore != 2 || z.Percentile != 0 || math.Abs(z.Threshold-(stats.Mean+2*stats.StdDev)) > 1e-9 {
+		t.Errorf("expected the z-score to win over the percentile, got %+v", z)
+	}
+
+	if _, ok := (RelativeThreshold{Percentile: 90, MinClassSize: 20}).Baseline(stats, Above); ok {
+		t.Error("expected no baseline for a class below the minimum size")
+	}
+	if _, ok := (RelativeThreshold{MinClassSize: 2}).Baseline(stats, Above); ok {
+		t.Error("expected no baseline when no relative threshold is set")
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	diffs := []domain.Diff{
+		{FilePath: "a.go", PatchText: "+0123456789", Timestamp: start},
+		{FilePath: "a.go", PatchText: "+0123456789\n-01234", Timestamp: start.Add(5 * time.Second)},
+		// A second session after a long break
+		{FilePath: "a.go", PatchText: "+0123456789", Timestamp: start.Add(2 * time.Hour)},
+		{FilePath: "a.go", PatchText: "+0123456789", Timestamp: start.Add(2*time.Hour + 10*time.Second)},
+	}
+	values, ok := Measure(diffs, 30*time.Minute)
+	if !ok {
+		t.Fatal("expected features")
+	}
+	if values[domain.FeatureSessionCount] != 2 {
+		t.Errorf("expected 2 sessions, got %v", values[domain.FeatureSessionCount])
+	}
+	if got, want := values[domain.FeatureTimeOnTask], 15.0/60; math.Abs(got-want) > 1e-9 {
+		t.Errorf("expected %v minutes on task, got %v", want, got)
+	}
+	if got := values[domain.FeatureDeletionRatio]; math.Abs(got-5.0/40) > 1e-9 {
+		t.Errorf("expected a deletion ratio of 5/40, got %v", got)
+	}
+	// Edits at 2 and 1 chars/sec, the gap of two hours isn't typing
+	if got := values[domain.FeatureTypingSpeed]; math.Abs(got-1.9) > 1e-9 {
+		t.Errorf("expected a typing speed of 1.9, got %v", got)
+	}
+	if _, ok := Measure(nil, 30*time.Minute); ok {
+		t.Error("expected no features without edits")
+	}
+}
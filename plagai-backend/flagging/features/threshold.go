@@ -0,0 +1,90 @@
+package features
+
+import (
+	"fmt"
+
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// RelativeThreshold sets a threshold relative to the class. A percentile of 95 marks the values
+// more extreme than 95% of the class, a z-score of 2 those more than two standard deviations from
+// the mean. The z-score wins when both are set, 0 turns either off.
+type RelativeThreshold struct {
+	Percentile float64
+	ZScore     float64
+	// Classes with fewer measured submissions are too small to compare with
+	MinClassSize int
+}
+
+// Direction tells which tail of the class distribution is unusual
+type Direction int
+
+const (
+	Above Direction = iota
+	Below
+)
+
+// Baseline returns the threshold the relative threshold sets on the class distribution, with the
+// distribution it was taken from. It returns false when the threshold is off or the class is too
+// small, rules then use their fixed thresholds.
+func (t RelativeThreshold) Baseline(stats domain.FeatureStats, direction Direction) (domain.ClassBaseline, bool) {
+	if (t.Percentile <= 0 && t.ZScore <= 0) || stats.Count == 0 || stats.Count < t.MinClassSize {
+		return domain.ClassBaseline{}, false
+	}
+	baseline := domain.ClassBaseline{
+		Feature:     stats.Feature,
+		Submissions: stats.Count,
+		Mean:        stats.Mean,
+		StdDev:      stats.StdDev,
+		Median:      Percentile(stats, 50),
+	}
+	if t.ZScore > 0 {
+		baseline.ZScore = t.ZScore
+		baseline.Threshold = stats.Mean + t.ZScore*stats.StdDev
+		if direction == Below {
+			baseline.Threshold = stats.Mean - t.ZScore*stats.StdDev
+		}
+		return baseline, true
+	}
+	baseline.Percentile = t.Percentile
+	if direction == Below {
+		baseline.Percentile = 100 - t.Percentile
+	}
+	baseline.Threshold = Percentile(stats, baseline.Percentile)
+	return baseline, true
+}
+
+// Exceeds reports whether the value lies beyond the threshold in the direction
+func Exceeds(baseline domain.ClassBaseline, value float64, direction Direction) bool {
+	if direction == Below {
+		return value < baseline.Threshold
+	}
+	return value > baseline.Threshold
+}
+
+// Describe tells how the threshold was set, as "the class's 95th percentile of 30.2"
+func Describe(baseline domain.ClassBaseline) string {
+	if baseline.ZScore > 0 {
+		return fmt.Sprintf("%.1f standard deviations from the class mean of %.2f (%.2f)", baseline.ZScore, baseline.Mean, baseline.Threshold)
+	}
+	return fmt.Sprintf("the class's %s percentile of %.2f", ordinal(baseline.Percentile), baseline.Threshold)
+}
+
+func ordinal(p float64) string {
+	if p != float64(int(p)) {
+		return fmt.Sprintf("%.1fth", p)
+	}
+	n := int(p)
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
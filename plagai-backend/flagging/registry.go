@@ -0,0 +1,486 @@
+package flagging
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/plagai/plagai-backend/flagging/features"
+	"github.com/plagai/plagai-backend/flagging/rules"
+	"github.com/plagai/plagai-backend/flagging/similarity"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// RuleKind tells what a rule is applied to, see DiffRule, AssignmentRule and EventRule
+type RuleKind string
+
+const (
+	RuleKindDiff       RuleKind = "diff"
+	RuleKindAssignment RuleKind = "assignment"
+	RuleKindEvent      RuleKind = "event"
+)
+
+// ParamType is the type of a rule parameter. Parameters are sent and stored as JSON numbers.
+type ParamType string
+
+const (
+	ParamNumber  ParamType = "number"
+	ParamInteger ParamType = "integer"
+)
+
+// ParamSpec describes a parameter a rule is built with
+type ParamSpec struct {
+	Name        string    `json:"name"`
+	Type        ParamType `json:"type"`
+	Description string    `json:"description"`
+	Default     float64   `json:"default"`
+	// Smallest accepted value
+	Min float64 `json:"min"`
+	// Largest accepted value, 0 for none
+	Max float64 `json:"max,omitempty"`
+}
+
+// RuleDefinition is an entry of the rule registry
+type RuleDefinition struct {
+	ID          string      `json:"id"`
+	Kind        RuleKind    `json:"kind"`
+	Description string      `json:"description"`
+	Params      []ParamSpec `json:"params"`
+	// Raised whenever the rule starts flagging differently with the same parameters
+	Version int `json:"version"`
+	// Whether the rule runs for assignments that have no configuration for it
+	DefaultEnabled bool `json:"defaultEnabled"`
+	// build returns a DiffRule, AssignmentRule or EventRule matching Kind for the student
+	// assignment, params are complete and validated
+	build func(params domain.RuleParams, ctx RuleContext) any
+}
+
+// RuleContext is what rules know about a student assignment besides its events
+type RuleContext struct {
+	Assignment domain.Assignment
+	// Pairs of the student assignment with other student assignments of the assignment, seen from
+	// it and with the emails of the other students
+	SimilarityPairs []domain.SimilarityPair
+	// Reference documents of the assignment, fingerprinted without the starter code
+	Corpus similarity.Corpus
+	// Distributions of the features over the class and the features of the student assignment,
+	// nil when it has no typed edits
+	ClassStats domain.ClassStats
+	Features   map[domain.Feature]float64
+}
+
+// registry holds every rule an assignment can be flagged with, in the order they are applied
+var registry = []RuleDefinition{
+	{
+		ID:          "typing_speed",
+		Kind:        RuleKindDiff,
+		Version:     1,
+		Description: "Flags text entered faster than a person types, as when pasting",
+		Params: append([]ParamSpec{{
+			Name: "max_chars_per_second", Type: ParamNumber, Default: 20, Min: 1,
+			Description: "Characters per second above which an edit is flagged, unless a class-relative threshold is set",
+		}}, relativeParams(0, 0)...),
+		DefaultEnabled: true,
+		build: func(p domain.RuleParams, ctx RuleContext) any {
+			return rules.SpeedThresholdRule{
+				MaxCharsPerSecond: p["max_chars_per_second"],
+				Relative:          relativeThreshold(p),
+				Class:             ctx.ClassStats[domain.FeatureTypingSpeed],
+			}
+		},
+	},
+	{
+		ID:          "large_insertion",
+		Kind:        RuleKindDiff,
+		Version:     1,
+		Description: "Flags large blocks of text inserted in a single edit, as when pasting",
+		Params: []ParamSpec{
+			{
+				Name: "max_lines", Type: ParamInteger, Default: 40, Min: 0,
+				Description: "Lines of an inserted block above which it is flagged, 0 to not count lines",
+			},
+			{
+				Name: "max_chars", Type: ParamInteger, Default: 1500, Min: 0,
+				Description: "Characters other than whitespace of an inserted block above which it is flagged, 0 to not count characters",
+			},
+			{
+				Name: "max_tokens", Type: ParamInteger, Default: 300, Min: 0,
+				Description: "Identifiers, numbers and symbols of an inserted block above which it is flagged, 0 to not count tokens",
+			},
+		},
+		DefaultEnabled: true,
+		build: func(p domain.RuleParams, _ RuleContext) any {
+			return rules.LargeInsertionRule{
+				MaxLines:  int(p["max_lines"]),
+				MaxChars:  int(p["max_chars"]),
+				MaxTokens: int(p["max_tokens"]),
+			}
+		},
+	},
+	{
+		ID:          "corpus_insertion",
+		Kind:        RuleKindDiff,
+		Version:     1,
+		Description: "Flags blocks inserted in a single edit that match a reference document of the homework",
+		Params: []ParamSpec{
+			{
+				Name: "min_score", Type: ParamNumber, Default: 60, Min: 0,
+				Description: "Percentage of the fingerprints of a block found in a reference document from which it is flagged",
+			},
+			{
+				Name: "min_tokens", Type: ParamInteger, Default: 50, Min: 0,
+				Description: "Tokens below which an inserted block is too small to judge",
+			},
+		},
+		DefaultEnabled: true,
+		build: func(p domain.RuleParams, ctx RuleContext) any {
+			return rules.CorpusInsertionRule{
+				Corpus:    ctx.Corpus,
+				MinScore:  p["min_score"],
+				MinTokens: int(p["min_tokens"]),
+			}
+		},
+	},
+	{
+		ID:          "flag_everything",
+		Kind:        RuleKindDiff,
+		Version:     1,
+		Description: "Flags every edit, for testing the flagging pipeline",
+		build:       func(domain.RuleParams, RuleContext) any { return rules.FlagEverythingRule{} },
+	},
+	{
+		ID:             "no_deletions",
+		Kind:           RuleKindAssignment,
+		Version:        1,
+		Description:    "Flags assignments written without ever deleting anything",
+		DefaultEnabled: true,
+		build:          func(domain.RuleParams, RuleContext) any { return rules.NoDeletionsRule{} },
+	},
+	{
+		ID:          "work_session",
+		Kind:        RuleKindAssignment,
+		Version:     1,
+		Description: "Flags assignments written mostly in one work session or only shortly before the deadline",
+		Params: []ParamSpec{
+			{
+				Name: "idle_gap_minutes", Type: ParamNumber, Default: 30, Min: 1,
+				Description: "Minutes without edits that end a work session",
+			},
+			{
+				Name: "max_session_share", Type: ParamNumber, Default: 80, Min: 0,
+				Description: "Percentage of the code written in a single session above which it is flagged, 0 to not check",
+			},
+			{
+				Name: "last_hours", Type: ParamNumber, Default: 6, Min: 0,
+				Description: "Hours before the deadline; assignments with all work done in them are flagged, 0 to not check",
+			},
+			{
+				Name: "min_chars", Type: ParamInteger, Default: 500, Min: 0,
+				Description: "Characters written below which an assignment is too small to judge",
+			},
+		},
+		DefaultEnabled: true,
+		build: func(p domain.RuleParams, ctx RuleContext) any {
+			return rules.WorkSessionRule{
+				IdleGap:         time.Duration(p["idle_gap_minutes"] * float64(time.Minute)),
+				MaxSessionShare: p["max_session_share"],
+				LastHours:       p["last_hours"],
+				MinChars:        int(p["min_chars"]),
+				Deadline:        ctx.Assignment.DueDate,
+			}
+		},
+	},
+	{
+		ID:             "class_outlier",
+		Kind:           RuleKindAssignment,
+		Version:        1,
+		Description:    "Flags assignments typed much faster, with much fewer deletions, or in fewer and shorter work sessions than the rest of the class",
+		Params:         relativeParams(0, 2.5),
+		DefaultEnabled: true,
+		build: func(p domain.RuleParams, ctx RuleContext) any {
+			return rules.ClassOutlierRule{
+				Relative: relativeThreshold(p),
+				Class:    ctx.ClassStats,
+				Values:   ctx.Features,
+			}
+		},
+	},
+	{
+		ID:          "similarity",
+		Kind:        RuleKindAssignment,
+		Version:     1,
+		Description: "Flags final files similar to those of another student of the assignment",
+		Params: []ParamSpec{
+			{
+				Name: "min_score", Type: ParamNumber, Default: 60, Min: 0,
+				Description: "Percentage of the fingerprints of the smaller submission found in the other one from which a pair is flagged",
+			},
+			{
+				Name: "min_shared", Type: ParamInteger, Default: 20, Min: 0,
+				Description: "Matching fingerprints below which a pair is too small to judge",
+			},
+		},
+		DefaultEnabled: true,
+		build: func(p domain.RuleParams, ctx RuleContext) any {
+			return rules.SimilarityRule{
+				Pairs:     ctx.SimilarityPairs,
+				MinScore:  p["min_score"],
+				MinShared: int(p["min_shared"]),
+			}
+		},
+	},
+	{
+		ID:          "clock_consistency",
+		Kind:        RuleKindEvent,
+		Version:     3,
+		Description: "Flags gaps in the edit history and changes of the system clock while working",
+		Params: []ParamSpec{{
+			Name: "tolerance_ms", Type: ParamInteger, Default: 5000, Min: 0,
+			Description: "Allowed drift in milliseconds between the wall clock and the monotonic clock of two consecutive events",
+		}},
+		DefaultEnabled: true,
+		build: func(p domain.RuleParams, _ RuleContext) any {
+			return rules.ClockConsistencyRule{ToleranceMs: int64(p["tolerance_ms"])}
+		},
+	},
+	{
+		ID:             "final_snapshot",
+		Kind:           RuleKindEvent,
+		Version:        2,
+		Description:    "Flags handed in files whose content never appeared in the edit history",
+		DefaultEnabled: true,
+		build:          func(domain.RuleParams, RuleContext) any { return rules.FinalSnapshotRule{} },
+	},
+	{
+		ID:          "corpus_file",
+		Kind:        RuleKindEvent,
+		Version:     1,
+		Description: "Flags final files that match a reference document of the homework",
+		Params: []ParamSpec{
+			{
+				Name: "min_score", Type: ParamNumber, Default: 50, Min: 0,
+				Description: "Percentage of the fingerprints of the file or the document, whichever has fewer, found in the other from which it is flagged",
+			},
+			{
+				Name: "min_shared", Type: ParamInteger, Default: 20, Min: 0,
+				Description: "Matching fingerprints below which a file is too small to judge",
+			},
+		},
+		DefaultEnabled: true,
+		build: func(p domain.RuleParams, ctx RuleContext) any {
+			return rules.CorpusFileRule{
+				Corpus:    ctx.Corpus,
+				MinScore:  p["min_score"],
+				MinShared: int(p["min_shared"]),
+			}
+		},
+	},
+	{
+		ID:             "vcs_operation",
+		Kind:           RuleKindEvent,
+		Version:        1,
+		Description:    "Explains git pulls and merges that brought in files",
+		DefaultEnabled: true,
+		build:          func(domain.RuleParams, RuleContext) any { return rules.VCSOperationRule{} },
+	},
+	{
+		ID:             "bulk_operation",
+		Kind:           RuleKindEvent,
+		Version:        1,
+		Description:    "Explains changes to many files at once, such as extracting an archive",
+		DefaultEnabled: true,
+		build:          func(domain.RuleParams, RuleContext) any { return rules.BulkOperationRule{} },
+	},
+	{
+		ID:             "tracking_pause",
+		Kind:           RuleKindEvent,
+		Version:        1,
+		Description:    "Explains pauses of tracking during which files changed",
+		DefaultEnabled: true,
+		build:          func(domain.RuleParams, RuleContext) any { return rules.TrackingPauseRule{} },
+	},
+}
+
+// relativeParams are the parameters of rules whose thresholds can be set relative to the class,
+// see features.RelativeThreshold
+func relativeParams(percentile float64, zScore float64) []ParamSpec {
+	return []ParamSpec{
+		{
+			Name: "percentile", Type: ParamNumber, Default: percentile, Min: 0, Max: 100,
+			Description: "Flags values more extreme than this percentage of the class, 0 to not compare by percentile",
+		},
+		{
+			Name: "z_score", Type: ParamNumber, Default: zScore, Min: 0,
+			Description: "Flags values more than this many standard deviations from the class mean, 0 to not compare by z-score. Used over the percentile when both are set",
+		},
+		{
+			Name: "min_class_size", Type: ParamInteger, Default: 10, Min: 2,
+			Description: "Analysed submissions below which the class is too small to compare with",
+		},
+	}
+}
+
+func relativeThreshold(p domain.RuleParams) features.RelativeThreshold {
+	return features.RelativeThreshold{
+		Percentile:   p["percentile"],
+		ZScore:       p["z_score"],
+		MinClassSize: int(p["min_class_size"]),
+	}
+}
+
+// ConfiguredParams returns the parameters the rule runs with under the configurations, the
+// defaults when it has no configuration
+func ConfiguredParams(configs []domain.RuleConfig, def RuleDefinition) domain.RuleParams {
+	for _, config := range configs {
+		if config.RuleID == def.ID {
+			return def.EffectiveParams(config.Params)
+		}
+	}
+	return def.EffectiveParams(nil)
+}
+
+// Rules returns the rule registry
+func Rules() []RuleDefinition {
+	return registry
+}
+
+// LookupRule returns the registry entry of the rule with the given ID
+func LookupRule(id string) (RuleDefinition, bool) {
+	for _, def := range registry {
+		if def.ID == id {
+			return def, true
+		}
+	}
+	return RuleDefinition{}, false
+}
+
+// ValidateParams checks that params only holds parameters of the rule with values of their type
+func (def RuleDefinition) ValidateParams(params domain.RuleParams) error {
+	for name, value := range params {
+		spec, ok := def.param(name)
+		if !ok {
+			return fmt.Errorf("rule %s has no parameter %q", def.ID, name)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("parameter %q must be a finite number", name)
+		}
+		if spec.Type == ParamInteger && value != math.Trunc(value) {
+			return fmt.Errorf("parameter %q must be an integer", name)
+		}
+		if value < spec.Min {
+			return fmt.Errorf("parameter %q must be at least %v", name, spec.Min)
+		}
+		if spec.Max != 0 && value > spec.Max {
+			return fmt.Errorf("parameter %q must be at most %v", name, spec.Max)
+		}
+	}
+	return nil
+}
+
+// EffectiveParams returns the defaults of the rule overridden by params
+func (def RuleDefinition) EffectiveParams(params domain.RuleParams) domain.RuleParams {
+	effective := make(domain.RuleParams, len(def.Params))
+	for _, spec := range def.Params {
+		effective[spec.Name] = spec.Default
+		if value, ok := params[spec.Name]; ok {
+			effective[spec.Name] = value
+		}
+	}
+	return effective
+}
+
+func (def RuleDefinition) param(name string) (ParamSpec, bool) {
+	for _, spec := range def.Params {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return ParamSpec{}, false
+}
+
+// BuildFlaggingEngine builds the engine of a student assignment from the rule configurations of
+// its assignment. Rules without a configuration run as the registry sets them up by default.
+func BuildFlaggingEngine(configs []domain.RuleConfig, ctx RuleContext) (*FlaggingEngine, error) {
+	byID := make(map[string]domain.RuleConfig, len(configs))
+	for _, config := range configs {
+		if _, ok := LookupRule(config.RuleID); !ok {
+			return nil, fmt.Errorf("unknown rule %q", config.RuleID)
+		}
+		byID[config.RuleID] = config
+	}
+
+	engine := &FlaggingEngine{}
+	for _, def := range registry {
+		enabled, params := def.DefaultEnabled, domain.RuleParams(nil)
+		if config, ok := byID[def.ID]; ok {
+			enabled, params = config.Enabled, config.Params
+		}
+		if !enabled {
+			continue
+		}
+		if err := def.ValidateParams(params); err != nil {
+			return nil, err
+		}
+		params = def.EffectiveParams(params)
+
+		switch rule := def.build(params, ctx).(type) {
+		case DiffRule:
+			engine.DiffRules = append(engine.DiffRules, identifiedDiffRule{id: def.ID, version: def.Version, params: params, rule: rule})
+		case AssignmentRule:
+			engine.AssignmentRules = append(engine.AssignmentRules, identifiedAssignmentRule{id: def.ID, version: def.Version, params: params, rule: rule})
+		case EventRule:
+			engine.EventRules = append(engine.EventRules, identifiedEventRule{id: def.ID, version: def.Version, params: params, rule: rule})
+		default:
+			return nil, fmt.Errorf("rule %s builds %T, which is no rule", def.ID, rule)
+		}
+	}
+	return engine, nil
+}
+
+// The identified rules record which rule raised a flag, in which version and with which
+// parameters
+
+type identifiedDiffRule struct {
+	id      string
+	version int
+	params  domain.RuleParams
+	rule    DiffRule
+}
+
+func (r identifiedDiffRule) Apply(diff domain.Diff, prevTimestamp time.Time) *domain.Flag {
+	f := r.rule.Apply(diff, prevTimestamp)
+	if f != nil {
+		f.RuleID, f.RuleVersion, f.RuleParams = r.id, r.version, r.params
+	}
+	return f
+}
+
+type identifiedAssignmentRule struct {
+	id      string
+	version int
+	params  domain.RuleParams
+	rule    AssignmentRule
+}
+
+func (r identifiedAssignmentRule) Apply(diffs []domain.Diff) []domain.Flag {
+	return identify(r.rule.Apply(diffs), r.id, r.version, r.params)
+}
+
+type identifiedEventRule struct {
+	id      string
+	version int
+	params  domain.RuleParams
+	rule    EventRule
+}
+
+func (r identifiedEventRule) Apply(events []models.EditEvent) []domain.Flag {
+	return identify(r.rule.Apply(events), r.id, r.version, r.params)
+}
+
+func identify(flags []domain.Flag, id string, version int, params domain.RuleParams) []domain.Flag {
+	for i := range flags {
+		flags[i].RuleID, flags[i].RuleVersion, flags[i].RuleParams = id, version, params
+	}
+	return flags
+}
@@ -1,16 +1,21 @@
 package flagging
 
 import (
+	"fmt"
 	"time"
 
-	"github.com/plagai/plagai-backend/flagging/rules"
 	"github.com/plagai/plagai-backend/models"
 	"github.com/plagai/plagai-backend/models/domain"
 )
 
+// EngineVersion is raised whenever the engine changes which events it hands to the rules, so
+// flags of an older engine can be told apart after a re-run
+const EngineVersion = 2
+
 type FlaggingEngine struct {
 	DiffRules       []DiffRule
 	AssignmentRules []AssignmentRule
+	EventRules      []EventRule
 }
 
 // Rule applied to a single diff
@@ -23,16 +28,19 @@ type AssignmentRule interface {
 	Apply(diffs []domain.Diff) []domain.Flag
 }
 
+// Rule applied to the raw event stream of a submission, including lifecycle events
+type EventRule interface {
+	Apply(events []models.EditEvent) []domain.Flag
+}
+
+// GetDefaultFlaggingEngine returns the engine of assignments without rule configurations
 func GetDefaultFlaggingEngine() *FlaggingEngine {
-	return &FlaggingEngine{
-		DiffRules: []DiffRule{
-			rules.SpeedThresholdRule{MaxCharsPerSecond: 20}, // example threshold
-			rules.FlagEverythingRule{},
-		},
-		AssignmentRules: []AssignmentRule{
-			rules.NoDeletionsRule{},
-		},
+	engine, err := BuildFlaggingEngine(nil, RuleContext{})
+	if err != nil {
+		// The registry defaults are fixed, they can only be wrong while developing
+		panic(fmt.Sprintf("invalid rule registry defaults: %v", err))
 	}
+	return engine
 }
 
 func NewFlaggingEngine(diffRules []DiffRule, assignmentRules []AssignmentRule) *FlaggingEngine {
@@ -46,28 +54,48 @@ func (e *FlaggingEngine) FlagAssignment(events []models.EditEvent) []domain.Flag
 	flags := []domain.Flag{}
 
 	// Accumulate diffs in the diff rules to use for assignment rules
-	lastEditTimeForFile := make(map[string]time.Time)
+	lastEditForFile := make(map[string]domain.Diff)
 	diffs := []domain.Diff{}
+	// Diffs recorded between a daemon start, watch, overflow or resume and the following reconcile
+	// event hold edits the daemon didn't see happen, so they say nothing about typing speed
+	reconciling := false
 	// Apply per-diff rules
 	for _, event := range events {
-		if event.EventType != models.APIEventAdded && event.EventType != models.APIEventModified {
-			lastEditTimeForFile[event.FilePath] = event.Timestamp
+		if event.EventType.IsLifecycle() {
+			switch event.EventType {
+			case models.APIEventDaemonStarted, models.APIEventWatchAdded, models.APIEventOverflow, models.APIEventTrackingResumed:
+				reconciling = true
+			case models.APIEventReconcile:
+				reconciling = false
+			}
 			continue
 		}
-		diff := domain.Diff{
-			FilePath:  event.FilePath,
-			PatchText: event.Patch,
-			Timestamp: event.Timestamp,
+		diff := eventDiff(event)
+		// Deletions, renames and restores aren't typing, and starter files, git operations and bulk
+		// operations weren't typed either. They only move the previous edit forward.
+		if !typedEdit(event, diff) {
+			lastEditForFile[event.FilePath] = diff
+			continue
 		}
 		diffs = append(diffs, diff)
+		// Coarse patches count the whole changed block as typed, which would trip the speed rules
+		if reconciling || diff.Degraded {
+			lastEditForFile[event.FilePath] = diff
+			continue
+		}
+		// Rules only see timestamps, so the previous edit time is derived from the elapsed time
+		// which prefers the monotonic clock over the wall clock
+		var prevEditTime time.Time
+		if prev, ok := lastEditForFile[event.FilePath]; ok {
+			prevEditTime = diff.Timestamp.Add(-diff.ElapsedSince(prev))
+		}
 		for _, rule := range e.DiffRules {
-			prevEditTime := lastEditTimeForFile[event.FilePath]
 			if f := rule.Apply(diff, prevEditTime); f != nil {
 				f.Diff = diff
 				flags = append(flags, *f)
 			}
 		}
-		lastEditTimeForFile[event.FilePath] = event.Timestamp
+		lastEditForFile[event.FilePath] = diff
 	}
 
 	// Apply whole-assignment rules
@@ -75,5 +103,53 @@ func (e *FlaggingEngine) FlagAssignment(events []models.EditEvent) []domain.Flag
 		flags = append(flags, rule.Apply(diffs)...)
 	}
 
+	for _, rule := range e.EventRules {
+		flags = append(flags, rule.Apply(events)...)
+	}
+
+	for i := range flags {
+		flags[i].EngineVersion = EngineVersion
+	}
 	return flags
 }
+
+// AssignmentDiffs returns the edits of an event stream that assignment rules are applied to, the
+// ones the student may have typed
+func AssignmentDiffs(events []models.EditEvent) []domain.Diff {
+	diffs := []domain.Diff{}
+	for _, event := range events {
+		if event.EventType.IsLifecycle() {
+			continue
+		}
+		if diff := eventDiff(event); typedEdit(event, diff) {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+func eventDiff(event models.EditEvent) domain.Diff {
+	return domain.Diff{
+		ID:            event.DiffID,
+		FilePath:      event.FilePath,
+		PatchText:     event.Patch,
+		Timestamp:     event.EventTime(),
+		Seq:           event.Seq,
+		MonoMs:        event.MonoMs,
+		SessionID:     event.SessionID,
+		Degraded:      event.IsDegraded(),
+		Baseline:      event.IsBaseline(),
+		VCSOperation:  event.VCSOperationID(),
+		BulkOperation: event.BulkOperationID(),
+	}
+}
+
+// typedEdit reports whether the edit may have been typed by the student. Starter files were
+// handed out, git writes checked out or pulled files and tools write many files at once, none of
+// that was typed. Bulk operations are explained by BulkOperationRule.
+func typedEdit(event models.EditEvent, diff domain.Diff) bool {
+	if event.EventType != models.APIEventAdded && event.EventType != models.APIEventModified {
+		return false
+	}
+	return !diff.Baseline && diff.VCSOperation == "" && diff.BulkOperation == ""
+}
@@ -0,0 +1,44 @@
+package flagging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// flagEverything flags every diff it is handed
+type flagEverything struct{}
+
+func (flagEverything) Apply(diff domain.Diff, _ time.Time) *domain.Flag {
+	return &domain.Flag{FlagExplanation: "edit", Severity: 1}
+}
+
+func TestFilesFoundWhenWatchingAreNotTyped(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int, eventType models.EditEventType, path string) models.EditEvent {
+		return models.EditEvent{
+			FilePath:  path,
+			EventType: eventType,
+			Patch:     "@@ -0,0 +1 @@\n+package main\n",
+			Timestamp: start.Add(time.Duration(seconds) * time.Second),
+		}
+	}
+	events := []models.EditEvent{
+		at(0, models.APIEventWatchAdded, "/hw"),
+		at(1, models.APIEventAdded, "/hw/main.go"),
+		at(1, models.APIEventAdded, "/hw/util.go"),
+		at(2, models.APIEventReconcile, "/hw"),
+		at(60, models.APIEventModified, "/hw/main.go"),
+	}
+
+	engine := NewFlaggingEngine([]DiffRule{flagEverything{}}, nil)
+	flags := engine.FlagAssignment(events)
+	if len(flags) != 1 {
+		t.Fatalf("expected only the edit after the reconcile to reach the diff rules, got %+v", flags)
+	}
+	if flags[0].Diff.Timestamp != events[4].Timestamp {
+		t.Errorf("expected the flag on the edit after the reconcile, got %+v", flags[0].Diff)
+	}
+}
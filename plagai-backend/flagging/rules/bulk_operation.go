@@ -0,0 +1,55 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// BulkOperationRule explains every burst of changes to many files at once with a single flag.
+// The changes themselves are left out of the typing rules, which would flag each file as pasted.
+type BulkOperationRule struct{}
+
+func (r BulkOperationRule) Apply(events []models.EditEvent) []domain.Flag {
+	flags := []domain.Flag{}
+	for _, event := range events {
+		if event.EventType != models.APIEventBulkOperation {
+			continue
+		}
+		var op models.BulkOperation
+		if err := json.Unmarshal([]byte(event.Patch), &op); err != nil {
+			continue
+		}
+		took := op.EndedAt.Sub(op.StartedAt).Round(time.Millisecond)
+
+		var explanation string
+		severity := 1
+		switch op.Kind {
+		case "copy_in":
+			explanation = fmt.Sprintf("%d files appeared at once within %s, as when extracting an archive or copying files in. Their content was not typed here", op.Added, took)
+			severity = 2
+		case "rewrite":
+			explanation = fmt.Sprintf("%d files were rewritten at once within %s, as when running a formatter over the project", op.Modified, took)
+		case "delete":
+			// Removing files brings nothing in
+			continue
+		default:
+			explanation = fmt.Sprintf("%d files changed at once within %s (%d added, %d modified, %d deleted), as when a tool rewrote the project",
+				op.Files, took, op.Added, op.Modified, op.Deleted)
+		}
+		flags = append(flags, domain.Flag{
+			Diff: domain.Diff{
+				FilePath:  event.FilePath,
+				PatchText: event.Patch,
+				Timestamp: event.EventTime(),
+				Seq:       event.Seq,
+			},
+			FlagExplanation: explanation,
+			Severity:        severity,
+		})
+	}
+	return flags
+}
@@ -0,0 +1,57 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/plagai/plagai-backend/flagging/features"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// ClassOutlierRule flags student assignments written unlike the rest of the class: typing much
+// faster, deleting much less, or working in fewer and shorter sessions. What is unusual depends
+// on the course, so the thresholds come from the class distributions.
+type ClassOutlierRule struct {
+	Relative features.RelativeThreshold
+	Class    domain.ClassStats
+	// Features of the student assignment, nil when it has no typed edits
+	Values map[domain.Feature]float64
+}
+
+// outlierDirections are the unusual tails of the features, in the order they are checked
+var outlierDirections = []struct {
+	feature     domain.Feature
+	direction   features.Direction
+	explanation string
+}{
+	{domain.FeatureTypingSpeed, features.Above, "Typed much faster than the rest of the class"},
+	{domain.FeatureDeletionRatio, features.Below, "Deleted much less than the rest of the class"},
+	{domain.FeatureSessionCount, features.Below, "Worked in far fewer sessions than the rest of the class"},
+	{domain.FeatureTimeOnTask, features.Below, "Spent much less time on the assignment than the rest of the class"},
+}
+
+func (r ClassOutlierRule) Apply([]domain.Diff) []domain.Flag {
+	flags := []domain.Flag{}
+	if r.Values == nil {
+		return flags
+	}
+	for _, outlier := range outlierDirections {
+		value, measured := r.Values[outlier.feature]
+		baseline, ok := r.Relative.Baseline(r.Class[outlier.feature], outlier.direction)
+		if !measured || !ok || !features.Exceeds(baseline, value, outlier.direction) {
+			continue
+		}
+		baseline.Value = value
+		// The explanation stays the same while the class grows, so decisions on the flag are kept;
+		// the numbers are in the baseline and the patch text
+		flags = append(flags, domain.Flag{
+			Diff: domain.Diff{
+				PatchText: fmt.Sprintf("%s: %.2f, beyond %s (class median %.2f, %d submissions)\n",
+					outlier.feature, value, features.Describe(baseline), baseline.Median, baseline.Submissions),
+			},
+			FlagExplanation: outlier.explanation,
+			Severity:        1,
+			Baseline:        &baseline,
+		})
+	}
+	return flags
+}
@@ -0,0 +1,85 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// ClockConsistencyRule checks the sequence numbers and clock readings the agent attaches to
+// every event. Within one daemon session the wall clock and the monotonic clock should advance
+// by the same amount, if they don't the system clock was changed while the student worked. The
+// agent reads a monotonic clock that keeps counting while the machine sleeps, so drift in either
+// direction is flagged. Moving the clock forward would stretch the time edits appear to take.
+//
+// A gap in the sequence numbers may just be an event the agent failed to store, it is flagged
+// with a low severity. Sequence numbers start over on another device, see models.SortEventsBySeq.
+type ClockConsistencyRule struct {
+	ToleranceMs int64 // allowed drift between wall and monotonic clock for two consecutive events
+}
+
+func (r ClockConsistencyRule) Apply(events []models.EditEvent) []domain.Flag {
+	flags := []domain.Flag{}
+	var prev *models.EditEvent
+
+	for i := range events {
+		event := &events[i]
+		if event.Seq == 0 {
+			// Old agents don't send sequence numbers or clock readings
+			return flags
+		}
+		if prev == nil {
+			prev = event
+			continue
+		}
+
+		// A session starting at 1 belongs to a new agent database or another device
+		newHistory := event.SessionID != prev.SessionID && event.Seq == 1
+		if event.Seq != prev.Seq+1 && !newHistory {
+			flags = append(flags, r.flag(*event, 1, fmt.Sprintf(
+				"Edit history is not contiguous, sequence number jumps from %d to %d", prev.Seq, event.Seq)))
+		}
+
+		wallDelta := event.WallMs - prev.WallMs
+		if event.SessionID != "" && event.SessionID == prev.SessionID {
+			monoDelta := event.MonoMs - prev.MonoMs
+			switch {
+			case monoDelta < 0:
+				flags = append(flags, r.flag(*event, 3, fmt.Sprintf(
+					"Monotonic clock went backwards by %d ms within one agent session", -monoDelta)))
+			case abs(wallDelta-monoDelta) > r.ToleranceMs:
+				flags = append(flags, r.flag(*event, 3, fmt.Sprintf(
+					"System clock moved by %s while %s actually passed",
+					time.Duration(wallDelta)*time.Millisecond, time.Duration(monoDelta)*time.Millisecond)))
+			}
+		} else if wallDelta < -r.ToleranceMs {
+			flags = append(flags, r.flag(*event, 2, fmt.Sprintf(
+				"System clock moved back by %s between two agent sessions", time.Duration(-wallDelta)*time.Millisecond)))
+		}
+		prev = event
+	}
+
+	return flags
+}
+
+func (r ClockConsistencyRule) flag(event models.EditEvent, severity int, explanation string) domain.Flag {
+	return domain.Flag{
+		Diff: domain.Diff{
+			FilePath:  event.FilePath,
+			PatchText: event.Patch,
+			Timestamp: event.EventTime(),
+			Seq:       event.Seq,
+		},
+		FlagExplanation: explanation,
+		Severity:        severity,
+	}
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+func TestClockConsistencyRule(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC).UnixMilli()
+	event := func(seq int64, wallMs int64, monoMs int64) models.EditEvent {
+		return models.EditEvent{
+			FilePath:  "main.go",
+			EventType: models.APIEventModified,
+			Seq:       seq,
+			WallMs:    start + wallMs,
+			MonoMs:    monoMs,
+			SessionID: "session",
+		}
+	}
+	rule := ClockConsistencyRule{ToleranceMs: 5000}
+
+	tests := []struct {
+		name     string
+		events   []models.EditEvent
+		severity []int
+	}{
+		{
+			name:   "clocks advancing together",
+			events: []models.EditEvent{event(1, 0, 0), event(2, 60_000, 60_000), event(3, 62_000, 61_000)},
+		},
+		{
+			// The agent's monotonic clock keeps counting the hour of sleep
+			name:   "laptop suspended",
+			events: []models.EditEvent{event(1, 0, 0), event(2, 60_000, 60_000), event(3, 3_660_000, 3_660_000)},
+		},
+		{
+			// Makes a pasted block look typed over an hour
+			name:     "system clock set forward",
+			events:   []models.EditEvent{event(1, 0, 0), event(2, 60_000, 60_000), event(3, 3_660_000, 61_000)},
+			severity: []int{3},
+		},
+		{
+			name:     "system clock set back",
+			events:   []models.EditEvent{event(1, 0, 0), event(2, 60_000, 60_000), event(3, -3_600_000, 61_000)},
+			severity: []int{3},
+		},
+		{
+			name:     "monotonic clock going backwards",
+			events:   []models.EditEvent{event(1, 0, 60_000), event(2, 1000, 1000)},
+			severity: []int{3},
+		},
+		{
+			name: "second device",
+			events: []models.EditEvent{event(1, 0, 0), event(2, 1000, 1000),
+				{Seq: 1, WallMs: start + 60_000, SessionID: "laptop"}, {Seq: 2, WallMs: start + 61_000, MonoMs: 1000, SessionID: "laptop"}},
+		},
+		{
+			name:     "sequence gap",
+			events:   []models.EditEvent{event(1, 0, 0), event(3, 1000, 1000)},
+			severity: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := rule.Apply(tt.events)
+			if len(flags) != len(tt.severity) {
+				t.Fatalf("expected %d flags, got %+v", len(tt.severity), flags)
+			}
+			for i, severity := range tt.severity {
+				if flags[i].Severity != severity {
+					t.Errorf("flag %d: expected severity %d, got %d: %s", i, severity, flags[i].Severity, flags[i].FlagExplanation)
+				}
+			}
+		})
+	}
+}
+
+func TestElapsedSinceIgnoresClockChanges(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	prev := domain.Diff{Timestamp: start, MonoMs: 0, SessionID: "session"}
+
+	setForward := domain.Diff{Timestamp: start.Add(time.Hour), MonoMs: 60_000, SessionID: "session"}
+	if got := setForward.ElapsedSince(prev); got != time.Minute {
+		t.Errorf("expected the monotonic minute when the clock was set forward, got %v", got)
+	}
+	setBack := domain.Diff{Timestamp: start.Add(-time.Hour), MonoMs: 60_000, SessionID: "session"}
+	if got := setBack.ElapsedSince(prev); got != time.Minute {
+		t.Errorf("expected the monotonic minute when the clock was set back, got %v", got)
+	}
+}
@@ -0,0 +1,103 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/plagai/plagai-backend/flagging/similarity"
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/service"
+)
+
+// CorpusFileRule flags final files, rebuilt from the history, that match a reference document of
+// the assignment's corpus, such as an answer the instructor had an AI assistant write
+type CorpusFileRule struct {
+	Corpus similarity.Corpus
+	// Percentage of matching fingerprints from which a file is flagged
+	MinScore float64
+	// Matching fingerprints below which a file is too small to judge
+	MinShared int
+}
+
+func (r CorpusFileRule) Apply(events []models.EditEvent) []domain.Flag {
+	flags := []domain.Flag{}
+	if r.Corpus.Empty() {
+		return flags
+	}
+	// Files whose history can't be replayed are flagged by FinalSnapshotRule
+	files, _ := service.RebuildFiles(events)
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		fingerprints := similarity.Fingerprints(path, similarity.Tokenize(path, files[path]))
+		match, found := r.Corpus.BestMatch(fingerprints)
+		if !found || match.Score < r.MinScore || match.Shared < r.MinShared {
+			continue
+		}
+		flag := corpusFlag(match, fmt.Sprintf("%s matches %.0f%% of the %s reference %s",
+			path, match.Score, match.Document.Tag, match.Document.Name))
+		flag.Diff.FilePath = path
+		flags = append(flags, flag)
+	}
+	return flags
+}
+
+// CorpusInsertionRule flags blocks inserted in a single edit that match a reference document of
+// the assignment's corpus, even when the final file was changed afterwards to hide it
+type CorpusInsertionRule struct {
+	Corpus similarity.Corpus
+	// Percentage of the block's fingerprints found in a document from which it is flagged
+	MinScore float64
+	// Tokens below which a block is too small to judge
+	MinTokens int
+}
+
+func (r CorpusInsertionRule) Apply(diff domain.Diff, _ time.Time) *domain.Flag {
+	if r.Corpus.Empty() {
+		return nil
+	}
+	var best *similarity.CorpusMatch
+	var bestBlock InsertedBlock
+	for _, block := range InsertedBlocks(diff.PatchText) {
+		if block.Tokens < r.MinTokens {
+			continue
+		}
+		fingerprints := similarity.Fingerprints(diff.FilePath, similarity.Tokenize(diff.FilePath, block.Text))
+		match, found := r.Corpus.BestMatch(fingerprints)
+		if !found || match.Score < r.MinScore {
+			continue
+		}
+		if best == nil || match.Shared > best.Shared {
+			best, bestBlock = &match, block
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	flag := corpusFlag(*best, fmt.Sprintf("Inserted %d lines at once at character %d of %s, %.0f%% of them match the %s reference %s",
+		bestBlock.Lines, bestBlock.Offset, diff.FilePath, best.Score, best.Document.Tag, best.Document.Name))
+	flag.Diff = diff
+	return &flag
+}
+
+// corpusFlag links the flag to the largest region of the document the match covers. The patch
+// text lists every matched region, lines of the block or file = lines of the document.
+func corpusFlag(match similarity.CorpusMatch, explanation string) domain.Flag {
+	flag := domain.Flag{
+		Diff:            domain.Diff{PatchText: describeRegions(match.Regions)},
+		FlagExplanation: explanation,
+		Severity:        3,
+		Reference:       &domain.CorpusReference{DocumentID: match.Document.ID},
+	}
+	if region := similarity.LargestRegion(match.Regions); region != nil {
+		flag.Reference.StartLine, flag.Reference.EndLine = region.OtherStartLine, region.OtherEndLine
+		flag.FlagExplanation += fmt.Sprintf(" (lines %d-%d)", region.OtherStartLine, region.OtherEndLine)
+	}
+	return flag
+}
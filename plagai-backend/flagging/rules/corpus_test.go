@@ -0,0 +1,61 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plagai/plagai-backend/flagging/similarity"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+const referenceAnswer = `import sys
+
+def read_numbers(path):
+    with open(path) as f:
+        return [int(line) for line in f if line.strip()]
+
+def median(numbers):
+    ordered = sorted(numbers)
+    middle = len(ordered) // 2
+    if len(ordered) % 2 == 0:
+        return (ordered[middle - 1] + ordered[middle]) / 2
+    return ordered[middle]
+
+if __name__ == "__main__":
+    print(median(read_numbers(sys.argv[1])))
+`
+
+func TestCorpusInsertionRule(t *testing.T) {
+	corpus := similarity.NewCorpus([]domain.CorpusDocument{
+		{ID: 7, Name: "assistant.py", Tag: domain.CorpusAIGenerated, Content: referenceAnswer},
+	}, nil)
+	rule := CorpusInsertionRule{Corpus: corpus, MinScore: 60, MinTokens: 50}
+
+	// The median function pasted with other names, lines 7-12 of the reference
+	pasted := "def mid(values):\n" +
+		"    s = sorted(values)\n" +
+		"    m = len(s) // 2\n" +
+		"    if len(s) % 2 == 0:\n" +
+		"        return (s[m - 1] + s[m]) / 2\n" +
+		"    return s[m]\n"
+	patch := "@@ -0,0 +1,200 @@\n+" + strings.ReplaceAll(strings.TrimSuffix(pasted, "\n"), "\n", "\n+") + "\n"
+	flag := rule.Apply(domain.Diff{FilePath: "solution.py", PatchText: patch}, time.Time{})
+	if flag == nil {
+		t.Fatal("expected the pasted reference code to be flagged")
+	}
+	if flag.Reference == nil || flag.Reference.DocumentID != 7 {
+		t.Fatalf("expected a reference to document 7, got %+v", flag.Reference)
+	}
+	if flag.Reference.StartLine < 7 || flag.Reference.EndLine > 12 {
+		t.Errorf("expected the reference within lines 7-12, got %d-%d", flag.Reference.StartLine, flag.Reference.EndLine)
+	}
+	if !strings.Contains(flag.FlagExplanation, "ai-generated reference assistant.py") {
+		t.Errorf("explanation doesn't name the document: %q", flag.FlagExplanation)
+	}
+
+	own := "@@ -0,0 +1,200 @@\n" + strings.Repeat("+total = total + values[i] * weights[i] - offset\n", 6)
+	if flag := rule.Apply(domain.Diff{FilePath: "solution.py", PatchText: own}, time.Time{}); flag != nil {
+		t.Errorf("expected unrelated code not to be flagged, got %q", flag.FlagExplanation)
+	}
+}
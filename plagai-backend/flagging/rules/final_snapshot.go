@@ -0,0 +1,148 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+	"github.com/plagai/plagai-backend/service"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// FinalSnapshotRule compares the files handed in with the files rebuilt from the typed history.
+// A student could watch a decoy directory and hand in other files, so every file whose content
+// the history doesn't explain is flagged with the lines it can't explain. Files that were only
+// not handed in, such as deleted scratch files, and histories of coarse patches that can't be
+// replayed are flagged with a low severity.
+type FinalSnapshotRule struct{}
+
+func (r FinalSnapshotRule) Apply(events []models.EditEvent) []domain.Flag {
+	flags := []domain.Flag{}
+	var snapshotEvent *models.EditEvent
+	for i := range events {
+		if events[i].EventType == models.APIEventFinalSnapshot {
+			snapshotEvent = &events[i]
+		}
+	}
+	if snapshotEvent == nil {
+		// Older agents don't send a snapshot
+		return flags
+	}
+	var snapshot []models.SnapshotFile
+	if err := json.Unmarshal([]byte(snapshotEvent.Patch), &snapshot); err != nil {
+		return append(flags, snapshotFlag(*snapshotEvent, "", "", 3, "The snapshot of the handed in files can't be read"))
+	}
+	degraded := make(map[string]bool)
+	for _, event := range events {
+		if event.IsDegraded() {
+			degraded[event.FilePath] = true
+		}
+	}
+
+	rebuilt, failed := service.RebuildFiles(events)
+	inSnapshot := make(map[string]bool, len(snapshot))
+	for _, file := range snapshot {
+		inSnapshot[file.Path] = true
+		if err, broken := failed[file.Path]; broken {
+			// Coarse patches replace whole blocks and may not apply when the block moved
+			severity := 3
+			if degraded[file.Path] {
+				severity = 1
+			}
+			flags = append(flags, snapshotFlag(*snapshotEvent, file.Path, unexplainedLines("", file.Content), severity,
+				fmt.Sprintf("The history of %s can't be replayed (%v), so the handed in file isn't explained by it", file.Path, err)))
+			continue
+		}
+		content, typed := rebuilt[file.Path]
+		if !typed {
+			flags = append(flags, snapshotFlag(*snapshotEvent, file.Path, unexplainedLines("", file.Content), 3,
+				fmt.Sprintf("%s was handed in but never appears in the edit history", file.Path)))
+			continue
+		}
+		if contentHash(content) == file.SHA256 {
+			continue
+		}
+		if file.Omitted != "" {
+			hashes := fmt.Sprintf("sha256 handed in: %s\nsha256 of the history: %s\n", file.SHA256, contentHash(content))
+			flags = append(flags, snapshotFlag(*snapshotEvent, file.Path, hashes, 3,
+				fmt.Sprintf("The handed in %s differs from its edit history, its content wasn't sent (%s)", file.Path, file.Omitted)))
+			continue
+		}
+		unexplained := unexplainedLines(content, file.Content)
+		flags = append(flags, snapshotFlag(*snapshotEvent, file.Path, unexplained, 3,
+			fmt.Sprintf("The handed in %s differs from its edit history, %d of its lines were never typed and %d typed lines are missing from it",
+				file.Path, countLines(unexplained, '+'), countLines(unexplained, '-'))))
+	}
+
+	var missing []string
+	for path := range rebuilt {
+		if !inSnapshot[path] {
+			missing = append(missing, path)
+		}
+	}
+	sort.Strings(missing)
+	for _, path := range missing {
+		flags = append(flags, snapshotFlag(*snapshotEvent, path, unexplainedLines(rebuilt[path], ""), 1,
+			fmt.Sprintf("%s is in the edit history but wasn't handed in", path)))
+	}
+	return flags
+}
+
+func snapshotFlag(event models.EditEvent, path string, patch string, severity int, explanation string) domain.Flag {
+	return domain.Flag{
+		Diff: domain.Diff{
+			FilePath:  path,
+			PatchText: patch,
+			Timestamp: event.EventTime(),
+		},
+		FlagExplanation: explanation,
+		Severity:        severity,
+	}
+}
+
+// unexplainedLines returns a line diff from the rebuilt file to the handed in one. Lines starting
+// with + were handed in but never typed, lines starting with - were typed but not handed in.
+func unexplainedLines(rebuilt string, handedIn string) string {
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToChars(rebuilt, handedIn)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(a, b, false), lines)
+
+	sb := strings.Builder{}
+	for _, diff := range diffs {
+		var kind byte
+		switch diff.Type {
+		case diffmatchpatch.DiffInsert:
+			kind = '+'
+		case diffmatchpatch.DiffDelete:
+			kind = '-'
+		default:
+			continue
+		}
+		for line := range strings.SplitSeq(strings.TrimSuffix(diff.Text, "\n"), "\n") {
+			sb.WriteByte(kind)
+			sb.WriteString(line)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+func countLines(patch string, kind byte) int {
+	n := 0
+	for line := range strings.SplitSeq(patch, "\n") {
+		if len(line) > 0 && line[0] == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
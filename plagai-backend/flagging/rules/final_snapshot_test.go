@@ -0,0 +1,75 @@
+package rules
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/plagai/plagai-backend/models"
+)
+
+func TestFinalSnapshotRule(t *testing.T) {
+	typed := "package main\n\nfunc main() {}\n"
+	added := func(path string, seq int64) models.EditEvent {
+		return models.EditEvent{FilePath: path, EventType: models.APIEventAdded, Patch: "@@ -0,0 +1,29 @@\n+package main\n+\n+func main() {}\n+\n\n", Seq: seq}
+	}
+	// Recorded against content the history doesn't have
+	broken := func(path string, seq int64, meta *models.EventMeta) models.EditEvent {
+		return models.EditEvent{FilePath: path, EventType: models.APIEventModified, Patch: "@@ -1,12 +1,12 @@\n-func helper\n+func replaced\n", Seq: seq, Meta: meta}
+	}
+	snapshot := []models.SnapshotFile{
+		{Path: "main.go", SHA256: contentHash(typed), Content: typed},
+		{Path: "pasted.go", SHA256: contentHash(typed + "// pasted\n"), Content: typed + "// pasted\n"},
+		{Path: "data.bin", SHA256: contentHash("binary"), Omitted: "binary file"},
+		{Path: "large.go", SHA256: contentHash(typed), Content: typed},
+		{Path: "edited.go", SHA256: contentHash(typed), Content: typed},
+	}
+	snapshotData, _ := json.Marshal(snapshot)
+	events := []models.EditEvent{
+		added("main.go", 1),
+		added("pasted.go", 2),
+		added("data.bin", 3),
+		added("scratch.go", 4),
+		added("large.go", 5),
+		broken("large.go", 6, &models.EventMeta{Degraded: true}),
+		added("edited.go", 7),
+		broken("edited.go", 8, nil),
+		{EventType: models.APIEventFinalSnapshot, Patch: string(snapshotData), Seq: 9},
+	}
+
+	want := map[string]int{
+		"pasted.go":  3,
+		"data.bin":   3,
+		"scratch.go": 1,
+		"large.go":   1,
+		"edited.go":  3,
+	}
+	flags := FinalSnapshotRule{}.Apply(events)
+	if len(flags) != len(want) {
+		t.Fatalf("expected %d flags, got %+v", len(want), flags)
+	}
+	for _, flag := range flags {
+		severity, ok := want[flag.Diff.FilePath]
+		if !ok {
+			t.Errorf("unexpected flag on %s: %s", flag.Diff.FilePath, flag.FlagExplanation)
+			continue
+		}
+		if flag.Severity != severity {
+			t.Errorf("expected severity %d for %s, got %d: %s", severity, flag.Diff.FilePath, flag.Severity, flag.FlagExplanation)
+		}
+		switch flag.Diff.FilePath {
+		case "pasted.go":
+			if flag.Diff.PatchText != "+// pasted\n" {
+				t.Errorf("expected only the pasted line unexplained, got %q", flag.Diff.PatchText)
+			}
+		case "data.bin":
+			if !strings.Contains(flag.Diff.PatchText, contentHash("binary")) {
+				t.Errorf("expected the hashes of the omitted file, got %q", flag.Diff.PatchText)
+			}
+		case "scratch.go":
+			if !strings.HasPrefix(flag.Diff.PatchText, "-package main") {
+				t.Errorf("expected the typed lines that weren't handed in, got %q", flag.Diff.PatchText)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// LargeInsertionRule flags edits that insert a large block of text at once, as pasting does.
+// Unlike SpeedThresholdRule it doesn't depend on the time since the previous edit, so it also
+// catches the first edit of a file and pastes after a long break. A limit of 0 isn't checked.
+type LargeInsertionRule struct {
+	MaxLines  int // lines of the inserted block
+	MaxChars  int // characters of the block other than whitespace
+	MaxTokens int // identifiers, numbers and symbols of the block
+}
+
+// InsertedBlock is a contiguous block of text inserted by one hunk of a patch
+type InsertedBlock struct {
+	Text string
+	// Character offset in the new file the block starts at, counted from 0
+	Offset int
+	Lines  int
+	Chars  int
+	Tokens int
+}
+
+func (r LargeInsertionRule) Apply(diff domain.Diff, _ time.Time) *domain.Flag {
+	var largest *InsertedBlock
+	tooLarge := 0
+	for _, block := range InsertedBlocks(diff.PatchText) {
+		if !r.tooLarge(block) {
+			continue
+		}
+		tooLarge++
+		if largest == nil || block.Chars > largest.Chars {
+			largest = &block
+		}
+	}
+	if largest == nil {
+		return nil
+	}
+
+	explanation := fmt.Sprintf("Inserted %d lines (%d characters, %d tokens) at once at character %d of %s",
+		largest.Lines, largest.Chars, largest.Tokens, largest.Offset, diff.FilePath)
+	if tooLarge > 1 {
+		explanation += fmt.Sprintf(", along with %d more large blocks in the same edit", tooLarge-1)
+	}
+	return &domain.Flag{
+		Diff:            diff,
+		FlagExplanation: explanation,
+		Severity:        2,
+	}
+}
+
+func (r LargeInsertionRule) tooLarge(block InsertedBlock) bool {
+	return (r.MaxLines > 0 && block.Lines > r.MaxLines) ||
+		(r.MaxChars > 0 && block.Chars > r.MaxChars) ||
+		(r.MaxTokens > 0 && block.Tokens > r.MaxTokens)
+}
+
+// InsertedBlocks returns the blocks a patch recorded by the agent inserts. The agent splits the
+// text of every insertion and context segment of a hunk on line breaks and prefixes each line
+// with the segment's kind, so consecutive lines of the same kind are one segment. Blocks of
+// whitespace only are left out.
+func InsertedBlocks(patch string) []InsertedBlock {
+	var blocks []InsertedBlock
+	lines := strings.Split(patch, "\n")
+	offset := 0
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+		kind := line[0]
+		if kind == '@' {
+			offset = hunkStart(line)
+			continue
+		}
+		if kind != '+' && kind != '-' && kind != ' ' {
+			continue
+		}
+
+		segment := []string{line[1:]}
+		for i+1 < len(lines) && lines[i+1] != "" && lines[i+1][0] == kind {
+			i++
+			segment = append(segment, lines[i][1:])
+		}
+		text := strings.Join(segment, "\n")
+		switch kind {
+		case ' ':
+			offset += len([]rune(text))
+		case '+':
+			if strings.TrimSpace(text) != "" {
+				blocks = append(blocks, measureBlock(text, offset))
+			}
+			offset += len([]rune(text))
+		}
+	}
+	return blocks
+}
+
+// hunkStart reads where a hunk starts in the new text from a header like @@ -12,5 +14,9 @@
+func hunkStart(header string) int {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0
+	}
+	start, length, _ := strings.Cut(fields[2][1:], ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0
+	}
+	// Starts are counted from 1, except for empty ranges which name the character before
+	if length != "0" {
+		n--
+	}
+	return max(n, 0)
+}
+
+func measureBlock(text string, offset int) InsertedBlock {
+	block := InsertedBlock{Text: text, Offset: offset}
+	block.Lines = strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1
+	inWord := false
+	for _, c := range text {
+		switch {
+		case unicode.IsSpace(c):
+			inWord = false
+			continue
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_':
+			if !inWord {
+				block.Tokens++
+			}
+			inWord = true
+		default:
+			block.Tokens++
+			inWord = false
+		}
+		block.Chars++
+	}
+	return block
+}
@@ -0,0 +1,81 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+func TestInsertedBlocks(t *testing.T) {
+	// A function pasted after the first line of a file, as the agent records it
+	patch := "@@ -1,9 +1,40 @@\n" +
+		" package \n" +
+		"+\n" +
+		"+func add(a, b int) int {\n" +
+		"+\treturn a + b\n" +
+		"+}\n" +
+		" main\n"
+
+	blocks := InsertedBlocks(patch)
+	if len(blocks) != 1 {
+		t.Fatalf("expected 1 block, got %d", len(blocks))
+	}
+	block := blocks[0]
+	if block.Offset != len(" package ")-1 {
+		t.Errorf("expected the block at character %d, got %d", len(" package ")-1, block.Offset)
+	}
+	if block.Lines != 4 {
+		t.Errorf("expected 4 lines, got %d", block.Lines)
+	}
+	if want := len("funcadd(a,bint)int{returna+b}"); block.Chars != want {
+		t.Errorf("expected %d characters, got %d", want, block.Chars)
+	}
+	// func add ( a , b int ) int { return a + b }
+	if block.Tokens != 15 {
+		t.Errorf("expected 15 tokens, got %d", block.Tokens)
+	}
+}
+
+func TestInsertedBlocksSkipsWhitespace(t *testing.T) {
+	patch := "@@ -1,4 +1,10 @@\n" +
+		" a\n" +
+		"+\n" +
+		"+      \n" +
+		"+\n" +
+		"-b\n" +
+		"+c\n"
+	blocks := InsertedBlocks(patch)
+	if len(blocks) != 1 || blocks[0].Text != "c" {
+		t.Fatalf("expected only the block c, got %+v", blocks)
+	}
+	// a, the whitespace block, and the deleted b doesn't count
+	if want := len("a\n      \n"); blocks[0].Offset != want {
+		t.Errorf("expected the block at character %d, got %d", want, blocks[0].Offset)
+	}
+}
+
+func TestLargeInsertionRule(t *testing.T) {
+	rule := LargeInsertionRule{MaxLines: 40, MaxChars: 1500, MaxTokens: 300}
+
+	small := domain.Diff{FilePath: "main.go", PatchText: "@@ -0,0 +1,6 @@\n+x := 1\n"}
+	if flag := rule.Apply(small, time.Time{}); flag != nil {
+		t.Errorf("expected no flag for a small insertion, got %q", flag.FlagExplanation)
+	}
+
+	pasted := strings.Repeat("+fmt.Println(\"hello\")\n", 50)
+	large := domain.Diff{FilePath: "main.go", PatchText: "@@ -0,0 +1,1100 @@\n" + pasted}
+	flag := rule.Apply(large, time.Time{})
+	if flag == nil {
+		t.Fatal("expected a flag for a 50 line paste, even as the first edit of the file")
+	}
+	if !strings.Contains(flag.FlagExplanation, "50 lines") || !strings.Contains(flag.FlagExplanation, "character 0 of main.go") {
+		t.Errorf("explanation doesn't give the size and location: %q", flag.FlagExplanation)
+	}
+
+	onlyLines := LargeInsertionRule{MaxLines: 60}
+	if flag := onlyLines.Apply(large, time.Time{}); flag != nil {
+		t.Errorf("expected no flag when only lines are limited above the paste, got %q", flag.FlagExplanation)
+	}
+}
@@ -0,0 +1,51 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// SimilarityRule flags student assignments whose final files are similar to those of another
+// student of the assignment. Pairs are computed across submissions beforehand, see
+// analysis.UpdateSimilarity; the rule is built with the pairs of the submission it flags.
+type SimilarityRule struct {
+	Pairs []domain.SimilarityPair
+	// Percentage of matching fingerprints from which a pair is flagged
+	MinScore float64
+	// Matching fingerprints below which a pair is too small to judge
+	MinShared int
+}
+
+func (r SimilarityRule) Apply([]domain.Diff) []domain.Flag {
+	flags := []domain.Flag{}
+	for _, pair := range r.Pairs {
+		if pair.Score < r.MinScore || pair.SharedFingerprints < r.MinShared {
+			continue
+		}
+		filePath := ""
+		if len(pair.Regions) > 0 {
+			filePath = pair.Regions[0].FilePath
+		}
+		flags = append(flags, domain.Flag{
+			Diff: domain.Diff{
+				FilePath:  filePath,
+				PatchText: describeRegions(pair.Regions),
+			},
+			FlagExplanation: fmt.Sprintf("The final files are %.0f%% similar to those of %s (%d matching fingerprints in %d regions)",
+				pair.Score, pair.OtherStudent, pair.SharedFingerprints, len(pair.Regions)),
+			Severity: 3,
+		})
+	}
+	return flags
+}
+
+// describeRegions lists the matched regions a line each, as path:start-end = other path:start-end
+func describeRegions(regions []domain.MatchedRegion) string {
+	sb := strings.Builder{}
+	for _, r := range regions {
+		fmt.Fprintf(&sb, "%s:%d-%d = %s:%d-%d\n", r.FilePath, r.StartLine, r.EndLine, r.OtherFilePath, r.OtherStartLine, r.OtherEndLine)
+	}
+	return sb.String()
+}
@@ -0,0 +1,63 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// TrackingPauseRule explains every time the student paused tracking with the reason they gave.
+// Files changed while paused are recorded as net changes after the resume, so how they were
+// written is unknown. A pause that never ended leaves the changes since out of the history.
+type TrackingPauseRule struct{}
+
+func (r TrackingPauseRule) Apply(events []models.EditEvent) []domain.Flag {
+	flags := []domain.Flag{}
+	var open *models.EditEvent
+	for i, event := range events {
+		switch event.EventType {
+		case models.APIEventTrackingPaused:
+			open = &events[i]
+		case models.APIEventTrackingResumed:
+			open = nil
+			var pause models.TrackingPause
+			if err := json.Unmarshal([]byte(event.Patch), &pause); err != nil {
+				continue
+			}
+			// Nothing changed, the gap shows in the coverage and needs no flag
+			if pause.ChangedFiles == 0 {
+				continue
+			}
+			explanation := fmt.Sprintf("Tracking was paused for %s (%q). %d files changed meanwhile and were recorded as net changes after resuming",
+				pause.ResumedAt.Sub(pause.PausedAt).Round(time.Second), pause.Reason, pause.ChangedFiles)
+			if pause.RollingChecksum != pause.ChecksumAtResume {
+				explanation += ". The agent missed some of the changes made while paused"
+			}
+			flags = append(flags, pauseFlag(event, explanation, 1))
+		}
+	}
+	if open != nil {
+		var pause models.TrackingPause
+		_ = json.Unmarshal([]byte(open.Patch), &pause)
+		explanation := fmt.Sprintf("Tracking was still paused (%q) when the history was submitted, changes made since %s are not in it",
+			pause.Reason, open.EventTime().Format(time.RFC3339))
+		flags = append(flags, pauseFlag(*open, explanation, 2))
+	}
+	return flags
+}
+
+func pauseFlag(event models.EditEvent, explanation string, severity int) domain.Flag {
+	return domain.Flag{
+		Diff: domain.Diff{
+			FilePath:  event.FilePath,
+			PatchText: event.Patch,
+			Timestamp: event.EventTime(),
+			Seq:       event.Seq,
+		},
+		FlagExplanation: explanation,
+		Severity:        severity,
+	}
+}
@@ -6,11 +6,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/plagai/plagai-backend/flagging/features"
 	"github.com/plagai/plagai-backend/models/domain"
 )
 
 type SpeedThresholdRule struct {
 	MaxCharsPerSecond float64 // e.g., 5–10 chars/sec is reasonable, >50 chars/sec is suspicious
+	// Replaces MaxCharsPerSecond with a threshold on the typing speeds of the class when it is
+	// large enough
+	Relative features.RelativeThreshold
+	Class    domain.FeatureStats
 }
 
 func (r SpeedThresholdRule) Apply(diff domain.Diff, prevTimestamp time.Time) *domain.Flag {
@@ -34,6 +39,20 @@ func (r SpeedThresholdRule) Apply(diff domain.Diff, prevTimestamp time.Time) *do
 	}
 	speed := float64(lengthOfAdditions) / duration
 
+	if baseline, ok := r.Relative.Baseline(r.Class, features.Above); ok {
+		if !features.Exceeds(baseline, speed, features.Above) {
+			return nil
+		}
+		baseline.Value = speed
+		return &domain.Flag{
+			Diff: diff,
+			FlagExplanation: "Text entered too fast for this class (probably copy-pasted), speed: " +
+				fmt.Sprintf("%.1f chars/sec, above %s", speed, features.Describe(baseline)),
+			Severity: 2,
+			Baseline: &baseline,
+		}
+	}
+
 	if speed > r.MaxCharsPerSecond {
 		return &domain.Flag{
 			Diff: diff,
@@ -0,0 +1,52 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// VCSOperationRule points out git pulls and merges that changed files of the assignment.
+// Their changes are left out of the typing rules since git wrote them, but they were written
+// somewhere else first, which the instructor may want to look into.
+type VCSOperationRule struct{}
+
+func (r VCSOperationRule) Apply(events []models.EditEvent) []domain.Flag {
+	flags := []domain.Flag{}
+	for _, event := range events {
+		if event.EventType != models.APIEventVCSOperation {
+			continue
+		}
+		var op models.VCSOperation
+		if err := json.Unmarshal([]byte(event.Patch), &op); err != nil {
+			continue
+		}
+		if (op.Kind != "pull" && op.Kind != "merge") || op.Files == 0 {
+			continue
+		}
+		flags = append(flags, domain.Flag{
+			Diff: domain.Diff{
+				FilePath:  event.FilePath,
+				PatchText: event.Patch,
+				Timestamp: event.EventTime(),
+				Seq:       event.Seq,
+			},
+			FlagExplanation: fmt.Sprintf("git %s changed %d files (%s to %s), the changes were brought in from another copy of the repository",
+				op.Kind, op.Files, shortCommit(op.FromCommit), shortCommit(op.ToCommit)),
+			Severity: 1,
+		})
+	}
+	return flags
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	if commit == "" {
+		return "unknown"
+	}
+	return commit
+}
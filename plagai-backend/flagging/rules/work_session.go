@@ -0,0 +1,66 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/plagai/plagai-backend/flagging/sessions"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// WorkSessionRule looks at when the assignment was written. Writing a whole project in one short
+// session, or only in the hours before the deadline, is typical for generated code. Work spread
+// over many sessions isn't. A limit of 0 isn't checked.
+type WorkSessionRule struct {
+	IdleGap time.Duration // time without edits that ends a session
+	// Percentage of the written characters above which a single session is flagged
+	MaxSessionShare float64
+	// Hours before Deadline that all work was done in to be flagged
+	LastHours float64
+	Deadline  time.Time
+	// Assignments with fewer characters written are too small to judge
+	MinChars int
+}
+
+func (r WorkSessionRule) Apply(diffs []domain.Diff) []domain.Flag {
+	flags := []domain.Flag{}
+	found := sessions.Segment(diffs, r.IdleGap)
+	if len(found) == 0 {
+		return flags
+	}
+	total := 0
+	for _, session := range found {
+		total += session.CharsAdded
+	}
+	if total == 0 || total < r.MinChars {
+		return flags
+	}
+
+	if r.MaxSessionShare > 0 {
+		for i, session := range found {
+			share := float64(session.CharsAdded) / float64(total) * 100
+			if share <= r.MaxSessionShare {
+				continue
+			}
+			flags = append(flags, domain.Flag{
+				Diff: domain.Diff{Timestamp: session.Start},
+				FlagExplanation: fmt.Sprintf("%.0f%% of the code was written in a single %s session starting %s (session %d of %d)",
+					share, session.Duration().Round(time.Minute), session.Start.Format(time.RFC3339), i+1, len(found)),
+				Severity: 1,
+			})
+		}
+	}
+
+	if r.LastHours > 0 && !r.Deadline.IsZero() {
+		windowStart := r.Deadline.Add(-time.Duration(r.LastHours * float64(time.Hour)))
+		if found[0].Start.After(windowStart) && !found[0].Start.After(r.Deadline) {
+			flags = append(flags, domain.Flag{
+				Diff: domain.Diff{Timestamp: found[0].Start},
+				FlagExplanation: fmt.Sprintf("All work was done in the last %g hours before the deadline, starting %s before it",
+					r.LastHours, r.Deadline.Sub(found[0].Start).Round(time.Minute)),
+				Severity: 1,
+			})
+		}
+	}
+	return flags
+}
@@ -0,0 +1,90 @@
+// Package sessions splits the edits of a student assignment into work sessions, the stretches of
+// time the student worked without a long break.
+package sessions
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// Session is a stretch of edits without an idle gap between them
+type Session struct {
+	Start time.Time
+	End   time.Time
+	// Edits made during the session
+	Edits        int
+	CharsAdded   int
+	CharsDeleted int
+	// Files edited during the session, sorted
+	Files []string
+}
+
+func (s Session) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// NetGrowth is how much the code grew during the session, negative when it shrank
+func (s Session) NetGrowth() int {
+	return s.CharsAdded - s.CharsDeleted
+}
+
+// Segment splits diffs, in the order they were recorded, into sessions wherever no edit was made
+// for longer than idleGap. The time between edits prefers the monotonic clock, see
+// domain.Diff.ElapsedSince.
+func Segment(diffs []domain.Diff, idleGap time.Duration) []Session {
+	var sessions []Session
+	var current *Session
+	var prev domain.Diff
+	files := make(map[string]bool)
+	for i, diff := range diffs {
+		if i == 0 || diff.ElapsedSince(prev) > idleGap {
+			if current != nil {
+				current.Files = sortedFiles(files)
+				sessions = append(sessions, *current)
+			}
+			current = &Session{Start: diff.Timestamp}
+			files = make(map[string]bool)
+		}
+		added, deleted := CountChanges(diff.PatchText)
+		current.End = diff.Timestamp
+		current.Edits++
+		current.CharsAdded += added
+		current.CharsDeleted += deleted
+		files[diff.FilePath] = true
+		prev = diff
+	}
+	if current != nil {
+		current.Files = sortedFiles(files)
+		sessions = append(sessions, *current)
+	}
+	return sessions
+}
+
+// CountChanges returns how many characters a patch adds and deletes, the way SpeedThresholdRule
+// counts them
+func CountChanges(patch string) (added int, deleted int) {
+	for line := range strings.SplitSeq(patch, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		switch line[0] {
+		case '+':
+			added += len(line) - 1
+		case '-':
+			deleted += len(line) - 1
+		}
+	}
+	return added, deleted
+}
+
+func sortedFiles(files map[string]bool) []string {
+	sorted := make([]string, 0, len(files))
+	for file := range files {
+		sorted = append(sorted, file)
+	}
+	slices.Sort(sorted)
+	return sorted
+}
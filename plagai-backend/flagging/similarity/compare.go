@@ -0,0 +1,99 @@
+package similarity
+
+import (
+	"sort"
+
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// Match is what two submissions share
+type Match struct {
+	// Percentage of the distinct fingerprints of the smaller submission found in the other one,
+	// so code copied into a larger submission still scores high
+	Score float64
+	// Distinct fingerprints both submissions have
+	Shared int
+	// Regions of the first submission matching regions of the second, merged where they overlap
+	Regions []domain.MatchedRegion
+}
+
+// Compare matches the fingerprints of two submissions
+func Compare(a []domain.Fingerprint, b []domain.Fingerprint) Match {
+	byHashA, byHashB := groupByHash(a), groupByHash(b)
+	if len(byHashA) == 0 || len(byHashB) == 0 {
+		return Match{}
+	}
+
+	var matches []domain.MatchedRegion
+	shared := 0
+	for hash, inA := range byHashA {
+		inB, ok := byHashB[hash]
+		if !ok {
+			continue
+		}
+		shared++
+		// Repeated code is matched occurrence by occurrence, in the order it appears
+		for i := 0; i < len(inA) && i < len(inB); i++ {
+			matches = append(matches, domain.MatchedRegion{
+				FilePath: inA[i].FilePath, StartLine: inA[i].StartLine, EndLine: inA[i].EndLine,
+				OtherFilePath: inB[i].FilePath, OtherStartLine: inB[i].StartLine, OtherEndLine: inB[i].EndLine,
+			})
+		}
+	}
+	return Match{
+		Score:   100 * float64(shared) / float64(min(len(byHashA), len(byHashB))),
+		Shared:  shared,
+		Regions: mergeRegions(matches),
+	}
+}
+
+// groupByHash returns the fingerprints by hash, each group in file and line order
+func groupByHash(fingerprints []domain.Fingerprint) map[uint64][]domain.Fingerprint {
+	sorted := append([]domain.Fingerprint(nil), fingerprints...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].FilePath != sorted[j].FilePath {
+			return sorted[i].FilePath < sorted[j].FilePath
+		}
+		return sorted[i].StartLine < sorted[j].StartLine
+	})
+	groups := make(map[uint64][]domain.Fingerprint)
+	for _, f := range sorted {
+		groups[f.Hash] = append(groups[f.Hash], f)
+	}
+	return groups
+}
+
+// mergeRegions joins matches that overlap or touch on both sides into one region. The hashed
+// runs of consecutive fingerprints of copied code overlap, since Window is smaller than K.
+func mergeRegions(matches []domain.MatchedRegion) []domain.MatchedRegion {
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		if a.OtherFilePath != b.OtherFilePath {
+			return a.OtherFilePath < b.OtherFilePath
+		}
+		if a.StartLine != b.StartLine {
+			return a.StartLine < b.StartLine
+		}
+		return a.OtherStartLine < b.OtherStartLine
+	})
+
+	var regions []domain.MatchedRegion
+	for _, m := range matches {
+		if n := len(regions); n > 0 {
+			last := &regions[n-1]
+			if last.FilePath == m.FilePath && last.OtherFilePath == m.OtherFilePath &&
+				m.StartLine <= last.EndLine+1 &&
+				m.OtherStartLine <= last.OtherEndLine+1 && m.OtherEndLine >= last.OtherStartLine-1 {
+				last.EndLine = max(last.EndLine, m.EndLine)
+				last.OtherStartLine = min(last.OtherStartLine, m.OtherStartLine)
+				last.OtherEndLine = max(last.OtherEndLine, m.OtherEndLine)
+				continue
+			}
+		}
+		regions = append(regions, m)
+	}
+	return regions
+}
@@ -0,0 +1,85 @@
+package similarity
+
+import "github.com/plagai/plagai-backend/models/domain"
+
+// Corpus holds the fingerprints of the reference documents of an assignment
+type Corpus struct {
+	documents []indexedDocument
+}
+
+type indexedDocument struct {
+	document     domain.CorpusDocument
+	fingerprints []domain.Fingerprint
+}
+
+// CorpusMatch is the document of a corpus that fingerprints match the most
+type CorpusMatch struct {
+	Document domain.CorpusDocument
+	// Regions are matched to lines of the document, named by the document's name
+	Match
+}
+
+// NewCorpus fingerprints the documents, leaving out the fingerprints found in ignored such as
+// those of the starter files
+func NewCorpus(documents []domain.CorpusDocument, ignored map[uint64]bool) Corpus {
+	corpus := Corpus{}
+	for _, document := range documents {
+		var fingerprints []domain.Fingerprint
+		for _, f := range Fingerprints(document.Name, Tokenize(document.Name, document.Content)) {
+			if !ignored[f.Hash] {
+				fingerprints = append(fingerprints, f)
+			}
+		}
+		if len(fingerprints) > 0 {
+			corpus.documents = append(corpus.documents, indexedDocument{document: document, fingerprints: fingerprints})
+		}
+	}
+	return corpus
+}
+
+func (c Corpus) Empty() bool {
+	return len(c.documents) == 0
+}
+
+// BestMatch returns the document with the highest score for the fingerprints, ties going to the
+// one sharing more fingerprints. It returns false when no document shares any.
+func (c Corpus) BestMatch(fingerprints []domain.Fingerprint) (CorpusMatch, bool) {
+	var best CorpusMatch
+	found := false
+	for _, d := range c.documents {
+		match := Compare(fingerprints, d.fingerprints)
+		if match.Shared == 0 {
+			continue
+		}
+		if !found || match.Score > best.Score || (match.Score == best.Score && match.Shared > best.Shared) {
+			best = CorpusMatch{Document: d.document, Match: match}
+			found = true
+		}
+	}
+	return best, found
+}
+
+// StarterHashes returns the hashes of the fingerprints of the starter files, code everyone was
+// handed that says nothing about where a submission came from
+func StarterHashes(files []domain.StarterFile) map[uint64]bool {
+	hashes := make(map[uint64]bool)
+	for _, file := range files {
+		for _, f := range Fingerprints(file.Path, Tokenize(file.Path, file.Content)) {
+			hashes[f.Hash] = true
+		}
+	}
+	return hashes
+}
+
+// LargestRegion returns the region spanning the most lines of the other side, nil when there is
+// none
+func LargestRegion(regions []domain.MatchedRegion) *domain.MatchedRegion {
+	var largest *domain.MatchedRegion
+	for i := range regions {
+		r := &regions[i]
+		if largest == nil || r.OtherEndLine-r.OtherStartLine > largest.OtherEndLine-largest.OtherStartLine {
+			largest = r
+		}
+	}
+	return largest
+}
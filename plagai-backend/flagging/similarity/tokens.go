@@ -0,0 +1,116 @@
+// Package similarity compares the final files of students with winnowing fingerprints, so that
+// code shared between submissions is found even when identifiers were renamed or it was
+// reformatted.
+package similarity
+
+import (
+	"path"
+	"strings"
+	"unicode"
+)
+
+// Token is a normalised token of a file and the line it starts on, counted from 1
+type Token struct {
+	Text string
+	Line int
+}
+
+// Normalised forms of the tokens that are told apart by kind only
+const (
+	identifierToken = "id"
+	numberToken     = "0"
+	stringToken     = `""`
+)
+
+// keywords of common languages stay as they are, every other identifier becomes identifierToken
+var keywords = toSet(
+	"break", "case", "catch", "class", "const", "continue", "def", "default", "defer", "do",
+	"elif", "else", "enum", "except", "extends", "false", "finally", "fn", "for", "func", "go",
+	"goto", "if", "implements", "import", "in", "interface", "lambda", "let", "map", "match",
+	"new", "nil", "None", "null", "package", "pass", "private", "protected", "public", "range",
+	"raise", "return", "select", "static", "struct", "super", "switch", "this", "throw", "throws",
+	"true", "True", "False", "try", "type", "var", "void", "while", "with", "yield",
+)
+
+// Languages whose comments start with a hash, in the others a hash is code such as #include
+var hashComments = toSet(".py", ".sh", ".bash", ".rb", ".r", ".pl", ".yaml", ".yml", ".toml")
+
+// Tokenize splits a file into tokens with whitespace and comments dropped. Identifiers other
+// than keywords, numbers and string literals are replaced by a token of their kind, so renaming
+// a variable or changing a message doesn't hide copied code.
+func Tokenize(filePath string, content string) []Token {
+	hashComment := hashComments[strings.ToLower(path.Ext(filePath))]
+	src := []rune(content)
+	var tokens []Token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(c):
+			i++
+		case c == '/' && i+1 < len(src) && src[i+1] == '/', c == '#' && hashComment:
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i < len(src) && !(src[i] == '*' && i+1 < len(src) && src[i+1] == '/') {
+				if src[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			i += 2
+		case c == '"' || c == '\'' || c == '`':
+			start := line
+			i++
+			for i < len(src) && src[i] != c {
+				// Only raw strings span lines, an unterminated quote ends with its line
+				if src[i] == '\n' && c != '`' {
+					break
+				}
+				if src[i] == '\\' && c != '`' && i+1 < len(src) {
+					i++
+				}
+				if src[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i < len(src) && src[i] == c {
+				i++
+			}
+			tokens = append(tokens, Token{Text: stringToken, Line: start})
+		case unicode.IsDigit(c):
+			for i < len(src) && (unicode.IsLetter(src[i]) || unicode.IsDigit(src[i]) || src[i] == '.' || src[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, Token{Text: numberToken, Line: line})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(src[i]) || unicode.IsDigit(src[i]) || src[i] == '_') {
+				i++
+			}
+			word := string(src[start:i])
+			if !keywords[word] {
+				word = identifierToken
+			}
+			tokens = append(tokens, Token{Text: word, Line: line})
+		default:
+			tokens = append(tokens, Token{Text: string(c), Line: line})
+			i++
+		}
+	}
+	return tokens
+}
+
+func toSet(values ...string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,77 @@
+package similarity
+
+import (
+	"hash/fnv"
+
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+const (
+	// K is the number of tokens hashed together, shorter runs of shared tokens are noise
+	K = 12
+	// Window is the number of consecutive hashes winnowing selects one from. Any run of at least
+	// K+Window-1 shared tokens shares a fingerprint.
+	Window = 8
+)
+
+// Fingerprints selects the winnowing fingerprints of a file: of every Window consecutive hashes of
+// K tokens the smallest one, the rightmost on ties, each selected position recorded once. See
+// Schleimer et al., "Winnowing: Local Algorithms for Document Fingerprinting".
+func Fingerprints(filePath string, tokens []Token) []domain.Fingerprint {
+	if len(tokens) < K {
+		return nil
+	}
+	hashes := make([]uint64, len(tokens)-K+1)
+	for i := range hashes {
+		hashes[i] = hashTokens(tokens[i : i+K])
+	}
+
+	var fingerprints []domain.Fingerprint
+	selected := -1
+	// A file shorter than a window has a single window
+	windows := max(len(hashes)-Window+1, 1)
+	for start := 0; start < windows; start++ {
+		end := min(start+Window, len(hashes))
+		smallest := start
+		for i := start + 1; i < end; i++ {
+			if hashes[i] <= hashes[smallest] {
+				smallest = i
+			}
+		}
+		if smallest == selected {
+			continue
+		}
+		selected = smallest
+		fingerprints = append(fingerprints, domain.Fingerprint{
+			FilePath:  filePath,
+			Hash:      hashes[smallest],
+			StartLine: tokens[smallest].Line,
+			EndLine:   tokens[smallest+K-1].Line,
+		})
+	}
+	return fingerprints
+}
+
+// FileFingerprints tokenises and fingerprints every file, dropping the fingerprints found in
+// ignored, such as those of the starter files everyone was handed
+func FileFingerprints(files map[string]string, ignored map[uint64]bool) []domain.Fingerprint {
+	var fingerprints []domain.Fingerprint
+	for filePath, content := range files {
+		for _, f := range Fingerprints(filePath, Tokenize(filePath, content)) {
+			if !ignored[f.Hash] {
+				fingerprints = append(fingerprints, f)
+			}
+		}
+	}
+	return fingerprints
+}
+
+func hashTokens(tokens []Token) uint64 {
+	h := fnv.New64a()
+	for _, t := range tokens {
+		h.Write([]byte(t.Text))
+		// Keeps "a" "bc" apart from "ab" "c"
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
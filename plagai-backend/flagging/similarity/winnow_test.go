@@ -0,0 +1,151 @@
+package similarity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+const original = `package main
+
+import "fmt"
+
+// fib returns the n-th Fibonacci number
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	a, b := 0, 1
+	for i := 1; i < n; i++ {
+		a, b = b, a+b
+	}
+	return b
+}
+
+func main() {
+	for i := 0; i < 10; i++ {
+		fmt.Println("fib", i, fib(i))
+	}
+}
+`
+
+// The same code with renamed identifiers, other literals, other comments and other formatting
+const renamed = `package main
+import "fmt"
+
+/* computes fibonacci */
+func fibonacci(count int) int {
+	if count < 3 { return count }
+	x, y := 0, 1
+	for j := 1; j < count; j++ {
+		x, y = y, x+y
+	}
+	return y
+}
+
+func main() {
+	for k := 0; k < 20; k++ { fmt.Println("value:", k, fibonacci(k)) }
+}
+`
+
+const unrelated = `package main
+
+type stack struct {
+	items []string
+}
+
+func (s *stack) push(item string) {
+	s.items = append(s.items, item)
+}
+
+func (s *stack) pop() (string, bool) {
+	if len(s.items) == 0 {
+		return "", false
+	}
+	item := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return item, true
+}
+`
+
+func TestTokenizeNormalises(t *testing.T) {
+	tokens := Tokenize("main.go", "x := \"hi\" // greeting\nreturn  x+1")
+	var texts []string
+	for _, token := range tokens {
+		texts = append(texts, token.Text)
+	}
+	if got, want := strings.Join(texts, " "), `id : = "" return id + 0`; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if tokens[len(tokens)-1].Line != 2 {
+		t.Errorf("expected the last token on line 2, got %d", tokens[len(tokens)-1].Line)
+	}
+}
+
+func TestFingerprintsSelectOnePerWindow(t *testing.T) {
+	tokens := Tokenize("main.go", original)
+	fingerprints := Fingerprints("main.go", tokens)
+	if len(fingerprints) == 0 {
+		t.Fatal("expected fingerprints")
+	}
+	hashes := len(tokens) - K + 1
+	// Every window has a fingerprint, and winnowing keeps far fewer than all hashes
+	if len(fingerprints) < hashes/Window || len(fingerprints) >= hashes {
+		t.Errorf("expected between %d and %d fingerprints, got %d", hashes/Window, hashes, len(fingerprints))
+	}
+	for _, f := range fingerprints {
+		if f.StartLine < 1 || f.EndLine < f.StartLine {
+			t.Errorf("invalid lines %d-%d", f.StartLine, f.EndLine)
+		}
+	}
+	if Fingerprints("short.go", tokens[:K-1]) != nil {
+		t.Error("expected no fingerprints for fewer than K tokens")
+	}
+}
+
+func TestCompareFindsRenamedCopy(t *testing.T) {
+	a := Fingerprints("main.go", Tokenize("main.go", original))
+	b := Fingerprints("solution.go", Tokenize("solution.go", renamed))
+	match := Compare(a, b)
+	if match.Score < 50 {
+		t.Errorf("expected the renamed copy to score at least 50, got %.1f", match.Score)
+	}
+	if len(match.Regions) == 0 {
+		t.Fatal("expected matched regions")
+	}
+	for _, r := range match.Regions {
+		if r.FilePath != "main.go" || r.OtherFilePath != "solution.go" {
+			t.Errorf("unexpected files %s and %s", r.FilePath, r.OtherFilePath)
+		}
+	}
+
+	other := Fingerprints("stack.go", Tokenize("stack.go", unrelated))
+	if unrelatedMatch := Compare(a, other); unrelatedMatch.Score >= 20 {
+		t.Errorf("expected unrelated code to score below 20, got %.1f", unrelatedMatch.Score)
+	}
+}
+
+func TestFileFingerprintsDropsIgnored(t *testing.T) {
+	starter := map[uint64]bool{}
+	for _, f := range Fingerprints("main.go", Tokenize("main.go", original)) {
+		starter[f.Hash] = true
+	}
+	if fingerprints := FileFingerprints(map[string]string{"main.go": original}, starter); len(fingerprints) != 0 {
+		t.Errorf("expected the starter code to be ignored, got %d fingerprints", len(fingerprints))
+	}
+}
+
+func TestMergeRegions(t *testing.T) {
+	regions := mergeRegions([]domain.MatchedRegion{
+		{FilePath: "a", StartLine: 5, EndLine: 8, OtherFilePath: "b", OtherStartLine: 15, OtherEndLine: 18},
+		{FilePath: "a", StartLine: 1, EndLine: 5, OtherFilePath: "b", OtherStartLine: 11, OtherEndLine: 15},
+		{FilePath: "a", StartLine: 30, EndLine: 32, OtherFilePath: "b", OtherStartLine: 2, OtherEndLine: 4},
+	})
+	if len(regions) != 2 {
+		t.Fatalf("expected 2 regions, got %+v", regions)
+	}
+	if r := regions[0]; r.StartLine != 1 || r.EndLine != 8 || r.OtherStartLine != 11 || r.OtherEndLine != 18 {
+		t.Errorf("unexpected merged region %+v", r)
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AgentVersionHeader is sent by the agent with every request
+const AgentVersionHeader = "X-Plaggy-Agent-Version"
+
+// MinAgentVersion is the oldest agent whose submissions are accepted, empty accepts every agent.
+// Set it with MIN_AGENT_VERSION when a fix to the diff engine or the protocol has to reach everyone.
+var MinAgentVersion string
+
+func init() {
+	MinAgentVersion = os.Getenv("MIN_AGENT_VERSION")
+}
+
+// RequireAgentVersion refuses requests from agents older than MinAgentVersion with 426 Upgrade Required.
+// Agents from before the version header existed are refused as well.
+func RequireAgentVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if MinAgentVersion == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		version := r.Header.Get(AgentVersionHeader)
+		if version == "" || CompareVersions(version, MinAgentVersion) < 0 {
+			w.Header().Set("X-Plaggy-Min-Agent-Version", MinAgentVersion)
+			http.Error(w, `"agent version `+MinAgentVersion+` or newer is required"`, http.StatusUpgradeRequired)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CompareVersions compares two dotted versions like 1.4.2 and returns -1, 0 or 1.
+// A leading v is ignored and a pre-release after a dash sorts before its release,
+// the same way the agent compares them.
+func CompareVersions(a string, b string) int {
+	aCore, aPre := splitVersion(a)
+	bCore, bPre := splitVersion(b)
+	for i := 0; i < max(len(aCore), len(bCore)); i++ {
+		var x, y int
+		if i < len(aCore) {
+			x = aCore[i]
+		}
+		if i < len(bCore) {
+			y = bCore[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return strings.Compare(aPre, bPre)
+}
+
+func splitVersion(v string) ([]int, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	core, pre, _ := strings.Cut(v, "-")
+	var parts []int
+	for _, part := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			n = 0
+		}
+		parts = append(parts, n)
+	}
+	return parts, pre
+}
@@ -0,0 +1,26 @@
+package database
+
+import "time"
+
+// AnalysisJob is a queued run of the flagging engine over the history of a student assignment.
+// Workers claim pending jobs, a running job whose lock expired is claimed again. A student
+// assignment has at most one pending job, see idx_analysis_jobs_pending.
+type AnalysisJob struct {
+	ID                  uint `gorm:"primaryKey"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	StudentAssignmentID uint              `gorm:"not null;index;uniqueIndex:idx_analysis_jobs_pending,where:status = 'pending'"`
+	StudentAssignment   StudentAssignment `gorm:"foreignKey:StudentAssignmentID"`
+	// pending, running, succeeded or dead
+	Status      string    `gorm:"size:16;not null;index:idx_analysis_job_queue,priority:1"`
+	RunAfter    time.Time `gorm:"not null;index:idx_analysis_job_queue,priority:2"`
+	Attempts    int       `gorm:"not null;default:0"`
+	MaxAttempts int       `gorm:"not null"`
+	// Worker holding the job and until when, another worker may take it over afterwards
+	LockedBy    string `gorm:"size:64"`
+	LockedUntil *time.Time
+	LastError   string
+	FinishedAt  *time.Time
+	// Number of flags the successful run stored
+	Flags int
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CorpusDocument is a reference file an instructor uploaded for an assignment. Deleted documents
+// are kept so the flags matching them still link to them.
+type CorpusDocument struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt
+	AssignmentID uint       `gorm:"not null;index"`
+	Assignment   Assignment `gorm:"foreignKey:AssignmentID"`
+	Name         string     `gorm:"not null"`
+	// ai-generated, past-term or public-solution
+	Tag        string `gorm:"size:32;not null"`
+	Note       string
+	Content    string `gorm:"not null"`
+	SHA256     string `gorm:"size:64;not null"`
+	UploadedBy string `gorm:"size:255"`
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeviceKey is the public key of an agent installation a student bound an assignment with.
+// Evidence bundles are only imported when signed by one of the student's device keys.
+type DeviceKey struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt
+	StudentID uint    `gorm:"not null;uniqueIndex:idx_device_keys_student_key"`
+	Student   Student `gorm:"foreignKey:StudentID"`
+	DeviceID  string  `gorm:"size:32"`
+	PublicKey string  `gorm:"size:64;not null;uniqueIndex:idx_device_keys_student_key"`
+	Hostname  string
+	OS        string `gorm:"size:32"`
+}
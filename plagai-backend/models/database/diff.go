@@ -6,13 +6,26 @@ import (
 	"gorm.io/gorm"
 )
 
+// Diff is an edit event of a student assignment. Agents submit their whole history every time,
+// idx_diffs_event stores an event once per daemon session and sequence number. Diffs stored
+// along with flags and events of old agents have no sequence number and aren't deduplicated.
 type Diff struct {
 	ID                  uint `gorm:"primaryKey"`
 	CreatedAt           time.Time
 	UpdatedAt           time.Time
 	DeletedAt           gorm.DeletedAt
-	StudentAssignmentID uint              `gorm:"not null;index"`
+	StudentAssignmentID uint              `gorm:"not null;index;uniqueIndex:idx_diffs_event,priority:1,where:seq > 0"`
 	StudentAssignment   StudentAssignment `gorm:"foreignKey:StudentAssignmentID"`
 	FilePath            string            `gorm:"not null"`
 	DiffData            string            `gorm:"not null"`
+	Seq                 int64             `gorm:"index;uniqueIndex:idx_diffs_event,priority:3"`
+	MonoMs              int64
+	SessionID           string `gorm:"size:32;uniqueIndex:idx_diffs_event,priority:2"`
+	Degraded            bool   `gorm:"not null;default:false"`
+	Baseline            bool   `gorm:"not null;default:false"`
+	VCSOperation        string `gorm:"size:16;index"`
+	BulkOperation       string `gorm:"size:16;index"`
+	// added, modified, deleted, renamed or restored. Empty for diffs stored along with a flag
+	// that isn't about an edit, and for edits stored before the type was kept.
+	EventType string `gorm:"size:16"`
 }
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EvidenceImport records an evidence bundle an instructor imported for a student,
+// so it can be traced back to the device that signed it.
+type EvidenceImport struct {
+	ID                  uint `gorm:"primaryKey"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	DeletedAt           gorm.DeletedAt
+	StudentAssignmentID uint              `gorm:"not null;index"`
+	StudentAssignment   StudentAssignment `gorm:"foreignKey:StudentAssignmentID"`
+	InstructorID        uint              `gorm:"not null"`
+	Instructor          Instructor        `gorm:"foreignKey:InstructorID"`
+	DeviceID            string            `gorm:"size:32;index"`
+	DevicePublicKey     string
+	DeviceHostname      string
+	AgentVersion        string `gorm:"size:32"`
+	ChainHead           string `gorm:"size:64"`
+	EventCount          int
+	FileCount           int
+	BundleSHA256        string `gorm:"size:64;uniqueIndex"`
+	ExportedAt          time.Time
+}
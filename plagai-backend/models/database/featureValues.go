@@ -0,0 +1,18 @@
+package database
+
+import "time"
+
+// FeatureValues are the features measured on the latest analysis of a student assignment, the
+// class distributions are taken from them
+type FeatureValues struct {
+	ID                  uint `gorm:"primaryKey"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	StudentAssignmentID uint              `gorm:"not null;uniqueIndex"`
+	StudentAssignment   StudentAssignment `gorm:"foreignKey:StudentAssignmentID"`
+	AssignmentID        uint              `gorm:"not null;index"`
+	TypingSpeed         float64           `gorm:"not null"`
+	DeletionRatio       float64           `gorm:"not null"`
+	SessionCount        float64           `gorm:"not null"`
+	TimeOnTask          float64           `gorm:"not null"`
+}
@@ -0,0 +1,35 @@
+package database
+
+import "time"
+
+// Fingerprint is a winnowing fingerprint of a final file of a student assignment, every analysis
+// replaces the fingerprints of the student assignment
+type Fingerprint struct {
+	ID                  uint `gorm:"primaryKey"`
+	CreatedAt           time.Time
+	StudentAssignmentID uint              `gorm:"not null;index"`
+	StudentAssignment   StudentAssignment `gorm:"foreignKey:StudentAssignmentID"`
+	FilePath            string            `gorm:"not null"`
+	// The uint64 hash stored in a bigint
+	Hash      int64 `gorm:"not null;index"`
+	StartLine int   `gorm:"not null"`
+	EndLine   int   `gorm:"not null"`
+}
+
+// SimilarityPair is how similar two student assignments of an assignment are, stored once with
+// the smaller student assignment ID first
+type SimilarityPair struct {
+	ID                   uint `gorm:"primaryKey"`
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	AssignmentID         uint              `gorm:"not null;index"`
+	Assignment           Assignment        `gorm:"foreignKey:AssignmentID"`
+	StudentAssignmentAID uint              `gorm:"not null;uniqueIndex:idx_similarity_pair"`
+	StudentAssignmentA   StudentAssignment `gorm:"foreignKey:StudentAssignmentAID"`
+	StudentAssignmentBID uint              `gorm:"not null;uniqueIndex:idx_similarity_pair;index"`
+	StudentAssignmentB   StudentAssignment `gorm:"foreignKey:StudentAssignmentBID"`
+	Score                float64           `gorm:"not null"`
+	SharedFingerprints   int               `gorm:"not null"`
+	// JSON list of domain.MatchedRegion, seen from student assignment A
+	Regions string `gorm:"not null"`
+}
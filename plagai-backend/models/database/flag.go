@@ -17,4 +17,26 @@ type Flag struct {
 	Severity            uint              `gorm:"not null"`
 	StudentAssignmentID uint              `gorm:"not null;index"`
 	StudentAssignment   StudentAssignment `gorm:"foreignKey:StudentAssignmentID"`
+	// Registry ID of the rule that raised the flag and the JSON parameters it ran with
+	RuleID     string `gorm:"size:64;index"`
+	RuleParams string
+	// Versions of the rule and the engine that raised the flag
+	RuleVersion   int `gorm:"not null;default:0"`
+	EngineVersion int `gorm:"not null;default:0"`
+	// Analysis of the student assignment the flag belongs to. Flags from before analyses were
+	// versioned have 0.
+	AnalysisVersion uint `gorm:"not null;default:0"`
+	// Set once a later analysis replaced the flag, archived flags are kept for the record
+	ArchivedAt *time.Time `gorm:"index"`
+	// confirmed or dismissed by an instructor, empty while undecided
+	Decision     string `gorm:"size:16"`
+	DecisionNote string
+	DecidedBy    string `gorm:"size:255"`
+	DecidedAt    *time.Time
+	// Corpus document and lines of it the flag matched, if any
+	CorpusDocumentID *uint `gorm:"index"`
+	CorpusStartLine  int   `gorm:"not null;default:0"`
+	CorpusEndLine    int   `gorm:"not null;default:0"`
+	// JSON domain.ClassBaseline the flag was judged against, empty for fixed thresholds
+	Baseline string
 }
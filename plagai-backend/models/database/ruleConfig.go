@@ -0,0 +1,22 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RuleConfig overrides the defaults of one flagging rule for an assignment. Rules without a
+// configuration run with the defaults of the rule registry.
+type RuleConfig struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt
+	AssignmentID uint       `gorm:"not null;uniqueIndex:idx_rule_config_assignment_rule"`
+	Assignment   Assignment `gorm:"foreignKey:AssignmentID"`
+	RuleID       string     `gorm:"size:64;not null;uniqueIndex:idx_rule_config_assignment_rule"`
+	Enabled      bool       `gorm:"not null"`
+	// JSON object of the parameters that differ from the rule's defaults
+	Params string
+}
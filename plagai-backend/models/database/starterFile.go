@@ -0,0 +1,22 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StarterFile is a file the instructor hands out with an assignment. Students fetch them with
+// plaggy init, edits that leave a file equal to its starter file don't count as typed.
+type StarterFile struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt
+	AssignmentID uint       `gorm:"not null;index"`
+	Assignment   Assignment `gorm:"foreignKey:AssignmentID"`
+	// Relative to the assignment directory, slash separated
+	Path    string `gorm:"not null"`
+	Content string `gorm:"not null"`
+	SHA256  string `gorm:"size:64;not null"`
+}
@@ -16,4 +16,6 @@ type StudentAssignment struct {
 	Student      Student    `gorm:"foreignKey:StudentID"`
 	AssignmentID uint       `gorm:"not null;index"`
 	Assignment   Assignment `gorm:"foreignKey:AssignmentID"`
+	// Latest version of the flags, raised by every analysis that flagged something different
+	AnalysisVersion uint `gorm:"not null;default:0"`
 }
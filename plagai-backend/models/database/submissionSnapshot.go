@@ -0,0 +1,19 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SubmissionSnapshot holds the files a submission handed in, every submission adds one
+type SubmissionSnapshot struct {
+	ID                  uint `gorm:"primaryKey"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	DeletedAt           gorm.DeletedAt
+	StudentAssignmentID uint              `gorm:"not null;index"`
+	StudentAssignment   StudentAssignment `gorm:"foreignKey:StudentAssignmentID"`
+	// JSON list of models.SnapshotFile
+	Files string `gorm:"not null"`
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TrackingEvent is a lifecycle event sent by the agent daemon (start, stop, heartbeat...),
+// used to work out when a student's work was actually being tracked. Like diffs, a resubmitted
+// event is stored once.
+type TrackingEvent struct {
+	ID                  uint `gorm:"primaryKey"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	DeletedAt           gorm.DeletedAt
+	StudentAssignmentID uint              `gorm:"not null;index;uniqueIndex:idx_tracking_events_event,priority:1,where:seq > 0"`
+	StudentAssignment   StudentAssignment `gorm:"foreignKey:StudentAssignmentID"`
+	EventType           string            `gorm:"size:32;not null"`
+	Detail              string
+	OccurredAt          time.Time `gorm:"not null;index"`
+	Seq                 int64     `gorm:"uniqueIndex:idx_tracking_events_event,priority:3"`
+	FilePath            string
+	MonoMs              int64
+	SessionID           string `gorm:"size:32;uniqueIndex:idx_tracking_events_event,priority:2"`
+}
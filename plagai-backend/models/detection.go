@@ -11,4 +11,35 @@ type Detection struct {
 	HomeworkID string    `json:"homeworkId"`
 	FilePath   string    `json:"filePath"`
 	DiffData   string    `json:"diffData"`
+	// Registry ID of the rule that raised the flag, empty for flags raised before rules had IDs
+	RuleID string `json:"ruleId,omitempty"`
+	// confirmed or dismissed by an instructor, empty while undecided
+	Decision     string `json:"decision,omitempty"`
+	DecisionNote string `json:"decisionNote,omitempty"`
+	// Reference document of the homework the flag matched, if any
+	Reference *CorpusReference `json:"reference,omitempty"`
+	// Class distribution the flag was judged against, if its threshold was relative to the class
+	Baseline *ClassBaseline `json:"baseline,omitempty"`
+}
+
+// CorpusReference points at the lines of a reference document a detection matched
+type CorpusReference struct {
+	DocumentID uint   `json:"documentId"`
+	Name       string `json:"name"`
+	Tag        string `json:"tag"`
+	StartLine  int    `json:"startLine"`
+	EndLine    int    `json:"endLine"`
+}
+
+// ClassBaseline is the class distribution a detection was judged against
+type ClassBaseline struct {
+	Feature     string  `json:"feature"`
+	Submissions int     `json:"submissions"`
+	Mean        float64 `json:"mean"`
+	StdDev      float64 `json:"stdDev"`
+	Median      float64 `json:"median"`
+	Percentile  float64 `json:"percentile,omitempty"`
+	ZScore      float64 `json:"zScore,omitempty"`
+	Threshold   float64 `json:"threshold"`
+	Value       float64 `json:"value"`
 }
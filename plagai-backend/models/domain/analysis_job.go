@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+type AnalysisJobStatus string
+
+const (
+	AnalysisPending   AnalysisJobStatus = "pending"
+	AnalysisRunning   AnalysisJobStatus = "running"
+	AnalysisSucceeded AnalysisJobStatus = "succeeded"
+	// Failed too often and won't be retried
+	AnalysisDead AnalysisJobStatus = "dead"
+)
+
+type AnalysisJob struct {
+	ID                  uint
+	StudentAssignmentID uint
+	Status              AnalysisJobStatus
+	Attempts            int
+	MaxAttempts         int
+	LastError           string
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	FinishedAt          *time.Time
+	Flags               int
+}
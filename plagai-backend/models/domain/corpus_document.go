@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// CorpusTag tells where a reference document of an assignment comes from
+type CorpusTag string
+
+const (
+	// Generated by an AI assistant, usually by the instructor
+	CorpusAIGenerated CorpusTag = "ai-generated"
+	// Handed in by a student in an earlier term
+	CorpusPastTerm CorpusTag = "past-term"
+	// Published solution, such as one found online
+	CorpusPublicSolution CorpusTag = "public-solution"
+)
+
+func (t CorpusTag) Valid() bool {
+	switch t {
+	case CorpusAIGenerated, CorpusPastTerm, CorpusPublicSolution:
+		return true
+	}
+	return false
+}
+
+// CorpusDocument is a reference file of an assignment that submissions are matched against
+type CorpusDocument struct {
+	ID           uint
+	AssignmentID uint
+	// File name, its extension tells how the content is tokenised
+	Name       string
+	Tag        CorpusTag
+	Note       string
+	Content    string
+	SHA256     string
+	UploadedBy string
+	CreatedAt  time.Time
+}
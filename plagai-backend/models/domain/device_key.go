@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+type DeviceKey struct {
+	ID        uint
+	StudentID uint
+	DeviceID  string
+	// Base64 encoded ed25519 public key
+	PublicKey    string
+	Hostname     string
+	OS           string
+	RegisteredAt time.Time
+}
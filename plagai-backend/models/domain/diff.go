@@ -7,4 +7,25 @@ type Diff struct {
 	FilePath  string
 	PatchText string
 	Timestamp time.Time
+	Seq       int64
+	MonoMs    int64
+	SessionID string
+	// The patch is a coarse block replacement, see models.EventMeta
+	Degraded bool
+	// The file equals the instructor's starter file after this edit
+	Baseline bool
+	// ID of the git operation that changed the file, empty for edits of the student
+	VCSOperation string
+	// ID of the bulk operation, such as an archive extraction, the change was part of
+	BulkOperation string
+}
+
+// ElapsedSince returns the time that passed between prev and d.
+// When both were recorded in the same agent session the monotonic readings are used,
+// since the wall clock can be changed by the student while the monotonic clock can't.
+func (d Diff) ElapsedSince(prev Diff) time.Duration {
+	if d.SessionID != "" && d.SessionID == prev.SessionID {
+		return time.Duration(d.MonoMs-prev.MonoMs) * time.Millisecond
+	}
+	return d.Timestamp.Sub(prev.Timestamp)
 }
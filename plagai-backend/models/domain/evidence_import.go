@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+type EvidenceImport struct {
+	ID                  uint
+	StudentAssignmentID uint
+	InstructorID        uint
+	DeviceID            string
+	DevicePublicKey     string
+	DeviceHostname      string
+	AgentVersion        string
+	ChainHead           string
+	EventCount          int
+	FileCount           int
+	BundleSHA256        string
+	ExportedAt          time.Time
+	ImportedAt          time.Time
+}
@@ -0,0 +1,54 @@
+package domain
+
+// Feature is a measure of how a student assignment was written, compared across the class
+type Feature string
+
+const (
+	// Characters per second of the student's fastest typing, the 90th percentile of their edits
+	FeatureTypingSpeed Feature = "typing_speed"
+	// Characters deleted per character added
+	FeatureDeletionRatio Feature = "deletion_ratio"
+	// Work sessions, split where no edit was made for the work_session rule's idle gap
+	FeatureSessionCount Feature = "session_count"
+	// Minutes spent in work sessions
+	FeatureTimeOnTask Feature = "time_on_task"
+)
+
+// Features lists every feature in a fixed order
+var Features = []Feature{FeatureTypingSpeed, FeatureDeletionRatio, FeatureSessionCount, FeatureTimeOnTask}
+
+// FeatureValues are the features measured on the typed edits of a student assignment
+type FeatureValues struct {
+	StudentAssignmentID uint
+	Values              map[Feature]float64
+}
+
+// FeatureStats is the distribution of a feature over the submissions of an assignment
+type FeatureStats struct {
+	Feature Feature
+	// Submissions the feature was measured on
+	Count  int
+	Mean   float64
+	StdDev float64
+	// Measured values in increasing order
+	Values []float64
+}
+
+// ClassStats holds the distribution of every feature over an assignment
+type ClassStats map[Feature]FeatureStats
+
+// ClassBaseline is the class distribution a flag was judged against and the threshold taken from
+// it
+type ClassBaseline struct {
+	Feature     Feature
+	Submissions int
+	Mean        float64
+	StdDev      float64
+	Median      float64
+	// How the threshold was set, a percentile or a number of standard deviations from the mean
+	Percentile float64
+	ZScore     float64
+	Threshold  float64
+	// The value that was judged
+	Value float64
+}
@@ -1,8 +1,82 @@
 package domain
 
+import (
+	"fmt"
+	"time"
+)
+
+// FlagDecision is what an instructor decided about a flag after reviewing it
+type FlagDecision string
+
+const (
+	FlagUndecided FlagDecision = ""
+	// The flagged work wasn't the student's own
+	FlagConfirmed FlagDecision = "confirmed"
+	// The flag was a false alarm
+	FlagDismissed FlagDecision = "dismissed"
+)
+
 type Flag struct {
 	ID              uint
 	Diff            Diff
 	FlagExplanation string
 	Severity        int
+	// Registry ID of the rule that raised the flag and the parameters it ran with
+	RuleID     string
+	RuleParams RuleParams
+	// Versions of the rule and the engine that raised the flag
+	RuleVersion   int
+	EngineVersion int
+	// Analysis of the student assignment the flag belongs to, counted from 1
+	AnalysisVersion uint
+	// Set once a later analysis replaced the flag
+	ArchivedAt *time.Time
+	Decision   FlagDecision
+	// Why the instructor decided so and who did
+	DecisionNote string
+	DecidedBy    string
+	DecidedAt    *time.Time
+	// Set when the flag matched a reference document of the assignment's corpus
+	Reference *CorpusReference
+	// Set when the flag was judged against the rest of the class
+	Baseline *ClassBaseline
+}
+
+// CorpusReference points at the lines of a corpus document a flag matched, counted from 1
+type CorpusReference struct {
+	DocumentID uint
+	StartLine  int
+	EndLine    int
+}
+
+// Identity tells which flags of two analyses are about the same thing. Edits are resubmitted with
+// every submission and stored again, so they are told apart by their sequence number and the
+// daemon session that recorded them, sequence numbers alone repeat across agent databases.
+func (f Flag) Identity() string {
+	if f.Diff.Seq != 0 {
+		return fmt.Sprintf("%s|%s|%d|%s", f.RuleID, f.Diff.SessionID, f.Diff.Seq, f.Diff.FilePath)
+	}
+	return fmt.Sprintf("%s|%s|%s", f.RuleID, f.Diff.FilePath, f.FlagExplanation)
+}
+
+// FlagChange is a flag raised again by a new analysis, but with a different result
+type FlagChange struct {
+	Previous Flag
+	Current  Flag
+}
+
+// FlagVersionChanges summarises what an analysis changed about the flags of a student assignment
+type FlagVersionChanges struct {
+	StudentAssignmentID uint
+	// Equal when the analysis flagged exactly what the previous one did and no version was written
+	PreviousVersion uint
+	Version         uint
+	// Flags of the new version, Added, Changed and unchanged ones together
+	Flags     int
+	Added     []Flag
+	Removed   []Flag
+	Changed   []FlagChange
+	Unchanged int
+	// Decisions taken over from the previous version
+	DecisionsKept int
 }
@@ -0,0 +1,14 @@
+package domain
+
+// RuleParams are the numeric parameters of a flagging rule, by name
+type RuleParams map[string]float64
+
+// RuleConfig is how an instructor set up one flagging rule for an assignment
+type RuleConfig struct {
+	ID           uint
+	AssignmentID uint
+	RuleID       string
+	Enabled      bool
+	// Only the parameters that differ from the rule's defaults
+	Params RuleParams
+}
@@ -0,0 +1,51 @@
+package domain
+
+// Fingerprint is a hash of a run of normalised tokens of a final file that winnowing selected,
+// with the lines the run spans
+type Fingerprint struct {
+	FilePath  string
+	Hash      uint64
+	StartLine int
+	EndLine   int
+}
+
+// MatchedRegion is a stretch of lines of a file that matches a stretch of a file of another
+// student assignment
+type MatchedRegion struct {
+	FilePath       string
+	StartLine      int
+	EndLine        int
+	OtherFilePath  string
+	OtherStartLine int
+	OtherEndLine   int
+}
+
+// SimilarityPair is how similar the final files of two student assignments of an assignment are
+type SimilarityPair struct {
+	ID                       uint
+	AssignmentID             uint
+	StudentAssignmentID      uint
+	OtherStudentAssignmentID uint
+	// Email of the student of the other student assignment, when loaded for a single student
+	OtherStudent string
+	// Percentage of the fingerprints of the smaller submission found in the other one
+	Score              float64
+	SharedFingerprints int
+	// Regions of the student assignment matching regions of the other one
+	Regions []MatchedRegion
+}
+
+// Swapped returns the pair seen from the other student assignment
+func (p SimilarityPair) Swapped() SimilarityPair {
+	swapped := p
+	swapped.StudentAssignmentID, swapped.OtherStudentAssignmentID = p.OtherStudentAssignmentID, p.StudentAssignmentID
+	swapped.OtherStudent = ""
+	swapped.Regions = make([]MatchedRegion, len(p.Regions))
+	for i, r := range p.Regions {
+		swapped.Regions[i] = MatchedRegion{
+			FilePath: r.OtherFilePath, StartLine: r.OtherStartLine, EndLine: r.OtherEndLine,
+			OtherFilePath: r.FilePath, OtherStartLine: r.StartLine, OtherEndLine: r.EndLine,
+		}
+	}
+	return swapped
+}
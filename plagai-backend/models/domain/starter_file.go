@@ -0,0 +1,9 @@
+package domain
+
+type StarterFile struct {
+	ID           uint
+	AssignmentID uint
+	Path         string
+	Content      string
+	SHA256       string
+}
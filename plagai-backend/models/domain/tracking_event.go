@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+type TrackingEvent struct {
+	ID         uint
+	EventType  string
+	Detail     string
+	OccurredAt time.Time
+	Seq        int64
+	// Assignment directory on the student's machine, and the monotonic clock reading of the
+	// agent session that recorded the event
+	FilePath  string
+	MonoMs    int64
+	SessionID string
+}
@@ -0,0 +1,16 @@
+package mappers
+
+import (
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+func AssignmentToDomain(a *database.Assignment) domain.Assignment {
+	return domain.Assignment{
+		ID:          a.ID,
+		Title:       a.Title,
+		DueDate:     a.DueDate,
+		AssignedAt:  a.CreatedAt,
+		ClassroomID: a.ClassroomID,
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 type PatchWithTimestamp struct {
 	PatchText string `json:"patch_text"`
@@ -15,8 +18,48 @@ const (
 	APIEventModified EditEventType = "modified"
 	APIEventDeleted  EditEventType = "deleted"
 	APIEventRenamed  EditEventType = "renamed"
+	// The student rolled the file back to an earlier state with plaggy restore, the patch
+	// is needed to rebuild the file but the restored text was not typed
+	APIEventRestored EditEventType = "restored"
+)
+
+// Lifecycle events are recorded by the agent daemon about itself, not about a file.
+// FilePath is the assignment directory and Patch holds a short detail text.
+const (
+	APIEventDaemonStarted EditEventType = "daemon_start"
+	APIEventDaemonStopped EditEventType = "daemon_stop"
+	APIEventWatchAdded    EditEventType = "watch_added"
+	APIEventWatchRemoved  EditEventType = "watch_removed"
+	APIEventOverflow      EditEventType = "overflow"
+	APIEventReconcile     EditEventType = "reconcile"
+	APIEventHeartbeat     EditEventType = "heartbeat"
+	// plaggy init wrote the assignment's starter files, Patch is the JSON list of BaselineFile
+	APIEventBaseline EditEventType = "baseline"
+	// A git command ended, Patch is the VCSOperation as JSON
+	APIEventVCSOperation EditEventType = "vcs_operation"
+	// A tool changed many files at once, Patch is the BulkOperation as JSON
+	APIEventBulkOperation EditEventType = "bulk_operation"
+	// The student paused or resumed tracking with a reason, Patch is the TrackingPause as JSON.
+	// Edits made while paused are reconciled into net changes after the resume.
+	APIEventTrackingPaused  EditEventType = "tracking_paused"
+	APIEventTrackingResumed EditEventType = "tracking_resumed"
+	// The files as the student handed them in, Patch is the JSON list of SnapshotFile. It isn't
+	// recorded by the agent but sent along with the submission, and comes after every other event.
+	APIEventFinalSnapshot EditEventType = "final_snapshot"
 )
 
+// IsLifecycle reports whether the event describes the daemon instead of a file edit
+func (t EditEventType) IsLifecycle() bool {
+	switch t {
+	case APIEventDaemonStarted, APIEventDaemonStopped, APIEventWatchAdded, APIEventWatchRemoved,
+		APIEventOverflow, APIEventReconcile, APIEventHeartbeat, APIEventBaseline, APIEventVCSOperation, APIEventBulkOperation,
+		APIEventTrackingPaused, APIEventTrackingResumed, APIEventFinalSnapshot:
+		return true
+	default:
+		return false
+	}
+}
+
 // EditEvent is the JSON representation sent over HTTP
 type EditEvent struct {
 	ID           int           `json:"id"`
@@ -25,15 +68,193 @@ type EditEvent struct {
 	EventType    EditEventType `json:"event_type"`
 	Patch        string        `json:"patch,omitempty"`
 	Timestamp    time.Time     `json:"timestamp"`
+	// Per-assignment position of the event, events are ordered by this rather than by time
+	Seq int64 `json:"seq"`
+	// Wall clock in unix milliseconds, can be changed by the student
+	WallMs int64 `json:"wall_ms"`
+	// Monotonic milliseconds since the daemon session started, only comparable within one SessionID
+	MonoMs    int64      `json:"mono_ms"`
+	SessionID string     `json:"session_id,omitempty"`
+	Meta      *EventMeta `json:"meta,omitempty"`
+	// ID of the stored diff, set when the event was loaded back from the database
+	DiffID uint `json:"-"`
+}
+
+// EventMeta carries optional facts about how the agent recorded an event
+type EventMeta struct {
+	// The patch replaces the changed block as a whole because the file was too large or too slow
+	// to diff line by line, so it overstates how much was typed
+	Degraded       bool   `json:"degraded,omitempty"`
+	DegradedReason string `json:"degraded_reason,omitempty"`
+	// The file equals the starter file at its path, so the edit wasn't typed by the student.
+	// It is only trusted after VerifyBaselines checked it against the instructor's starter files.
+	Baseline bool `json:"baseline,omitempty"`
+	// The file was changed by the git operation with this ID, described by a vcs_operation event.
+	// It is only trusted after VerifyVCSOperations found that event.
+	VCSOperation string `json:"vcs_operation,omitempty"`
+	// Commit HEAD pointed at when the git operation started
+	VCSCommit string `json:"vcs_commit,omitempty"`
+	// The file changed together with many others at once, described by the bulk_operation event
+	// with this ID. It is only trusted after VerifyBulkOperations found that event.
+	BulkOperation string `json:"bulk_operation,omitempty"`
+}
+
+// VCSOperation is the detail of a vcs_operation event, a git command the agent saw running
+type VCSOperation struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	Repository string    `json:"repository"`
+	FromBranch string    `json:"fromBranch,omitempty"`
+	ToBranch   string    `json:"toBranch,omitempty"`
+	FromCommit string    `json:"fromCommit,omitempty"`
+	ToCommit   string    `json:"toCommit,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	EndedAt    time.Time `json:"endedAt"`
+	Files      int       `json:"files"`
+}
+
+// ChangesWorkingTree reports whether the git command writes files by itself.
+// A commit doesn't, files changed while it ran were changed by the student.
+func (op VCSOperation) ChangesWorkingTree() bool {
+	switch op.Kind {
+	case "checkout", "pull", "merge", "rebase", "reset", "stash":
+		return true
+	default:
+		return false
+	}
+}
+
+// BulkOperation is the detail of a bulk_operation event, a burst of changes to many files the
+// agent saw, such as extracting an archive or running a formatter
+type BulkOperation struct {
+	ID string `json:"id"`
+	// copy_in, rewrite, delete or mixed, by what happened to most of the files
+	Kind      string    `json:"kind"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+	Files     int       `json:"files"`
+	Added     int       `json:"added"`
+	Modified  int       `json:"modified"`
+	Deleted   int       `json:"deleted"`
+}
+
+// TrackingPause is the detail of a tracking_paused event, and of the tracking_resumed event
+// ending the pause with the resume fields set
+type TrackingPause struct {
+	Reason          string    `json:"reason"`
+	PausedAt        time.Time `json:"pausedAt"`
+	ChecksumAtPause string    `json:"checksumAtPause"`
+	ResumedAt       time.Time `json:"resumedAt"`
+	// Checksum of the directory on resume and the one the agent kept up to date from the file
+	// events it held back, they differ when it missed some
+	ChecksumAtResume string `json:"checksumAtResume,omitempty"`
+	RollingChecksum  string `json:"rollingChecksum,omitempty"`
+	ChangedFiles     int    `json:"changedFiles"`
+}
+
+// BaselineFile is an entry of a baseline event, a starter file as the agent received it
+type BaselineFile struct {
+	// Relative to the assignment directory, slash separated
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// SnapshotFile is a file of the final snapshot sent with a submission
+type SnapshotFile struct {
+	// Relative to the assignment directory, like the paths of the events
+	Path string `json:"path"`
+	// Hash of the content with secrets redacted, the way the agent diffs it
+	SHA256  string `json:"sha256"`
+	Content string `json:"content,omitempty"`
+	// Why the content was left out, such as for binary or large files. Only the hash is compared.
+	Omitted string `json:"omitted,omitempty"`
+}
+
+// IsDegraded reports whether the event's patch is a coarse block replacement
+func (e EditEvent) IsDegraded() bool {
+	return e.Meta != nil && e.Meta.Degraded
+}
+
+// IsBaseline reports whether the event left the file equal to its starter file
+func (e EditEvent) IsBaseline() bool {
+	return e.Meta != nil && e.Meta.Baseline
+}
+
+// VCSOperationID returns the ID of the git operation that changed the file, if any
+func (e EditEvent) VCSOperationID() string {
+	if e.Meta == nil {
+		return ""
+	}
+	return e.Meta.VCSOperation
+}
+
+// BulkOperationID returns the ID of the bulk operation the event was part of, if any
+func (e EditEvent) BulkOperationID() string {
+	if e.Meta == nil {
+		return ""
+	}
+	return e.Meta.BulkOperation
+}
+
+// EventTime returns the wall clock time of the event at millisecond resolution,
+// falling back to the second resolution timestamp sent by older agents
+func (e EditEvent) EventTime() time.Time {
+	if e.WallMs != 0 {
+		return time.UnixMilli(e.WallMs)
+	}
+	return e.Timestamp
+}
+
+// SortEventsBySeq orders events by their sequence number within each daemon session and the
+// sessions by when they started. Sequence numbers start over with a new agent database or on
+// another device, so the histories of two devices are kept apart instead of interleaved.
+// Submissions from agents that don't send sequence numbers are left in the order they arrived in.
+func SortEventsBySeq(events []EditEvent) {
+	// A session starts at the wall time of its first event
+	type sessionStart struct {
+		seq    int64
+		wallMs int64
+	}
+	starts := make(map[string]sessionStart)
+	for _, e := range events {
+		if e.Seq == 0 {
+			return
+		}
+		if start, ok := starts[e.SessionID]; !ok || e.Seq < start.seq {
+			starts[e.SessionID] = sessionStart{seq: e.Seq, wallMs: e.EventTime().UnixMilli()}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if a.SessionID != b.SessionID {
+			if starts[a.SessionID].wallMs != starts[b.SessionID].wallMs {
+				return starts[a.SessionID].wallMs < starts[b.SessionID].wallMs
+			}
+			return a.SessionID < b.SessionID
+		}
+		return a.Seq < b.Seq
+	})
 }
 
 type Submission struct {
 	AssignmentId uint        `json:"assignmentID"`
 	Edits        []EditEvent `json:"edits"`
+	// The submitted files as they are on disk, older agents don't send it
+	Snapshot []SnapshotFile `json:"snapshot,omitempty"`
 }
 
 type DBEditEvent struct {
 	PatchText string
 	Timestamp int64
 	FilePath  string
+	Seq       int64
+	MonoMs    int64
+	SessionID string
+	Degraded  bool
+	Baseline  bool
+	// ID of the git operation that changed the file
+	VCSOperation string
+	// ID of the bulk operation the change was part of
+	BulkOperation string
+	EventType     EditEventType
 }
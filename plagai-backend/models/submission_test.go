@@ -0,0 +1,25 @@
+package models
+
+import "testing"
+
+func TestSortEventsBySeqKeepsDevicesApart(t *testing.T) {
+	event := func(session string, seq int64, wallMs int64) EditEvent {
+		return EditEvent{SessionID: session, Seq: seq, WallMs: wallMs}
+	}
+	// A desktop history, a restart of its daemon, and a laptop with its own agent database
+	events := []EditEvent{
+		event("laptop", 2, 5000), event("desktop", 2, 1000), event("restart", 3, 3000),
+		event("laptop", 1, 4000), event("desktop", 1, 0),
+	}
+	SortEventsBySeq(events)
+
+	want := []EditEvent{
+		event("desktop", 1, 0), event("desktop", 2, 1000), event("restart", 3, 3000),
+		event("laptop", 1, 4000), event("laptop", 2, 5000),
+	}
+	for i := range want {
+		if events[i].SessionID != want[i].SessionID || events[i].Seq != want[i].Seq {
+			t.Fatalf("expected %+v, got %+v", want, events)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrAnalysisJobDatabase = errors.New("database error while handling analysis jobs")
+	// The job was taken over by another worker after its lock expired
+	ErrAnalysisJobLost = errors.New("analysis job is no longer held by this worker")
+)
+
+type AnalysisJobRepository interface {
+	// Enqueue adds a pending job for the student assignment, unless one is waiting already. A
+	// job added while another one runs waits for it to finish.
+	Enqueue(studentAssignmentID uint, maxAttempts int) (domain.AnalysisJob, error)
+	// EnqueueAssignment enqueues every student assignment of the assignment, for when something
+	// all of them are analysed against changed
+	EnqueueAssignment(assignmentID uint, maxAttempts int) ([]domain.AnalysisJob, error)
+	// Claim locks the next due job for the worker until the visibility timeout passes, jobs whose
+	// worker let the lock expire are due again. Jobs of a student assignment another worker is
+	// analysing wait. It returns nil when no job is due.
+	Claim(workerID string, visibility time.Duration) (*domain.AnalysisJob, error)
+	// Complete marks the job held by the worker as succeeded
+	Complete(jobID uint, workerID string, flags int) error
+	// Fail records why the run failed and schedules the job again at retryAt, or gives up on it
+	// for good when retryAt is zero or another job of the student assignment is pending
+	Fail(jobID uint, workerID string, reason string, retryAt time.Time) error
+	// GetLatestJobs returns the latest job of every student assignment of the assignment, by
+	// student assignment ID
+	GetLatestJobs(assignmentID uint) (map[uint]domain.AnalysisJob, error)
+}
+
+type analysisJobRepository struct {
+	db *gorm.DB
+}
+
+func NewAnalysisJobRepository(db *gorm.DB) AnalysisJobRepository {
+	return &analysisJobRepository{db: db}
+}
+
+func (r *analysisJobRepository) Enqueue(studentAssignmentID uint, maxAttempts int) (domain.AnalysisJob, error) {
+	dbJob := database.AnalysisJob{
+		StudentAssignmentID: studentAssignmentID,
+		Status:              string(domain.AnalysisPending),
+		RunAfter:            time.Now(),
+		MaxAttempts:         maxAttempts,
+	}
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&dbJob)
+	if result.Error != nil {
+		return domain.AnalysisJob{}, ErrAnalysisJobDatabase
+	}
+	if result.RowsAffected == 1 {
+		return toDomainAnalysisJob(&dbJob), nil
+	}
+
+	// A job that hasn't started yet will see the new events as well
+	dbJob = database.AnalysisJob{}
+	if err := r.db.
+		Where("student_assignment_id = ? AND status = ?", studentAssignmentID, domain.AnalysisPending).
+		First(&dbJob).Error; err != nil {
+		return domain.AnalysisJob{}, ErrAnalysisJobDatabase
+	}
+	return toDomainAnalysisJob(&dbJob), nil
+}
+
+func (r *analysisJobRepository) EnqueueAssignment(assignmentID uint, maxAttempts int) ([]domain.AnalysisJob, error) {
+	var jobs []domain.AnalysisJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var studentAssignmentIDs []uint
+		if err := tx.Model(&database.StudentAssignment{}).
+			Where("assignment_id = ?", assignmentID).
+			Order("id ASC").
+			Pluck("id", &studentAssignmentIDs).Error; err != nil {
+			return ErrAnalysisJobDatabase
+		}
+		txRepo := &analysisJobRepository{db: tx}
+		for _, id := range studentAssignmentIDs {
+			job, err := txRepo.Enqueue(id, maxAttempts)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *analysisJobRepository) Claim(workerID string, visibility time.Duration) (*domain.AnalysisJob, error) {
+	now := time.Now()
+	var dbJob database.AnalysisJob
+	// SKIP LOCKED lets every worker claim a different job without waiting for the others
+	result := r.db.Raw(`
+		UPDATE analysis_jobs
+		SET status = ?, attempts = attempts + 1, locked_by = ?, locked_until = ?, updated_at = ?
+		WHERE id = (
+			SELECT id FROM analysis_jobs j
+			WHERE ((j.status = ? AND j.run_after <= ?) OR (j.status = ? AND j.locked_until < ?))
+			AND NOT EXISTS (
+				SELECT 1 FROM analysis_jobs running
+				WHERE running.student_assignment_id = j.student_assignment_id AND running.id <> j.id
+				AND running.status = ? AND running.locked_until >= ?
+			)
+			ORDER BY j.run_after ASC, j.id ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`, domain.AnalysisRunning, workerID, now.Add(visibility), now,
+		domain.AnalysisPending, now, domain.AnalysisRunning, now, domain.AnalysisRunning, now).Scan(&dbJob)
+	if result.Error != nil {
+		return nil, ErrAnalysisJobDatabase
+	}
+	if result.RowsAffected == 0 || dbJob.ID == 0 {
+		return nil, nil
+	}
+	job := toDomainAnalysisJob(&dbJob)
+	return &job, nil
+}
+
+func (r *analysisJobRepository) Complete(jobID uint, workerID string, flags int) error {
+	now := time.Now()
+	return r.release(jobID, workerID, map[string]any{
+		"status":       domain.AnalysisSucceeded,
+		"finished_at":  now,
+		"locked_until": nil,
+		"last_error":   "",
+		"flags":        flags,
+	})
+}
+
+func (r *analysisJobRepository) Fail(jobID uint, workerID string, reason string, retryAt time.Time) error {
+	updates := map[string]any{
+		"last_error":   reason,
+		"locked_until": nil,
+	}
+	if !retryAt.IsZero() {
+		// The pending job runs the analysis again anyway
+		var pending int64
+		if err := r.db.Model(&database.AnalysisJob{}).
+			Where("status = ? AND student_assignment_id = (SELECT student_assignment_id FROM analysis_jobs WHERE id = ?)", domain.AnalysisPending, jobID).
+			Count(&pending).Error; err != nil {
+			return ErrAnalysisJobDatabase
+		}
+		if pending > 0 {
+			retryAt = time.Time{}
+			updates["last_error"] = reason + ", not retried since a newer job is pending"
+		}
+	}
+	if retryAt.IsZero() {
+		updates["status"] = domain.AnalysisDead
+		updates["finished_at"] = time.Now()
+	} else {
+		updates["status"] = domain.AnalysisPending
+		updates["run_after"] = retryAt
+	}
+	return r.release(jobID, workerID, updates)
+}
+
+// release updates the job unless another worker took it over in the meantime
+func (r *analysisJobRepository) release(jobID uint, workerID string, updates map[string]any) error {
+	result := r.db.Model(&database.AnalysisJob{}).
+		Where("id = ? AND locked_by = ? AND status = ?", jobID, workerID, domain.AnalysisRunning).
+		Updates(updates)
+	if result.Error != nil {
+		return ErrAnalysisJobDatabase
+	}
+	if result.RowsAffected == 0 {
+		return ErrAnalysisJobLost
+	}
+	return nil
+}
+
+func (r *analysisJobRepository) GetLatestJobs(assignmentID uint) (map[uint]domain.AnalysisJob, error) {
+	var dbJobs []database.AnalysisJob
+	if err := r.db.Raw(`
+		SELECT DISTINCT ON (j.student_assignment_id) j.*
+		FROM analysis_jobs j
+		JOIN student_assignments sa ON sa.id = j.student_assignment_id
+		WHERE sa.assignment_id = ? AND sa.deleted_at IS NULL
+		ORDER BY j.student_assignment_id, j.id DESC
+	`, assignmentID).Scan(&dbJobs).Error; err != nil {
+		return nil, ErrAnalysisJobDatabase
+	}
+	jobs := make(map[uint]domain.AnalysisJob, len(dbJobs))
+	for i := range dbJobs {
+		jobs[dbJobs[i].StudentAssignmentID] = toDomainAnalysisJob(&dbJobs[i])
+	}
+	return jobs, nil
+}
+
+func toDomainAnalysisJob(j *database.AnalysisJob) domain.AnalysisJob {
+	return domain.AnalysisJob{
+		ID:                  j.ID,
+		StudentAssignmentID: j.StudentAssignmentID,
+		Status:              domain.AnalysisJobStatus(j.Status),
+		Attempts:            j.Attempts,
+		MaxAttempts:         j.MaxAttempts,
+		LastError:           j.LastError,
+		CreatedAt:           j.CreatedAt,
+		UpdatedAt:           j.UpdatedAt,
+		FinishedAt:          j.FinishedAt,
+		Flags:               j.Flags,
+	}
+}
+
+// RemoveDuplicatePendingJobs keeps the oldest pending job of every student assignment, so
+// idx_analysis_jobs_pending can be created on queues from before it. It only does something once.
+func RemoveDuplicatePendingJobs(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&database.AnalysisJob{}) || db.Migrator().HasIndex(&database.AnalysisJob{}, "idx_analysis_jobs_pending") {
+		return nil
+	}
+	return db.Exec(`
+		DELETE FROM analysis_jobs
+		WHERE status = ? AND id NOT IN (
+			SELECT MIN(id) FROM analysis_jobs WHERE status = ? GROUP BY student_assignment_id
+		)
+	`, domain.AnalysisPending, domain.AnalysisPending).Error
+}
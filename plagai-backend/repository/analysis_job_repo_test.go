@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+func TestEnqueueKeepsOnePendingJob(t *testing.T) {
+	db := testDB(t)
+	repo := NewAnalysisJobRepository(db)
+	first, err := repo.Enqueue(1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := repo.Enqueue(1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("expected the pending job %d to be reused, got %d", first.ID, again.ID)
+	}
+
+	// A worker runs the job when the student submits again
+	lockedUntil := time.Now().Add(time.Minute)
+	if err := db.Model(&database.AnalysisJob{}).Where("id = ?", first.ID).
+		Updates(map[string]any{"status": domain.AnalysisRunning, "locked_by": "worker", "locked_until": lockedUntil}).Error; err != nil {
+		t.Fatal(err)
+	}
+	next, err := repo.Enqueue(1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID == first.ID || next.Status != domain.AnalysisPending {
+		t.Fatalf("expected a new pending job for the new events, got %+v", next)
+	}
+
+	// The running job fails, the pending one analyses the student assignment again anyway
+	if err := repo.Fail(first.ID, "worker", "timeout", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	var pending int64
+	db.Model(&database.AnalysisJob{}).Where("student_assignment_id = ? AND status = ?", 1, domain.AnalysisPending).Count(&pending)
+	if pending != 1 {
+		t.Errorf("expected one pending job, got %d", pending)
+	}
+}
+
+func TestEnqueueAssignmentQueuesEveryStudent(t *testing.T) {
+	db := testDB(t)
+	for _, sa := range []database.StudentAssignment{
+		{StudentID: 1, AssignmentID: 1}, {StudentID: 2, AssignmentID: 1}, {StudentID: 1, AssignmentID: 2},
+	} {
+		if err := db.Create(&sa).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := NewAnalysisJobRepository(db)
+	waiting, err := repo.Enqueue(1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := repo.EnqueueAssignment(1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != waiting.ID || jobs[1].StudentAssignmentID != 2 {
+		t.Fatalf("expected the waiting job and a new one for the second student, got %+v", jobs)
+	}
+}
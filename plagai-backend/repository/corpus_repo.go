@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCorpusDatabase         = errors.New("database error while handling corpus documents")
+	ErrCorpusDocumentNotFound = errors.New("corpus document not found")
+)
+
+type CorpusRepository interface {
+	AddDocument(document domain.CorpusDocument) (domain.CorpusDocument, error)
+	// GetDocuments returns the documents of the assignment in upload order
+	GetDocuments(assignmentID uint) ([]domain.CorpusDocument, error)
+	// GetDocument returns a document of the assignment
+	GetDocument(assignmentID uint, documentID uint) (domain.CorpusDocument, error)
+	// DeleteDocument removes a document of the assignment from its corpus
+	DeleteDocument(assignmentID uint, documentID uint) error
+}
+
+type corpusRepository struct {
+	db *gorm.DB
+}
+
+func NewCorpusRepository(db *gorm.DB) CorpusRepository {
+	return &corpusRepository{db: db}
+}
+
+func (r *corpusRepository) AddDocument(document domain.CorpusDocument) (domain.CorpusDocument, error) {
+	dbDocument := database.CorpusDocument{
+		AssignmentID: document.AssignmentID,
+		Name:         document.Name,
+		Tag:          string(document.Tag),
+		Note:         document.Note,
+		Content:      document.Content,
+		SHA256:       document.SHA256,
+		UploadedBy:   document.UploadedBy,
+	}
+	if err := r.db.Create(&dbDocument).Error; err != nil {
+		return domain.CorpusDocument{}, ErrCorpusDatabase
+	}
+	return toDomainCorpusDocument(&dbDocument), nil
+}
+
+func (r *corpusRepository) GetDocuments(assignmentID uint) ([]domain.CorpusDocument, error) {
+	var dbDocuments []database.CorpusDocument
+	if err := r.db.Where("assignment_id = ?", assignmentID).Order("id ASC").Find(&dbDocuments).Error; err != nil {
+		return nil, ErrCorpusDatabase
+	}
+	documents := make([]domain.CorpusDocument, len(dbDocuments))
+	for i := range dbDocuments {
+		documents[i] = toDomainCorpusDocument(&dbDocuments[i])
+	}
+	return documents, nil
+}
+
+func (r *corpusRepository) GetDocument(assignmentID uint, documentID uint) (domain.CorpusDocument, error) {
+	var dbDocument database.CorpusDocument
+	if err := r.db.Where("id = ? AND assignment_id = ?", documentID, assignmentID).First(&dbDocument).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.CorpusDocument{}, ErrCorpusDocumentNotFound
+		}
+		return domain.CorpusDocument{}, ErrCorpusDatabase
+	}
+	return toDomainCorpusDocument(&dbDocument), nil
+}
+
+func (r *corpusRepository) DeleteDocument(assignmentID uint, documentID uint) error {
+	result := r.db.Where("id = ? AND assignment_id = ?", documentID, assignmentID).Delete(&database.CorpusDocument{})
+	if result.Error != nil {
+		return ErrCorpusDatabase
+	}
+	if result.RowsAffected == 0 {
+		return ErrCorpusDocumentNotFound
+	}
+	return nil
+}
+
+func toDomainCorpusDocument(d *database.CorpusDocument) domain.CorpusDocument {
+	return domain.CorpusDocument{
+		ID:           d.ID,
+		AssignmentID: d.AssignmentID,
+		Name:         d.Name,
+		Tag:          domain.CorpusTag(d.Tag),
+		Note:         d.Note,
+		Content:      d.Content,
+		SHA256:       d.SHA256,
+		UploadedBy:   d.UploadedBy,
+		CreatedAt:    d.CreatedAt,
+	}
+}
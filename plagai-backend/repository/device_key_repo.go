@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrDeviceKeyDatabase = errors.New("database error while handling device keys")
+
+type DeviceKeyRepository interface {
+	// RegisterKey adds the device key to the student's keys, registering a key again updates
+	// the description of its device
+	RegisterKey(key domain.DeviceKey) error
+	// GetKeys returns the base64 public keys registered for the student
+	GetKeys(studentID uint) ([]string, error)
+}
+
+type deviceKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceKeyRepository(db *gorm.DB) DeviceKeyRepository {
+	return &deviceKeyRepository{db: db}
+}
+
+func (r *deviceKeyRepository) RegisterKey(key domain.DeviceKey) error {
+	dbKey := database.DeviceKey{
+		StudentID: key.StudentID,
+		DeviceID:  key.DeviceID,
+		PublicKey: key.PublicKey,
+		Hostname:  key.Hostname,
+		OS:        key.OS,
+	}
+	if err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "student_id"}, {Name: "public_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "device_id", "hostname", "os"}),
+	}).Create(&dbKey).Error; err != nil {
+		return ErrDeviceKeyDatabase
+	}
+	return nil
+}
+
+func (r *deviceKeyRepository) GetKeys(studentID uint) ([]string, error) {
+	var keys []string
+	if err := r.db.Model(&database.DeviceKey{}).
+		Where("student_id = ?", studentID).
+		Order("id ASC").
+		Pluck("public_key", &keys).Error; err != nil {
+		return nil, ErrDeviceKeyDatabase
+	}
+	return keys, nil
+}
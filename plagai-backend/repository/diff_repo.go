@@ -32,7 +32,7 @@ func (r *diffRepository) GetDiffs(studentAssignmentID uint, start, finish int) (
 
 	query := r.db.
 		Where("student_assignment_id = ?", studentAssignmentID).
-		Order("created_at ASC")
+		Order("seq ASC, created_at ASC, id ASC")
 
 	// Apply limit/offset only if finish is non-negative.
 	if finish >= 0 {
@@ -63,9 +63,16 @@ func (r *diffRepository) GetDiffs(studentAssignmentID uint, start, finish int) (
 
 func toDomainDiff(d *database.Diff) domain.Diff {
 	return domain.Diff{
-		ID:        d.ID,
-		FilePath:  d.FilePath,
-		PatchText: d.DiffData,
-		Timestamp: d.CreatedAt,
+		ID:            d.ID,
+		FilePath:      d.FilePath,
+		PatchText:     d.DiffData,
+		Timestamp:     d.CreatedAt,
+		Seq:           d.Seq,
+		MonoMs:        d.MonoMs,
+		SessionID:     d.SessionID,
+		Degraded:      d.Degraded,
+		Baseline:      d.Baseline,
+		VCSOperation:  d.VCSOperation,
+		BulkOperation: d.BulkOperation,
 	}
 }
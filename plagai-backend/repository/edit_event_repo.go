@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/database"
+	"gorm.io/gorm"
+)
+
+var ErrEditEventDatabase = errors.New("database error while loading edit events")
+
+type EditEventRepository interface {
+	// GetEvents rebuilds the event stream of a student assignment as the agent submitted it,
+	// edits and lifecycle events together in recording order. The snapshot of the latest
+	// submission comes last as a final_snapshot event.
+	GetEvents(studentAssignmentID uint) ([]models.EditEvent, error)
+}
+
+type editEventRepository struct {
+	db *gorm.DB
+}
+
+func NewEditEventRepository(db *gorm.DB) EditEventRepository {
+	return &editEventRepository{db: db}
+}
+
+func (r *editEventRepository) GetEvents(studentAssignmentID uint) ([]models.EditEvent, error) {
+	// Diffs without an event type that a flag points at were stored for that flag, not submitted
+	var diffs []database.Diff
+	if err := r.db.
+		Where("student_assignment_id = ?", studentAssignmentID).
+		Where("event_type <> '' OR id NOT IN (SELECT diff_id FROM flags WHERE student_assignment_id = ?)", studentAssignmentID).
+		Order("id ASC").
+		Find(&diffs).Error; err != nil {
+		return nil, ErrEditEventDatabase
+	}
+	var trackingEvents []database.TrackingEvent
+	if err := r.db.
+		Where("student_assignment_id = ?", studentAssignmentID).
+		Order("id ASC").
+		Find(&trackingEvents).Error; err != nil {
+		return nil, ErrEditEventDatabase
+	}
+
+	events := make([]models.EditEvent, 0, len(diffs)+len(trackingEvents))
+	for _, d := range diffs {
+		eventType := models.EditEventType(d.EventType)
+		if eventType == "" {
+			eventType = models.APIEventModified
+		}
+		event := models.EditEvent{
+			FilePath:  d.FilePath,
+			EventType: eventType,
+			Patch:     d.DiffData,
+			Timestamp: d.CreatedAt,
+			Seq:       d.Seq,
+			WallMs:    d.CreatedAt.UnixMilli(),
+			MonoMs:    d.MonoMs,
+			SessionID: d.SessionID,
+			DiffID:    d.ID,
+		}
+		if d.Degraded || d.Baseline || d.VCSOperation != "" || d.BulkOperation != "" {
+			event.Meta = &models.EventMeta{
+				Degraded:      d.Degraded,
+				Baseline:      d.Baseline,
+				VCSOperation:  d.VCSOperation,
+				BulkOperation: d.BulkOperation,
+			}
+		}
+		events = append(events, event)
+	}
+	for _, e := range trackingEvents {
+		events = append(events, models.EditEvent{
+			FilePath:  e.FilePath,
+			EventType: models.EditEventType(e.EventType),
+			Patch:     e.Detail,
+			Timestamp: e.OccurredAt,
+			Seq:       e.Seq,
+			WallMs:    e.OccurredAt.UnixMilli(),
+			MonoMs:    e.MonoMs,
+			SessionID: e.SessionID,
+		})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].EventTime().Before(events[j].EventTime())
+	})
+	models.SortEventsBySeq(events)
+
+	var snapshot database.SubmissionSnapshot
+	err := r.db.
+		Where("student_assignment_id = ?", studentAssignmentID).
+		Order("id DESC").
+		First(&snapshot).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEditEventDatabase
+	}
+	if err == nil {
+		// Appended after sorting, it has no sequence number since the agent didn't record it
+		events = append(events, models.EditEvent{
+			EventType: models.APIEventFinalSnapshot,
+			Patch:     snapshot.Files,
+			Timestamp: snapshot.CreatedAt,
+			WallMs:    snapshot.CreatedAt.UnixMilli(),
+		})
+	}
+	return events, nil
+}
+
+// RemoveResubmittedEvents deletes the copies of events stored again by every submission before
+// idx_diffs_event and idx_tracking_events_event existed, so the indexes can be created. Flags
+// on a deleted copy are moved to the copy that is kept. It only does something once.
+func RemoveResubmittedEvents(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&database.Diff{}) || db.Migrator().HasIndex(&database.Diff{}, "idx_diffs_event") {
+		return nil
+	}
+	copies := func(table string) string {
+		return "SELECT id, MIN(id) OVER (PARTITION BY student_assignment_id, session_id, seq) AS kept FROM " + table + " WHERE seq > 0"
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE flags SET diff_id = (SELECT c.kept FROM (" + copies("diffs") + ") c WHERE c.id = flags.diff_id) " +
+			"WHERE diff_id IN (SELECT c.id FROM (" + copies("diffs") + ") c WHERE c.id <> c.kept)").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM diffs WHERE id IN (SELECT c.id FROM (" + copies("diffs") + ") c WHERE c.id <> c.kept)").Error; err != nil {
+			return err
+		}
+		if !tx.Migrator().HasTable(&database.TrackingEvent{}) {
+			return nil
+		}
+		return tx.Exec("DELETE FROM tracking_events WHERE id IN (SELECT c.id FROM (" + copies("tracking_events") + ") c WHERE c.id <> c.kept)").Error
+	})
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// resubmittedHistory returns the diffs of a laptop submitted twice and of a second device
+// numbering its events from 1 as well
+func resubmittedHistory() []database.Diff {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	diff := func(minutes int, session string, seq int64, patch string) database.Diff {
+		at := start.Add(time.Duration(minutes) * time.Minute)
+		return database.Diff{
+			StudentAssignmentID: 1, FilePath: "/hw/main.go", DiffData: patch, EventType: "modified",
+			Seq: seq, SessionID: session, CreatedAt: at, UpdatedAt: at,
+		}
+	}
+	return []database.Diff{
+		diff(0, "laptop", 1, "+a"),
+		diff(1, "laptop", 2, "+b"),
+		diff(0, "laptop", 1, "+a"),
+		diff(1, "laptop", 2, "+b"),
+		diff(5, "desktop", 1, "+c"),
+		diff(6, "desktop", 2, "+d"),
+	}
+}
+
+func expectEachEventOnce(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	events, err := NewEditEventRepository(db).GetEvents(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches := map[string]int{}
+	for _, event := range events {
+		patches[event.Patch]++
+	}
+	if len(events) != 4 || patches["+a"] != 1 || patches["+b"] != 1 || patches["+c"] != 1 || patches["+d"] != 1 {
+		t.Fatalf("expected every event of both devices once, got %+v", events)
+	}
+}
+
+func TestResubmittedEventsAreStoredOnce(t *testing.T) {
+	db := testDB(t)
+	// The way submissions store their diffs
+	diffs := resubmittedHistory()
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&diffs).Error; err != nil {
+		t.Fatal(err)
+	}
+	expectEachEventOnce(t, db)
+}
+
+func TestRemoveResubmittedEvents(t *testing.T) {
+	db := testDB(t)
+	// A database from before the index
+	if err := db.Migrator().DropIndex(&database.Diff{}, "idx_diffs_event"); err != nil {
+		t.Fatal(err)
+	}
+	diffs := resubmittedHistory()
+	if err := db.Create(&diffs).Error; err != nil {
+		t.Fatal(err)
+	}
+	flag := database.Flag{Text: "Typed too fast", DiffID: diffs[3].ID, Severity: 2, StudentAssignmentID: 1}
+	if err := db.Create(&flag).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RemoveResubmittedEvents(db); err != nil {
+		t.Fatal(err)
+	}
+	expectEachEventOnce(t, db)
+	if err := db.First(&flag, flag.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if flag.DiffID != diffs[1].ID {
+		t.Errorf("expected the flag moved to the kept copy %d, got %d", diffs[1].ID, flag.DiffID)
+	}
+	if err := db.AutoMigrate(&database.Diff{}); err != nil {
+		t.Fatalf("expected the index to be created after removing the copies: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"gorm.io/gorm"
+)
+
+type EvidenceImportRepository interface {
+	AddImport(evidenceImport domain.EvidenceImport) (domain.EvidenceImport, error)
+	IsImported(bundleSHA256 string) (bool, error)
+}
+
+type evidenceImportRepository struct {
+	db *gorm.DB
+}
+
+func NewEvidenceImportRepository(db *gorm.DB) EvidenceImportRepository {
+	return &evidenceImportRepository{db: db}
+}
+
+func (r *evidenceImportRepository) AddImport(e domain.EvidenceImport) (domain.EvidenceImport, error) {
+	dbImport := database.EvidenceImport{
+		StudentAssignmentID: e.StudentAssignmentID,
+		InstructorID:        e.InstructorID,
+		DeviceID:            e.DeviceID,
+		DevicePublicKey:     e.DevicePublicKey,
+		DeviceHostname:      e.DeviceHostname,
+		AgentVersion:        e.AgentVersion,
+		ChainHead:           e.ChainHead,
+		EventCount:          e.EventCount,
+		FileCount:           e.FileCount,
+		BundleSHA256:        e.BundleSHA256,
+		ExportedAt:          e.ExportedAt,
+	}
+	if err := r.db.Create(&dbImport).Error; err != nil {
+		return domain.EvidenceImport{}, err
+	}
+	e.ID = dbImport.ID
+	e.ImportedAt = dbImport.CreatedAt
+	return e, nil
+}
+
+// IsImported reports whether a bundle with the same content was imported before
+func (r *evidenceImportRepository) IsImported(bundleSHA256 string) (bool, error) {
+	var count int64
+	if err := r.db.Model(&database.EvidenceImport{}).
+		Where("bundle_sha256 = ?", bundleSHA256).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
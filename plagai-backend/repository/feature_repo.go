@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrFeatureDatabase = errors.New("database error while handling features")
+
+type FeatureRepository interface {
+	// SaveFeatures replaces the features of the student assignment
+	SaveFeatures(assignmentID uint, features domain.FeatureValues) error
+	// DeleteFeatures leaves the student assignment out of the class distributions
+	DeleteFeatures(studentAssignmentID uint) error
+	// GetClassFeatures returns the features of every measured student assignment of the assignment
+	GetClassFeatures(assignmentID uint) ([]domain.FeatureValues, error)
+}
+
+type featureRepository struct {
+	db *gorm.DB
+}
+
+func NewFeatureRepository(db *gorm.DB) FeatureRepository {
+	return &featureRepository{db: db}
+}
+
+func (r *featureRepository) SaveFeatures(assignmentID uint, features domain.FeatureValues) error {
+	dbFeatures := database.FeatureValues{
+		StudentAssignmentID: features.StudentAssignmentID,
+		AssignmentID:        assignmentID,
+		TypingSpeed:         features.Values[domain.FeatureTypingSpeed],
+		DeletionRatio:       features.Values[domain.FeatureDeletionRatio],
+		SessionCount:        features.Values[domain.FeatureSessionCount],
+		TimeOnTask:          features.Values[domain.FeatureTimeOnTask],
+	}
+	if err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "student_assignment_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "typing_speed", "deletion_ratio", "session_count", "time_on_task"}),
+	}).Create(&dbFeatures).Error; err != nil {
+		return ErrFeatureDatabase
+	}
+	return nil
+}
+
+func (r *featureRepository) DeleteFeatures(studentAssignmentID uint) error {
+	if err := r.db.Where("student_assignment_id = ?", studentAssignmentID).
+		Delete(&database.FeatureValues{}).Error; err != nil {
+		return ErrFeatureDatabase
+	}
+	return nil
+}
+
+func (r *featureRepository) GetClassFeatures(assignmentID uint) ([]domain.FeatureValues, error) {
+	var dbFeatures []database.FeatureValues
+	if err := r.db.
+		Joins("JOIN student_assignments sa ON sa.id = feature_values.student_assignment_id").
+		Where("feature_values.assignment_id = ? AND sa.deleted_at IS NULL", assignmentID).
+		Order("feature_values.student_assignment_id ASC").
+		Find(&dbFeatures).Error; err != nil {
+		return nil, ErrFeatureDatabase
+	}
+	features := make([]domain.FeatureValues, len(dbFeatures))
+	for i, f := range dbFeatures {
+		features[i] = domain.FeatureValues{
+			StudentAssignmentID: f.StudentAssignmentID,
+			Values: map[domain.Feature]float64{
+				domain.FeatureTypingSpeed:   f.TypingSpeed,
+				domain.FeatureDeletionRatio: f.DeletionRatio,
+				domain.FeatureSessionCount:  f.SessionCount,
+				domain.FeatureTimeOnTask:    f.TimeOnTask,
+			},
+		}
+	}
+	return features, nil
+}
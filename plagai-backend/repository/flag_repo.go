@@ -1,23 +1,39 @@
 package repository
 
 import (
+	"encoding/json"
 	"errors"
+	"maps"
 	"time"
 
 	"github.com/plagai/plagai-backend/models/database"
 	"github.com/plagai/plagai-backend/models/domain"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
 	ErrUnauthorized = errors.New("unauthorized access to classroom")
 	ErrDatabase     = errors.New("database error")
+	ErrFlagNotFound = errors.New("flag not found")
+	// ErrFlagVersionConflict is returned when another analysis stored a version of the flags
+	// after this one read the version it analysed
+	ErrFlagVersionConflict = errors.New("flags were superseded by another analysis")
 )
 
 type FlagRepository interface {
 	AddFlag(flag *domain.Flag, studentAssignmentID uint) error
 	FindByID(id uint) (*domain.Flag, error)
 	FindByStudentAssignmentID(studentAssignmentID uint) ([]domain.Flag, error)
+	// SupersedeFlags stores flags as the new version of the flags of the student assignment and
+	// archives the version before, both in one transaction. Decisions on flags raised again are
+	// taken over. Nothing is written when the flags are the same as before. readVersion is the
+	// analysis version the student assignment had before its events were loaded for the flags,
+	// ErrFlagVersionConflict is returned when another analysis wrote a version since.
+	SupersedeFlags(studentAssignmentID uint, readVersion uint, flags []domain.Flag) (domain.FlagVersionChanges, error)
+	// SetDecision records an instructor's decision on a flag that isn't archived, an undecided
+	// decision clears it
+	SetDecision(flagID uint, decision domain.FlagDecision, note string, decidedBy string) error
 	Delete(id uint) error
 }
 
@@ -44,7 +60,7 @@ func (r *flagRepository) FindByID(id uint) (*domain.Flag, error) {
 
 func (r *flagRepository) FindByStudentAssignmentID(studentAssignmentID uint) ([]domain.Flag, error) {
 	var dbFlags []database.Flag
-	if err := r.db.Where("student_assignment_id = ?", studentAssignmentID).Find(&dbFlags).Error; err != nil {
+	if err := r.db.Where("student_assignment_id = ? AND archived_at IS NULL", studentAssignmentID).Find(&dbFlags).Error; err != nil {
 		return nil, err
 	}
 	flags := make([]domain.Flag, len(dbFlags))
@@ -54,6 +70,146 @@ func (r *flagRepository) FindByStudentAssignmentID(studentAssignmentID uint) ([]
 	return flags, nil
 }
 
+func (r *flagRepository) SupersedeFlags(studentAssignmentID uint, readVersion uint, flags []domain.Flag) (domain.FlagVersionChanges, error) {
+	changes := domain.FlagVersionChanges{StudentAssignmentID: studentAssignmentID}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Analyses of the same student assignment write their versions one after the other
+		var sa database.StudentAssignment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sa, studentAssignmentID).Error; err != nil {
+			return err
+		}
+		// The flags of another analysis stored since may come from newer events than these
+		if sa.AnalysisVersion != readVersion {
+			return ErrFlagVersionConflict
+		}
+		var current []database.Flag
+		if err := tx.Preload("Diff").
+			Where("student_assignment_id = ? AND archived_at IS NULL", studentAssignmentID).
+			Order("id ASC").
+			Find(&current).Error; err != nil {
+			return err
+		}
+		changes.PreviousVersion = sa.AnalysisVersion
+
+		// A flag raised again is matched with the one before it to compare them and keep the decision
+		previous := make(map[string][]*domain.Flag)
+		for i := range current {
+			flag := toDomainFlag(&current[i])
+			previous[flag.Identity()] = append(previous[flag.Identity()], flag)
+		}
+		matched := make(map[uint]bool, len(current))
+		for i := range flags {
+			key := flags[i].Identity()
+			if len(previous[key]) == 0 {
+				changes.Added = append(changes.Added, flags[i])
+				continue
+			}
+			before := previous[key][0]
+			previous[key] = previous[key][1:]
+			matched[before.ID] = true
+			if before.Decision != domain.FlagUndecided {
+				flags[i].Decision, flags[i].DecisionNote = before.Decision, before.DecisionNote
+				flags[i].DecidedBy, flags[i].DecidedAt = before.DecidedBy, before.DecidedAt
+				changes.DecisionsKept++
+			}
+			if sameFlagResult(before, &flags[i]) {
+				changes.Unchanged++
+			} else {
+				changes.Changed = append(changes.Changed, domain.FlagChange{Previous: *before, Current: flags[i]})
+			}
+		}
+		for i := range current {
+			if !matched[current[i].ID] {
+				changes.Removed = append(changes.Removed, *toDomainFlag(&current[i]))
+			}
+		}
+		changes.Flags = len(flags)
+
+		// The stored version already says the same, another one would only grow the archive. Flags
+		// from before versioning are written again to get a version.
+		unchanged := len(changes.Added) == 0 && len(changes.Removed) == 0 && len(changes.Changed) == 0
+		if unchanged && (changes.PreviousVersion > 0 || len(current) == 0) {
+			changes.Version = changes.PreviousVersion
+			return nil
+		}
+		changes.Version = changes.PreviousVersion + 1
+
+		// Databases without row locks let another analysis in between, it keeps its results
+		bumped := tx.Model(&database.StudentAssignment{}).
+			Where("id = ? AND analysis_version = ?", studentAssignmentID, changes.PreviousVersion).
+			Update("analysis_version", changes.Version)
+		if bumped.Error != nil {
+			return bumped.Error
+		}
+		if bumped.RowsAffected != 1 {
+			return ErrFlagVersionConflict
+		}
+		if err := tx.Model(&database.Flag{}).
+			Where("student_assignment_id = ? AND archived_at IS NULL", studentAssignmentID).
+			Update("archived_at", time.Now()).Error; err != nil {
+			return err
+		}
+		for i := range flags {
+			flags[i].AnalysisVersion = changes.Version
+			dbFlag := toDBFlag(&flags[i], studentAssignmentID)
+			if err := tx.Create(&dbFlag).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.FlagVersionChanges{}, err
+	}
+	return changes, nil
+}
+
+func (r *flagRepository) SetDecision(flagID uint, decision domain.FlagDecision, note string, decidedBy string) error {
+	updates := map[string]any{
+		"decision":      string(decision),
+		"decision_note": note,
+		"decided_by":    decidedBy,
+		"decided_at":    time.Now(),
+	}
+	if decision == domain.FlagUndecided {
+		updates["decision_note"], updates["decided_by"], updates["decided_at"] = "", "", nil
+	}
+	result := r.db.Model(&database.Flag{}).
+		Where("id = ? AND archived_at IS NULL", flagID).
+		Updates(updates)
+	if result.Error != nil {
+		return ErrDatabase
+	}
+	if result.RowsAffected == 0 {
+		return ErrFlagNotFound
+	}
+	return nil
+}
+
+func sameFlagResult(a *domain.Flag, b *domain.Flag) bool {
+	return a.FlagExplanation == b.FlagExplanation &&
+		a.Severity == b.Severity &&
+		a.RuleVersion == b.RuleVersion &&
+		a.EngineVersion == b.EngineVersion &&
+		maps.Equal(a.RuleParams, b.RuleParams) &&
+		sameReference(a.Reference, b.Reference) &&
+		sameBaseline(a.Baseline, b.Baseline)
+}
+
+func sameBaseline(a *domain.ClassBaseline, b *domain.ClassBaseline) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameReference(a *domain.CorpusReference, b *domain.CorpusReference) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 func (r *flagRepository) Delete(id uint) error {
 	return r.db.Delete(&database.Flag{}, id).Error
 }
@@ -138,29 +294,90 @@ func (r *flagRepository) GetFlagsForClassroom(section uint, homeworkNum uint, in
 */
 
 func toDBFlag(flag *domain.Flag, studentAssignmentID uint) database.Flag {
-	return database.Flag{
-		ID:   0, // GORM will auto-generate
-		Text: flag.FlagExplanation,
-		Diff: database.Diff{
-			StudentAssignmentID: studentAssignmentID,
-			FilePath:            flag.Diff.FilePath,
-			DiffData:            flag.Diff.PatchText,
-		},
+	var params string
+	if len(flag.RuleParams) > 0 {
+		encoded, _ := json.Marshal(flag.RuleParams)
+		params = string(encoded)
+	}
+	dbFlag := database.Flag{
+		ID:                  0, // GORM will auto-generate
+		Text:                flag.FlagExplanation,
 		Severity:            uint(flag.Severity),
 		StudentAssignmentID: studentAssignmentID,
 		CreatedAt:           time.Now(),
+		RuleID:              flag.RuleID,
+		RuleParams:          params,
+		RuleVersion:         flag.RuleVersion,
+		EngineVersion:       flag.EngineVersion,
+		AnalysisVersion:     flag.AnalysisVersion,
+		ArchivedAt:          flag.ArchivedAt,
+		Decision:            string(flag.Decision),
+		DecisionNote:        flag.DecisionNote,
+		DecidedBy:           flag.DecidedBy,
+		DecidedAt:           flag.DecidedAt,
 	}
+	if flag.Baseline != nil {
+		encoded, _ := json.Marshal(flag.Baseline)
+		dbFlag.Baseline = string(encoded)
+	}
+	if flag.Reference != nil {
+		dbFlag.CorpusDocumentID = &flag.Reference.DocumentID
+		dbFlag.CorpusStartLine, dbFlag.CorpusEndLine = flag.Reference.StartLine, flag.Reference.EndLine
+	}
+	if flag.Diff.ID != 0 {
+		// The flagged edit is stored already
+		dbFlag.DiffID = flag.Diff.ID
+		return dbFlag
+	}
+	dbFlag.Diff = database.Diff{
+		StudentAssignmentID: studentAssignmentID,
+		FilePath:            flag.Diff.FilePath,
+		DiffData:            flag.Diff.PatchText,
+	}
+	return dbFlag
 }
 
 func toDomainFlag(dbFlag *database.Flag) *domain.Flag {
-	return &domain.Flag{
+	var params domain.RuleParams
+	if dbFlag.RuleParams != "" {
+		_ = json.Unmarshal([]byte(dbFlag.RuleParams), &params)
+	}
+	flag := &domain.Flag{
 		ID: dbFlag.ID,
 		Diff: domain.Diff{
+			ID:        dbFlag.DiffID,
 			FilePath:  dbFlag.Diff.FilePath,
 			PatchText: dbFlag.Diff.DiffData,
 			Timestamp: dbFlag.Diff.CreatedAt,
+			Seq:       dbFlag.Diff.Seq,
+			MonoMs:    dbFlag.Diff.MonoMs,
+			SessionID: dbFlag.Diff.SessionID,
 		},
 		FlagExplanation: dbFlag.Text,
 		Severity:        int(dbFlag.Severity),
+		RuleID:          dbFlag.RuleID,
+		RuleParams:      params,
+		RuleVersion:     dbFlag.RuleVersion,
+		EngineVersion:   dbFlag.EngineVersion,
+		AnalysisVersion: dbFlag.AnalysisVersion,
+		ArchivedAt:      dbFlag.ArchivedAt,
+		Decision:        domain.FlagDecision(dbFlag.Decision),
+		DecisionNote:    dbFlag.DecisionNote,
+		DecidedBy:       dbFlag.DecidedBy,
+		DecidedAt:       dbFlag.DecidedAt,
+	}
+	if dbFlag.CorpusDocumentID != nil {
+		flag.Reference = &domain.CorpusReference{
+			DocumentID: *dbFlag.CorpusDocumentID,
+			StartLine:  dbFlag.CorpusStartLine,
+			EndLine:    dbFlag.CorpusEndLine,
+		}
+	}
+	if dbFlag.Baseline != "" {
+		var baseline domain.ClassBaseline
+		if err := json.Unmarshal([]byte(dbFlag.Baseline), &baseline); err == nil {
+			flag.Baseline = &baseline
+		}
 	}
+	return flag
 }
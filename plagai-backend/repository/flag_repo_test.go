@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+func TestSupersedeFlagsTwiceKeepsOneVersionAndDecisions(t *testing.T) {
+	db := testDB(t)
+	sa := database.StudentAssignment{StudentID: 1, AssignmentID: 1}
+	if err := db.Create(&sa).Error; err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	diffs := []database.Diff{
+		{StudentAssignmentID: sa.ID, FilePath: "/hw/main.go", DiffData: "+a", EventType: "modified", Seq: 1, SessionID: "s", CreatedAt: start},
+		{StudentAssignmentID: sa.ID, FilePath: "/hw/main.go", DiffData: "+b", EventType: "modified", Seq: 2, SessionID: "s", CreatedAt: start.Add(time.Minute)},
+	}
+	if err := db.Create(&diffs).Error; err != nil {
+		t.Fatal(err)
+	}
+	// The results of one analysis, every run builds them anew
+	results := func(severity int) []domain.Flag {
+		flags := make([]domain.Flag, len(diffs))
+		for i, d := range diffs {
+			flags[i] = domain.Flag{
+				Diff:            domain.Diff{ID: d.ID, FilePath: d.FilePath, PatchText: d.DiffData, Seq: d.Seq, SessionID: d.SessionID},
+				FlagExplanation: "Typed too fast",
+				Severity:        severity,
+				RuleID:          "typing_speed",
+				RuleVersion:     1,
+			}
+		}
+		return flags
+	}
+	repo := NewFlagRepository(db)
+	liveFlags := func() []domain.Flag {
+		flags, err := repo.FindByStudentAssignmentID(sa.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return flags
+	}
+
+	if _, err := repo.SupersedeFlags(sa.ID, 0, results(2)); err != nil {
+		t.Fatal(err)
+	}
+	decided := liveFlags()[0]
+	if err := repo.SetDecision(decided.ID, domain.FlagDismissed, "pasted from the lecture", "instructor@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two jobs of the same submission that read version 1 storing the same new results
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = repo.SupersedeFlags(sa.ID, 1, results(3))
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil && err != ErrFlagVersionConflict {
+			t.Fatal(err)
+		}
+	}
+	changes, err := repo.SupersedeFlags(sa.ID, 2, results(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Version != 2 || len(changes.Changed) != 0 || len(changes.Added) != 0 {
+		t.Errorf("expected the same results to keep version 2, got %+v", changes)
+	}
+
+	live := liveFlags()
+	if len(live) != len(diffs) {
+		t.Fatalf("expected one live set of %d flags, got %d", len(diffs), len(live))
+	}
+	kept := 0
+	for _, flag := range live {
+		if flag.AnalysisVersion != 2 || flag.Severity != 3 {
+			t.Errorf("expected live flags of version 2 with severity 3, got %+v", flag)
+		}
+		if flag.Diff.ID == decided.Diff.ID {
+			kept++
+			if flag.Decision != domain.FlagDismissed || flag.DecisionNote != "pasted from the lecture" {
+				t.Errorf("expected the decision to be kept, got %q %q", flag.Decision, flag.DecisionNote)
+			}
+		}
+	}
+	if kept != 1 {
+		t.Errorf("expected the decided flag once, got %d", kept)
+	}
+	var archived int64
+	db.Model(&database.Flag{}).Where("archived_at IS NOT NULL").Count(&archived)
+	if archived != int64(len(diffs)) {
+		t.Errorf("expected the first version archived, got %d archived flags", archived)
+	}
+}
+
+func TestSupersedeFlagsRefusesStaleVersion(t *testing.T) {
+	db := testDB(t)
+	sa := database.StudentAssignment{StudentID: 1, AssignmentID: 1}
+	if err := db.Create(&sa).Error; err != nil {
+		t.Fatal(err)
+	}
+	repo := NewFlagRepository(db)
+	flag := func(text string) []domain.Flag {
+		return []domain.Flag{{Diff: domain.Diff{FilePath: "/hw"}, FlagExplanation: text, Severity: 1, RuleID: "final_snapshot"}}
+	}
+	if _, err := repo.SupersedeFlags(sa.ID, 0, flag("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// One analysis reads version 1 and loads the events, another one loads newer events and
+	// stores its flags before the first one gets to store its own
+	if _, err := repo.SupersedeFlags(sa.ID, 1, flag("newer events")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SupersedeFlags(sa.ID, 1, flag("older events")); err != ErrFlagVersionConflict {
+		t.Fatalf("expected a version conflict, got %v", err)
+	}
+	live, _ := repo.FindByStudentAssignmentID(sa.ID)
+	if len(live) != 1 || live[0].FlagExplanation != "newer events" || live[0].AnalysisVersion != 2 {
+		t.Errorf("expected the flags of the newer events to stay live, got %+v", live)
+	}
+}
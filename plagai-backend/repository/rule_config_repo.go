@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"gorm.io/gorm"
+)
+
+var ErrRuleConfigDatabase = errors.New("database error while handling rule configurations")
+
+type RuleConfigRepository interface {
+	// GetRuleConfigs returns the rule configurations of the assignment ordered by rule ID
+	GetRuleConfigs(assignmentID uint) ([]domain.RuleConfig, error)
+	// SaveRuleConfig creates or replaces the configuration of the rule for the assignment
+	SaveRuleConfig(config domain.RuleConfig) (domain.RuleConfig, error)
+	// DeleteRuleConfig resets the rule to its defaults for the assignment
+	DeleteRuleConfig(assignmentID uint, ruleID string) error
+}
+
+type ruleConfigRepository struct {
+	db *gorm.DB
+}
+
+func NewRuleConfigRepository(db *gorm.DB) RuleConfigRepository {
+	return &ruleConfigRepository{db: db}
+}
+
+func (r *ruleConfigRepository) GetRuleConfigs(assignmentID uint) ([]domain.RuleConfig, error) {
+	var dbConfigs []database.RuleConfig
+	if err := r.db.
+		Where("assignment_id = ?", assignmentID).
+		Order("rule_id ASC").
+		Find(&dbConfigs).Error; err != nil {
+		return nil, ErrRuleConfigDatabase
+	}
+	configs := make([]domain.RuleConfig, len(dbConfigs))
+	for i := range dbConfigs {
+		configs[i] = toDomainRuleConfig(&dbConfigs[i])
+	}
+	return configs, nil
+}
+
+func (r *ruleConfigRepository) SaveRuleConfig(config domain.RuleConfig) (domain.RuleConfig, error) {
+	params, err := json.Marshal(config.Params)
+	if err != nil {
+		return domain.RuleConfig{}, err
+	}
+	var dbConfig database.RuleConfig
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("assignment_id = ? AND rule_id = ?", config.AssignmentID, config.RuleID).
+			FirstOrInit(&dbConfig).Error; err != nil {
+			return err
+		}
+		dbConfig.AssignmentID = config.AssignmentID
+		dbConfig.RuleID = config.RuleID
+		dbConfig.Enabled = config.Enabled
+		dbConfig.Params = string(params)
+		return tx.Save(&dbConfig).Error
+	})
+	if err != nil {
+		return domain.RuleConfig{}, ErrRuleConfigDatabase
+	}
+	return toDomainRuleConfig(&dbConfig), nil
+}
+
+func (r *ruleConfigRepository) DeleteRuleConfig(assignmentID uint, ruleID string) error {
+	// Unscoped, a soft deleted row would keep the rule from being configured again
+	if err := r.db.Unscoped().
+		Where("assignment_id = ? AND rule_id = ?", assignmentID, ruleID).
+		Delete(&database.RuleConfig{}).Error; err != nil {
+		return ErrRuleConfigDatabase
+	}
+	return nil
+}
+
+func toDomainRuleConfig(dbConfig *database.RuleConfig) domain.RuleConfig {
+	config := domain.RuleConfig{
+		ID:           dbConfig.ID,
+		AssignmentID: dbConfig.AssignmentID,
+		RuleID:       dbConfig.RuleID,
+		Enabled:      dbConfig.Enabled,
+	}
+	if dbConfig.Params != "" {
+		if err := json.Unmarshal([]byte(dbConfig.Params), &config.Params); err != nil {
+			log.Printf("ignoring unreadable parameters of rule %s for assignment %d: %v",
+				dbConfig.RuleID, dbConfig.AssignmentID, err)
+		}
+	}
+	return config
+}
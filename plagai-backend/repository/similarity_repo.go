@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrSimilarityDatabase = errors.New("database error while handling similarity")
+
+type SimilarityRepository interface {
+	// ReplaceFingerprints makes fingerprints the only fingerprints of the student assignment
+	ReplaceFingerprints(studentAssignmentID uint, fingerprints []domain.Fingerprint) error
+	// GetFingerprints returns the fingerprints of every student assignment of the assignment, by
+	// student assignment ID
+	GetFingerprints(assignmentID uint) (map[uint][]domain.Fingerprint, error)
+	// ReplacePairs makes pairs, seen from the student assignment, its only pairs. It returns the
+	// other student assignments whose pair with it was added, removed or changed.
+	ReplacePairs(assignmentID uint, studentAssignmentID uint, pairs []domain.SimilarityPair) ([]uint, error)
+	// GetPairs returns the pairs of the assignment scoring at least minScore, most similar first
+	GetPairs(assignmentID uint, minScore float64) ([]domain.SimilarityPair, error)
+	// GetPairsOf returns the pairs of the student assignment seen from it, with the email of the
+	// other student, most similar first
+	GetPairsOf(studentAssignmentID uint) ([]domain.SimilarityPair, error)
+}
+
+type similarityRepository struct {
+	db *gorm.DB
+}
+
+func NewSimilarityRepository(db *gorm.DB) SimilarityRepository {
+	return &similarityRepository{db: db}
+}
+
+func (r *similarityRepository) ReplaceFingerprints(studentAssignmentID uint, fingerprints []domain.Fingerprint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("student_assignment_id = ?", studentAssignmentID).
+			Delete(&database.Fingerprint{}).Error; err != nil {
+			return err
+		}
+		if len(fingerprints) == 0 {
+			return nil
+		}
+		dbFingerprints := make([]database.Fingerprint, len(fingerprints))
+		for i, f := range fingerprints {
+			dbFingerprints[i] = database.Fingerprint{
+				StudentAssignmentID: studentAssignmentID,
+				FilePath:            f.FilePath,
+				Hash:                int64(f.Hash),
+				StartLine:           f.StartLine,
+				EndLine:             f.EndLine,
+			}
+		}
+		return tx.CreateInBatches(dbFingerprints, 1000).Error
+	})
+	if err != nil {
+		return ErrSimilarityDatabase
+	}
+	return nil
+}
+
+func (r *similarityRepository) GetFingerprints(assignmentID uint) (map[uint][]domain.Fingerprint, error) {
+	var dbFingerprints []database.Fingerprint
+	if err := r.db.
+		Joins("JOIN student_assignments sa ON sa.id = fingerprints.student_assignment_id").
+		Where("sa.assignment_id = ? AND sa.deleted_at IS NULL", assignmentID).
+		Order("fingerprints.id ASC").
+		Find(&dbFingerprints).Error; err != nil {
+		return nil, ErrSimilarityDatabase
+	}
+	fingerprints := make(map[uint][]domain.Fingerprint)
+	for _, f := range dbFingerprints {
+		fingerprints[f.StudentAssignmentID] = append(fingerprints[f.StudentAssignmentID], domain.Fingerprint{
+			FilePath:  f.FilePath,
+			Hash:      uint64(f.Hash),
+			StartLine: f.StartLine,
+			EndLine:   f.EndLine,
+		})
+	}
+	return fingerprints, nil
+}
+
+func (r *similarityRepository) ReplacePairs(assignmentID uint, studentAssignmentID uint, pairs []domain.SimilarityPair) ([]uint, error) {
+	var changed []uint
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var existing []database.SimilarityPair
+		if err := tx.Where("student_assignment_a_id = ? OR student_assignment_b_id = ?", studentAssignmentID, studentAssignmentID).
+			Find(&existing).Error; err != nil {
+			return err
+		}
+		previous := make(map[uint]database.SimilarityPair, len(existing))
+		for _, p := range existing {
+			other := p.StudentAssignmentAID
+			if other == studentAssignmentID {
+				other = p.StudentAssignmentBID
+			}
+			previous[other] = p
+		}
+
+		current := make(map[uint]bool, len(pairs))
+		for _, pair := range pairs {
+			current[pair.OtherStudentAssignmentID] = true
+			dbPair, err := toDBSimilarityPair(assignmentID, studentAssignmentID, pair)
+			if err != nil {
+				return err
+			}
+			if old, ok := previous[pair.OtherStudentAssignmentID]; !ok ||
+				old.Score != dbPair.Score || old.SharedFingerprints != dbPair.SharedFingerprints {
+				changed = append(changed, pair.OtherStudentAssignmentID)
+			}
+			// The other student assignment may have stored the pair since it was loaded
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "student_assignment_a_id"}, {Name: "student_assignment_b_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"updated_at", "score", "shared_fingerprints", "regions"}),
+			}).Create(&dbPair).Error; err != nil {
+				return err
+			}
+		}
+		for other, old := range previous {
+			if current[other] {
+				continue
+			}
+			changed = append(changed, other)
+			if err := tx.Delete(&database.SimilarityPair{}, old.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, ErrSimilarityDatabase
+	}
+	slices.Sort(changed)
+	return changed, nil
+}
+
+func (r *similarityRepository) GetPairs(assignmentID uint, minScore float64) ([]domain.SimilarityPair, error) {
+	var dbPairs []database.SimilarityPair
+	if err := r.db.
+		Where("assignment_id = ? AND score >= ?", assignmentID, minScore).
+		Order("score DESC, shared_fingerprints DESC, id ASC").
+		Find(&dbPairs).Error; err != nil {
+		return nil, ErrSimilarityDatabase
+	}
+	pairs := make([]domain.SimilarityPair, len(dbPairs))
+	for i := range dbPairs {
+		pairs[i] = toDomainSimilarityPair(&dbPairs[i])
+	}
+	return pairs, nil
+}
+
+func (r *similarityRepository) GetPairsOf(studentAssignmentID uint) ([]domain.SimilarityPair, error) {
+	var dbPairs []database.SimilarityPair
+	if err := r.db.
+		Where("student_assignment_a_id = ? OR student_assignment_b_id = ?", studentAssignmentID, studentAssignmentID).
+		Order("score DESC, id ASC").
+		Find(&dbPairs).Error; err != nil {
+		return nil, ErrSimilarityDatabase
+	}
+
+	others := make([]uint, 0, len(dbPairs))
+	pairs := make([]domain.SimilarityPair, 0, len(dbPairs))
+	for i := range dbPairs {
+		pair := toDomainSimilarityPair(&dbPairs[i])
+		if pair.StudentAssignmentID != studentAssignmentID {
+			pair = pair.Swapped()
+		}
+		others = append(others, pair.OtherStudentAssignmentID)
+		pairs = append(pairs, pair)
+	}
+	if len(others) == 0 {
+		return pairs, nil
+	}
+
+	type row struct {
+		StudentAssignmentID uint
+		Email               string
+	}
+	var rows []row
+	if err := r.db.Table("student_assignments sa").
+		Select("sa.id AS student_assignment_id, s.email AS email").
+		Joins("JOIN students s ON s.id = sa.student_id").
+		Where("sa.id IN ? AND sa.deleted_at IS NULL", others).
+		Scan(&rows).Error; err != nil {
+		return nil, ErrSimilarityDatabase
+	}
+	emails := make(map[uint]string, len(rows))
+	for _, row := range rows {
+		emails[row.StudentAssignmentID] = row.Email
+	}
+	// Pairs with student assignments deleted since are left out
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		if email, ok := emails[pair.OtherStudentAssignmentID]; ok {
+			pair.OtherStudent = email
+			kept = append(kept, pair)
+		}
+	}
+	return kept, nil
+}
+
+// toDBSimilarityPair stores the pair with the smaller student assignment ID first
+func toDBSimilarityPair(assignmentID uint, studentAssignmentID uint, pair domain.SimilarityPair) (database.SimilarityPair, error) {
+	pair.StudentAssignmentID = studentAssignmentID
+	if pair.OtherStudentAssignmentID < pair.StudentAssignmentID {
+		pair = pair.Swapped()
+	}
+	regions, err := json.Marshal(pair.Regions)
+	if err != nil {
+		return database.SimilarityPair{}, err
+	}
+	return database.SimilarityPair{
+		AssignmentID:         assignmentID,
+		StudentAssignmentAID: pair.StudentAssignmentID,
+		StudentAssignmentBID: pair.OtherStudentAssignmentID,
+		Score:                pair.Score,
+		SharedFingerprints:   pair.SharedFingerprints,
+		Regions:              string(regions),
+	}, nil
+}
+
+func toDomainSimilarityPair(p *database.SimilarityPair) domain.SimilarityPair {
+	var regions []domain.MatchedRegion
+	_ = json.Unmarshal([]byte(p.Regions), &regions)
+	return domain.SimilarityPair{
+		ID:                       p.ID,
+		AssignmentID:             p.AssignmentID,
+		StudentAssignmentID:      p.StudentAssignmentAID,
+		OtherStudentAssignmentID: p.StudentAssignmentBID,
+		Score:                    p.Score,
+		SharedFingerprints:       p.SharedFingerprints,
+		Regions:                  regions,
+	}
+}
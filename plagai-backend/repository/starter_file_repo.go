@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"gorm.io/gorm"
+)
+
+var ErrStarterFileDatabase = errors.New("database error while handling starter files")
+
+type StarterFileRepository interface {
+	// ReplaceStarterFiles makes files the only starter files of the assignment
+	ReplaceStarterFiles(assignmentID uint, files []domain.StarterFile) error
+	GetStarterFiles(assignmentID uint) ([]domain.StarterFile, error)
+}
+
+type starterFileRepository struct {
+	db *gorm.DB
+}
+
+func NewStarterFileRepository(db *gorm.DB) StarterFileRepository {
+	return &starterFileRepository{db: db}
+}
+
+func (r *starterFileRepository) ReplaceStarterFiles(assignmentID uint, files []domain.StarterFile) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("assignment_id = ?", assignmentID).
+			Delete(&database.StarterFile{}).Error; err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		dbFiles := make([]database.StarterFile, len(files))
+		for i, f := range files {
+			dbFiles[i] = database.StarterFile{
+				AssignmentID: assignmentID,
+				Path:         f.Path,
+				Content:      f.Content,
+				SHA256:       f.SHA256,
+			}
+		}
+		return tx.CreateInBatches(&dbFiles, 100).Error
+	})
+}
+
+// GetStarterFiles returns the starter files of the assignment ordered by path
+func (r *starterFileRepository) GetStarterFiles(assignmentID uint) ([]domain.StarterFile, error) {
+	var dbFiles []database.StarterFile
+	if err := r.db.
+		Where("assignment_id = ?", assignmentID).
+		Order("path ASC").
+		Find(&dbFiles).Error; err != nil {
+		return nil, ErrStarterFileDatabase
+	}
+	files := make([]domain.StarterFile, len(dbFiles))
+	for i, f := range dbFiles {
+		files[i] = domain.StarterFile{
+			ID:           f.ID,
+			AssignmentID: f.AssignmentID,
+			Path:         f.Path,
+			Content:      f.Content,
+			SHA256:       f.SHA256,
+		}
+	}
+	return files, nil
+}
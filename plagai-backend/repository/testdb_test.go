@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB returns an empty in-memory database with the tables repositories use
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// Every connection to an in-memory database gets a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&database.Classroom{}, &database.Instructor{}, &database.Student{}, &database.Assignment{},
+		&database.StudentAssignment{}, &database.Diff{}, &database.TrackingEvent{}, &database.Flag{},
+		&database.SubmissionSnapshot{}, &database.CorpusDocument{}, &database.AnalysisJob{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
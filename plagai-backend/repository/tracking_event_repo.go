@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/models/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTrackingEventDatabase = errors.New("database error while handling tracking events")
+
+type TrackingEventRepository interface {
+	AddEvents(studentAssignmentID uint, events []domain.TrackingEvent) error
+	GetEvents(studentAssignmentID uint) ([]domain.TrackingEvent, error)
+}
+
+type trackingEventRepository struct {
+	db *gorm.DB
+}
+
+func NewTrackingEventRepository(db *gorm.DB) TrackingEventRepository {
+	return &trackingEventRepository{db: db}
+}
+
+func (r *trackingEventRepository) AddEvents(studentAssignmentID uint, events []domain.TrackingEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	dbEvents := make([]database.TrackingEvent, len(events))
+	for i, e := range events {
+		dbEvents[i] = database.TrackingEvent{
+			StudentAssignmentID: studentAssignmentID,
+			EventType:           e.EventType,
+			Detail:              e.Detail,
+			OccurredAt:          e.OccurredAt,
+			Seq:                 e.Seq,
+			FilePath:            e.FilePath,
+			MonoMs:              e.MonoMs,
+			SessionID:           e.SessionID,
+		}
+	}
+	// Events the agent submitted before are already stored
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&dbEvents, 200).Error
+}
+
+// GetEvents returns the tracking events of a student assignment ordered by the time they happened
+func (r *trackingEventRepository) GetEvents(studentAssignmentID uint) ([]domain.TrackingEvent, error) {
+	var dbEvents []database.TrackingEvent
+	if err := r.db.
+		Where("student_assignment_id = ?", studentAssignmentID).
+		Order("occurred_at ASC, id ASC").
+		Find(&dbEvents).Error; err != nil {
+		return nil, ErrTrackingEventDatabase
+	}
+	events := make([]domain.TrackingEvent, len(dbEvents))
+	for i, e := range dbEvents {
+		events[i] = domain.TrackingEvent{
+			ID:         e.ID,
+			EventType:  e.EventType,
+			Detail:     e.Detail,
+			OccurredAt: e.OccurredAt,
+			Seq:        e.Seq,
+			FilePath:   e.FilePath,
+			MonoMs:     e.MonoMs,
+			SessionID:  e.SessionID,
+		}
+	}
+	return events, nil
+}
@@ -16,9 +16,11 @@ import (
 	"gorm.io/gorm/logger"
 
 	// internal packages
+	"github.com/plagai/plagai-backend/analysis"
 	"github.com/plagai/plagai-backend/api/routeHandles"
 	"github.com/plagai/plagai-backend/middleware"
 	"github.com/plagai/plagai-backend/models/database"
+	"github.com/plagai/plagai-backend/repository"
 )
 
 func Start() {
@@ -44,7 +46,13 @@ func Start() {
 	fmt.Println("Successfully connected to Neon Postgres database!")
 	// Auto-migrate the schema
 	if os.Getenv("ENV") != "DEV" {
-		err = db.AutoMigrate(&database.Assignment{}, &database.Classroom{}, &database.Diff{}, &database.Flag{}, &database.Instructor{}, &database.Student{}, &database.StudentAssignment{})
+		if err := repository.RemoveResubmittedEvents(db); err != nil {
+			log.Fatalf("Failed to remove resubmitted events: %v", err)
+		}
+		if err := repository.RemoveDuplicatePendingJobs(db); err != nil {
+			log.Fatalf("Failed to remove duplicate analysis jobs: %v", err)
+		}
+		err = db.AutoMigrate(&database.Assignment{}, &database.Classroom{}, &database.Diff{}, &database.Flag{}, &database.Instructor{}, &database.Student{}, &database.StudentAssignment{}, &database.TrackingEvent{}, &database.EvidenceImport{}, &database.StarterFile{}, &database.RuleConfig{}, &database.AnalysisJob{}, &database.SubmissionSnapshot{}, &database.Fingerprint{}, &database.SimilarityPair{}, &database.CorpusDocument{}, &database.FeatureValues{}, &database.DeviceKey{})
 		if err != nil {
 			log.Fatalf("Failed to migrate database: %v", err)
 		}
@@ -54,6 +62,9 @@ func Start() {
 	// dbscripts.HashPasswords(db)
 	// dbscripts.Populate(db)
 
+	// Submissions are flagged in the background for as long as the server runs
+	analysis.NewPool(db, analysis.SettingsFromEnv()).Start(make(chan struct{}))
+
 	h := &routeHandles.Handler{DB: db}
 
 	r := mux.NewRouter()
@@ -68,12 +79,16 @@ func Start() {
 	protected := api.PathPrefix("").Subrouter()
 	protected.Use(middleware.AuthMiddleware)
 	protected.HandleFunc("/health", routeHandles.HealthCheck).Methods("GET")
-	protected.HandleFunc("/submit", h.SubmitHandler).Methods("POST")
+	protected.Handle("/submit", middleware.RequireAgentVersion(http.HandlerFunc(h.SubmitHandler))).Methods("POST")
 	protected.HandleFunc("/assignments", h.SendAssignments).Methods("GET")
+	protected.HandleFunc("/starter", h.SendStarterFiles).Methods("GET")
+	protected.HandleFunc("/devices", h.RegisterDeviceKey).Methods("POST")
 
 	// Currently giving a JWT token timed out error and will ask brtcrt about it later
 	// protected.Use(middleware.AuthMiddleware)
 	protected.HandleFunc("/detections", h.SendDetections).Methods("GET")
+	protected.HandleFunc("/flags/reevaluate", h.ReevaluateFlags).Methods("POST")
+	protected.HandleFunc("/flags/decision", h.SaveFlagDecision).Methods("PUT")
 	protected.HandleFunc("/sections", h.SendSections).Methods("GET")
 	protected.HandleFunc("/homeworks", h.SendHomeworks).Methods("GET")
 	protected.HandleFunc("/section", h.SendSectionDetails).Methods("GET")
@@ -82,6 +97,22 @@ func Start() {
 	protected.HandleFunc("/build_file", h.BuildFile).Methods("GET")
 	protected.HandleFunc("/homework/students", h.ListHomeworkStudents).Methods("GET")
 	protected.HandleFunc("/homework/files", h.ListStudentFiles).Methods("GET")
+	protected.HandleFunc("/homework/coverage", h.SendCoverage).Methods("GET")
+	protected.HandleFunc("/homework/analysis", h.SendAnalysisStatus).Methods("GET")
+	protected.HandleFunc("/homework/sessions", h.SendWorkSessions).Methods("GET")
+	protected.HandleFunc("/homework/similarity", h.SendSimilarityPairs).Methods("GET")
+	protected.HandleFunc("/homework/statistics", h.SendClassStatistics).Methods("GET")
+	protected.HandleFunc("/homework/import", h.ImportEvidence).Methods("POST")
+	protected.HandleFunc("/homework/starter", h.UploadStarterFiles).Methods("POST")
+	protected.HandleFunc("/homework/corpus", h.SendCorpusDocuments).Methods("GET")
+	protected.HandleFunc("/homework/corpus", h.UploadCorpusDocument).Methods("POST")
+	protected.HandleFunc("/homework/corpus", h.DeleteCorpusDocument).Methods("DELETE")
+	protected.HandleFunc("/homework/corpus/document", h.SendCorpusDocument).Methods("GET")
+	protected.HandleFunc("/rules", h.SendRuleRegistry).Methods("GET")
+	protected.HandleFunc("/homework/rules", h.SendRuleConfigs).Methods("GET")
+	protected.HandleFunc("/homework/rules", h.SaveRuleConfig).Methods("PUT")
+	protected.HandleFunc("/homework/rules", h.DeleteRuleConfig).Methods("DELETE")
+	protected.HandleFunc("/homework/rules/simulate", h.SimulateRuleConfigs).Methods("POST")
 	// What is this?
 	/*
 		In very simple terms, this is a method of disallowing cross origin request forgery. What this should
@@ -95,7 +126,7 @@ func Start() {
 	// 2 months later and I still have no clue how this works. I just added these in the server manually
 	// and it decided to work so now I am too scared to change it. ~brtcrt
 	allowedOrigins := []string{"http://localhost:3000", "http://127.0.0.1:3000", "http://13.51.70.165:3000", "http://plaggy.xyz", "/"}
-	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "X-CSRF-Token"})
+	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "X-CSRF-Token", middleware.AgentVersionHeader})
 	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"})
 	headersExposed := handlers.ExposedHeaders([]string{"X-Total-Count", "X-Page", "X-Limit", "X-Has-More", "X-Next-Page", "token"})
 
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/plagai/plagai-backend/models"
+)
+
+// VerifyBulkOperations clears EventMeta.BulkOperation on every event whose bulk operation the
+// submission doesn't describe. It returns the described operations by ID and how many events
+// were cleared.
+func VerifyBulkOperations(events []models.EditEvent) (map[string]models.BulkOperation, int) {
+	operations := make(map[string]models.BulkOperation)
+	for _, e := range events {
+		if e.EventType != models.APIEventBulkOperation {
+			continue
+		}
+		var op models.BulkOperation
+		if err := json.Unmarshal([]byte(e.Patch), &op); err != nil || op.ID == "" {
+			log.Printf("ignoring unreadable bulk operation event %d: %v", e.Seq, err)
+			continue
+		}
+		operations[op.ID] = op
+	}
+
+	cleared := 0
+	for i, e := range events {
+		id := e.BulkOperationID()
+		if id == "" {
+			continue
+		}
+		if _, ok := operations[id]; ok {
+			continue
+		}
+		meta := *e.Meta
+		meta.BulkOperation = ""
+		events[i].Meta = &meta
+		cleared++
+	}
+	return operations, cleared
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// DefaultHeartbeatInterval is assumed when the agent didn't say how often it sends heartbeats
+const DefaultHeartbeatInterval = 5 * time.Minute
+
+// A heartbeat may be this many intervals late before we consider tracking to have stopped
+const heartbeatTolerance = 2.5
+
+// CoverageWindow is a period during which the agent daemon was running and watching the assignment
+type CoverageWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// CoverageGap is a period during which edits may have happened without being tracked
+type CoverageGap struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason"`
+}
+
+type Coverage struct {
+	Windows        []CoverageWindow `json:"windows"`
+	Gaps           []CoverageGap    `json:"gaps"`
+	TrackedSeconds float64          `json:"trackedSeconds"`
+}
+
+// ComputeCoverage turns the lifecycle events and edits of a student assignment into the windows
+// where tracking was active and the gaps in between.
+//
+// A window is only opened by a heartbeat or a file edit, the events that show the daemon was
+// watching the files. Markers like baselines, git or bulk operations and snapshots don't. It is
+// closed by a stop or unwatch event, or when heartbeats stop arriving for too long.
+// Overflows are reported as zero length gaps since events were lost even though the daemon ran.
+// A pause closes the window until the matching resume, with the student's reason on the gap.
+func ComputeCoverage(events []domain.TrackingEvent) Coverage {
+	sorted := make([]domain.TrackingEvent, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].OccurredAt.Before(sorted[j].OccurredAt)
+	})
+
+	coverage := Coverage{Windows: []CoverageWindow{}, Gaps: []CoverageGap{}}
+	open := false
+	// lastSeen is the last heartbeat or edit of the open window, closedAt when the last window
+	// closed and gapReason why
+	var windowStart, lastSeen, closedAt time.Time
+	gapReason := ""
+	// Heartbeats during a pause don't mean tracking
+	paused := false
+	interval := DefaultHeartbeatInterval
+
+	closeWindow := func(end time.Time, reason string) {
+		coverage.Windows = append(coverage.Windows, CoverageWindow{Start: windowStart, End: end})
+		coverage.TrackedSeconds += end.Sub(windowStart).Seconds()
+		open = false
+		closedAt, gapReason = end, reason
+	}
+
+	for _, event := range sorted {
+		if d, ok := heartbeatIntervalFromDetail(event.Detail); ok {
+			interval = d
+		}
+		maxSilence := time.Duration(float64(interval) * heartbeatTolerance)
+
+		// The daemon keeps running while paused, the gap lasts until tracking resumes or the
+		// directory is watched anew
+		eventType := models.EditEventType(event.EventType)
+		if paused && eventType != models.APIEventTrackingResumed &&
+			eventType != models.APIEventWatchAdded && eventType != models.APIEventWatchRemoved {
+			continue
+		}
+		paused = false
+
+		if open && event.OccurredAt.Sub(lastSeen) > maxSilence {
+			closeWindow(lastSeen, "no heartbeat from the agent")
+		}
+
+		switch {
+		case eventType == models.APIEventTrackingPaused:
+			var pause models.TrackingPause
+			_ = json.Unmarshal([]byte(event.Detail), &pause)
+			paused = true
+			if open {
+				closeWindow(event.OccurredAt, "")
+			}
+			if !closedAt.IsZero() {
+				gapReason = "tracking paused by the student: " + pause.Reason
+			}
+		case eventType == models.APIEventDaemonStopped, eventType == models.APIEventWatchRemoved:
+			if open {
+				closeWindow(event.OccurredAt, "agent stopped or directory not watched")
+			}
+		case eventType == models.APIEventOverflow:
+			coverage.Gaps = append(coverage.Gaps, CoverageGap{
+				Start:  event.OccurredAt,
+				End:    event.OccurredAt,
+				Reason: "agent event queue overflowed, edits were reconciled afterwards",
+			})
+		case eventType == models.APIEventHeartbeat, !eventType.IsLifecycle():
+			if !open {
+				if !closedAt.IsZero() {
+					coverage.Gaps = append(coverage.Gaps, CoverageGap{
+						Start:  closedAt,
+						End:    event.OccurredAt,
+						Reason: gapReason,
+					})
+				}
+				open = true
+				windowStart = event.OccurredAt
+			}
+			lastSeen = event.OccurredAt
+		}
+	}
+	if open {
+		closeWindow(lastSeen, "")
+	}
+
+	return coverage
+}
+
+// heartbeatIntervalFromDetail reads the "heartbeat=<duration>" detail the agent attaches to
+// start and heartbeat events.
+func heartbeatIntervalFromDetail(detail string) (time.Duration, bool) {
+	for field := range strings.FieldsSeq(detail) {
+		value, found := strings.CutPrefix(field, "heartbeat=")
+		if !found {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return 0, false
+		}
+		return d, true
+	}
+	return 0, false
+}
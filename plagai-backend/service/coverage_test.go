@@ -0,0 +1,142 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+func TestComputeCoverage(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes float64, eventType models.EditEventType, detail string) domain.TrackingEvent {
+		return domain.TrackingEvent{
+			EventType:  string(eventType),
+			Detail:     detail,
+			OccurredAt: start.Add(time.Duration(minutes * float64(time.Minute))),
+		}
+	}
+	window := func(from, to float64) CoverageWindow {
+		return CoverageWindow{
+			Start: start.Add(time.Duration(from * float64(time.Minute))),
+			End:   start.Add(time.Duration(to * float64(time.Minute))),
+		}
+	}
+	gap := func(from, to float64, reason string) CoverageGap {
+		return CoverageGap{
+			Start:  start.Add(time.Duration(from * float64(time.Minute))),
+			End:    start.Add(time.Duration(to * float64(time.Minute))),
+			Reason: reason,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		events  []domain.TrackingEvent
+		windows []CoverageWindow
+		gaps    []CoverageGap
+	}{
+		{
+			name: "heartbeats and edits until a stop",
+			events: []domain.TrackingEvent{
+				at(0, models.APIEventDaemonStarted, "heartbeat=5m0s"),
+				at(5, models.APIEventHeartbeat, "heartbeat=5m0s"),
+				at(7, models.APIEventModified, ""),
+				at(10, models.APIEventHeartbeat, "heartbeat=5m0s"),
+				at(12, models.APIEventDaemonStopped, ""),
+			},
+			windows: []CoverageWindow{window(5, 12)},
+		},
+		{
+			name: "markers don't open a window",
+			events: []domain.TrackingEvent{
+				at(0, models.APIEventBaseline, "[]"),
+				at(1, models.APIEventVCSOperation, "{}"),
+				at(2, models.APIEventBulkOperation, "{}"),
+				at(3, models.APIEventTrackingPaused, `{"reason":"lunch"}`),
+				at(4, models.APIEventFinalSnapshot, "[]"),
+			},
+			windows: []CoverageWindow{},
+		},
+		{
+			name: "a heartbeat up to 2.5 intervals late keeps the window open",
+			events: []domain.TrackingEvent{
+				at(0, models.APIEventHeartbeat, "heartbeat=4m0s"),
+				at(10, models.APIEventHeartbeat, "heartbeat=4m0s"),
+			},
+			windows: []CoverageWindow{window(0, 10)},
+		},
+		{
+			name: "a heartbeat more than 2.5 intervals late opens a gap",
+			events: []domain.TrackingEvent{
+				at(0, models.APIEventHeartbeat, "heartbeat=4m0s"),
+				at(10.5, models.APIEventHeartbeat, "heartbeat=4m0s"),
+				at(14, models.APIEventAdded, ""),
+			},
+			windows: []CoverageWindow{window(0, 0), window(10.5, 14)},
+			gaps:    []CoverageGap{gap(0, 10.5, "no heartbeat from the agent")},
+		},
+		{
+			name: "the gap after a stop lasts until the next heartbeat",
+			events: []domain.TrackingEvent{
+				at(0, models.APIEventHeartbeat, ""),
+				at(3, models.APIEventDaemonStopped, ""),
+				at(20, models.APIEventDaemonStarted, ""),
+				at(21, models.APIEventWatchAdded, ""),
+				at(25, models.APIEventHeartbeat, ""),
+			},
+			windows: []CoverageWindow{window(0, 3), window(25, 25)},
+			gaps:    []CoverageGap{gap(3, 25, "agent stopped or directory not watched")},
+		},
+		{
+			name: "a pause keeps the student's reason until tracking starts again",
+			events: []domain.TrackingEvent{
+				at(0, models.APIEventHeartbeat, ""),
+				at(2, models.APIEventTrackingPaused, `{"reason":"lunch"}`),
+				at(7, models.APIEventHeartbeat, ""),
+				at(30, models.APIEventTrackingResumed, `{"reason":"lunch"}`),
+				at(31, models.APIEventModified, ""),
+			},
+			windows: []CoverageWindow{window(0, 2), window(31, 31)},
+			gaps:    []CoverageGap{gap(2, 31, "tracking paused by the student: lunch")},
+		},
+		{
+			name: "an overflow is a zero length gap inside the window",
+			events: []domain.TrackingEvent{
+				at(0, models.APIEventHeartbeat, ""),
+				at(1, models.APIEventOverflow, ""),
+				at(2, models.APIEventModified, ""),
+			},
+			windows: []CoverageWindow{window(0, 2)},
+			gaps:    []CoverageGap{gap(1, 1, "agent event queue overflowed, edits were reconciled afterwards")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coverage := ComputeCoverage(tt.events)
+			if len(coverage.Windows) != len(tt.windows) {
+				t.Fatalf("expected windows %v, got %v", tt.windows, coverage.Windows)
+			}
+			var tracked float64
+			for i, w := range tt.windows {
+				if !coverage.Windows[i].Start.Equal(w.Start) || !coverage.Windows[i].End.Equal(w.End) {
+					t.Errorf("window %d: expected %v, got %v", i, w, coverage.Windows[i])
+				}
+				tracked += w.End.Sub(w.Start).Seconds()
+			}
+			if coverage.TrackedSeconds != tracked {
+				t.Errorf("expected %v tracked seconds, got %v", tracked, coverage.TrackedSeconds)
+			}
+			if len(coverage.Gaps) != len(tt.gaps) {
+				t.Fatalf("expected gaps %v, got %v", tt.gaps, coverage.Gaps)
+			}
+			for i, g := range tt.gaps {
+				if !coverage.Gaps[i].Start.Equal(g.Start) || !coverage.Gaps[i].End.Equal(g.End) || coverage.Gaps[i].Reason != g.Reason {
+					t.Errorf("gap %d: expected %v, got %v", i, g, coverage.Gaps[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plagai/plagai-backend/models"
+)
+
+// Entries of an evidence bundle exported with plaggy export
+const (
+	bundleManifestEntry  = "manifest.json"
+	bundleSignatureEntry = "manifest.sig"
+	bundleEventsEntry    = "events.json"
+	bundleSnapshotsDir   = "snapshots/"
+)
+
+// Bundle format versions this backend can read
+const supportedBundleFormat = 1
+
+var ErrInvalidBundle = errors.New("invalid evidence bundle")
+
+// BundleManifest is the signed description of an evidence bundle
+type BundleManifest struct {
+	FormatVersion int       `json:"formatVersion"`
+	AgentVersion  string    `json:"agentVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Device        struct {
+		ID        string `json:"id"`
+		Hostname  string `json:"hostname"`
+		OS        string `json:"os"`
+		PublicKey string `json:"publicKey"`
+	} `json:"device"`
+	Assignment struct {
+		ID        uint   `json:"id"`
+		Directory string `json:"directory"`
+	} `json:"assignment"`
+	StudentEmail string            `json:"studentEmail"`
+	EventCount   int               `json:"eventCount"`
+	ChainHead    string            `json:"chainHead"`
+	Files        map[string]string `json:"files"`
+}
+
+// EvidenceBundle is a bundle whose signature, entry hashes and event hash chain were verified
+type EvidenceBundle struct {
+	Manifest BundleManifest
+	Events   []models.EditEvent
+	// Final file contents by path relative to the assignment directory
+	Snapshots map[string]string
+	// sha256 of the whole archive
+	SHA256 string
+}
+
+// ReadEvidenceBundle opens a bundle and verifies it. registeredKeys returns the device keys the
+// student named by the manifest registered when binding assignments, the bundle has to be signed
+// by one of them. Anyone can sign a bundle with a key of their own, so the key in the manifest
+// proves nothing by itself. Every error about the bundle wraps ErrInvalidBundle.
+func ReadEvidenceBundle(data []byte, registeredKeys func(studentEmail string) ([]string, error)) (*EvidenceBundle, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a zip archive: %v", ErrInvalidBundle, err)
+	}
+	entries := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't open %s: %v", ErrInvalidBundle, f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't read %s: %v", ErrInvalidBundle, f.Name, err)
+		}
+		entries[f.Name] = content
+	}
+
+	manifestData, ok := entries[bundleManifestEntry]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidBundle, bundleManifestEntry)
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: bad manifest: %v", ErrInvalidBundle, err)
+	}
+	if manifest.FormatVersion != supportedBundleFormat {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidBundle, manifest.FormatVersion)
+	}
+	keys, err := registeredKeys(manifest.StudentEmail)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device keys of %s: %w", manifest.StudentEmail, err)
+	}
+	if !slices.Contains(keys, manifest.Device.PublicKey) {
+		return nil, fmt.Errorf("%w: device %s isn't registered for %s", ErrInvalidBundle, manifest.Device.ID, manifest.StudentEmail)
+	}
+	if err := verifyBundleSignature(manifest.Device.PublicKey, manifestData, entries[bundleSignatureEntry]); err != nil {
+		return nil, err
+	}
+
+	// Every entry except the manifest and its signature has to be listed with the right hash
+	for name, content := range entries {
+		if name == bundleManifestEntry || name == bundleSignatureEntry {
+			continue
+		}
+		expected, listed := manifest.Files[name]
+		sum := sha256.Sum256(content)
+		if !listed || expected != hex.EncodeToString(sum[:]) {
+			return nil, fmt.Errorf("%w: %s doesn't match the manifest", ErrInvalidBundle, name)
+		}
+	}
+	for name := range manifest.Files {
+		if _, ok := entries[name]; !ok {
+			return nil, fmt.Errorf("%w: missing %s", ErrInvalidBundle, name)
+		}
+	}
+
+	bundle := &EvidenceBundle{Manifest: manifest, Snapshots: make(map[string]string)}
+	if err := json.Unmarshal(entries[bundleEventsEntry], &bundle.Events); err != nil {
+		return nil, fmt.Errorf("%w: bad events: %v", ErrInvalidBundle, err)
+	}
+	if len(bundle.Events) != manifest.EventCount {
+		return nil, fmt.Errorf("%w: manifest lists %d events, bundle has %d", ErrInvalidBundle, manifest.EventCount, len(bundle.Events))
+	}
+	// A bundle holds the history of one agent database, whose sequence numbers the chain follows
+	// even across daemon sessions
+	sort.SliceStable(bundle.Events, func(i, j int) bool { return bundle.Events[i].Seq < bundle.Events[j].Seq })
+	if head := EventChainHead(bundle.Events); head != manifest.ChainHead {
+		return nil, fmt.Errorf("%w: event hash chain doesn't match the chain head", ErrInvalidBundle)
+	}
+
+	for name, content := range entries {
+		if relativePath, ok := strings.CutPrefix(name, bundleSnapshotsDir); ok {
+			bundle.Snapshots[relativePath] = string(content)
+		}
+	}
+	sum := sha256.Sum256(data)
+	bundle.SHA256 = hex.EncodeToString(sum[:])
+	return bundle, nil
+}
+
+// SnapshotFiles returns the final files of the bundle the way a submission sends them, so an
+// imported bundle is checked against its history like a regular submission
+func (b *EvidenceBundle) SnapshotFiles() []models.SnapshotFile {
+	files := make([]models.SnapshotFile, 0, len(b.Snapshots))
+	for relativePath, content := range b.Snapshots {
+		sum := sha256.Sum256([]byte(content))
+		files = append(files, models.SnapshotFile{
+			Path:    relativePath,
+			SHA256:  hex.EncodeToString(sum[:]),
+			Content: content,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// DeviceKeyProof is the message an agent signs with its device key when registering it, showing
+// that it holds the private key
+func DeviceKeyProof(studentEmail string) []byte {
+	return []byte("plaggy device key of " + studentEmail)
+}
+
+// VerifyDeviceKeyProof checks signature is the signature of DeviceKeyProof by publicKey
+func VerifyDeviceKeyProof(publicKey string, studentEmail string, signature string) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("bad device public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key), DeviceKeyProof(studentEmail), sig) {
+		return errors.New("device key proof doesn't verify")
+	}
+	return nil
+}
+
+func verifyBundleSignature(publicKey string, manifest []byte, signature []byte) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: bad device public key", ErrInvalidBundle)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key), manifest, sig) {
+		return fmt.Errorf("%w: manifest signature doesn't verify", ErrInvalidBundle)
+	}
+	return nil
+}
+
+// EventChainHead recomputes the agent's hash chain over events in sequence order and returns
+// the hash of the last one. It must match the agent's evidence.ChainHash exactly.
+func EventChainHead(events []models.EditEvent) string {
+	head := ""
+	for _, e := range events {
+		fields := []string{
+			head,
+			strconv.FormatInt(e.Seq, 10),
+			e.FilePath,
+			string(e.EventType),
+			e.Patch,
+			strconv.FormatInt(e.EventTime().UnixMilli(), 10),
+			strconv.FormatInt(e.MonoMs, 10),
+			e.SessionID,
+			strconv.FormatBool(e.IsDegraded()),
+		}
+		h := sha256.New()
+		for _, field := range fields {
+			h.Write([]byte(strconv.Itoa(len(field))))
+			h.Write([]byte{':'})
+			h.Write([]byte(field))
+		}
+		head = hex.EncodeToString(h.Sum(nil))
+	}
+	return head
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/plagai/plagai-backend/models"
+)
+
+// writeBundle builds a bundle of events signed with key the way plaggy export does
+func writeBundle(t *testing.T, key ed25519.PrivateKey, events []models.EditEvent, tamper func(entries map[string][]byte)) []byte {
+	t.Helper()
+	eventData, err := json.Marshal(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string][]byte{bundleEventsEntry: eventData}
+
+	var manifest BundleManifest
+	manifest.FormatVersion = supportedBundleFormat
+	manifest.StudentEmail = "student@example.com"
+	manifest.EventCount = len(events)
+	manifest.ChainHead = EventChainHead(events)
+	manifest.Device.ID = "device"
+	manifest.Device.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	manifest.Files = map[string]string{}
+	for name, data := range entries {
+		sum := sha256.Sum256(data)
+		manifest.Files[name] = hex.EncodeToString(sum[:])
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries[bundleManifestEntry] = manifestData
+	entries[bundleSignatureEntry] = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifestData)))
+	if tamper != nil {
+		tamper(entries)
+	}
+
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+	for name, data := range entries {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadEvidenceBundleRequiresRegisteredKey(t *testing.T) {
+	_, studentKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	registered := base64.StdEncoding.EncodeToString(studentKey.Public().(ed25519.PublicKey))
+	registeredKeys := func(email string) ([]string, error) {
+		if email != "student@example.com" {
+			return nil, nil
+		}
+		return []string{registered}, nil
+	}
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	events := []models.EditEvent{
+		{FilePath: "/hw/main.go", EventType: models.APIEventAdded, Patch: "+package main", Seq: 1, WallMs: start.UnixMilli()},
+		{FilePath: "/hw/main.go", EventType: models.APIEventModified, Patch: "+func main() {}", Seq: 2, WallMs: start.Add(time.Minute).UnixMilli()},
+	}
+
+	bundle, err := ReadEvidenceBundle(writeBundle(t, studentKey, events, nil), registeredKeys)
+	if err != nil {
+		t.Fatalf("expected the bundle signed by the registered key to verify: %v", err)
+	}
+	if len(bundle.Events) != 2 {
+		t.Errorf("expected 2 events, got %d", len(bundle.Events))
+	}
+
+	forged := []models.EditEvent{events[0], {FilePath: "/hw/main.go", EventType: models.APIEventModified, Patch: "+// typed slowly", Seq: 2, WallMs: events[1].WallMs}}
+	if _, err := ReadEvidenceBundle(writeBundle(t, otherKey, forged, nil), registeredKeys); !errors.Is(err, ErrInvalidBundle) {
+		t.Errorf("expected a bundle re-signed with an unregistered key to be rejected, got %v", err)
+	}
+
+	tampered := writeBundle(t, studentKey, events, func(entries map[string][]byte) {
+		data, _ := json.Marshal(forged)
+		entries[bundleEventsEntry] = data
+	})
+	if _, err := ReadEvidenceBundle(tampered, registeredKeys); !errors.Is(err, ErrInvalidBundle) {
+		t.Errorf("expected a bundle with changed events to be rejected, got %v", err)
+	}
+}
+
+func TestVerifyDeviceKeyProof(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	publicKey := base64.StdEncoding.EncodeToString(public)
+	proof := base64.StdEncoding.EncodeToString(ed25519.Sign(private, DeviceKeyProof("student@example.com")))
+	if err := VerifyDeviceKeyProof(publicKey, "student@example.com", proof); err != nil {
+		t.Errorf("expected the proof to verify: %v", err)
+	}
+	if err := VerifyDeviceKeyProof(publicKey, "other@example.com", proof); err == nil {
+		t.Error("expected the proof of another student to be rejected")
+	}
+}
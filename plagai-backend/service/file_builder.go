@@ -5,6 +5,7 @@ import (
 	"log"
 	"strings"
 
+	"github.com/plagai/plagai-backend/models"
 	"github.com/plagai/plagai-backend/models/domain"
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
@@ -37,7 +38,7 @@ func BuildFileFromPatchesAndStartText(startText string, patches []domain.Diff) (
 		hunks := splitUnifiedIntoHunks(patch.PatchText)
 
 		for j, hunk := range hunks {
-			patches, err := dmp.PatchFromText(hunk)
+			patches, err := dmp.PatchFromText(escapePatch(hunk))
 			if err != nil {
 				return "", fmt.Errorf("patch %d hunk %d: bad patch text: %w", i, j, err)
 			}
@@ -56,6 +57,36 @@ func BuildFileFromPatchesAndStartText(startText string, patches []domain.Diff) (
 	return text, nil
 }
 
+// RebuildFiles replays the edit events of a submission and returns the files that exist at its
+// end by path. Deletions and renames remove the file, a file added again starts over. Files whose
+// patches don't apply are returned in failed instead.
+func RebuildFiles(events []models.EditEvent) (files map[string]string, failed map[string]error) {
+	files = make(map[string]string)
+	failed = make(map[string]error)
+	for _, event := range events {
+		if event.EventType.IsLifecycle() {
+			continue
+		}
+		switch event.EventType {
+		case models.APIEventDeleted, models.APIEventRenamed:
+			delete(files, event.FilePath)
+			delete(failed, event.FilePath)
+			continue
+		}
+		if _, broken := failed[event.FilePath]; broken {
+			continue
+		}
+		text, err := BuildFileFromPatchesAndStartText(files[event.FilePath], []domain.Diff{{PatchText: event.Patch}})
+		if err != nil {
+			delete(files, event.FilePath)
+			failed[event.FilePath] = fmt.Errorf("event %d: %w", event.Seq, err)
+			continue
+		}
+		files[event.FilePath] = text
+	}
+	return files, failed
+}
+
 // splitUnifiedIntoHunks takes a unified-diff string that may contain
 // multiple hunks and returns a []string, each starting with its "@@" header.
 func splitUnifiedIntoHunks(patch string) []string {
@@ -77,3 +108,38 @@ func splitUnifiedIntoHunks(patch string) []string {
 
 	return hunks
 }
+
+// escapePatch turns a patch recorded by the agent back into the diffmatchpatch text format. The
+// agent unescapes the lines of its patches and splits them on line breaks, so consecutive lines
+// of the same kind were a single line before and are joined again.
+func escapePatch(patch string) string {
+	dmp := diffmatchpatch.New()
+	sb := strings.Builder{}
+	lines := strings.Split(patch, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+		kind := line[0]
+		if kind != '+' && kind != '-' && kind != ' ' {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+			continue
+		}
+
+		segment := []string{line[1:]}
+		for i+1 < len(lines) && lines[i+1] != "" && lines[i+1][0] == kind {
+			i++
+			segment = append(segment, lines[i][1:])
+		}
+		// DiffToDelta escapes an insert the same way PatchToText does, after the leading '+'
+		delta := dmp.DiffToDelta([]diffmatchpatch.Diff{
+			{Type: diffmatchpatch.DiffInsert, Text: strings.Join(segment, "\n")},
+		})
+		sb.WriteByte(kind)
+		sb.WriteString(delta[1:])
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// agentPatch records the change from before to after the way the agent's file differ does
+func agentPatch(before string, after string) string {
+	dmp := diffmatchpatch.New()
+	text := dmp.PatchToText(dmp.PatchMake(before, after))
+	sb := strings.Builder{}
+	for line := range strings.SplitSeq(text, "\n") {
+		if line == "" || !strings.ContainsRune("+- ", rune(line[0])) {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+			continue
+		}
+		unescaped, _ := url.QueryUnescape(strings.ReplaceAll(line[1:], "+", "%2b"))
+		for hunkLine := range strings.SplitSeq(unescaped, "\n") {
+			sb.WriteByte(line[0])
+			sb.WriteString(hunkLine)
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+func TestEscapePatchRoundTrip(t *testing.T) {
+	before := "package main\n\nfunc main() {\n}\n"
+	after := "package main\n\n// 100% done, a+b\nfunc main() {\n\tprintln(\"a & b\")\n}\n"
+	patch := agentPatch(before, after)
+	dmp := diffmatchpatch.New()
+	patches, err := dmp.PatchFromText(escapePatch(patch))
+	if err != nil {
+		t.Fatalf("expected the escaped patch to parse: %v\n%s", err, patch)
+	}
+	if got, _ := dmp.PatchApply(patches, before); got != after {
+		t.Errorf("expected the escaped patch to rebuild the file, got %q", got)
+	}
+}
+
+func TestRebuildFiles(t *testing.T) {
+	main1 := "package main\n"
+	main2 := "package main\n\nfunc main() {}\n"
+	events := []models.EditEvent{
+		{FilePath: "/hw", EventType: models.APIEventWatchAdded, Seq: 1},
+		{FilePath: "main.go", EventType: models.APIEventAdded, Patch: agentPatch("", main1), Seq: 2},
+		{FilePath: "scratch.go", EventType: models.APIEventAdded, Patch: agentPatch("", "package scratch\n"), Seq: 3},
+		{FilePath: "main.go", EventType: models.APIEventModified, Patch: agentPatch(main1, main2), Seq: 4},
+		{FilePath: "scratch.go", EventType: models.APIEventDeleted, Seq: 5},
+		{FilePath: "util.go", EventType: models.APIEventAdded, Patch: agentPatch("", "package main\n"), Seq: 6},
+		// Recorded against content the history doesn't have
+		{FilePath: "util.go", EventType: models.APIEventModified, Patch: agentPatch("package util\n\nfunc helper() {}\n", "package util\n\nfunc helper() int { return 1 }\n"), Seq: 7},
+	}
+
+	files, failed := RebuildFiles(events)
+	if len(files) != 1 || files["main.go"] != main2 {
+		t.Errorf("expected only main.go rebuilt, got %q", files)
+	}
+	if _, ok := failed["util.go"]; !ok || len(failed) != 1 {
+		t.Errorf("expected util.go to fail to replay, got %v", failed)
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/plagai/plagai-backend/models"
+	"github.com/plagai/plagai-backend/models/domain"
+)
+
+// Most files a starter archive may hold
+const maxStarterFiles = 500
+
+var ErrInvalidStarterArchive = errors.New("invalid starter archive")
+
+// ReadStarterArchive returns the files of a zip archive uploaded as an assignment's starter code.
+// Directories and macOS metadata are skipped, and a top level directory shared by every file is
+// dropped so archives made by zipping the project folder unpack into the assignment directory.
+// Every error wraps ErrInvalidStarterArchive.
+func ReadStarterArchive(data []byte) ([]domain.StarterFile, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a zip archive: %v", ErrInvalidStarterArchive, err)
+	}
+	var files []domain.StarterFile
+	for _, f := range zr.File {
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || path.Base(name) == ".DS_Store" {
+			continue
+		}
+		clean := path.Clean(name)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("%w: %s points outside of the assignment directory", ErrInvalidStarterArchive, f.Name)
+		}
+		if len(files) == maxStarterFiles {
+			return nil, fmt.Errorf("%w: more than %d files", ErrInvalidStarterArchive, maxStarterFiles)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't open %s: %v", ErrInvalidStarterArchive, f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't read %s: %v", ErrInvalidStarterArchive, f.Name, err)
+		}
+		// The agent records text, binary files can't be handed out as starter code
+		if !utf8.Valid(content) {
+			return nil, fmt.Errorf("%w: %s is not a text file", ErrInvalidStarterArchive, f.Name)
+		}
+		sum := sha256.Sum256(content)
+		files = append(files, domain.StarterFile{
+			Path:    clean,
+			Content: string(content),
+			SHA256:  hex.EncodeToString(sum[:]),
+		})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: no files", ErrInvalidStarterArchive)
+	}
+	stripSharedDirectory(files)
+	return files, nil
+}
+
+// stripSharedDirectory drops the first path element when every file is inside the same directory
+func stripSharedDirectory(files []domain.StarterFile) {
+	first, _, found := strings.Cut(files[0].Path, "/")
+	if !found {
+		return
+	}
+	for _, f := range files {
+		if !strings.HasPrefix(f.Path, first+"/") {
+			return
+		}
+	}
+	for i := range files {
+		files[i].Path = strings.TrimPrefix(files[i].Path, first+"/")
+	}
+}
+
+// VerifyBaselines clears EventMeta.Baseline on every event the instructor's starter files don't
+// back up. An event is trusted when a baseline event of the submission lists its file with the
+// same hash as the starter file at that path. It returns how many events were cleared.
+func VerifyBaselines(events []models.EditEvent, starterFiles []domain.StarterFile) int {
+	starterHashes := make(map[string]string, len(starterFiles))
+	for _, f := range starterFiles {
+		starterHashes[f.Path] = f.SHA256
+	}
+
+	trusted := make(map[string]bool)
+	for _, e := range events {
+		if e.EventType != models.APIEventBaseline {
+			continue
+		}
+		var files []models.BaselineFile
+		if err := json.Unmarshal([]byte(e.Patch), &files); err != nil {
+			log.Printf("ignoring unreadable baseline event %d: %v", e.Seq, err)
+			continue
+		}
+		root := normalizeEventPath(e.FilePath)
+		for _, f := range files {
+			if hash, ok := starterHashes[f.Path]; ok && hash == f.SHA256 {
+				trusted[root+"/"+f.Path] = true
+			}
+		}
+	}
+
+	cleared := 0
+	for i, e := range events {
+		if !e.IsBaseline() || trusted[normalizeEventPath(e.FilePath)] {
+			continue
+		}
+		meta := *e.Meta
+		meta.Baseline = false
+		events[i].Meta = &meta
+		cleared++
+	}
+	return cleared
+}
+
+// normalizeEventPath makes paths sent by Windows and Unix agents comparable
+func normalizeEventPath(p string) string {
+	return strings.TrimSuffix(strings.ReplaceAll(p, "\\", "/"), "/")
+}
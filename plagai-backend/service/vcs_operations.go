@@ -0,0 +1,43 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/plagai/plagai-backend/models"
+)
+
+// VerifyVCSOperations clears EventMeta.VCSOperation on every event whose git operation the
+// submission doesn't describe, or whose git operation doesn't write files by itself. It returns
+// the described operations by ID and how many events were cleared.
+func VerifyVCSOperations(events []models.EditEvent) (map[string]models.VCSOperation, int) {
+	operations := make(map[string]models.VCSOperation)
+	for _, e := range events {
+		if e.EventType != models.APIEventVCSOperation {
+			continue
+		}
+		var op models.VCSOperation
+		if err := json.Unmarshal([]byte(e.Patch), &op); err != nil || op.ID == "" {
+			log.Printf("ignoring unreadable vcs operation event %d: %v", e.Seq, err)
+			continue
+		}
+		operations[op.ID] = op
+	}
+
+	cleared := 0
+	for i, e := range events {
+		id := e.VCSOperationID()
+		if id == "" {
+			continue
+		}
+		if op, ok := operations[id]; ok && op.ChangesWorkingTree() {
+			continue
+		}
+		meta := *e.Meta
+		meta.VCSOperation = ""
+		meta.VCSCommit = ""
+		events[i].Meta = &meta
+		cleared++
+	}
+	return operations, cleared
+}